@@ -3,9 +3,15 @@
 package main
 
 import (
+	"github.com/traas-stack/holoinsight-collector/connector/holoinsightlogmetricsconnector"
 	"github.com/traas-stack/holoinsight-collector/extension/holoinsightlogsextension"
+	"github.com/traas-stack/holoinsight-collector/extension/holoinsighttenantlimiterextension"
+	"github.com/traas-stack/holoinsight-collector/extension/holoinsighttenantresolverextension"
 	"github.com/traas-stack/holoinsight-collector/extension/httpforwarderauthextension"
+	"github.com/traas-stack/holoinsight-collector/processor/holoinsightlogpatternprocessor"
+	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightauthauditreceiver"
 	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightdatadogreceiver"
+	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightlogsreceiver"
 	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver"
 	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightskywalkingreceiver"
 	"go.opentelemetry.io/collector/connector"
@@ -189,6 +195,8 @@ func components() (otelcol.Factories, error) {
 
 	factories.Extensions, err = extension.MakeFactoryMap(
 		holoinsightlogsextension.NewFactory(),
+		holoinsighttenantlimiterextension.NewFactory(),
+		holoinsighttenantresolverextension.NewFactory(),
 		httpforwarderauthextension.NewFactory(),
 		zpagesextension.NewFactory(),
 		ballastextension.NewFactory(),
@@ -217,6 +225,8 @@ func components() (otelcol.Factories, error) {
 		holoinsightotlpreceiver.NewFactory(),
 		holoinsightskywalkingreceiver.NewFactory(),
 		holoinsightdatadogreceiver.NewFactory(),
+		holoinsightauthauditreceiver.NewFactory(),
+		holoinsightlogsreceiver.NewFactory(),
 		otlpreceiver.NewFactory(),
 		activedirectorydsreceiver.NewFactory(),
 		aerospikereceiver.NewFactory(),
@@ -373,6 +383,7 @@ func components() (otelcol.Factories, error) {
 		spanprocessor.NewFactory(),
 		tailsamplingprocessor.NewFactory(),
 		transformprocessor.NewFactory(),
+		holoinsightlogpatternprocessor.NewFactory(),
 	)
 	if err != nil {
 		return otelcol.Factories{}, err
@@ -383,6 +394,7 @@ func components() (otelcol.Factories, error) {
 		countconnector.NewFactory(),
 		servicegraphconnector.NewFactory(),
 		spanmetricsconnector.NewFactory(),
+		holoinsightlogmetricsconnector.NewFactory(),
 	)
 	if err != nil {
 		return otelcol.Factories{}, err
@@ -0,0 +1,125 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/traas-stack/holoinsight-collector/internal/aescrypt"
+)
+
+// newCryptCommand returns the "crypt" command, encrypting and decrypting the apikeys and logstores
+// handed to agents the way the decrypt settings of the holoinsight extensions expect them.
+func newCryptCommand() *cobra.Command {
+	var keys []string
+	var secretKey, iv string
+	keyring := func() (*aescrypt.Keyring, error) {
+		parsed := make([]aescrypt.Key, 0, len(keys))
+		for _, k := range keys {
+			id, secret, ok := strings.Cut(k, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid key %q, expected <key id>=<base64 secret>", id)
+			}
+			parsed = append(parsed, aescrypt.Key{ID: id, Secret: secret})
+		}
+		return aescrypt.New(parsed, secretKey, iv)
+	}
+
+	cmd := &cobra.Command{
+		Use:   "crypt",
+		Short: "Encrypts and decrypts apikeys and logstores",
+	}
+	cmd.PersistentFlags().StringArrayVar(&keys, "key", nil,
+		"AES-GCM key as <key id>=<base64 secret>, repeatable. The first key encrypts")
+	cmd.PersistentFlags().StringVar(&secretKey, "secret-key", "", "legacy AES secret key of the holoinsight backend, decrypt only")
+	cmd.PersistentFlags().StringVar(&iv, "iv", "", "legacy AES-CBC iv of the holoinsight backend, decrypt only")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:          "encrypt [value...]",
+		Short:        "Encrypts the values, read line by line from stdin when none is given",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k, err := keyring()
+			if err != nil {
+				return err
+			}
+			return eachValue(cmd, args, k.Encrypt)
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:          "decrypt [value...]",
+		Short:        "Decrypts the values, read line by line from stdin when none is given",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k, err := keyring()
+			if err != nil {
+				return err
+			}
+			return eachValue(cmd, args, k.Decrypt)
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:          "keygen",
+		Short:        "Prints a new random base64 encoded AES-256 key",
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			secret, err := aescrypt.GenerateKey()
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintln(cmd.OutOrStdout(), secret)
+			return err
+		},
+	})
+	return cmd
+}
+
+// eachValue prints fn applied to every argument, or to every line of stdin when there are no arguments.
+func eachValue(cmd *cobra.Command, args []string, fn func(string) (string, error)) error {
+	emit := func(value string) error {
+		result, err := fn(value)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(cmd.OutOrStdout(), result)
+		return err
+	}
+	if len(args) > 0 {
+		for _, arg := range args {
+			if err := emit(arg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(cmd.InOrStdin())
+	for scanner.Scan() {
+		if err := emit(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogmetricsconnector // import "github.com/traas-stack/holoinsight-collector/connector/holoinsightlogmetricsconnector"
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// maxSamples is the number of values of a series the percentiles are computed from, sampled past it.
+const maxSamples = 1024
+
+// series is the aggregation of the logs of a tenant with the same dimensions.
+type series struct {
+	tenant     string
+	dimensions []string
+	count      int64
+	sum        float64
+	min        float64
+	max        float64
+	samples    []float64
+}
+
+func (s *series) add(value float64, percentiles bool) {
+	s.count++
+	s.sum += value
+	if s.count == 1 || value < s.min {
+		s.min = value
+	}
+	if s.count == 1 || value > s.max {
+		s.max = value
+	}
+	if !percentiles {
+		return
+	}
+	if len(s.samples) < maxSamples {
+		s.samples = append(s.samples, value)
+	} else if i := rand.Int63n(s.count); i < maxSamples { //nolint:gosec
+		// reservoir sampling
+		s.samples[i] = value
+	}
+}
+
+// aggregator aggregates the logs of a rule over its windows.
+type aggregator struct {
+	rule      *compiledRule
+	maxSeries int
+
+	mu      sync.Mutex
+	start   time.Time
+	series  map[string]*series
+	dropped int64
+	// closed is set once the rule is removed, the logs still being consumed with it are dropped.
+	closed bool
+}
+
+func newAggregator(rule *compiledRule, maxSeries int, now time.Time) *aggregator {
+	return &aggregator{
+		rule:      rule,
+		maxSeries: maxSeries,
+		start:     now.Truncate(rule.window),
+		series:    make(map[string]*series),
+	}
+}
+
+// add aggregates the value of a log of tenant, dropped over the max series or once closed.
+func (a *aggregator) add(tenant string, dimensions []string, value float64) {
+	key := tenant + "\x00" + strings.Join(dimensions, "\x00")
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return
+	}
+	s, ok := a.series[key]
+	if !ok {
+		if len(a.series) >= a.maxSeries {
+			a.dropped++
+			return
+		}
+		s = &series{tenant: tenant, dimensions: dimensions}
+		a.series[key] = s
+	}
+	s.add(value, a.rule.Aggregation.Type == aggregationPercentiles)
+}
+
+// close stops the aggregation of the logs, for the rule is removed. The window left is still flushed.
+func (a *aggregator) close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.closed = true
+}
+
+// flush appends the metric of the window to out and starts a new one once the window ended at now, or anyway when
+// force. It returns the number of series dropped in the window.
+func (a *aggregator) flush(now time.Time, force bool, out *metricsBuilder) int64 {
+	a.mu.Lock()
+	end := a.start.Add(a.rule.window)
+	if !force && now.Before(end) {
+		a.mu.Unlock()
+		return 0
+	}
+	start, current, dropped := a.start, a.series, a.dropped
+	a.start, a.series, a.dropped = now.Truncate(a.rule.window), make(map[string]*series), 0
+	a.mu.Unlock()
+
+	if force && now.Before(end) {
+		end = now
+	}
+	for _, s := range current {
+		a.appendPoint(out.metric(s.tenant, a.rule), s, start, end)
+	}
+	return dropped
+}
+
+func (a *aggregator) appendPoint(m pmetric.Metric, s *series, start, end time.Time) {
+	var attributes pcommon.Map
+	switch a.rule.Aggregation.Type {
+	case aggregationCount:
+		dp := m.Sum().DataPoints().AppendEmpty()
+		dp.SetIntValue(s.count)
+		attributes = dp.Attributes()
+		dp.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(end))
+	case aggregationSum:
+		dp := m.Sum().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(s.sum)
+		attributes = dp.Attributes()
+		dp.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(end))
+	case aggregationMin, aggregationMax, aggregationAvg:
+		dp := m.Gauge().DataPoints().AppendEmpty()
+		switch a.rule.Aggregation.Type {
+		case aggregationMin:
+			dp.SetDoubleValue(s.min)
+		case aggregationMax:
+			dp.SetDoubleValue(s.max)
+		default:
+			dp.SetDoubleValue(s.sum / float64(s.count))
+		}
+		attributes = dp.Attributes()
+		dp.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(end))
+	case aggregationPercentiles:
+		dp := m.Summary().DataPoints().AppendEmpty()
+		dp.SetCount(uint64(s.count))
+		dp.SetSum(s.sum)
+		sort.Float64s(s.samples)
+		for _, p := range a.rule.percentiles {
+			q := dp.QuantileValues().AppendEmpty()
+			q.SetQuantile(p / 100)
+			q.SetValue(percentile(s.samples, p))
+		}
+		attributes = dp.Attributes()
+		dp.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(end))
+	}
+	for i, name := range a.rule.Dimensions {
+		attributes.PutStr(name, s.dimensions[i])
+	}
+}
+
+// percentile returns the nearest-rank percentile p of the sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// metricsBuilder builds the metrics of a flush, a resource per tenant and a metric per rule.
+type metricsBuilder struct {
+	tenantAttribute string
+	md              pmetric.Metrics
+	scopes          map[string]pmetric.ScopeMetrics
+	metrics         map[string]pmetric.Metric
+}
+
+func newMetricsBuilder(tenantAttribute string) *metricsBuilder {
+	return &metricsBuilder{
+		tenantAttribute: tenantAttribute,
+		md:              pmetric.NewMetrics(),
+		scopes:          make(map[string]pmetric.ScopeMetrics),
+		metrics:         make(map[string]pmetric.Metric),
+	}
+}
+
+// metric returns the metric of the rule for tenant, created when missing.
+func (b *metricsBuilder) metric(tenant string, rule *compiledRule) pmetric.Metric {
+	key := tenant + "\x00" + rule.key
+	if m, ok := b.metrics[key]; ok {
+		return m
+	}
+	scope, ok := b.scopes[tenant]
+	if !ok {
+		rm := b.md.ResourceMetrics().AppendEmpty()
+		if tenant != "" {
+			rm.Resource().Attributes().PutStr(b.tenantAttribute, tenant)
+		}
+		scope = rm.ScopeMetrics().AppendEmpty()
+		scope.Scope().SetName(scopeName)
+		b.scopes[tenant] = scope
+	}
+	m := scope.Metrics().AppendEmpty()
+	m.SetName(rule.Name)
+	m.SetDescription(rule.Description)
+	m.SetUnit(rule.Unit)
+	switch rule.Aggregation.Type {
+	case aggregationCount:
+		m.SetEmptySum().SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+		m.Sum().SetIsMonotonic(true)
+	case aggregationSum:
+		m.SetEmptySum().SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+	case aggregationPercentiles:
+		m.SetEmptySummary()
+	default:
+		m.SetEmptyGauge()
+	}
+	b.metrics[key] = m
+	return m
+}
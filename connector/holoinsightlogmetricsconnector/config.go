@@ -0,0 +1,68 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogmetricsconnector // import "github.com/traas-stack/holoinsight-collector/connector/holoinsightlogmetricsconnector"
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/collector/config/confighttp"
+)
+
+// Config defines the configuration of the holoinsight_log_metrics connector.
+type Config struct {
+	// Server is the holoinsight server the rules are pulled from.
+	Server ServerSettings `mapstructure:"server"`
+	// Rules are applied with the rules of the server.
+	Rules []Rule `mapstructure:"rules"`
+	// TenantAttribute is the resource attribute holding the tenant of the logs, and of the metrics. default: tenant
+	TenantAttribute string `mapstructure:"tenant_attribute"`
+	// MaxSeries is the number of series of a rule in a window, the logs of the other series are dropped. default: 1000
+	MaxSeries int `mapstructure:"max_series"`
+}
+
+// ServerSettings configures the client pulling the rules from the holoinsight server.
+type ServerSettings struct {
+	// Endpoint, TLS, headers, timeout (default: 10s) and auth extension of the requests. Only the local rules are
+	// applied when the endpoint is not set.
+	confighttp.HTTPClientSettings `mapstructure:",squash"`
+	// Token is sent as the bearer token of the requests.
+	Token string `mapstructure:"token"`
+	// ReloadInterval is how often the rules are pulled. default: 30s
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+}
+
+// Validate checks the local rules compile and the limits are positive.
+func (cfg *Config) Validate() error {
+	if cfg.Server.Endpoint == "" && len(cfg.Rules) == 0 {
+		return errors.New("neither server endpoint nor rules set")
+	}
+	if cfg.Server.Endpoint != "" && cfg.Server.ReloadInterval <= 0 {
+		return errors.New("server reload_interval must be positive")
+	}
+	if cfg.TenantAttribute == "" {
+		return errors.New("tenant_attribute not set")
+	}
+	if cfg.MaxSeries <= 0 {
+		return errors.New("max_series must be positive")
+	}
+	for i, r := range cfg.Rules {
+		if _, err := compileRule(r); err != nil {
+			return fmt.Errorf("rule %d %q: %w", i, r.Name, err)
+		}
+	}
+	return nil
+}
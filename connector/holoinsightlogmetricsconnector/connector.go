@@ -0,0 +1,300 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogmetricsconnector // import "github.com/traas-stack/holoinsight-collector/connector/holoinsightlogmetricsconnector"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/connector"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.uber.org/zap"
+)
+
+const (
+	rulesPath = "/internal/customize/log/metric/rules"
+	// flushInterval is how often the windows are checked for their end.
+	flushInterval = time.Second
+)
+
+// logMetrics is the connector turning the logs into the metrics of the rules.
+type logMetrics struct {
+	cfg       *Config
+	logger    *zap.Logger
+	telemetry component.TelemetrySettings
+	next      consumer.Metrics
+	client    *http.Client
+
+	local []*compiledRule
+
+	mu          sync.RWMutex
+	aggregators []*aggregator
+	// rules is the last response of the server, the rules being reloaded when it changes.
+	rules []byte
+
+	// pulls is the context of the pulls of the rules, aborted on shutdown.
+	pulls context.Context
+	abort context.CancelFunc
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+var _ connector.Logs = (*logMetrics)(nil)
+
+func newConnector(cfg *Config, params connector.CreateSettings, next consumer.Metrics) (*logMetrics, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	c := &logMetrics{
+		cfg:       cfg,
+		logger:    params.Logger,
+		telemetry: params.TelemetrySettings,
+		next:      next,
+		done:      make(chan struct{}),
+	}
+	c.pulls, c.abort = context.WithCancel(context.Background())
+	for _, r := range cfg.Rules {
+		rule, err := compileRule(r)
+		if err != nil {
+			return nil, err
+		}
+		c.local = append(c.local, rule)
+	}
+	c.apply(nil)
+	return c, nil
+}
+
+func (c *logMetrics) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: false}
+}
+
+// Start pulls the rules of the server in the background, then reloads them every reload interval, and flushes the
+// windows as they end.
+func (c *logMetrics) Start(_ context.Context, host component.Host) error {
+	if c.cfg.Server.Endpoint != "" {
+		client, err := c.cfg.Server.ToClient(host, c.telemetry)
+		if err != nil {
+			return fmt.Errorf("[holoinsightlogmetricsconnector] failed to create holoinsight server client: %w", err)
+		}
+		c.client = client
+
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			// the local rules are applied until the server answers
+			c.reload(c.pulls)
+			ticker := time.NewTicker(c.cfg.Server.ReloadInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					c.reload(c.pulls)
+				case <-c.done:
+					return
+				}
+			}
+		}()
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				c.mu.RLock()
+				aggregators := c.aggregators
+				c.mu.RUnlock()
+				c.flush(aggregators, now, false)
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Shutdown flushes the windows, ended or not.
+func (c *logMetrics) Shutdown(context.Context) error {
+	c.abort()
+	close(c.done)
+	c.wg.Wait()
+	c.mu.RLock()
+	aggregators := c.aggregators
+	c.mu.RUnlock()
+	c.flush(aggregators, time.Now(), true)
+	return nil
+}
+
+// reload pulls the rules of the server, keeping the current ones when it fails. The invalid rules are skipped.
+func (c *logMetrics) reload(ctx context.Context) {
+	body, err := c.fetch(ctx)
+	if err != nil {
+		c.logger.Warn("[holoinsightlogmetricsconnector] failed to pull the rules, keeping the current ones", zap.Error(err))
+		return
+	}
+	c.mu.RLock()
+	unchanged := c.rules != nil && bytes.Equal(body, c.rules)
+	c.mu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	var rules []Rule
+	if err = json.Unmarshal(body, &rules); err != nil {
+		c.logger.Warn("[holoinsightlogmetricsconnector] invalid rules, keeping the current ones", zap.Error(err))
+		return
+	}
+	compiled := make([]*compiledRule, 0, len(rules))
+	for _, r := range rules {
+		rule, err := compileRule(r)
+		if err != nil {
+			c.logger.Error("[holoinsightlogmetricsconnector] invalid rule, skipping it",
+				zap.String("rule", r.Name), zap.String("tenant", r.Tenant), zap.Error(err))
+			continue
+		}
+		compiled = append(compiled, rule)
+	}
+	c.mu.Lock()
+	c.rules = body
+	c.mu.Unlock()
+	c.apply(compiled)
+	c.logger.Info("[holoinsightlogmetricsconnector] rules reloaded", zap.Int("rules", len(compiled)))
+}
+
+func (c *logMetrics) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.cfg.Server.Endpoint, "/")+rulesPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.cfg.Server.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Server.Token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Status code: " + resp.Status)
+	}
+	return body, nil
+}
+
+// apply replaces the rules by the local ones and the ones of the server. The aggregations of the rules which didn't
+// change are kept, the ones of the other rules closed and flushed: the logs being consumed with the previous rules
+// are dropped rather than added to windows never flushed again.
+func (c *logMetrics) apply(server []*compiledRule) {
+	now := time.Now()
+	c.mu.Lock()
+	current := make(map[string]*aggregator, len(c.aggregators))
+	for _, a := range c.aggregators {
+		current[a.rule.key] = a
+	}
+	aggregators := make([]*aggregator, 0, len(c.local)+len(server))
+	for _, rule := range append(append([]*compiledRule{}, c.local...), server...) {
+		a, ok := current[rule.key]
+		if !ok {
+			a = newAggregator(rule, c.cfg.MaxSeries, now)
+		}
+		delete(current, rule.key)
+		aggregators = append(aggregators, a)
+	}
+	c.aggregators = aggregators
+	c.mu.Unlock()
+
+	removed := make([]*aggregator, 0, len(current))
+	for _, a := range current {
+		a.close()
+		removed = append(removed, a)
+	}
+	c.flush(removed, now, true)
+}
+
+// flush sends the metrics of the windows of aggregators ended at now, or all of them when force.
+func (c *logMetrics) flush(aggregators []*aggregator, now time.Time, force bool) {
+	out := newMetricsBuilder(c.cfg.TenantAttribute)
+	for _, a := range aggregators {
+		if dropped := a.flush(now, force, out); dropped > 0 {
+			c.logger.Warn("[holoinsightlogmetricsconnector] too many series, logs dropped",
+				zap.String("rule", a.rule.Name), zap.String("tenant", a.rule.Tenant), zap.Int64("logs", dropped))
+		}
+	}
+	if out.md.DataPointCount() == 0 {
+		return
+	}
+	if err := c.next.ConsumeMetrics(context.Background(), out.md); err != nil {
+		c.logger.Error("[holoinsightlogmetricsconnector] failed to send the metrics", zap.Error(err))
+	}
+}
+
+// ConsumeLogs aggregates the logs into the windows of the rules they match.
+func (c *logMetrics) ConsumeLogs(_ context.Context, ld plog.Logs) error {
+	c.mu.RLock()
+	aggregators := c.aggregators
+	c.mu.RUnlock()
+
+	for i := 0; i < ld.ResourceLogs().Len(); i++ {
+		rl := ld.ResourceLogs().At(i)
+		var tenant string
+		if v, ok := rl.Resource().Attributes().Get(c.cfg.TenantAttribute); ok {
+			tenant = v.AsString()
+		}
+		for _, a := range aggregators {
+			if !a.rule.matches(tenant, rl.Resource().Attributes()) {
+				continue
+			}
+			for j := 0; j < rl.ScopeLogs().Len(); j++ {
+				records := rl.ScopeLogs().At(j).LogRecords()
+				for k := 0; k < records.Len(); k++ {
+					c.aggregate(a, tenant, records.At(k))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *logMetrics) aggregate(a *aggregator, tenant string, record plog.LogRecord) {
+	fields, ok := a.rule.fields(record)
+	if !ok || !a.rule.accept(fields) {
+		return
+	}
+	value, ok := a.rule.value(fields)
+	if !ok {
+		return
+	}
+	dimensions := make([]string, len(a.rule.Dimensions))
+	for i, name := range a.rule.Dimensions {
+		dimensions[i] = fields[name]
+	}
+	a.add(tenant, dimensions, value)
+}
@@ -0,0 +1,258 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogmetricsconnector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/connector/connectortest"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+func accessLogs(tenant string, lines ...string) plog.Logs {
+	ld := plog.NewLogs()
+	rl := ld.ResourceLogs().AppendEmpty()
+	rl.Resource().Attributes().PutStr("tenant", tenant)
+	rl.Resource().Attributes().PutStr("holoinsight.logstore", "access")
+	records := rl.ScopeLogs().AppendEmpty().LogRecords()
+	for _, line := range lines {
+		records.AppendEmpty().Body().SetStr(line)
+	}
+	return ld
+}
+
+func startConnector(t *testing.T, cfg *Config) (*logMetrics, *consumertest.MetricsSink) {
+	sink := new(consumertest.MetricsSink)
+	c, err := newConnector(cfg, connectortest.NewNopCreateSettings(), sink)
+	require.NoError(t, err)
+	require.NoError(t, c.Start(context.Background(), componenttest.NewNopHost()))
+	return c, sink
+}
+
+// metricsOf returns the metrics sent to sink by tenant and name.
+func metricsOf(sink *consumertest.MetricsSink) map[string]pmetric.Metric {
+	metrics := make(map[string]pmetric.Metric)
+	for _, md := range sink.AllMetrics() {
+		for i := 0; i < md.ResourceMetrics().Len(); i++ {
+			rm := md.ResourceMetrics().At(i)
+			tenant, _ := rm.Resource().Attributes().Get("tenant")
+			for j := 0; j < rm.ScopeMetrics().Len(); j++ {
+				ms := rm.ScopeMetrics().At(j).Metrics()
+				for k := 0; k < ms.Len(); k++ {
+					metrics[tenant.Str()+"/"+ms.At(k).Name()] = ms.At(k)
+				}
+			}
+		}
+	}
+	return metrics
+}
+
+func TestConsumeLogs(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	extract := Extract{Type: extractRegex, Pattern: `(?P<path>\S+) (?P<status>\d+) (?P<latency>\d+)`}
+	cfg.Rules = []Rule{
+		{
+			Name:        "requests",
+			Match:       map[string]string{"holoinsight.logstore": "access"},
+			Extract:     extract,
+			Dimensions:  []string{"status"},
+			Aggregation: Aggregation{Type: aggregationCount},
+		},
+		{
+			Name:        "latency",
+			Tenant:      "t1",
+			Extract:     extract,
+			Filters:     []Filter{{Field: "status", Value: "200"}},
+			Aggregation: Aggregation{Type: aggregationPercentiles, Field: "latency", Percentiles: []float64{50, 100}},
+		},
+		{
+			Name:        "latency_max",
+			Extract:     extract,
+			Dimensions:  []string{"path"},
+			Aggregation: Aggregation{Type: aggregationMax, Field: "latency"},
+		},
+	}
+	c, sink := startConnector(t, cfg)
+
+	require.NoError(t, c.ConsumeLogs(context.Background(), accessLogs("t1", "/a 200 10", "/a 200 30", "/b 500 20", "not an access log")))
+	require.NoError(t, c.ConsumeLogs(context.Background(), accessLogs("t2", "/a 200 5")))
+	require.NoError(t, c.Shutdown(context.Background()))
+
+	metrics := metricsOf(sink)
+	require.Len(t, metrics, 5)
+
+	requests := metrics["t1/requests"].Sum()
+	assert.Equal(t, pmetric.AggregationTemporalityDelta, requests.AggregationTemporality())
+	counts := map[string]int64{}
+	for i := 0; i < requests.DataPoints().Len(); i++ {
+		dp := requests.DataPoints().At(i)
+		status, _ := dp.Attributes().Get("status")
+		counts[status.Str()] = dp.IntValue()
+	}
+	assert.Equal(t, map[string]int64{"200": 2, "500": 1}, counts)
+	assert.Equal(t, int64(1), metrics["t2/requests"].Sum().DataPoints().At(0).IntValue())
+
+	latency := metrics["t1/latency"].Summary().DataPoints().At(0)
+	assert.Equal(t, uint64(2), latency.Count())
+	assert.Equal(t, 40.0, latency.Sum())
+	assert.Equal(t, 10.0, latency.QuantileValues().At(0).Value())
+	assert.Equal(t, 30.0, latency.QuantileValues().At(1).Value())
+	_, ok := metrics["t2/latency"]
+	assert.False(t, ok)
+
+	assert.Equal(t, 2, metrics["t1/latency_max"].Gauge().DataPoints().Len())
+}
+
+func TestMaxSeries(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.MaxSeries = 1
+	cfg.Rules = []Rule{{
+		Name:        "requests",
+		Extract:     Extract{Type: extractSeparator, Separator: " ", Columns: []string{"path"}},
+		Dimensions:  []string{"path"},
+		Aggregation: Aggregation{Type: aggregationCount},
+	}}
+	c, sink := startConnector(t, cfg)
+	require.NoError(t, c.ConsumeLogs(context.Background(), accessLogs("t1", "/a", "/b", "/a")))
+	require.NoError(t, c.Shutdown(context.Background()))
+
+	dps := metricsOf(sink)["t1/requests"].Sum().DataPoints()
+	require.Equal(t, 1, dps.Len())
+	assert.Equal(t, int64(2), dps.At(0).IntValue())
+}
+
+func TestWindowFlush(t *testing.T) {
+	rule, err := compileRule(Rule{Name: "requests", Window: "1m", Aggregation: Aggregation{Type: aggregationCount}})
+	require.NoError(t, err)
+	start := time.Date(2023, 1, 1, 0, 0, 30, 0, time.UTC)
+	a := newAggregator(rule, 10, start)
+	a.add("t1", nil, 1)
+
+	out := newMetricsBuilder("tenant")
+	a.flush(start.Add(20*time.Second), false, out)
+	assert.Equal(t, 0, out.md.DataPointCount())
+
+	a.flush(start.Add(40*time.Second), false, out)
+	require.Equal(t, 1, out.md.DataPointCount())
+	dp := out.md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0).Sum().DataPoints().At(0)
+	assert.Equal(t, pcommon.NewTimestampFromTime(start.Truncate(time.Minute)), dp.StartTimestamp())
+	assert.Equal(t, pcommon.NewTimestampFromTime(start.Truncate(time.Minute).Add(time.Minute)), dp.Timestamp())
+}
+
+func TestReloadRules(t *testing.T) {
+	var mu sync.Mutex
+	rules := `[{"name":"errors","tenant":"t1","filters":[{"field":"level","value":"error"}],"aggregation":{"type":"count"}}]`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != rulesPath || r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = w.Write([]byte(rules))
+	}))
+	defer server.Close()
+
+	cfg := createDefaultConfig().(*Config)
+	cfg.Server.Endpoint = server.URL
+	cfg.Server.Token = "s3cret"
+	c, sink := startConnector(t, cfg)
+	// the rules are pulled in the background
+	require.Eventually(t, func() bool {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return len(c.aggregators) == 1
+	}, 5*time.Second, time.Millisecond)
+
+	logs := plog.NewLogs()
+	rl := logs.ResourceLogs().AppendEmpty()
+	rl.Resource().Attributes().PutStr("tenant", "t1")
+	rl.ScopeLogs().AppendEmpty().LogRecords().AppendEmpty().Attributes().PutStr("level", "error")
+	require.NoError(t, c.ConsumeLogs(context.Background(), logs))
+
+	// the changed rule is flushed, and replaced, an invalid one skipped
+	mu.Lock()
+	rules = `[{"name":"errors","tenant":"t1","aggregation":{"type":"count"}},{"name":"bad","aggregation":{"type":"median"}}]`
+	mu.Unlock()
+	c.reload(context.Background())
+	require.Len(t, c.aggregators, 1)
+	assert.Equal(t, int64(1), metricsOf(sink)["t1/errors"].Sum().DataPoints().At(0).IntValue())
+
+	// the rules are kept when the server fails
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	c.reload(context.Background())
+	require.Len(t, c.aggregators, 1)
+
+	require.NoError(t, c.ConsumeLogs(context.Background(), logs))
+	require.NoError(t, c.ConsumeLogs(context.Background(), logs))
+	require.NoError(t, c.Shutdown(context.Background()))
+	assert.Equal(t, int64(2), metricsOf(sink)["t1/errors"].Sum().DataPoints().At(0).IntValue())
+}
+
+func TestStartWithoutServer(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cfg := createDefaultConfig().(*Config)
+	cfg.Server.Endpoint = server.URL
+	cfg.Rules = []Rule{{Name: "requests", Aggregation: Aggregation{Type: aggregationCount}}}
+	// the local rules are applied while the server doesn't answer, the pull aborted on shutdown
+	c, sink := startConnector(t, cfg)
+	require.NoError(t, c.ConsumeLogs(context.Background(), accessLogs("t1", "/a")))
+	require.NoError(t, c.Shutdown(context.Background()))
+	assert.Equal(t, int64(1), metricsOf(sink)["t1/requests"].Sum().DataPoints().At(0).IntValue())
+}
+
+func TestRemovedRuleClosed(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.Rules = []Rule{{Name: "requests", Aggregation: Aggregation{Type: aggregationCount}}}
+	c, sink := startConnector(t, cfg)
+	removed, err := compileRule(Rule{Name: "errors", Aggregation: Aggregation{Type: aggregationCount}})
+	require.NoError(t, err)
+	c.apply([]*compiledRule{removed})
+	c.mu.RLock()
+	old := c.aggregators
+	c.mu.RUnlock()
+	require.Len(t, old, 2)
+
+	// the logs consumed with the removed rule once flushed are dropped
+	c.apply(nil)
+	old[1].add("t1", nil, 1)
+	require.NoError(t, c.ConsumeLogs(context.Background(), accessLogs("t1", "/a")))
+	require.NoError(t, c.Shutdown(context.Background()))
+	metrics := metricsOf(sink)
+	assert.Equal(t, int64(1), metrics["t1/requests"].Sum().DataPoints().At(0).IntValue())
+	assert.NotContains(t, metrics, "t1/errors")
+}
@@ -0,0 +1,69 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogmetricsconnector // import "github.com/traas-stack/holoinsight-collector/connector/holoinsightlogmetricsconnector"
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/connector"
+	"go.opentelemetry.io/collector/consumer"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+)
+
+const (
+	// The value of connector "type" in configuration.
+	typeStr = "holoinsight_log_metrics"
+	// scopeName is the instrumentation scope of the metrics.
+	scopeName = "github.com/traas-stack/holoinsight-collector/connector/holoinsightlogmetricsconnector"
+
+	defaultServerTimeout  = 10 * time.Second
+	defaultReloadInterval = 30 * time.Second
+	defaultMaxSeries      = 1000
+)
+
+// NewFactory creates a factory for the holoinsight_log_metrics connector.
+func NewFactory() connector.Factory {
+	return connector.NewFactory(
+		typeStr,
+		createDefaultConfig,
+		connector.WithLogsToMetrics(createLogsToMetrics, component.StabilityLevelAlpha),
+	)
+}
+
+func createDefaultConfig() component.Config {
+	return &Config{
+		Server: ServerSettings{
+			HTTPClientSettings: confighttp.HTTPClientSettings{
+				Timeout: defaultServerTimeout,
+			},
+			ReloadInterval: defaultReloadInterval,
+		},
+		TenantAttribute: tenantresolver.DefaultName,
+		MaxSeries:       defaultMaxSeries,
+	}
+}
+
+func createLogsToMetrics(
+	_ context.Context,
+	params connector.CreateSettings,
+	cfg component.Config,
+	next consumer.Metrics,
+) (connector.Logs, error) {
+	return newConnector(cfg.(*Config), params, next)
+}
@@ -0,0 +1,47 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogmetricsconnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/connector/connectortest"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+)
+
+func TestCreateDefaultConfig(t *testing.T) {
+	cfg := NewFactory().CreateDefaultConfig().(*Config)
+	assert.Equal(t, "tenant", cfg.TenantAttribute)
+	assert.Equal(t, defaultReloadInterval, cfg.Server.ReloadInterval)
+	assert.Error(t, cfg.Validate())
+
+	cfg.Rules = []Rule{{Name: "errors", Aggregation: Aggregation{Type: aggregationCount}}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Rules[0].Aggregation.Type = aggregationSum
+	assert.Error(t, cfg.Validate())
+}
+
+func TestCreateLogsToMetrics(t *testing.T) {
+	factory := NewFactory()
+	cfg := factory.CreateDefaultConfig().(*Config)
+	cfg.Server.Endpoint = "http://127.0.0.1:8080"
+	c, err := factory.CreateLogsToMetrics(context.Background(), connectortest.NewNopCreateSettings(), cfg, consumertest.NewNop())
+	require.NoError(t, err)
+	assert.NotNil(t, c)
+}
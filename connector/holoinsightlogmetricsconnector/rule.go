@@ -0,0 +1,352 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogmetricsconnector // import "github.com/traas-stack/holoinsight-collector/connector/holoinsightlogmetricsconnector"
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+const (
+	extractRegex     = "regex"
+	extractJSON      = "json"
+	extractSeparator = "separator"
+
+	filterEquals      = "equals"
+	filterNotEquals   = "not_equals"
+	filterContains    = "contains"
+	filterNotContains = "not_contains"
+	filterRegex       = "regex"
+	filterExists      = "exists"
+	filterNotExists   = "not_exists"
+
+	aggregationCount       = "count"
+	aggregationSum         = "sum"
+	aggregationMin         = "min"
+	aggregationMax         = "max"
+	aggregationAvg         = "avg"
+	aggregationPercentiles = "percentiles"
+
+	defaultWindow = time.Minute
+)
+
+var defaultPercentiles = []float64{50, 90, 99}
+
+// Rule turns the logs into a metric, aggregating a value of the logs grouped by the dimensions extracted from them.
+type Rule struct {
+	// Name is the name of the metric.
+	Name        string `mapstructure:"name" json:"name"`
+	Description string `mapstructure:"description" json:"description"`
+	Unit        string `mapstructure:"unit" json:"unit"`
+	// Tenant is the tenant whose logs the rule applies to, all the tenants when empty.
+	Tenant string `mapstructure:"tenant" json:"tenant"`
+	// Match are the resource attributes of the logs the rule applies to, e.g. holoinsight.logstore.
+	Match map[string]string `mapstructure:"match" json:"match"`
+	// Extract extracts the fields of the logs, in addition to their attributes.
+	Extract Extract `mapstructure:"extract" json:"extract"`
+	// Filters are the conditions on the fields of the logs the rule applies to.
+	Filters []Filter `mapstructure:"filters" json:"filters"`
+	// Dimensions are the fields the metric is grouped by, its attributes.
+	Dimensions []string `mapstructure:"dimensions" json:"dimensions"`
+	// Aggregation is how the logs of a window are aggregated.
+	Aggregation Aggregation `mapstructure:"aggregation" json:"aggregation"`
+	// Window is the duration the logs are aggregated over, e.g. 1m. default: 1m
+	Window string `mapstructure:"window" json:"window"`
+}
+
+// Extract extracts fields from the body, or an attribute, of the logs.
+type Extract struct {
+	// Type is regex, json or separator, no field is extracted when empty.
+	Type string `mapstructure:"type" json:"type"`
+	// Field is the attribute the fields are extracted from, the body when empty.
+	Field string `mapstructure:"field" json:"field"`
+	// Pattern is the regular expression of regex, its named groups being the fields.
+	Pattern string `mapstructure:"pattern" json:"pattern"`
+	// Paths are the fields of json and their dot separated paths, e.g. request.status or items.0.name.
+	Paths map[string]string `mapstructure:"paths" json:"paths"`
+	// Separator splits the value of separator, into the Columns fields, the empty ones skipped.
+	Separator string   `mapstructure:"separator" json:"separator"`
+	Columns   []string `mapstructure:"columns" json:"columns"`
+}
+
+// Filter is a condition on a field of the logs.
+type Filter struct {
+	Field string `mapstructure:"field" json:"field"`
+	// Op is equals, not_equals, contains, not_contains, regex, exists or not_exists. default: equals
+	Op    string `mapstructure:"op" json:"op"`
+	Value string `mapstructure:"value" json:"value"`
+}
+
+// Aggregation is how the logs of a window are aggregated.
+type Aggregation struct {
+	// Type is count, sum, min, max, avg or percentiles.
+	Type string `mapstructure:"type" json:"type"`
+	// Field is the numeric field aggregated, except by count.
+	Field string `mapstructure:"field" json:"field"`
+	// Percentiles are the percentiles, in [0, 100], of percentiles. default: [50, 90, 99]
+	Percentiles []float64 `mapstructure:"percentiles" json:"percentiles"`
+}
+
+// compiledRule is a Rule ready to be applied.
+type compiledRule struct {
+	Rule
+	// key identifies the rule across reloads, the aggregations of a rule being kept while it doesn't change.
+	key         string
+	window      time.Duration
+	pattern     *regexp.Regexp
+	paths       map[string][]string
+	filters     []compiledFilter
+	percentiles []float64
+}
+
+type compiledFilter struct {
+	Filter
+	pattern *regexp.Regexp
+}
+
+func compileRule(r Rule) (*compiledRule, error) {
+	if r.Name == "" {
+		return nil, errors.New("name not set")
+	}
+	key, err := json.Marshal(&r)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiledRule{Rule: r, key: string(key), window: defaultWindow}
+	if r.Window != "" {
+		if c.window, err = time.ParseDuration(r.Window); err != nil || c.window < time.Second {
+			return nil, fmt.Errorf("invalid window %q, at least 1s", r.Window)
+		}
+	}
+
+	switch r.Extract.Type {
+	case "":
+	case extractRegex:
+		if c.pattern, err = regexp.Compile(r.Extract.Pattern); err != nil {
+			return nil, fmt.Errorf("invalid extract pattern: %w", err)
+		}
+	case extractJSON:
+		if len(r.Extract.Paths) == 0 {
+			return nil, errors.New("json extract paths not set")
+		}
+		c.paths = make(map[string][]string, len(r.Extract.Paths))
+		for field, path := range r.Extract.Paths {
+			c.paths[field] = strings.Split(path, ".")
+		}
+	case extractSeparator:
+		if r.Extract.Separator == "" || len(r.Extract.Columns) == 0 {
+			return nil, errors.New("extract separator and columns not set")
+		}
+	default:
+		return nil, fmt.Errorf("unknown extract type %q", r.Extract.Type)
+	}
+
+	for _, f := range r.Filters {
+		cf := compiledFilter{Filter: f}
+		switch f.Op {
+		case "":
+			cf.Op = filterEquals
+		case filterEquals, filterNotEquals, filterContains, filterNotContains, filterExists, filterNotExists:
+		case filterRegex:
+			if cf.pattern, err = regexp.Compile(f.Value); err != nil {
+				return nil, fmt.Errorf("invalid filter pattern of %s: %w", f.Field, err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown filter op %q", f.Op)
+		}
+		c.filters = append(c.filters, cf)
+	}
+
+	switch r.Aggregation.Type {
+	case aggregationCount:
+	case aggregationSum, aggregationMin, aggregationMax, aggregationAvg:
+		if r.Aggregation.Field == "" {
+			return nil, fmt.Errorf("%s aggregation field not set", r.Aggregation.Type)
+		}
+	case aggregationPercentiles:
+		if r.Aggregation.Field == "" {
+			return nil, errors.New("percentiles aggregation field not set")
+		}
+		c.percentiles = r.Aggregation.Percentiles
+		if len(c.percentiles) == 0 {
+			c.percentiles = defaultPercentiles
+		}
+		for _, p := range c.percentiles {
+			if p < 0 || p > 100 {
+				return nil, fmt.Errorf("invalid percentile %v", p)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown aggregation type %q", r.Aggregation.Type)
+	}
+	return c, nil
+}
+
+// matches reports whether the rule applies to the logs of tenant with resource.
+func (r *compiledRule) matches(tenant string, resource pcommon.Map) bool {
+	if r.Tenant != "" && r.Tenant != tenant {
+		return false
+	}
+	for k, v := range r.Match {
+		attr, ok := resource.Get(k)
+		if !ok || attr.AsString() != v {
+			return false
+		}
+	}
+	return true
+}
+
+// fields returns the attributes of the log and the fields extracted from it, false when they can't be extracted.
+func (r *compiledRule) fields(record plog.LogRecord) (map[string]string, bool) {
+	fields := make(map[string]string, record.Attributes().Len())
+	record.Attributes().Range(func(k string, v pcommon.Value) bool {
+		fields[k] = v.AsString()
+		return true
+	})
+	if r.Extract.Type == "" {
+		return fields, true
+	}
+
+	source := record.Body()
+	if r.Extract.Field != "" {
+		var ok bool
+		if source, ok = record.Attributes().Get(r.Extract.Field); !ok {
+			return nil, false
+		}
+	}
+	switch r.Extract.Type {
+	case extractRegex:
+		match := r.pattern.FindStringSubmatch(source.AsString())
+		if match == nil {
+			return nil, false
+		}
+		for i, name := range r.pattern.SubexpNames() {
+			if name != "" {
+				fields[name] = match[i]
+			}
+		}
+	case extractJSON:
+		var doc interface{}
+		if source.Type() == pcommon.ValueTypeMap || source.Type() == pcommon.ValueTypeSlice {
+			doc = source.AsRaw()
+		} else {
+			decoder := json.NewDecoder(strings.NewReader(source.AsString()))
+			decoder.UseNumber()
+			if decoder.Decode(&doc) != nil {
+				return nil, false
+			}
+		}
+		for field, path := range r.paths {
+			if value, ok := lookup(doc, path); ok {
+				fields[field] = value
+			}
+		}
+	case extractSeparator:
+		values := strings.Split(source.AsString(), r.Extract.Separator)
+		for i, name := range r.Extract.Columns {
+			if name != "" && i < len(values) {
+				fields[name] = strings.TrimSpace(values[i])
+			}
+		}
+	}
+	return fields, true
+}
+
+// lookup returns the value of doc at path, formatted as a string.
+func lookup(doc interface{}, path []string) (string, bool) {
+	for _, step := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if doc, ok = node[step]; !ok {
+				return "", false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(step)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", false
+			}
+			doc = node[i]
+		default:
+			return "", false
+		}
+	}
+	switch value := doc.(type) {
+	case nil:
+		return "", false
+	case string:
+		return value, true
+	case json.Number:
+		return value.String(), true
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	case int64:
+		return strconv.FormatInt(value, 10), true
+	case bool:
+		return strconv.FormatBool(value), true
+	default:
+		var buf bytes.Buffer
+		if json.NewEncoder(&buf).Encode(value) != nil {
+			return "", false
+		}
+		return strings.TrimSpace(buf.String()), true
+	}
+}
+
+// accept reports whether the fields pass the filters.
+func (r *compiledRule) accept(fields map[string]string) bool {
+	for _, f := range r.filters {
+		value, ok := fields[f.Field]
+		var pass bool
+		switch f.Op {
+		case filterEquals:
+			pass = ok && value == f.Value
+		case filterNotEquals:
+			pass = !ok || value != f.Value
+		case filterContains:
+			pass = ok && strings.Contains(value, f.Value)
+		case filterNotContains:
+			pass = !ok || !strings.Contains(value, f.Value)
+		case filterRegex:
+			pass = ok && f.pattern.MatchString(value)
+		case filterExists:
+			pass = ok
+		case filterNotExists:
+			pass = !ok
+		}
+		if !pass {
+			return false
+		}
+	}
+	return true
+}
+
+// value returns the value aggregated of the fields, false when it isn't a number.
+func (r *compiledRule) value(fields map[string]string) (float64, bool) {
+	if r.Aggregation.Type == aggregationCount {
+		return 1, true
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(fields[r.Aggregation.Field]), 64)
+	return value, err == nil
+}
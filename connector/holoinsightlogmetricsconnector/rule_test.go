@@ -0,0 +1,153 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogmetricsconnector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+func TestCompileRule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		err  bool
+	}{
+		{name: "count", rule: Rule{Name: "m", Aggregation: Aggregation{Type: aggregationCount}}},
+		{name: "no name", rule: Rule{Aggregation: Aggregation{Type: aggregationCount}}, err: true},
+		{name: "short window", rule: Rule{Name: "m", Window: "10ms", Aggregation: Aggregation{Type: aggregationCount}}, err: true},
+		{name: "bad pattern", rule: Rule{Name: "m", Extract: Extract{Type: extractRegex, Pattern: "("}, Aggregation: Aggregation{Type: aggregationCount}}, err: true},
+		{name: "json without paths", rule: Rule{Name: "m", Extract: Extract{Type: extractJSON}, Aggregation: Aggregation{Type: aggregationCount}}, err: true},
+		{name: "unknown filter", rule: Rule{Name: "m", Filters: []Filter{{Field: "a", Op: "like"}}, Aggregation: Aggregation{Type: aggregationCount}}, err: true},
+		{name: "bad percentile", rule: Rule{Name: "m", Aggregation: Aggregation{Type: aggregationPercentiles, Field: "v", Percentiles: []float64{101}}}, err: true},
+		{name: "unknown aggregation", rule: Rule{Name: "m", Aggregation: Aggregation{Type: "median"}}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileRule(tt.rule)
+			if tt.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRuleFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		extract Extract
+		body    func(pcommon.Value)
+		want    map[string]string
+		ok      bool
+	}{
+		{
+			name:    "regex",
+			extract: Extract{Type: extractRegex, Pattern: `(?P<method>\w+) (?P<path>\S+) (?P<status>\d+)`},
+			body:    func(v pcommon.Value) { v.SetStr("GET /orders 500") },
+			want:    map[string]string{"level": "info", "method": "GET", "path": "/orders", "status": "500"},
+			ok:      true,
+		},
+		{
+			name:    "regex mismatch",
+			extract: Extract{Type: extractRegex, Pattern: `(?P<status>\d+)`},
+			body:    func(v pcommon.Value) { v.SetStr("no status") },
+		},
+		{
+			name:    "json string",
+			extract: Extract{Type: extractJSON, Paths: map[string]string{"status": "response.status", "first": "items.0.name", "missing": "a.b"}},
+			body:    func(v pcommon.Value) { v.SetStr(`{"response":{"status":404},"items":[{"name":"x"}]}`) },
+			want:    map[string]string{"level": "info", "status": "404", "first": "x"},
+			ok:      true,
+		},
+		{
+			name:    "json map",
+			extract: Extract{Type: extractJSON, Paths: map[string]string{"latency": "latency"}},
+			body:    func(v pcommon.Value) { v.SetEmptyMap().PutDouble("latency", 1.5) },
+			want:    map[string]string{"level": "info", "latency": "1.5"},
+			ok:      true,
+		},
+		{
+			name:    "json invalid",
+			extract: Extract{Type: extractJSON, Paths: map[string]string{"a": "a"}},
+			body:    func(v pcommon.Value) { v.SetStr("{") },
+		},
+		{
+			name:    "separator",
+			extract: Extract{Type: extractSeparator, Separator: "|", Columns: []string{"time", "", "service"}},
+			body:    func(v pcommon.Value) { v.SetStr("2023-01-01 | ignored | orders") },
+			want:    map[string]string{"level": "info", "time": "2023-01-01", "service": "orders"},
+			ok:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := compileRule(Rule{Name: "m", Extract: tt.extract, Aggregation: Aggregation{Type: aggregationCount}})
+			require.NoError(t, err)
+			record := plog.NewLogRecord()
+			record.Attributes().PutStr("level", "info")
+			tt.body(record.Body())
+			fields, ok := rule.fields(record)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.want, fields)
+			}
+		})
+	}
+}
+
+func TestRuleAccept(t *testing.T) {
+	rule, err := compileRule(Rule{
+		Name: "m",
+		Filters: []Filter{
+			{Field: "level", Value: "error"},
+			{Field: "path", Op: filterRegex, Value: "^/api/"},
+			{Field: "debug", Op: filterNotExists},
+			{Field: "message", Op: filterNotContains, Value: "health"},
+		},
+		Aggregation: Aggregation{Type: aggregationCount},
+	})
+	require.NoError(t, err)
+	assert.True(t, rule.accept(map[string]string{"level": "error", "path": "/api/orders", "message": "timeout"}))
+	assert.False(t, rule.accept(map[string]string{"level": "info", "path": "/api/orders"}))
+	assert.False(t, rule.accept(map[string]string{"level": "error", "path": "/static"}))
+	assert.False(t, rule.accept(map[string]string{"level": "error", "path": "/api/orders", "debug": "1"}))
+	assert.False(t, rule.accept(map[string]string{"level": "error", "path": "/api/health", "message": "health check"}))
+}
+
+func TestRuleMatches(t *testing.T) {
+	rule, err := compileRule(Rule{Name: "m", Tenant: "t1", Match: map[string]string{"holoinsight.logstore": "orders"}, Aggregation: Aggregation{Type: aggregationCount}})
+	require.NoError(t, err)
+	resource := pcommon.NewMap()
+	resource.PutStr("holoinsight.logstore", "orders")
+	assert.True(t, rule.matches("t1", resource))
+	assert.False(t, rule.matches("t2", resource))
+	resource.PutStr("holoinsight.logstore", "payments")
+	assert.False(t, rule.matches("t1", resource))
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	assert.Equal(t, 5.0, percentile(values, 50))
+	assert.Equal(t, 9.0, percentile(values, 90))
+	assert.Equal(t, 10.0, percentile(values, 100))
+	assert.Equal(t, 1.0, percentile(values, 0))
+	assert.Equal(t, 0.0, percentile(nil, 50))
+}
@@ -0,0 +1,528 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/extension/experimental/storage"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+
+	"github.com/traas-stack/holoinsight-collector/internal/webtracking"
+)
+
+const (
+	overflowDropOldest = "drop_oldest"
+	overflowReject     = "reject"
+
+	defaultBufferMaxLogstoreSize  = 64 << 20
+	defaultBufferMaxTenantSize    = 256 << 20
+	defaultBufferMaxSize          = 1 << 30
+	defaultBufferRetryInterval    = time.Second
+	defaultBufferMaxRetryInterval = time.Minute
+
+	// storage keys: the logstores with buffered payloads, the range of the payloads of a logstore and a payload
+	bufferLogstoresKey = "logstores"
+	bufferMetaPrefix   = "meta/"
+	bufferItemPrefix   = "item/"
+
+	// reasons of the dropped payloads
+	dropLogstoreQuota = "logstore_quota"
+	dropTenantQuota   = "tenant_quota"
+	dropTotalQuota    = "total_quota"
+	dropPermanent     = "permanent_error"
+)
+
+// errBufferFull rejects the payloads the buffer has no room for.
+var errBufferFull = errors.New("buffer is full")
+
+// BufferSettings configures the write-ahead buffer of the accepted logs.
+type BufferSettings struct {
+	// Storage is the storage extension, e.g. file_storage, the logs are buffered in until their sink stores them.
+	// The logs are sent straight to their sink when not set.
+	Storage *component.ID `mapstructure:"storage"`
+	// MaxLogstoreSize is the bytes of the payloads buffered for a logstore. default: 64MiB
+	MaxLogstoreSize int64 `mapstructure:"max_logstore_size"`
+	// MaxTenantSize is the bytes of the payloads buffered for a tenant. default: 256MiB
+	MaxTenantSize int64 `mapstructure:"max_tenant_size"`
+	// MaxSize is the bytes of all the payloads buffered. default: 1GiB
+	MaxSize int64 `mapstructure:"max_size"`
+	// Overflow is what happens to a payload over a quota: drop_oldest drops the oldest payloads of the quota to
+	// make room, reject rejects it. default: drop_oldest
+	Overflow string `mapstructure:"overflow"`
+	// RetryInterval is the wait after a failed delivery, doubled after each failure up to MaxRetryInterval. default: 1s
+	RetryInterval time.Duration `mapstructure:"retry_interval"`
+	// MaxRetryInterval default: 1m
+	MaxRetryInterval time.Duration `mapstructure:"max_retry_interval"`
+}
+
+// Validate checks the quotas and intervals are positive and the overflow policy known.
+func (s *BufferSettings) Validate() error {
+	if s.Storage == nil {
+		return nil
+	}
+	if s.MaxLogstoreSize <= 0 || s.MaxTenantSize <= 0 || s.MaxSize <= 0 {
+		return errors.New("buffer sizes must be positive")
+	}
+	if s.RetryInterval <= 0 || s.MaxRetryInterval < s.RetryInterval {
+		return errors.New("buffer retry intervals must be positive, the max one at least the first one")
+	}
+	if s.Overflow != overflowDropOldest && s.Overflow != overflowReject {
+		return fmt.Errorf("unknown buffer overflow %q", s.Overflow)
+	}
+	return nil
+}
+
+// bufferedPayload is a payload in the storage.
+type bufferedPayload struct {
+	Tenant   string               `json:"tenant"`
+	Received time.Time            `json:"received"`
+	Payload  *webtracking.Payload `json:"payload"`
+}
+
+// bufferMeta is the range of the sequence numbers of the payloads of a logstore, some of them dropped.
+type bufferMeta struct {
+	Head uint64 `json:"head"`
+	Tail uint64 `json:"tail"`
+}
+
+// bufferedItem is what the buffer keeps in memory of a payload.
+type bufferedItem struct {
+	size     int64
+	tenant   string
+	received time.Time
+}
+
+// bufferQueue holds the payloads of a logstore, delivered in order by its goroutine.
+type bufferQueue struct {
+	logstore string
+	bufferMeta
+	items map[uint64]bufferedItem
+	size  int64
+	// inFlight is the sequence number of the payload being delivered, which isn't dropped, when sending.
+	inFlight uint64
+	sending  bool
+	draining bool
+}
+
+// next returns the oldest payload left.
+func (q *bufferQueue) next() (uint64, bufferedItem, bool) {
+	for seq := q.Head; seq < q.Tail; seq++ {
+		if item, ok := q.items[seq]; ok {
+			return seq, item, true
+		}
+	}
+	return 0, bufferedItem{}, false
+}
+
+// buffer is the write-ahead log of the accepted payloads, in a storage extension. The payloads of each logstore
+// are delivered in order by a goroutine, retried until their sink stores them or fails permanently. Over a quota,
+// the oldest payloads are dropped, or the new ones rejected.
+type buffer struct {
+	settings BufferSettings
+	client   storage.Client
+	deliver  func(ctx context.Context, logstore string, payload *webtracking.Payload, received time.Time) error
+	logger   *zap.Logger
+
+	mu          sync.Mutex
+	queues      map[string]*bufferQueue
+	tenantSizes map[string]int64
+	size        int64
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	// deliveries is the context of the deliveries, canceled by abort when the shutdown times out.
+	deliveries context.Context
+	abort      context.CancelFunc
+}
+
+// newBuffer opens the buffer of the storage extension and resumes the delivery of the payloads it holds.
+func newBuffer(
+	ctx context.Context,
+	settings BufferSettings,
+	host component.Host,
+	id component.ID,
+	deliver func(ctx context.Context, logstore string, payload *webtracking.Payload, received time.Time) error,
+	logger *zap.Logger,
+) (*buffer, error) {
+	ext, ok := host.GetExtensions()[*settings.Storage]
+	if !ok {
+		return nil, fmt.Errorf("storage %q not found", settings.Storage)
+	}
+	storageExt, ok := ext.(storage.Extension)
+	if !ok {
+		return nil, fmt.Errorf("extension %q is not a storage extension", settings.Storage)
+	}
+	client, err := storageExt.GetClient(ctx, component.KindExtension, id, "")
+	if err != nil {
+		return nil, err
+	}
+	b := &buffer{
+		settings:    settings,
+		client:      client,
+		deliver:     deliver,
+		logger:      logger,
+		queues:      make(map[string]*bufferQueue),
+		tenantSizes: make(map[string]int64),
+		done:        make(chan struct{}),
+	}
+	b.deliveries, b.abort = context.WithCancel(context.Background())
+	if err = b.load(ctx); err != nil {
+		b.abort()
+		return nil, multierr.Append(err, client.Close(ctx))
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, q := range b.queues {
+		b.recordDepthLocked(q)
+		b.drainLocked(q)
+	}
+	return b, nil
+}
+
+// load rebuilds the queues from the storage.
+func (b *buffer) load(ctx context.Context) error {
+	data, err := b.client.Get(ctx, bufferLogstoresKey)
+	if err != nil || data == nil {
+		return err
+	}
+	var logstores []string
+	if err = json.Unmarshal(data, &logstores); err != nil {
+		return fmt.Errorf("invalid buffered logstores: %w", err)
+	}
+	for _, logstore := range logstores {
+		q := &bufferQueue{logstore: logstore, items: make(map[uint64]bufferedItem)}
+		if data, err = b.client.Get(ctx, bufferMetaPrefix+logstore); err != nil {
+			return err
+		}
+		if data != nil {
+			if err = json.Unmarshal(data, &q.bufferMeta); err != nil {
+				return fmt.Errorf("invalid buffer of logstore %s: %w", logstore, err)
+			}
+		}
+		for seq := q.Head; seq < q.Tail; seq++ {
+			if data, err = b.client.Get(ctx, itemKey(logstore, seq)); err != nil {
+				return err
+			}
+			if data == nil {
+				continue
+			}
+			var payload bufferedPayload
+			if err = json.Unmarshal(data, &payload); err != nil {
+				b.logger.Warn("[holoinsightlogsextension] invalid buffered payload, skipping it", zap.String("logstore", logstore), zap.Error(err))
+				continue
+			}
+			item := bufferedItem{size: int64(len(data)), tenant: payload.Tenant, received: payload.Received}
+			q.items[seq] = item
+			q.size += item.size
+			b.tenantSizes[item.tenant] += item.size
+			b.size += item.size
+		}
+		b.queues[logstore] = q
+	}
+	if len(logstores) > 0 {
+		b.logger.Info("[holoinsightlogsextension] resuming the delivery of the buffered logs",
+			zap.Int("logstores", len(logstores)), zap.Int64("bytes", b.size))
+	}
+	return nil
+}
+
+func itemKey(logstore string, seq uint64) string {
+	return bufferItemPrefix + logstore + "/" + strconv.FormatUint(seq, 10)
+}
+
+// append buffers the payload of tenant posted to logstore, dropping the oldest payloads over the quotas.
+func (b *buffer) append(ctx context.Context, logstore, tenant string, payload *webtracking.Payload, received time.Time) error {
+	data, err := json.Marshal(&bufferedPayload{Tenant: tenant, Received: received, Payload: payload})
+	if err != nil {
+		return err
+	}
+	item := bufferedItem{size: int64(len(data)), tenant: tenant, received: received}
+	if item.size > b.settings.MaxLogstoreSize || item.size > b.settings.MaxTenantSize || item.size > b.settings.MaxSize {
+		return errBufferFull
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	select {
+	case <-b.done:
+		return errBufferFull
+	default:
+	}
+	q, ok := b.queues[logstore]
+	if !ok {
+		q = &bufferQueue{logstore: logstore, items: make(map[uint64]bufferedItem)}
+	}
+	drops, err := b.makeRoomLocked(q, item)
+	if err != nil {
+		return err
+	}
+
+	ops := make([]storage.Operation, 0, len(drops)+3)
+	for _, d := range drops {
+		ops = append(ops, storage.DeleteOperation(itemKey(d.queue.logstore, d.seq)))
+	}
+	meta := q.bufferMeta
+	meta.Tail++
+	metaData, _ := json.Marshal(&meta)
+	ops = append(ops, storage.SetOperation(itemKey(logstore, q.Tail), data), storage.SetOperation(bufferMetaPrefix+logstore, metaData))
+	if !ok {
+		logstores := make([]string, 0, len(b.queues)+1)
+		for name := range b.queues {
+			logstores = append(logstores, name)
+		}
+		logstoresData, _ := json.Marshal(append(logstores, logstore))
+		ops = append(ops, storage.SetOperation(bufferLogstoresKey, logstoresData))
+	}
+	if err = b.client.Batch(ctx, ops...); err != nil {
+		return err
+	}
+
+	for _, d := range drops {
+		b.removeLocked(d.queue, d.seq)
+		recordBufferDropped(d.queue.logstore, d.item.tenant, d.reason)
+		b.recordDepthLocked(d.queue)
+	}
+	b.queues[logstore] = q
+	q.items[q.Tail] = item
+	q.Tail++
+	q.size += item.size
+	b.tenantSizes[tenant] += item.size
+	b.size += item.size
+	b.recordDepthLocked(q)
+	b.drainLocked(q)
+	return nil
+}
+
+type bufferDrop struct {
+	queue  *bufferQueue
+	seq    uint64
+	item   bufferedItem
+	reason string
+}
+
+// makeRoomLocked returns the payloads to drop for item to be buffered in q, within the quotas.
+func (b *buffer) makeRoomLocked(q *bufferQueue, item bufferedItem) ([]bufferDrop, error) {
+	var drops []bufferDrop
+	dropped := make(map[*bufferQueue]map[uint64]bool)
+	queueSize, tenantSize, size := q.size, b.tenantSizes[item.tenant], b.size
+	// next finds the oldest payload of the queues, of tenant unless nil, not dropped yet.
+	next := func(queues []*bufferQueue, tenant *string) (bufferDrop, bool) {
+		var oldest bufferDrop
+		found := false
+		for _, candidate := range queues {
+			for seq := candidate.Head; seq < candidate.Tail; seq++ {
+				it, ok := candidate.items[seq]
+				if !ok || dropped[candidate][seq] || (candidate.sending && seq == candidate.inFlight) ||
+					(tenant != nil && it.tenant != *tenant) {
+					continue
+				}
+				if !found || it.received.Before(oldest.item.received) {
+					oldest = bufferDrop{queue: candidate, seq: seq, item: it}
+					found = true
+				}
+				break
+			}
+		}
+		return oldest, found
+	}
+
+	for {
+		var reason string
+		var candidates []*bufferQueue
+		var tenant *string
+		switch {
+		case queueSize+item.size > b.settings.MaxLogstoreSize:
+			reason, candidates = dropLogstoreQuota, []*bufferQueue{q}
+		case tenantSize+item.size > b.settings.MaxTenantSize:
+			reason, candidates, tenant = dropTenantQuota, b.queueList(), &item.tenant
+		case size+item.size > b.settings.MaxSize:
+			reason, candidates = dropTotalQuota, b.queueList()
+		default:
+			return drops, nil
+		}
+		if b.settings.Overflow == overflowReject {
+			return nil, errBufferFull
+		}
+		d, ok := next(candidates, tenant)
+		if !ok {
+			return nil, errBufferFull
+		}
+		d.reason = reason
+		drops = append(drops, d)
+		if dropped[d.queue] == nil {
+			dropped[d.queue] = make(map[uint64]bool)
+		}
+		dropped[d.queue][d.seq] = true
+		if d.queue == q {
+			queueSize -= d.item.size
+		}
+		if d.item.tenant == item.tenant {
+			tenantSize -= d.item.size
+		}
+		size -= d.item.size
+	}
+}
+
+func (b *buffer) queueList() []*bufferQueue {
+	queues := make([]*bufferQueue, 0, len(b.queues))
+	for _, q := range b.queues {
+		queues = append(queues, q)
+	}
+	return queues
+}
+
+// removeLocked forgets the payload seq of q, advancing the head past the removed payloads.
+func (b *buffer) removeLocked(q *bufferQueue, seq uint64) {
+	item, ok := q.items[seq]
+	if !ok {
+		return
+	}
+	delete(q.items, seq)
+	q.size -= item.size
+	b.size -= item.size
+	if b.tenantSizes[item.tenant] -= item.size; b.tenantSizes[item.tenant] <= 0 {
+		delete(b.tenantSizes, item.tenant)
+	}
+	for q.Head < q.Tail {
+		if _, ok = q.items[q.Head]; ok {
+			break
+		}
+		q.Head++
+	}
+}
+
+// drainLocked starts the goroutine delivering the payloads of q, unless it runs.
+func (b *buffer) drainLocked(q *bufferQueue) {
+	if q.draining || len(q.items) == 0 {
+		return
+	}
+	q.draining = true
+	b.wg.Add(1)
+	go b.drain(q)
+}
+
+// drain delivers the payloads of q in order until none is left or the buffer is shut down.
+func (b *buffer) drain(q *bufferQueue) {
+	defer b.wg.Done()
+	interval := b.settings.RetryInterval
+	for {
+		b.mu.Lock()
+		seq, item, ok := q.next()
+		select {
+		case <-b.done:
+			ok = false
+		default:
+		}
+		if !ok {
+			q.draining = false
+			b.mu.Unlock()
+			return
+		}
+		q.sending, q.inFlight = true, seq
+		b.mu.Unlock()
+
+		err := b.deliverItem(b.deliveries, q.logstore, seq)
+		if err != nil && !consumererror.IsPermanent(err) && !errors.Is(err, errLogTooLarge) {
+			b.mu.Lock()
+			q.sending = false
+			b.mu.Unlock()
+			b.logger.Warn("[holoinsightlogsextension] failed to deliver the buffered logs, retrying",
+				zap.String("logstore", q.logstore), zap.Duration("interval", interval), zap.Error(err))
+			select {
+			case <-b.done:
+				b.mu.Lock()
+				q.draining = false
+				b.mu.Unlock()
+				return
+			case <-time.After(interval):
+			}
+			if interval *= 2; interval > b.settings.MaxRetryInterval {
+				interval = b.settings.MaxRetryInterval
+			}
+			continue
+		}
+		interval = b.settings.RetryInterval
+		if err != nil {
+			b.logger.Error("[holoinsightlogsextension] buffered logs rejected, dropping them",
+				zap.String("logstore", q.logstore), zap.Error(err))
+			recordBufferDropped(q.logstore, item.tenant, dropPermanent)
+		}
+		if err = b.remove(q, seq); err != nil {
+			b.logger.Warn("[holoinsightlogsextension] failed to remove the delivered logs from the buffer",
+				zap.String("logstore", q.logstore), zap.Error(err))
+		}
+	}
+}
+
+// deliverItem delivers the payload seq of logstore, returning once its sink stored it.
+func (b *buffer) deliverItem(ctx context.Context, logstore string, seq uint64) error {
+	data, err := b.client.Get(ctx, itemKey(logstore, seq))
+	if err != nil {
+		return err
+	}
+	var payload bufferedPayload
+	if err = json.Unmarshal(data, &payload); err != nil || payload.Payload == nil {
+		return consumererror.NewPermanent(fmt.Errorf("invalid buffered payload: %w", err))
+	}
+	return b.deliver(ctx, logstore, payload.Payload, payload.Received)
+}
+
+// remove deletes the delivered payload seq of q.
+func (b *buffer) remove(q *bufferQueue, seq uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q.sending = false
+	b.removeLocked(q, seq)
+	metaData, _ := json.Marshal(&q.bufferMeta)
+	b.recordDepthLocked(q)
+	return b.client.Batch(context.Background(),
+		storage.DeleteOperation(itemKey(q.logstore, seq)),
+		storage.SetOperation(bufferMetaPrefix+q.logstore, metaData))
+}
+
+func (b *buffer) recordDepthLocked(q *bufferQueue) {
+	recordBufferDepth(q.logstore, len(q.items), q.size)
+}
+
+// shutdown stops the deliveries, keeping the payloads left for the next start. When ctx is done first, the
+// deliveries in progress are aborted, their payloads delivered again on the next start.
+func (b *buffer) shutdown(ctx context.Context) error {
+	close(b.done)
+	stopped := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		b.abort()
+		return b.client.Close(ctx)
+	case <-ctx.Done():
+	}
+	b.abort()
+	<-stopped
+	return multierr.Append(ctx.Err(), b.client.Close(context.Background()))
+}
@@ -0,0 +1,347 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/extension/experimental/storage"
+	"go.uber.org/zap"
+
+	"github.com/traas-stack/holoinsight-collector/internal/webtracking"
+)
+
+var bufferStorageID = component.NewID("memory_storage")
+
+// storageHost is a host with a storage extension.
+type storageHost struct {
+	component.Host
+	extensions map[component.ID]component.Component
+}
+
+func (h *storageHost) GetExtensions() map[component.ID]component.Component {
+	return h.extensions
+}
+
+// memoryStorage is a storage extension keeping the data in memory, shared by its clients.
+type memoryStorage struct {
+	component.StartFunc
+	component.ShutdownFunc
+
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (s *memoryStorage) GetClient(context.Context, component.Kind, component.ID, string) (storage.Client, error) {
+	return s, nil
+}
+
+func (s *memoryStorage) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data[key], nil
+}
+
+func (s *memoryStorage) Set(_ context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		s.data = make(map[string][]byte)
+	}
+	s.data[key] = value
+	return nil
+}
+
+func (s *memoryStorage) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *memoryStorage) Batch(ctx context.Context, ops ...storage.Operation) error {
+	for _, op := range ops {
+		switch op.Type {
+		case storage.Get:
+			op.Value, _ = s.Get(ctx, op.Key)
+		case storage.Set:
+			_ = s.Set(ctx, op.Key, op.Value)
+		case storage.Delete:
+			_ = s.Delete(ctx, op.Key)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStorage) Close(context.Context) error {
+	return nil
+}
+
+// items returns the number of payloads stored.
+func (s *memoryStorage) items() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for key := range s.data {
+		if strings.HasPrefix(key, bufferItemPrefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// testDeliveries records the contents of the payloads delivered, failing with err and blocking until release is
+// closed when set.
+type testDeliveries struct {
+	mu        sync.Mutex
+	err       error
+	attempts  int
+	delivered []string
+	release   chan struct{}
+}
+
+func (d *testDeliveries) deliver(ctx context.Context, _ string, payload *webtracking.Payload, _ time.Time) error {
+	d.mu.Lock()
+	d.attempts++
+	release := d.release
+	d.mu.Unlock()
+	if release != nil {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return d.err
+	}
+	d.delivered = append(d.delivered, payload.Logs[0]["content"])
+	return nil
+}
+
+func (d *testDeliveries) attemptCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.attempts
+}
+
+func (d *testDeliveries) deliveredContents() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.delivered...)
+}
+
+func testBufferSettings() BufferSettings {
+	return BufferSettings{
+		Storage:          &bufferStorageID,
+		MaxLogstoreSize:  defaultBufferMaxLogstoreSize,
+		MaxTenantSize:    defaultBufferMaxTenantSize,
+		MaxSize:          defaultBufferMaxSize,
+		Overflow:         overflowDropOldest,
+		RetryInterval:    time.Millisecond,
+		MaxRetryInterval: 10 * time.Millisecond,
+	}
+}
+
+func newTestBuffer(t *testing.T, settings BufferSettings, s *memoryStorage, d *testDeliveries) *buffer {
+	host := &storageHost{Host: componenttest.NewNopHost(), extensions: map[component.ID]component.Component{bufferStorageID: s}}
+	b, err := newBuffer(context.Background(), settings, host, component.NewID(typeStr), d.deliver, zap.NewNop())
+	require.NoError(t, err)
+	return b
+}
+
+// bufferTime is the time the test payloads are received at, the same size for each payload.
+var bufferTime = time.Date(2023, 11, 14, 0, 0, 0, 0, time.UTC)
+
+// appendPayload buffers a payload of one log of content, the n-th received.
+func appendPayload(b *buffer, logstore, tenant, content string, n int) error {
+	return b.append(context.Background(), logstore, tenant, payloadOf(content), bufferTime.Add(time.Duration(n)*time.Second))
+}
+
+// payloadSize is the size of the payloads of appendPayload with a content of 2 bytes.
+func payloadSize(t *testing.T) int64 {
+	data, err := json.Marshal(&bufferedPayload{Tenant: "t1", Received: bufferTime, Payload: payloadOf("a1")})
+	require.NoError(t, err)
+	return int64(len(data))
+}
+
+func TestBufferReplay(t *testing.T) {
+	s := &memoryStorage{}
+	failing := &testDeliveries{err: errors.New("unavailable")}
+	b := newTestBuffer(t, testBufferSettings(), s, failing)
+	require.NoError(t, appendPayload(b, "store", "t1", "a1", 1))
+	require.NoError(t, appendPayload(b, "store", "t1", "a2", 2))
+	require.Eventually(t, func() bool { return failing.attemptCount() > 1 }, 5*time.Second, time.Millisecond)
+	require.NoError(t, b.shutdown(context.Background()))
+	assert.Equal(t, 2, s.items())
+
+	// the payloads are delivered in order after the restart, then removed
+	d := &testDeliveries{}
+	b = newTestBuffer(t, testBufferSettings(), s, d)
+	require.Eventually(t, func() bool { return s.items() == 0 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, []string{"a1", "a2"}, d.deliveredContents())
+	require.NoError(t, appendPayload(b, "store", "t1", "a3", 3))
+	require.Eventually(t, func() bool { return len(d.deliveredContents()) == 3 }, 5*time.Second, time.Millisecond)
+	require.NoError(t, b.shutdown(context.Background()))
+	assert.Equal(t, 0, s.items())
+}
+
+func TestBufferQuotas(t *testing.T) {
+	size := payloadSize(t)
+	type payload struct {
+		logstore, tenant, content string
+	}
+	for _, tc := range []struct {
+		name     string
+		settings func(*BufferSettings)
+		// the first payload of each logstore is being delivered when the others are appended
+		payloads  []payload
+		delivered []string
+	}{
+		{
+			name:      "logstore",
+			settings:  func(s *BufferSettings) { s.MaxLogstoreSize = 3 * size },
+			payloads:  []payload{{"a", "t1", "a1"}, {"a", "t1", "a2"}, {"a", "t1", "a3"}, {"a", "t1", "a4"}, {"b", "t1", "b1"}},
+			delivered: []string{"a1", "a3", "a4", "b1"},
+		},
+		{
+			name:      "tenant",
+			settings:  func(s *BufferSettings) { s.MaxTenantSize = 3 * size },
+			payloads:  []payload{{"a", "t1", "a1"}, {"b", "t1", "b1"}, {"a", "t1", "a2"}, {"b", "t2", "b2"}, {"b", "t1", "b3"}},
+			delivered: []string{"a1", "b1", "b2", "b3"},
+		},
+		{
+			name:      "total",
+			settings:  func(s *BufferSettings) { s.MaxSize = 4 * size },
+			payloads:  []payload{{"a", "t1", "a1"}, {"b", "t2", "b1"}, {"b", "t2", "b2"}, {"a", "t1", "a2"}, {"a", "t1", "a3"}},
+			delivered: []string{"a1", "b1", "a2", "a3"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := testBufferSettings()
+			tc.settings(&settings)
+			d := &testDeliveries{release: make(chan struct{})}
+			b := newTestBuffer(t, settings, &memoryStorage{}, d)
+			logstores := make(map[string]bool)
+			for i, p := range tc.payloads {
+				require.NoError(t, appendPayload(b, p.logstore, p.tenant, p.content, i))
+				if !logstores[p.logstore] {
+					logstores[p.logstore] = true
+					n := len(logstores)
+					require.Eventually(t, func() bool { return d.attemptCount() == n }, 5*time.Second, time.Millisecond)
+				}
+			}
+			close(d.release)
+			require.Eventually(t, func() bool { return len(d.deliveredContents()) == len(tc.delivered) }, 5*time.Second, time.Millisecond)
+			assert.ElementsMatch(t, tc.delivered, d.deliveredContents())
+			require.NoError(t, b.shutdown(context.Background()))
+		})
+	}
+}
+
+func TestBufferReject(t *testing.T) {
+	settings := testBufferSettings()
+	settings.Overflow = overflowReject
+	settings.MaxLogstoreSize = 2 * payloadSize(t)
+	d := &testDeliveries{release: make(chan struct{})}
+	b := newTestBuffer(t, settings, &memoryStorage{}, d)
+	require.NoError(t, appendPayload(b, "a", "t1", "a1", 1))
+	require.NoError(t, appendPayload(b, "a", "t1", "a2", 2))
+	assert.ErrorIs(t, appendPayload(b, "a", "t1", "a3", 3), errBufferFull)
+	require.NoError(t, appendPayload(b, "b", "t1", "b1", 4))
+
+	close(d.release)
+	require.Eventually(t, func() bool { return len(d.deliveredContents()) == 3 }, 5*time.Second, time.Millisecond)
+	assert.ElementsMatch(t, []string{"a1", "a2", "b1"}, d.deliveredContents())
+	require.NoError(t, b.shutdown(context.Background()))
+}
+
+func TestBufferKeepsInFlight(t *testing.T) {
+	settings := testBufferSettings()
+	settings.MaxLogstoreSize = payloadSize(t)
+	d := &testDeliveries{release: make(chan struct{})}
+	b := newTestBuffer(t, settings, &memoryStorage{}, d)
+	require.NoError(t, appendPayload(b, "a", "t1", "a1", 1))
+	require.Eventually(t, func() bool { return d.attemptCount() == 1 }, 5*time.Second, time.Millisecond)
+	// the payload being delivered is not dropped to make room
+	assert.ErrorIs(t, appendPayload(b, "a", "t1", "a2", 2), errBufferFull)
+
+	close(d.release)
+	require.Eventually(t, func() bool { return len(d.deliveredContents()) == 1 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, []string{"a1"}, d.deliveredContents())
+	require.NoError(t, b.shutdown(context.Background()))
+}
+
+func TestBufferDropsRejectedPayloads(t *testing.T) {
+	s := &memoryStorage{}
+	d := &testDeliveries{err: consumererror.NewPermanent(errors.New("logstore not found"))}
+	b := newTestBuffer(t, testBufferSettings(), s, d)
+	require.NoError(t, appendPayload(b, "a", "t1", "a1", 1))
+	require.Eventually(t, func() bool { return s.items() == 0 }, 5*time.Second, time.Millisecond)
+	require.NoError(t, b.shutdown(context.Background()))
+	assert.Equal(t, 1, d.attemptCount())
+}
+
+func TestBufferWaitsForSink(t *testing.T) {
+	s := &memoryStorage{}
+	w := newFakeWriter()
+	w.release = make(chan struct{})
+	sink := newBatchSink("test", w, testSinkSettings(), zap.NewNop())
+	host := &storageHost{Host: componenttest.NewNopHost(), extensions: map[component.ID]component.Component{bufferStorageID: s}}
+	b, err := newBuffer(context.Background(), testBufferSettings(), host, component.NewID(typeStr), sink.Write, zap.NewNop())
+	require.NoError(t, err)
+
+	// each logstore delivers a payload at a time, the batch of 2 is filled by both
+	require.NoError(t, appendPayload(b, "a", "t1", "a1", 1))
+	require.NoError(t, appendPayload(b, "b", "t1", "b1", 2))
+	// the payloads are kept until their batch is written
+	require.Eventually(t, func() bool { return pendingOf(sink) == 0 && queuedOf(sink) == 2 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, 2, s.items())
+
+	close(w.release)
+	require.Eventually(t, func() bool { return s.items() == 0 }, 5*time.Second, time.Millisecond)
+	require.Len(t, w.contents(), 1)
+	assert.ElementsMatch(t, []string{"a1", "b1"}, w.contents()[0])
+	require.NoError(t, b.shutdown(context.Background()))
+	require.NoError(t, sink.Shutdown(context.Background()))
+}
+
+func TestBufferShutdownTimeout(t *testing.T) {
+	s := &memoryStorage{}
+	d := &testDeliveries{release: make(chan struct{})}
+	b := newTestBuffer(t, testBufferSettings(), s, d)
+	require.NoError(t, appendPayload(b, "a", "t1", "a1", 1))
+	require.Eventually(t, func() bool { return d.attemptCount() == 1 }, 5*time.Second, time.Millisecond)
+
+	// the delivery in progress is aborted, the payload kept for the next start
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, b.shutdown(ctx), context.DeadlineExceeded)
+	assert.Equal(t, 1, s.items())
+	assert.Empty(t, d.deliveredContents())
+}
@@ -0,0 +1,261 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultClientCacheTTL     = 10 * time.Minute
+	defaultClientCacheMaxSize = 1000
+
+	// refreshRetryInterval is how long a stale sink is used when the holoinsight server can't be queried.
+	refreshRetryInterval = 30 * time.Second
+)
+
+var errCacheClosed = errors.New("client cache is closed")
+
+// ClientCacheSettings bounds the clients of the logstores the holoinsight server tells the project of.
+type ClientCacheSettings struct {
+	// TTL is how long the project of a logstore is used before the holoinsight server is queried again,
+	// picking up rotated credentials. default: 10m
+	TTL time.Duration `mapstructure:"ttl"`
+	// MaxSize is the number of logstores cached, the least recently used being evicted. default: 1000
+	MaxSize int `mapstructure:"max_size"`
+}
+
+// Validate checks the TTL and size are positive.
+func (s *ClientCacheSettings) Validate() error {
+	if s.TTL <= 0 {
+		return errors.New("client cache ttl must be positive")
+	}
+	if s.MaxSize <= 0 {
+		return errors.New("client cache max_size must be positive")
+	}
+	return nil
+}
+
+// cachedSink is the sink of a logstore, created from the project the holoinsight server told.
+type cachedSink struct {
+	Sink
+	logstore string
+	project  map[string]string
+	// close releases the clients of the sink, nil for the configured sinks
+	close   func() error
+	expires time.Time
+	// refs counts the requests using the sink, which is closed once evicted and unused.
+	refs    int
+	evicted bool
+	closed  bool
+}
+
+// sinkCache holds the sinks of the logstores, queried from the holoinsight server. A sink is refreshed after the
+// TTL and replaced when the project changes, e.g. its credentials were rotated. The least recently used sinks are
+// evicted over the max size. Replaced and evicted sinks are closed once no request uses them.
+type sinkCache struct {
+	settings ClientCacheSettings
+	// query returns the project of a logstore, create the sink writing to it.
+	query  func(logstore string) (map[string]string, error)
+	create func(logstore string, project map[string]string) (Sink, func() error, error)
+	logger *zap.Logger
+	now    func() time.Time
+
+	loading singleflight.Group
+	closing sync.WaitGroup
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	closed  bool
+}
+
+func newSinkCache(
+	settings ClientCacheSettings,
+	query func(logstore string) (map[string]string, error),
+	create func(logstore string, project map[string]string) (Sink, func() error, error),
+	logger *zap.Logger,
+) *sinkCache {
+	return &sinkCache{
+		settings: settings,
+		query:    query,
+		create:   create,
+		logger:   logger,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// acquire returns the sink of logstore, which must be released once the logs are sent.
+func (c *sinkCache) acquire(logstore string) (*cachedSink, error) {
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return nil, errCacheClosed
+		}
+		if e, ok := c.entries[logstore]; ok {
+			entry := e.Value.(*cachedSink)
+			if c.now().Before(entry.expires) {
+				c.lru.MoveToFront(e)
+				entry.refs++
+				c.mu.Unlock()
+				return entry, nil
+			}
+		}
+		c.mu.Unlock()
+
+		v, err, _ := c.loading.Do(logstore, func() (interface{}, error) {
+			return c.refresh(logstore)
+		})
+		if err != nil {
+			return nil, err
+		}
+		entry := v.(*cachedSink)
+		c.mu.Lock()
+		// the sink may have been evicted and closed since it was loaded, load it again
+		if !entry.closed {
+			entry.refs++
+			c.mu.Unlock()
+			return entry, nil
+		}
+		c.mu.Unlock()
+	}
+}
+
+// release ends a request using entry, closing it when it was evicted meanwhile.
+func (c *sinkCache) release(entry *cachedSink) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.refs--
+	c.closeIfUnusedLocked(entry)
+}
+
+// refresh queries the project of logstore and updates its sink. When the server fails, the stale sink is used
+// for a while.
+func (c *sinkCache) refresh(logstore string) (*cachedSink, error) {
+	c.mu.Lock()
+	var current *cachedSink
+	if e, ok := c.entries[logstore]; ok {
+		current = e.Value.(*cachedSink)
+	}
+	c.mu.Unlock()
+
+	project, err := c.query(logstore)
+	if err != nil {
+		if current == nil {
+			return nil, err
+		}
+		c.logger.Warn("[holoinsightlogsextension] failed to refresh the project of the logstore, keeping the current one",
+			zap.String("logstore", logstore), zap.Error(err))
+		c.mu.Lock()
+		current.expires = c.now().Add(refreshRetryInterval)
+		c.mu.Unlock()
+		return current, nil
+	}
+	if current != nil && reflect.DeepEqual(current.project, project) {
+		c.mu.Lock()
+		current.expires = c.now().Add(c.settings.TTL)
+		c.mu.Unlock()
+		return current, nil
+	}
+
+	sink, closeSink, err := c.create(logstore, project)
+	if err != nil {
+		return nil, err
+	}
+	entry := &cachedSink{
+		Sink:     sink,
+		logstore: logstore,
+		project:  project,
+		close:    closeSink,
+		expires:  c.now().Add(c.settings.TTL),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		entry.evicted = true
+		c.closeIfUnusedLocked(entry)
+		return nil, errCacheClosed
+	}
+	if e, ok := c.entries[logstore]; ok {
+		c.evictLocked(e)
+		c.logger.Info("[holoinsightlogsextension] project of the logstore changed, replacing its client",
+			zap.String("logstore", logstore))
+	}
+	c.entries[logstore] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.settings.MaxSize {
+		c.evictLocked(c.lru.Back())
+	}
+	return entry, nil
+}
+
+func (c *sinkCache) evictLocked(e *list.Element) {
+	entry := c.lru.Remove(e).(*cachedSink)
+	delete(c.entries, entry.logstore)
+	entry.evicted = true
+	c.closeIfUnusedLocked(entry)
+}
+
+// closeIfUnusedLocked closes entry, in the background, once it is evicted and unused.
+func (c *sinkCache) closeIfUnusedLocked(entry *cachedSink) {
+	if !entry.evicted || entry.refs > 0 || entry.closed {
+		return
+	}
+	entry.closed = true
+	if entry.close == nil {
+		return
+	}
+	c.closing.Add(1)
+	go func() {
+		defer c.closing.Done()
+		if err := entry.close(); err != nil {
+			c.logger.Warn("[holoinsightlogsextension] failed to close the client of the logstore",
+				zap.String("logstore", entry.logstore), zap.Error(err))
+		}
+	}()
+}
+
+// shutdown closes every sink, waiting for them to be closed.
+func (c *sinkCache) shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	c.closed = true
+	for c.lru.Len() > 0 {
+		c.evictLocked(c.lru.Back())
+	}
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.closing.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/traas-stack/holoinsight-collector/internal/webtracking"
+)
+
+// testSink is a sink of a project, closed once.
+type testSink struct {
+	project string
+	closed  atomic.Int32
+}
+
+func (s *testSink) Send(context.Context, string, *webtracking.Payload, time.Time) error {
+	return nil
+}
+
+func (s *testSink) Write(context.Context, string, *webtracking.Payload, time.Time) error {
+	return nil
+}
+
+// testProjects answers the project of the logstores, counting the queries, and creates their sinks.
+type testProjects struct {
+	mu       sync.Mutex
+	projects map[string]string
+	err      error
+	queries  atomic.Int32
+	// release, when set, blocks the queries until it is closed
+	release chan struct{}
+	sinks   []*testSink
+}
+
+func (p *testProjects) query(logstore string) (map[string]string, error) {
+	p.queries.Add(1)
+	if p.release != nil {
+		<-p.release
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+	return map[string]string{projectName: p.projects[logstore]}, nil
+}
+
+func (p *testProjects) create(_ string, project map[string]string) (Sink, func() error, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := &testSink{project: project[projectName]}
+	p.sinks = append(p.sinks, s)
+	return s, func() error {
+		s.closed.Add(1)
+		return nil
+	}, nil
+}
+
+func (p *testProjects) set(logstore, project string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.projects[logstore] = project
+}
+
+func (p *testProjects) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+func newTestCache(t *testing.T, maxSize int, now *time.Time) (*sinkCache, *testProjects) {
+	projects := &testProjects{projects: map[string]string{"a": "project-a", "b": "project-b", "c": "project-c"}}
+	c := newSinkCache(ClientCacheSettings{TTL: time.Minute, MaxSize: maxSize}, projects.query, projects.create, zap.NewNop())
+	if now != nil {
+		c.now = func() time.Time { return *now }
+	}
+	return c, projects
+}
+
+// acquireSink returns the sink of logstore, released at once.
+func acquireSink(t *testing.T, c *sinkCache, logstore string) *testSink {
+	entry, err := c.acquire(logstore)
+	require.NoError(t, err)
+	c.release(entry)
+	return entry.Sink.(*testSink)
+}
+
+func TestCacheCoalescesQueries(t *testing.T) {
+	c, projects := newTestCache(t, 10, nil)
+	projects.release = make(chan struct{})
+
+	var wg sync.WaitGroup
+	entries := make([]*cachedSink, 10)
+	for i := range entries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			entries[i], _ = c.acquire("a")
+		}(i)
+	}
+	require.Eventually(t, func() bool { return projects.queries.Load() == 1 }, 5*time.Second, time.Millisecond)
+	// let the other acquires join the query in flight
+	time.Sleep(50 * time.Millisecond)
+	close(projects.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), projects.queries.Load())
+	for _, entry := range entries {
+		require.NotNil(t, entry)
+		assert.Same(t, entries[0], entry)
+		c.release(entry)
+	}
+	assert.Equal(t, 0, entries[0].refs)
+}
+
+func TestCacheRefresh(t *testing.T) {
+	now := time.Now()
+	c, projects := newTestCache(t, 10, &now)
+	sink := acquireSink(t, c, "a")
+	assert.Same(t, sink, acquireSink(t, c, "a"))
+	assert.Equal(t, int32(1), projects.queries.Load())
+
+	// after the TTL, the same project keeps the sink
+	now = now.Add(2 * time.Minute)
+	assert.Same(t, sink, acquireSink(t, c, "a"))
+	assert.Equal(t, int32(2), projects.queries.Load())
+	assert.Len(t, projects.sinks, 1)
+
+	// a changed project replaces it, closed once the requests using it release it
+	inUse, err := c.acquire("a")
+	require.NoError(t, err)
+	projects.set("a", "rotated")
+	now = now.Add(2 * time.Minute)
+	replaced := acquireSink(t, c, "a")
+	assert.NotSame(t, sink, replaced)
+	assert.Equal(t, "rotated", replaced.project)
+	assert.Equal(t, int32(0), sink.closed.Load())
+	c.release(inUse)
+	require.NoError(t, c.shutdown(context.Background()))
+	assert.Equal(t, int32(1), sink.closed.Load())
+}
+
+func TestCacheKeepsStaleSink(t *testing.T) {
+	now := time.Now()
+	c, projects := newTestCache(t, 10, &now)
+	sink := acquireSink(t, c, "a")
+
+	projects.fail(errors.New("server unavailable"))
+	now = now.Add(2 * time.Minute)
+	assert.Same(t, sink, acquireSink(t, c, "a"))
+	assert.Equal(t, int32(2), projects.queries.Load())
+	// the stale sink is used without querying again for a while
+	now = now.Add(refreshRetryInterval / 2)
+	assert.Same(t, sink, acquireSink(t, c, "a"))
+	assert.Equal(t, int32(2), projects.queries.Load())
+
+	// logstores without sink fail
+	_, err := c.acquire("b")
+	assert.EqualError(t, err, "server unavailable")
+	assert.Equal(t, int32(0), sink.closed.Load())
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c, projects := newTestCache(t, 2, nil)
+	a := acquireSink(t, c, "a")
+	b, err := c.acquire("b")
+	require.NoError(t, err)
+	assert.Same(t, a, acquireSink(t, c, "a"))
+
+	// b is the least recently used, closed once released
+	acquireSink(t, c, "c")
+	assert.Len(t, c.entries, 2)
+	assert.NotContains(t, c.entries, "b")
+	assert.Equal(t, int32(0), b.Sink.(*testSink).closed.Load())
+	c.release(b)
+	require.Eventually(t, func() bool { return b.Sink.(*testSink).closed.Load() == 1 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, int32(0), a.closed.Load())
+
+	// an evicted logstore is queried again
+	queries := projects.queries.Load()
+	acquireSink(t, c, "b")
+	assert.Equal(t, queries+1, projects.queries.Load())
+}
+
+func TestCacheShutdown(t *testing.T) {
+	c, projects := newTestCache(t, 10, nil)
+	acquireSink(t, c, "a")
+	acquireSink(t, c, "b")
+	require.NoError(t, c.shutdown(context.Background()))
+	for _, sink := range projects.sinks {
+		assert.Equal(t, int32(1), sink.closed.Load(), sink.project)
+	}
+	_, err := c.acquire("a")
+	assert.ErrorIs(t, err, errCacheClosed)
+}
@@ -15,28 +15,39 @@
 package holoinsightlogsextension
 
 import (
+	"errors"
+	"fmt"
+
+	"github.com/traas-stack/holoinsight-collector/internal/webtracking"
+	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/config/confighttp"
 )
 
 type Config struct {
-	ServerEndpoint string                         `mapstructure:"server_endpoint"`
-	HTTP           *confighttp.HTTPServerSettings `mapstructure:"http"`
-	SLSConfig      `mapstructure:"alibabacloud_logservice"`
+	ServerEndpoint string `mapstructure:"server_endpoint"`
+	// Server configures the client querying the projects of the logstores from the holoinsight server.
+	Server    ServerSettings                 `mapstructure:"server"`
+	HTTP      *confighttp.HTTPServerSettings `mapstructure:"http"`
+	SLSConfig `mapstructure:"alibabacloud_logservice"`
 	// If you want to encrypt the secretKey and iv of the holoinsight collector, it needs to be consistent with the holoinsight backend
 	// The holoinsight backend encrypts the configuration, and the holoinsight collector decrypts it
-	Decrypt `mapstructure:"decrypt"`
-}
-
-type Decrypt struct {
-	// default: false
-	Enable bool `mapstructure:"enable"`
-	// A secret key is a piece of information that is used to aes encrypt and decrypt data in a symmetric encryption algorithm.
-	SecretKey string `mapstructure:"secretKey"`
-	// IV (Initialization Vector): An initialization vector is a random value that is used in conjunction with a secret key to
-	// encrypt data in a symmetric encryption algorithm. It is used to ensure that the same plaintext message encrypted with
-	// the same secret key produces a different ciphertext message each time it is encrypted. The IV is typically included
-	// in the encrypted message and must be kept confidential to ensure the security of the encrypted data.
-	IV string `mapstructure:"iv"`
+	webtracking.Decrypt `mapstructure:"decrypt"`
+	// Sinks are the stores other than SLS the logs can be written to, by name.
+	Sinks map[string]*SinkSettings `mapstructure:"sinks"`
+	// Logstores are the names of the sinks of logstores. The other logstores are written to DefaultSink.
+	Logstores map[string]string `mapstructure:"logstores"`
+	// DefaultSink is the name of the sink of the logstores not in Logstores. When empty, the holoinsight server
+	// tells the sink of each logstore: the sink named in its project query response, else its SLS project.
+	DefaultSink string `mapstructure:"default_sink"`
+	// ClientCache bounds the clients of the logstores whose project is queried from the holoinsight server.
+	ClientCache ClientCacheSettings `mapstructure:"client_cache"`
+	// Buffer buffers the accepted logs in a storage extension until their sink stores them.
+	Buffer BufferSettings `mapstructure:"buffer"`
+	// TenantResolver is the tenant resolver extension telling the tenant of the logs the buffer quotas apply to,
+	// e.g. holoinsight_tenant_resolver. The built-in sources are used when not set.
+	TenantResolver *component.ID `mapstructure:"tenant_resolver"`
+	// Tail streams the logs ingested for a logstore to the clients of its tenant.
+	Tail TailSettings `mapstructure:"tail"`
 }
 
 type SLSConfig struct {
@@ -53,3 +64,41 @@ type SLSConfig struct {
 	// AlibabaCloud access key secret
 	AccessKeySecret string `mapstructure:"access_key_secret"`
 }
+
+// Validate checks the client cache, the buffer and the tails are bounded and the sinks and the logstores routed to them exist.
+func (cfg *Config) Validate() error {
+	if cfg.ServerEndpoint == "" && cfg.Server.Endpoint == "" && cfg.DefaultSink == "" {
+		return errors.New("server endpoint not set")
+	}
+	if cfg.Server.DecryptCredentials {
+		if keys, err := cfg.Decrypt.Keyring(); err != nil || keys == nil {
+			return errors.New("decrypt_credentials requires the decrypt keys")
+		}
+	}
+	if err := cfg.ClientCache.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Buffer.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Tail.Validate(); err != nil {
+		return err
+	}
+	for name, sink := range cfg.Sinks {
+		if sink == nil {
+			return fmt.Errorf("sink %q: type not set", name)
+		}
+		if err := sink.Validate(); err != nil {
+			return fmt.Errorf("sink %q: %w", name, err)
+		}
+	}
+	for logstore, name := range cfg.Logstores {
+		if _, ok := cfg.Sinks[name]; !ok {
+			return fmt.Errorf("logstore %q: unknown sink %q", logstore, name)
+		}
+	}
+	if _, ok := cfg.Sinks[cfg.DefaultSink]; cfg.DefaultSink != "" && !ok {
+		return fmt.Errorf("unknown default sink %q", cfg.DefaultSink)
+	}
+	return nil
+}
@@ -16,18 +16,23 @@ package holoinsightlogsextension
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	sls "github.com/aliyun/aliyun-log-go-sdk"
 	"github.com/gorilla/mux"
-	"github.com/traas-stack/holoinsight-collector/internal/utils"
+	"github.com/traas-stack/holoinsight-collector/internal/aescrypt"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+	"github.com/traas-stack/holoinsight-collector/internal/webtracking"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/extension"
+	"go.opentelemetry.io/collector/extension/auth"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/proto"
 	"net/http"
-	"net/url"
+	"sort"
 	"time"
 )
 
@@ -36,30 +41,73 @@ type logsExtension struct {
 	logger      *zap.Logger
 	server      *http.Server
 	params      extension.CreateSettings
-	clientCache map[string]LogServiceClient
+	clientCache *sinkCache
+	sinks       map[string]*batchSink
+	keys        *aescrypt.Keyring
+	tenants     tenantresolver.Gate
+	projects    *projectClient
+	tail        *tailHub
+	tailAuth    auth.Server
+	buffer      *buffer
 }
 
 func newExtension(cfg *Config, params extension.CreateSettings) (extension.Extension, error) {
-	if cfg.ServerEndpoint == "" {
-		return nil, errors.New("server endpoint not set")
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	keys, err := cfg.Decrypt.Keyring()
+	if err != nil {
+		return nil, fmt.Errorf("[holoinsightlogsextension] invalid decrypt keys: %w", err)
 	}
 
 	l := &logsExtension{
-		cfg:         cfg,
-		logger:      params.Logger,
-		server:      &http.Server{},
-		params:      params,
-		clientCache: make(map[string]LogServiceClient),
+		cfg:    cfg,
+		logger: params.Logger,
+		server: &http.Server{},
+		params: params,
+		sinks:  make(map[string]*batchSink),
+		keys:   keys,
 	}
+	l.clientCache = newSinkCache(cfg.ClientCache, l.queryProject, l.newProjectSink, l.logger)
 
 	return l, nil
 }
 
-func (l logsExtension) Start(ctx context.Context, host component.Host) error {
+func (l *logsExtension) Start(ctx context.Context, host component.Host) error {
+	projects, err := newProjectClient(l.cfg, l.keys, host, l.params.TelemetrySettings)
+	if err != nil {
+		return fmt.Errorf("[holoinsightlogsextension] failed to create holoinsight server client: %w", err)
+	}
+	l.projects = projects
+
+	for name, settings := range l.cfg.Sinks {
+		sink, err := newSink(name, *settings, host, l.params.TelemetrySettings)
+		if err != nil {
+			return err
+		}
+		l.sinks[name] = sink
+	}
+	if err = l.tenants.Resolve(host, l.cfg.TenantResolver); err != nil {
+		return err
+	}
+	if l.cfg.Buffer.Storage != nil {
+		l.buffer, err = newBuffer(ctx, l.cfg.Buffer, host, l.params.ID, l.store, l.logger)
+		if err != nil {
+			return fmt.Errorf("[holoinsightlogsextension] failed to open the buffer: %w", err)
+		}
+	}
+
 	router := mux.NewRouter()
-	router.HandleFunc("/logstores/{logstore}/track", l.handleLogs)
+	webtracking.Handle(router, l.handleLogs)
+	if l.cfg.Tail.Auth != nil {
+		if l.tailAuth, err = l.cfg.Tail.Auth.GetServerAuthenticator(host.GetExtensions()); err != nil {
+			return fmt.Errorf("[holoinsightlogsextension] failed to get the tail authenticator: %w", err)
+		}
+		l.tail = newTailHub(l.cfg.Tail)
+		router.HandleFunc(tailRoute, l.handleTail).Methods(http.MethodGet)
+	}
 
-	var err error
 	l.server, err = l.cfg.HTTP.ToServer(
 		host,
 		l.params.TelemetrySettings,
@@ -68,6 +116,8 @@ func (l logsExtension) Start(ctx context.Context, host component.Host) error {
 	if err != nil {
 		return fmt.Errorf("[holoinsightlogsextension] failed to create holoinsight logs server definition: %w", err)
 	}
+	l.server.ConnContext = tenantauth.ConnContext
+	l.server.Handler = tenantresolver.Handler(l.cfg.HTTP.Endpoint, l.server.Handler)
 	hln, err := l.cfg.HTTP.ToListener()
 	if err != nil {
 		return fmt.Errorf("[holoinsightlogsextension] failed to create holoinsight logs listener: %w", err)
@@ -81,123 +131,249 @@ func (l logsExtension) Start(ctx context.Context, host component.Host) error {
 	return nil
 }
 
-func (l logsExtension) Shutdown(ctx context.Context) error {
-	return l.server.Shutdown(ctx)
+func (l *logsExtension) Shutdown(ctx context.Context) error {
+	if l.tail != nil {
+		l.tail.close()
+	}
+	errs := l.server.Shutdown(ctx)
+	if l.buffer != nil {
+		errs = multierr.Append(errs, l.buffer.shutdown(ctx))
+	}
+	errs = multierr.Append(errs, l.clientCache.shutdown(ctx))
+	for _, sink := range l.sinks {
+		errs = multierr.Append(errs, sink.Shutdown(ctx))
+	}
+	return errs
 }
 
-func (l logsExtension) handleLogs(w http.ResponseWriter, req *http.Request) {
-	var err error
-	vars := mux.Vars(req)
-	logstore := vars["logstore"]
-	if l.cfg.Enable && l.cfg.SecretKey != "" {
-		decryptLogstore, err := AesDecrypt(logstore, l.cfg.SecretKey, l.cfg.IV)
-		if err != nil {
-			http.Error(w, "Unauthorized access", http.StatusUnauthorized)
-			l.logger.Error(fmt.Sprintf("[holoinsightlogsextension] logstore: %s, unauthorized access", logstore))
-			return
-		}
-		logstore = decryptLogstore
+func (l *logsExtension) handleLogs(w http.ResponseWriter, req *http.Request) {
+	logstore, err := l.logstore(req)
+	if err != nil {
+		http.Error(w, "Unauthorized access", http.StatusUnauthorized)
+		l.logger.Error(fmt.Sprintf("[holoinsightlogsextension] logstore: %s, unauthorized access", logstore))
+		return
 	}
 
-	datas, err := handlePayload(req)
+	var tenant string
+	if l.buffer != nil || l.tail != nil {
+		resource := pcommon.NewMap()
+		resource.PutStr("holoinsight.logstore", logstore)
+		tenant = l.tenants.Tenant(req.Context(), tenantresolver.RequestOf(req.Context(), ""), resource)
+	}
+
+	now := time.Now()
+	datas, _, err := webtracking.Decode(req)
 	if err != nil {
-		http.Error(w, "", http.StatusInternalServerError)
+		if l.tail != nil {
+			l.tail.publishError(logstore, tenant, err, now)
+		}
+		code := http.StatusBadRequest
+		if errors.Is(err, webtracking.ErrBodyTooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, "Unable to decode the logs", code)
 		l.logger.Error(fmt.Sprintf("[holoinsightlogsextension] logstore: %s, handlePayload error: ", logstore), zap.Error(err))
 		return
 	}
+	if l.tail != nil {
+		l.tail.publish(logstore, tenant, datas, now)
+	}
 
-	client, err := l.getLogServiceClient(logstore)
-	if err != nil {
-		http.Error(w, "", http.StatusInternalServerError)
-		l.logger.Error(fmt.Sprintf("[holoinsightlogsextension] logstore: %s, get log service client error: ", logstore), zap.Error(err))
+	if l.buffer != nil {
+		if err = l.buffer.append(req.Context(), logstore, tenant, datas, now); err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, errBufferFull) {
+				code = http.StatusServiceUnavailable
+			}
+			http.Error(w, "buffer data error", code)
+			l.logger.Error(fmt.Sprintf("[holoinsightlogsextension] logstore: %s, buffer data error: ", logstore), zap.Error(err))
+			return
+		}
+		webtracking.Succeed(w, req)
 		return
 	}
 
-	logs := l.dataToSLSLogs(datas, client)
-	if client.SendLogs(logs) != nil {
-		http.Error(w, "push data error", http.StatusInternalServerError)
+	if err = l.deliver(req.Context(), logstore, datas, now); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, errSinkFull) {
+			code = http.StatusServiceUnavailable
+		} else if errors.Is(err, errLogTooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, "push data error", code)
 		l.logger.Error(fmt.Sprintf("[holoinsightlogsextension] logstore: %s, pushLogsData error: ", logstore), zap.Error(err))
+		return
 	}
+	webtracking.Succeed(w, req)
 }
 
-func (l logsExtension) getLogServiceClient(key string) (LogServiceClient, error) {
-	// Get sls client from cache
-	client := l.clientCache[key]
-	if client == nil {
-		// Get from holoinsight server
-		response, err := utils.HTTPGet(l.cfg.ServerEndpoint + "/internal/customize/log/project/query?key=" + url.QueryEscape(key))
-		if err != nil {
-			l.logger.Error("[holoinsightlogsextension] get project from holoinsight server error: ", zap.Error(err))
-			return nil, err
-		}
-		if response == nil {
-			l.logger.Error("[holoinsightlogsextension] get empty sls config from holoinsight server: ", zap.Error(err))
-			return nil, err
-		}
+// handleTail streams the logs ingested for the logstore to the authenticated clients of its tenant.
+func (l *logsExtension) handleTail(w http.ResponseWriter, req *http.Request) {
+	ctx, err := l.tailAuth.Authenticate(req.Context(), req.Header)
+	if err != nil {
+		http.Error(w, "Unauthorized access", http.StatusUnauthorized)
+		return
+	}
+	tenant := tenantauth.Tenant(ctx)
+	if tenant == "" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	logstore, err := l.logstore(req)
+	if err != nil {
+		http.Error(w, "Unauthorized access", http.StatusUnauthorized)
+		return
+	}
 
-		slsProjectConfig := make(map[string]string)
-		err = json.Unmarshal(response, &slsProjectConfig)
-		if err != nil {
-			l.logger.Error("[holoinsightlogsextension] Unmarshal sls config error: ", zap.Error(err))
-			return nil, err
+	if err = l.tail.serve(w, req, logstore, tenant); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, errTailTooManyStreams) {
+			code = http.StatusTooManyRequests
+			w.Header().Set("Retry-After", "60")
 		}
+		http.Error(w, err.Error(), code)
+		l.logger.Warn(fmt.Sprintf("[holoinsightlogsextension] logstore: %s, tail error: ", logstore), zap.String("tenant", tenant), zap.Error(err))
+	}
+}
 
-		slsConfig := &SLSConfig{
-			Endpoint:        l.cfg.Endpoint,
-			Project:         slsProjectConfig["projectName"],
-			Logstore:        key,
-			AccessKeyID:     slsProjectConfig["accessId"],
-			AccessKeySecret: slsProjectConfig["accessKey"],
-		}
-		client, err = NewLogServiceClient(slsConfig, l.logger)
-		if err != nil {
-			l.logger.Error("[holoinsightlogsextension] new log service client error: ", zap.Error(err))
-			return nil, err
-		}
-		l.clientCache[key] = client
+// logstore returns the logstore of the request, decrypted when the decrypt keys are set.
+func (l *logsExtension) logstore(req *http.Request) (string, error) {
+	logstore := mux.Vars(req)["logstore"]
+	if l.keys == nil {
+		return logstore, nil
+	}
+	decryptLogstore, err := l.keys.Decrypt(logstore)
+	if err != nil {
+		return logstore, err
+	}
+	return decryptLogstore, nil
+}
+
+// deliver sends the payload of logstore, received at now, to its sink.
+func (l *logsExtension) deliver(ctx context.Context, logstore string, payload *webtracking.Payload, now time.Time) error {
+	sink, release, err := l.getSink(logstore)
+	if err != nil {
+		return fmt.Errorf("get sink error: %w", err)
+	}
+	defer release()
+	return sink.Send(ctx, logstore, payload, now)
+}
+
+// store writes the payload of logstore, received at now, to its sink, returning once it is stored: the buffer
+// keeps a payload until then.
+func (l *logsExtension) store(ctx context.Context, logstore string, payload *webtracking.Payload, now time.Time) error {
+	sink, release, err := l.getSink(logstore)
+	if err != nil {
+		return fmt.Errorf("get sink error: %w", err)
+	}
+	defer release()
+	return sink.Write(ctx, logstore, payload, now)
+}
+
+// getSink returns the sink of logstore: the configured one, else the one the holoinsight server tells.
+// release must be called once the logs are sent.
+func (l *logsExtension) getSink(logstore string) (sink Sink, release func(), err error) {
+	if name, ok := l.cfg.Logstores[logstore]; ok {
+		return l.sinks[name], func() {}, nil
+	}
+	if l.cfg.DefaultSink != "" {
+		return l.sinks[l.cfg.DefaultSink], func() {}, nil
+	}
+	entry, err := l.clientCache.acquire(logstore)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry, func() { l.clientCache.release(entry) }, nil
+}
+
+// queryProject gets the project of the logstore from the holoinsight server.
+func (l *logsExtension) queryProject(key string) (map[string]string, error) {
+	slsProjectConfig, err := l.projects.query(context.Background(), key)
+	if err != nil {
+		l.logger.Error("[holoinsightlogsextension] get project from holoinsight server error: ", zap.String("logstore", key), zap.Error(err))
+		return nil, err
 	}
-	return client, nil
+	return withoutSTSCredentials(slsProjectConfig), nil
 }
 
-func (l logsExtension) dataToSLSLogs(data *Data, client LogServiceClient) []*sls.Log {
-	result := make([]*sls.Log, 0)
-	log := &sls.Log{
-		Time:     proto.Uint32(uint32(time.Now().Unix())),
-		Contents: make([]*sls.LogContent, 0),
+// newProjectSink creates the sink of the logstore from its project: a configured sink, else a client of the SLS project.
+func (l *logsExtension) newProjectSink(key string, slsProjectConfig map[string]string) (Sink, func() error, error) {
+	// The project may be stored in a configured sink rather than SLS
+	if name := slsProjectConfig[projectSink]; name != "" {
+		sink, ok := l.sinks[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("[holoinsightlogsextension] unknown sink %q of logstore %s", name, key)
+		}
+		return sink, nil, nil
 	}
-	result = append(result, log)
 
-	for _, tmpLog := range data.Logs {
-		for k, v := range tmpLog {
+	slsConfig := &SLSConfig{
+		Endpoint:        l.cfg.Endpoint,
+		Project:         slsProjectConfig[projectName],
+		Logstore:        key,
+		AccessKeyID:     slsProjectConfig[projectAccessID],
+		AccessKeySecret: slsProjectConfig[projectAccessKey],
+	}
+	var client LogServiceClient
+	var err error
+	if slsProjectConfig[projectSTS] != "" {
+		// The STS token is refreshed by the client, before it expires
+		client, err = NewSTSLogServiceClient(slsConfig, func() (string, string, string, time.Time, error) {
+			return l.projects.credentials(key, l.cfg.ClientCache.TTL)
+		}, l.logger)
+	} else {
+		client, err = NewLogServiceClient(slsConfig, l.logger)
+	}
+	if err != nil {
+		l.logger.Error("[holoinsightlogsextension] new log service client error: ", zap.Error(err))
+		return nil, nil, err
+	}
+	return &slsSink{client: client}, client.Close, nil
+}
+
+// dataToSLSLogs converts each entry of __logs__ to a log, timestamped by its __time__, else now, and __tags__ to
+// the tags of the log group.
+func dataToSLSLogs(data *webtracking.Payload, now time.Time) ([]*sls.Log, []*sls.LogTag) {
+	logs := make([]*sls.Log, 0, len(data.Logs))
+	for _, entry := range data.Logs {
+		if len(entry) == 0 {
+			continue
+		}
+		t, ok := webtracking.EntryTime(entry)
+		if !ok {
+			t = now
+		}
+		log := &sls.Log{
+			Time:     proto.Uint32(uint32(t.Unix())),
+			Contents: make([]*sls.LogContent, 0, len(entry)),
+		}
+		for _, k := range sortedKeys(entry) {
+			if k == webtracking.TimeField {
+				continue
+			}
 			log.Contents = append(log.Contents, &sls.LogContent{
 				Key:   proto.String(k),
-				Value: proto.String(v),
+				Value: proto.String(entry[k]),
 			})
 		}
+		logs = append(logs, log)
 	}
 
-	for k, v := range data.Tags {
-		log.Contents = append(log.Contents, &sls.LogContent{
+	tags := make([]*sls.LogTag, 0, len(data.Tags))
+	for _, k := range sortedKeys(data.Tags) {
+		tags = append(tags, &sls.LogTag{
 			Key:   proto.String(k),
-			Value: proto.String(v),
-		})
-	}
-
-	if data.Topic != "" {
-		client.SetTopic(data.Topic)
-		log.Contents = append(log.Contents, &sls.LogContent{
-			Key:   proto.String("__topic__"),
-			Value: proto.String(data.Topic),
+			Value: proto.String(data.Tags[k]),
 		})
 	}
+	return logs, tags
+}
 
-	if data.Source != "" {
-		client.SetSource(data.Source)
-		log.Contents = append(log.Contents, &sls.LogContent{
-			Key:   proto.String("__source__"),
-			Value: proto.String(data.Source),
-		})
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
 	}
-
-	return result
+	sort.Strings(keys)
+	return keys
 }
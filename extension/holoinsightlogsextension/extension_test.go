@@ -0,0 +1,94 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/traas-stack/holoinsight-collector/internal/webtracking"
+)
+
+// contentsOf returns the contents of log as a map.
+func contentsOf(log *sls.Log) map[string]string {
+	contents := make(map[string]string, len(log.Contents))
+	for _, c := range log.Contents {
+		contents[c.GetKey()] = c.GetValue()
+	}
+	return contents
+}
+
+func TestDataToSLSLogs(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	payload := &webtracking.Payload{
+		Topic: "topic",
+		Tags:  map[string]string{"app": "shop", "env": "prod"},
+		Logs: []map[string]string{
+			{"content": "no time"},
+			{},
+			{"content": "seconds", webtracking.TimeField: "1600000000"},
+			{"content": "milliseconds", webtracking.TimeField: "1600000001500"},
+			{"content": "rfc3339", webtracking.TimeField: "2020-09-13T12:26:42Z"},
+			{"content": "invalid time", webtracking.TimeField: "yesterday"},
+		},
+	}
+	logs, tags := dataToSLSLogs(payload, now)
+	require.Len(t, logs, 5, "the empty entry is skipped")
+
+	for i, want := range []struct {
+		content string
+		time    uint32
+	}{
+		{content: "no time", time: 1700000000},
+		{content: "seconds", time: 1600000000},
+		{content: "milliseconds", time: 1600000001},
+		{content: "rfc3339", time: 1600000002},
+		{content: "invalid time", time: 1700000000},
+	} {
+		assert.Equal(t, want.time, logs[i].GetTime(), want.content)
+		assert.Equal(t, map[string]string{"content": want.content}, contentsOf(logs[i]))
+	}
+	// the tags are the tags of the log group, sorted
+	require.Len(t, tags, 2)
+	assert.Equal(t, "app", tags[0].GetKey())
+	assert.Equal(t, "shop", tags[0].GetValue())
+	assert.Equal(t, "env", tags[1].GetKey())
+	assert.Equal(t, "prod", tags[1].GetValue())
+}
+
+func TestHandleLogsDecodeError(t *testing.T) {
+	l := &logsExtension{logger: zap.NewNop()}
+	for _, tc := range []struct {
+		body string
+		code int
+	}{
+		{body: "not json", code: http.StatusBadRequest},
+		{body: strings.Repeat(" ", 16<<20+1), code: http.StatusRequestEntityTooLarge},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/logstores/store/track", strings.NewReader(tc.body))
+		w := httptest.NewRecorder()
+		l.handleLogs(w, req)
+		assert.Equal(t, tc.code, w.Code)
+		assert.Equal(t, "Unable to decode the logs\n", w.Body.String())
+	}
+}
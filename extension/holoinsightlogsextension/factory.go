@@ -16,6 +16,9 @@ package holoinsightlogsextension
 
 import (
 	"context"
+	"sync"
+
+	"go.opencensus.io/stats/view"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/config/confighttp"
 	"go.opentelemetry.io/collector/extension"
@@ -26,8 +29,13 @@ const (
 	typeStr = "holoinsight_logs"
 )
 
+var registerViews sync.Once
+
 // NewFactory creates a factory for the http_forwarder_auth Authenticator extension.
 func NewFactory() extension.Factory {
+	registerViews.Do(func() {
+		_ = view.Register(metricViews()...)
+	})
 	return extension.NewFactory(
 		typeStr,
 		createDefaultConfig,
@@ -41,6 +49,32 @@ func createDefaultConfig() component.Config {
 		HTTP: &confighttp.HTTPServerSettings{
 			Endpoint: "0.0.0.0:5551",
 		},
+		Server: ServerSettings{
+			HTTPClientSettings: confighttp.HTTPClientSettings{
+				Timeout: defaultServerTimeout,
+			},
+		},
+		ClientCache: ClientCacheSettings{
+			TTL:     defaultClientCacheTTL,
+			MaxSize: defaultClientCacheMaxSize,
+		},
+		Buffer: BufferSettings{
+			MaxLogstoreSize:  defaultBufferMaxLogstoreSize,
+			MaxTenantSize:    defaultBufferMaxTenantSize,
+			MaxSize:          defaultBufferMaxSize,
+			Overflow:         overflowDropOldest,
+			RetryInterval:    defaultBufferRetryInterval,
+			MaxRetryInterval: defaultBufferMaxRetryInterval,
+		},
+		Tail: TailSettings{
+			Size:                defaultTailSize,
+			MaxLogstores:        defaultTailMaxLogstores,
+			SamplingRate:        defaultTailSamplingRate,
+			RecordsPerSecond:    defaultTailRecordsPerSecond,
+			MaxStreamsPerTenant: defaultTailMaxStreamsPerTenant,
+			MaxStreams:          defaultTailMaxStreams,
+			MaxDuration:         defaultTailMaxDuration,
+		},
 	}
 }
 
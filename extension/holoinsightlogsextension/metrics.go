@@ -0,0 +1,72 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"context"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+var (
+	tagLogstore = tag.MustNewKey("logstore")
+	tagTenant   = tag.MustNewKey("tenant")
+	tagReason   = tag.MustNewKey("reason")
+
+	mBufferPayloads = stats.Int64("buffer_payloads", "Number of payloads buffered for a logstore", stats.UnitDimensionless)
+	mBufferSize     = stats.Int64("buffer_size", "Bytes of the payloads buffered for a logstore", stats.UnitBytes)
+	mBufferDropped  = stats.Int64("buffer_dropped_payloads", "Number of buffered payloads dropped", stats.UnitDimensionless)
+)
+
+// metricViews returns the views of the self-telemetry metrics.
+func metricViews() []*view.View {
+	return []*view.View{
+		{
+			Name:        typeStr + "/" + mBufferPayloads.Name(),
+			Measure:     mBufferPayloads,
+			Description: mBufferPayloads.Description(),
+			TagKeys:     []tag.Key{tagLogstore},
+			Aggregation: view.LastValue(),
+		},
+		{
+			Name:        typeStr + "/" + mBufferSize.Name(),
+			Measure:     mBufferSize,
+			Description: mBufferSize.Description(),
+			TagKeys:     []tag.Key{tagLogstore},
+			Aggregation: view.LastValue(),
+		},
+		{
+			Name:        typeStr + "/" + mBufferDropped.Name(),
+			Measure:     mBufferDropped,
+			Description: mBufferDropped.Description(),
+			TagKeys:     []tag.Key{tagLogstore, tagTenant, tagReason},
+			Aggregation: view.Sum(),
+		},
+	}
+}
+
+func recordBufferDepth(logstore string, payloads int, size int64) {
+	_ = stats.RecordWithTags(context.Background(),
+		[]tag.Mutator{tag.Upsert(tagLogstore, logstore)},
+		mBufferPayloads.M(int64(payloads)), mBufferSize.M(size))
+}
+
+func recordBufferDropped(logstore, tenant, reason string) {
+	_ = stats.RecordWithTags(context.Background(),
+		[]tag.Mutator{tag.Upsert(tagLogstore, logstore), tag.Upsert(tagTenant, tenant), tag.Upsert(tagReason, reason)},
+		mBufferDropped.M(1))
+}
@@ -0,0 +1,163 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/config/configopaque"
+
+	"github.com/traas-stack/holoinsight-collector/internal/aescrypt"
+)
+
+const (
+	defaultServerTimeout = 10 * time.Second
+
+	projectQueryPath = "/internal/customize/log/project/query"
+
+	// fields of the project query response
+	projectSink            = "sink"
+	projectName            = "projectName"
+	projectAccessID        = "accessId"
+	projectAccessKey       = "accessKey"
+	projectSecurityToken   = "securityToken"
+	projectTokenExpiration = "expiration"
+	// projectSTS marks the cached projects whose credentials are STS tokens, refreshed by their client.
+	projectSTS = "sts"
+)
+
+// ServerSettings configures the client querying the projects of the logstores from the holoinsight server.
+type ServerSettings struct {
+	// The endpoint defaults to server_endpoint. TLS, headers, timeout (default: 10s) and auth extension of the queries.
+	confighttp.HTTPClientSettings `mapstructure:",squash"`
+	// Token is sent as the bearer token of the queries.
+	Token configopaque.String `mapstructure:"token"`
+	// DecryptCredentials decrypts the accessId, accessKey and securityToken of the projects with the decrypt keys.
+	DecryptCredentials bool `mapstructure:"decrypt_credentials"`
+}
+
+// projectClient queries the projects of the logstores from the holoinsight server.
+type projectClient struct {
+	client   *http.Client
+	endpoint string
+	token    string
+	keys     *aescrypt.Keyring
+}
+
+func newProjectClient(cfg *Config, keys *aescrypt.Keyring, host component.Host, telemetry component.TelemetrySettings) (*projectClient, error) {
+	client, err := cfg.Server.ToClient(host, telemetry)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := cfg.Server.Endpoint
+	if endpoint == "" {
+		endpoint = cfg.ServerEndpoint
+	}
+	c := &projectClient{
+		client:   client,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		token:    string(cfg.Server.Token),
+	}
+	if cfg.Server.DecryptCredentials {
+		c.keys = keys
+	}
+	return c, nil
+}
+
+// query returns the project of the logstore, its credentials decrypted.
+func (c *projectClient) query(ctx context.Context, logstore string) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+projectQueryPath+"?key="+url.QueryEscape(logstore), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Status code: " + resp.Status)
+	}
+	if len(body) == 0 {
+		return nil, errors.New("empty project")
+	}
+
+	project := make(map[string]string)
+	if err = json.Unmarshal(body, &project); err != nil {
+		return nil, err
+	}
+	if c.keys != nil {
+		for _, field := range []string{projectAccessID, projectAccessKey, projectSecurityToken} {
+			if project[field] == "" {
+				continue
+			}
+			if project[field], err = c.keys.Decrypt(project[field]); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", field, err)
+			}
+		}
+	}
+	return project, nil
+}
+
+// credentials returns the STS token of the project of the logstore, for the client to refresh it before it expires.
+// A token without expiration is refreshed after ttl.
+func (c *projectClient) credentials(logstore string, ttl time.Duration) (accessKeyID, accessKeySecret, securityToken string, expireTime time.Time, err error) {
+	project, err := c.query(context.Background(), logstore)
+	if err != nil {
+		return "", "", "", time.Time{}, err
+	}
+	expireTime = time.Now().Add(ttl)
+	if expiration := project[projectTokenExpiration]; expiration != "" {
+		if expireTime, err = time.Parse(time.RFC3339, expiration); err != nil {
+			return "", "", "", time.Time{}, fmt.Errorf("invalid expiration: %w", err)
+		}
+	}
+	return project[projectAccessID], project[projectAccessKey], project[projectSecurityToken], expireTime, nil
+}
+
+// withoutSTSCredentials replaces the STS credentials of project by a mark, the client of a project refreshing
+// them rather than being replaced when they change.
+func withoutSTSCredentials(project map[string]string) map[string]string {
+	if project[projectSecurityToken] == "" {
+		return project
+	}
+	cached := make(map[string]string, len(project))
+	for k, v := range project {
+		switch k {
+		case projectAccessID, projectAccessKey, projectSecurityToken, projectTokenExpiration:
+		default:
+			cached[k] = v
+		}
+	}
+	cached[projectSTS] = "true"
+	return cached
+}
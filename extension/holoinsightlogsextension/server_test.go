@@ -0,0 +1,155 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+
+	"github.com/traas-stack/holoinsight-collector/internal/aescrypt"
+)
+
+// newTestProjectClient queries the projects from a server answering the projects of its logstores, checking the
+// token of the queries.
+func newTestProjectClient(t *testing.T, cfg *Config, keys *aescrypt.Keyring, projects map[string]map[string]string) *projectClient {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != projectQueryPath || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		project, ok := projects[r.URL.Query().Get("key")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if project == nil {
+			return
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(project))
+	}))
+	t.Cleanup(server.Close)
+	cfg.ServerEndpoint = server.URL + "/"
+	c, err := newProjectClient(cfg, keys, componenttest.NewNopHost(), componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+	return c
+}
+
+func testServerConfig() *Config {
+	cfg := createDefaultConfig().(*Config)
+	cfg.Server.Token = "secret"
+	return cfg
+}
+
+func TestProjectQuery(t *testing.T) {
+	c := newTestProjectClient(t, testServerConfig(), nil, map[string]map[string]string{
+		"store a": {projectName: "project", projectAccessID: "id", projectAccessKey: "key"},
+		"empty":   nil,
+	})
+	project, err := c.query(context.Background(), "store a")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{projectName: "project", projectAccessID: "id", projectAccessKey: "key"}, project)
+
+	_, err = c.query(context.Background(), "unknown")
+	assert.ErrorContains(t, err, "404")
+	_, err = c.query(context.Background(), "empty")
+	assert.ErrorContains(t, err, "empty project")
+
+	// the queries without the token are refused
+	cfg := testServerConfig()
+	cfg.Server.Token = ""
+	c = newTestProjectClient(t, cfg, nil, map[string]map[string]string{"store": {projectName: "project"}})
+	_, err = c.query(context.Background(), "store")
+	assert.ErrorContains(t, err, "401")
+}
+
+func TestProjectQueryDecrypt(t *testing.T) {
+	keys, err := aescrypt.New([]aescrypt.Key{{ID: "k1", Secret: base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))}}, "", "")
+	require.NoError(t, err)
+	encrypt := func(value string) string {
+		encrypted, err := keys.Encrypt(value)
+		require.NoError(t, err)
+		return encrypted
+	}
+	projects := map[string]map[string]string{
+		"store": {
+			projectName:          "project",
+			projectAccessID:      encrypt("id"),
+			projectAccessKey:     encrypt("key"),
+			projectSecurityToken: encrypt("token"),
+		},
+		"plain":   {projectName: "project", projectAccessID: encrypt("id"), projectAccessKey: "key"},
+		"no sts":  {projectName: "project", projectAccessID: encrypt("id"), projectAccessKey: encrypt("key")},
+		"invalid": {projectName: "project", projectAccessID: encrypt("id"), projectAccessKey: "key"},
+	}
+
+	cfg := testServerConfig()
+	cfg.Server.DecryptCredentials = true
+	c := newTestProjectClient(t, cfg, keys, projects)
+	project, err := c.query(context.Background(), "store")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{projectName: "project", projectAccessID: "id", projectAccessKey: "key", projectSecurityToken: "token"}, project)
+	project, err = c.query(context.Background(), "no sts")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{projectName: "project", projectAccessID: "id", projectAccessKey: "key"}, project)
+	_, err = c.query(context.Background(), "invalid")
+	assert.ErrorContains(t, err, "invalid accessKey")
+
+	// the credentials are left as they are without decrypt_credentials
+	c = newTestProjectClient(t, testServerConfig(), keys, projects)
+	project, err = c.query(context.Background(), "plain")
+	require.NoError(t, err)
+	assert.Equal(t, projects["plain"], project)
+}
+
+func TestProjectCredentials(t *testing.T) {
+	c := newTestProjectClient(t, testServerConfig(), nil, map[string]map[string]string{
+		"store":   {projectAccessID: "id", projectAccessKey: "key", projectSecurityToken: "token", projectTokenExpiration: "2023-11-14T22:13:20+08:00"},
+		"no ttl":  {projectAccessID: "id", projectAccessKey: "key", projectSecurityToken: "token"},
+		"invalid": {projectAccessID: "id", projectAccessKey: "key", projectSecurityToken: "token", projectTokenExpiration: "1700000000"},
+	})
+	id, key, token, expiration, err := c.credentials("store", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "key", "token"}, []string{id, key, token})
+	assert.True(t, time.Date(2023, 11, 14, 14, 13, 20, 0, time.UTC).Equal(expiration))
+
+	// a token without expiration expires after the ttl
+	before := time.Now()
+	_, _, _, expiration, err = c.credentials("no ttl", time.Hour)
+	require.NoError(t, err)
+	assert.WithinRange(t, expiration, before.Add(time.Hour), time.Now().Add(time.Hour))
+
+	_, _, _, _, err = c.credentials("invalid", time.Hour)
+	assert.ErrorContains(t, err, "invalid expiration")
+	_, _, _, _, err = c.credentials("unknown", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestWithoutSTSCredentials(t *testing.T) {
+	project := map[string]string{projectName: "project", projectAccessID: "id", projectAccessKey: "key"}
+	assert.Equal(t, project, withoutSTSCredentials(project))
+
+	project[projectSecurityToken] = "token"
+	project[projectTokenExpiration] = "2023-11-14T22:13:20+08:00"
+	assert.Equal(t, map[string]string{projectName: "project", projectSTS: "true"}, withoutSTSCredentials(project))
+}
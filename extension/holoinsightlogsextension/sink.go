@@ -0,0 +1,463 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.uber.org/zap"
+
+	"github.com/traas-stack/holoinsight-collector/internal/webtracking"
+)
+
+const (
+	sinkTypeElasticsearch = "elasticsearch"
+	sinkTypeClickHouse    = "clickhouse"
+	sinkTypeKafka         = "kafka"
+	sinkTypeFile          = "file"
+
+	defaultSendBatchSize   = 1000
+	defaultBatchTimeout    = time.Second
+	defaultQueueSize       = 10000
+	defaultInitialInterval = time.Second
+	defaultMaxInterval     = 30 * time.Second
+	defaultMaxElapsedTime  = 5 * time.Minute
+)
+
+// errSinkFull rejects the logs a sink has no room for.
+var errSinkFull = errors.New("sink queue is full")
+
+// Sink stores the logs posted to logstores.
+type Sink interface {
+	// Send queues the logs of payload, posted to logstore at now, to be stored in the background.
+	Send(ctx context.Context, logstore string, payload *webtracking.Payload, now time.Time) error
+	// Write stores the logs like Send, returning once they are stored, they failed or ctx is done.
+	Write(ctx context.Context, logstore string, payload *webtracking.Payload, now time.Time) error
+}
+
+// SinkSettings configures a sink of the logs.
+type SinkSettings struct {
+	// Type is the store of the sink: elasticsearch, clickhouse, kafka or file.
+	Type          string                `mapstructure:"type"`
+	Elasticsearch ElasticsearchSettings `mapstructure:"elasticsearch"`
+	ClickHouse    ClickHouseSettings    `mapstructure:"clickhouse"`
+	Kafka         KafkaSettings         `mapstructure:"kafka"`
+	File          FileSettings          `mapstructure:"file"`
+	Batch         BatchSettings         `mapstructure:"batch"`
+	Retry         RetrySettings         `mapstructure:"retry_on_failure"`
+}
+
+// BatchSettings batches the logs written to a sink.
+type BatchSettings struct {
+	// SendBatchSize is the number of logs written at once. default: 1000
+	SendBatchSize int `mapstructure:"send_batch_size"`
+	// Timeout is how long logs wait for a batch to fill. default: 1s
+	Timeout time.Duration `mapstructure:"timeout"`
+	// QueueSize is the number of logs waiting to be written, over which requests are rejected. default: 10000
+	QueueSize int `mapstructure:"queue_size"`
+}
+
+// RetrySettings retries the batches a sink failed to write.
+type RetrySettings struct {
+	// Disabled drops the batches failing the first time.
+	Disabled bool `mapstructure:"disabled"`
+	// InitialInterval is the wait after the first failure, doubled after each retry. default: 1s
+	InitialInterval time.Duration `mapstructure:"initial_interval"`
+	// MaxInterval is the longest wait between retries. default: 30s
+	MaxInterval time.Duration `mapstructure:"max_interval"`
+	// MaxElapsedTime is how long a batch is retried before it is dropped. default: 5m
+	MaxElapsedTime time.Duration `mapstructure:"max_elapsed_time"`
+}
+
+// Validate checks the settings of the type of the sink.
+func (s *SinkSettings) Validate() error {
+	if s.Batch.SendBatchSize < 0 || s.Batch.QueueSize < 0 {
+		return errors.New("batch sizes can't be negative")
+	}
+	switch s.Type {
+	case sinkTypeElasticsearch:
+		return s.Elasticsearch.Validate()
+	case sinkTypeClickHouse:
+		return s.ClickHouse.Validate()
+	case sinkTypeKafka:
+		return s.Kafka.Validate()
+	case sinkTypeFile:
+		return s.File.Validate()
+	case "":
+		return errors.New("type not set")
+	}
+	return fmt.Errorf("unknown type %q", s.Type)
+}
+
+// Record is a log written by the batched sinks.
+type Record struct {
+	Time     time.Time         `json:"@timestamp"`
+	Logstore string            `json:"logstore"`
+	Topic    string            `json:"topic,omitempty"`
+	Source   string            `json:"source,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Fields   map[string]string `json:"fields"`
+	// ack is the Write waiting for the record, if any.
+	ack *sinkAck
+}
+
+// sinkAck is the result of the write of the records of a Write, sent once all of them are written or dropped.
+type sinkAck struct {
+	mu        sync.Mutex
+	remaining int
+	err       error
+	result    chan error
+}
+
+func newSinkAck(records int) *sinkAck {
+	return &sinkAck{remaining: records, result: make(chan error, 1)}
+}
+
+// fail records the error of a dropped record.
+func (a *sinkAck) fail(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err == nil {
+		a.err = err
+	}
+}
+
+// done ends the write of a record, sending the result once it is the last one.
+func (a *sinkAck) done() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.remaining--; a.remaining == 0 {
+		a.result <- a.err
+	}
+}
+
+// acknowledge ends the write of records, failed with err for the dropped ones.
+func acknowledge(records, dropped []Record, err error) {
+	for i := range dropped {
+		if dropped[i].ack != nil {
+			dropped[i].ack.fail(err)
+		}
+	}
+	for i := range records {
+		if records[i].ack != nil {
+			records[i].ack.done()
+		}
+	}
+}
+
+// recordWriter writes batches of records to a store.
+type recordWriter interface {
+	write(ctx context.Context, records []Record) error
+	close() error
+}
+
+// partialError fails to write some records of a batch, the ones to retry.
+type partialError struct {
+	failed []Record
+	err    error
+}
+
+func (e *partialError) Error() string {
+	return e.err.Error()
+}
+
+func (e *partialError) Unwrap() error {
+	return e.err
+}
+
+func toRecords(logstore string, payload *webtracking.Payload, now time.Time) []Record {
+	records := make([]Record, 0, len(payload.Logs))
+	for _, fields := range payload.Logs {
+		if len(fields) == 0 {
+			continue
+		}
+		t, ok := webtracking.EntryTime(fields)
+		if !ok {
+			t = now
+		}
+		if _, ok = fields[webtracking.TimeField]; ok {
+			// the time is the timestamp of the record
+			fields = withoutKey(fields, webtracking.TimeField)
+		}
+		records = append(records, Record{
+			Time:     t,
+			Logstore: logstore,
+			Topic:    payload.Topic,
+			Source:   payload.Source,
+			Tags:     payload.Tags,
+			Fields:   fields,
+		})
+	}
+	return records
+}
+
+func withoutKey(m map[string]string, key string) map[string]string {
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		if k != key {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// newSink creates the sink named name, writing batches in the background until it is shut down.
+func newSink(name string, settings SinkSettings, host component.Host, telemetry component.TelemetrySettings) (*batchSink, error) {
+	var w recordWriter
+	var err error
+	switch settings.Type {
+	case sinkTypeElasticsearch:
+		w, err = newElasticsearchWriter(&settings.Elasticsearch, host, telemetry)
+	case sinkTypeClickHouse:
+		w, err = newClickHouseWriter(&settings.ClickHouse, host, telemetry)
+	case sinkTypeKafka:
+		w, err = newKafkaWriter(&settings.Kafka)
+	case sinkTypeFile:
+		w, err = newFileWriter(&settings.File)
+	default:
+		err = fmt.Errorf("unknown type %q", settings.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[holoinsightlogsextension] failed to create sink %q: %w", name, err)
+	}
+	return newBatchSink(name, w, settings, telemetry.Logger), nil
+}
+
+// newBatchSink creates the sink of w, writing batches in the background until it is shut down.
+func newBatchSink(name string, w recordWriter, settings SinkSettings, logger *zap.Logger) *batchSink {
+	if settings.Batch.SendBatchSize == 0 {
+		settings.Batch.SendBatchSize = defaultSendBatchSize
+	}
+	if settings.Batch.Timeout <= 0 {
+		settings.Batch.Timeout = defaultBatchTimeout
+	}
+	if settings.Batch.QueueSize == 0 {
+		settings.Batch.QueueSize = defaultQueueSize
+	}
+	if settings.Retry.InitialInterval <= 0 {
+		settings.Retry.InitialInterval = defaultInitialInterval
+	}
+	if settings.Retry.MaxInterval <= 0 {
+		settings.Retry.MaxInterval = defaultMaxInterval
+	}
+	if settings.Retry.MaxElapsedTime <= 0 {
+		settings.Retry.MaxElapsedTime = defaultMaxElapsedTime
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &batchSink{
+		name:    name,
+		writer:  w,
+		batch:   settings.Batch,
+		retry:   settings.Retry,
+		logger:  logger,
+		flush:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		abort:   cancel,
+	}
+	go s.run(ctx)
+	return s
+}
+
+// batchSink is the Sink of a recordWriter. The logs are queued, then written in batches by a single goroutine,
+// retrying the failed ones.
+type batchSink struct {
+	name   string
+	writer recordWriter
+	batch  BatchSettings
+	retry  RetrySettings
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	pending []Record
+	// queued counts the pending records and the ones being written.
+	queued int
+
+	flush   chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	// abort cancels the writes when the shutdown times out.
+	abort context.CancelFunc
+}
+
+// Send queues the logs, rejecting them with errSinkFull when the queue has no room for them.
+func (s *batchSink) Send(_ context.Context, logstore string, payload *webtracking.Payload, now time.Time) error {
+	return s.enqueue(toRecords(logstore, payload, now))
+}
+
+// Write queues the logs like Send and waits for their batches to be written: it fails when some of them are
+// dropped, permanently when they were refused.
+func (s *batchSink) Write(ctx context.Context, logstore string, payload *webtracking.Payload, now time.Time) error {
+	records := toRecords(logstore, payload, now)
+	if len(records) == 0 {
+		return nil
+	}
+	ack := newSinkAck(len(records))
+	for i := range records {
+		records[i].ack = ack
+	}
+	if err := s.enqueue(records); err != nil {
+		return err
+	}
+	select {
+	case err := <-ack.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *batchSink) enqueue(records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	if s.queued+len(records) > s.batch.QueueSize {
+		s.mu.Unlock()
+		return errSinkFull
+	}
+	s.pending = append(s.pending, records...)
+	s.queued += len(records)
+	full := len(s.pending) >= s.batch.SendBatchSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Shutdown writes the queued logs, once, and closes the writer. When ctx is done first, the writes are aborted,
+// dropping the logs left, and the writer is closed once the write in progress returns.
+func (s *batchSink) Shutdown(ctx context.Context) error {
+	close(s.done)
+	select {
+	case <-s.stopped:
+		s.abort()
+		return s.writer.close()
+	case <-ctx.Done():
+	}
+	s.abort()
+	go func() {
+		<-s.stopped
+		if err := s.writer.close(); err != nil {
+			s.logger.Warn("[holoinsightlogsextension] failed to close sink", zap.String("sink", s.name), zap.Error(err))
+		}
+	}()
+	return ctx.Err()
+}
+
+func (s *batchSink) run(ctx context.Context) {
+	defer close(s.stopped)
+	ticker := time.NewTicker(s.batch.Timeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			s.writePending(ctx)
+			return
+		case <-ticker.C:
+		case <-s.flush:
+		}
+		s.writePending(ctx)
+	}
+}
+
+func (s *batchSink) writePending(ctx context.Context) {
+	s.mu.Lock()
+	records := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	for len(records) > 0 {
+		n := len(records)
+		if n > s.batch.SendBatchSize {
+			n = s.batch.SendBatchSize
+		}
+		dropped, err := s.writeBatch(ctx, records[:n])
+		acknowledge(records[:n], dropped, err)
+		records = records[n:]
+
+		s.mu.Lock()
+		s.queued -= n
+		s.mu.Unlock()
+	}
+}
+
+// writeBatch writes records, retrying the failures until they are permanent, the retries time out or the sink
+// is shut down: a last attempt is then made and the failed records dropped, returned with the error.
+func (s *batchSink) writeBatch(ctx context.Context, records []Record) ([]Record, error) {
+	interval := s.retry.InitialInterval
+	deadline := time.Now().Add(s.retry.MaxElapsedTime)
+	last := s.retry.Disabled
+	for {
+		select {
+		case <-s.done:
+			last = true
+		default:
+		}
+
+		err := s.writer.write(ctx, records)
+		if err == nil {
+			return nil, nil
+		}
+		var partial *partialError
+		if errors.As(err, &partial) {
+			records = partial.failed
+		}
+		if last || consumererror.IsPermanent(err) || time.Now().Add(interval).After(deadline) {
+			s.logger.Error("[holoinsightlogsextension] sink failed to write logs, dropping them",
+				zap.String("sink", s.name), zap.Int("logs", len(records)), zap.Error(err))
+			return records, err
+		}
+		s.logger.Warn("[holoinsightlogsextension] sink failed to write logs, retrying",
+			zap.String("sink", s.name), zap.Int("logs", len(records)), zap.Duration("interval", interval), zap.Error(err))
+
+		select {
+		case <-s.done:
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > s.retry.MaxInterval {
+			interval = s.retry.MaxInterval
+		}
+	}
+}
+
+// statusError is the error of a response, permanent unless the request may succeed later.
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err := fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(body))
+	if retryableStatus(resp.StatusCode) {
+		return err
+	}
+	return consumererror.NewPermanent(err)
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
@@ -0,0 +1,145 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+)
+
+const (
+	defaultClickHouseDatabase = "default"
+	defaultClickHouseTable    = "holoinsight_logs"
+
+	clickHouseTimeLayout = "2006-01-02 15:04:05.000000000"
+)
+
+var clickHouseIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ClickHouseSettings configures a sink inserting the logs into a table, with the HTTP interface of ClickHouse.
+type ClickHouseSettings struct {
+	confighttp.HTTPClientSettings `mapstructure:",squash"`
+	// Database of the table. default: default
+	Database string `mapstructure:"database"`
+	// Table the logs are inserted into. default: holoinsight_logs
+	Table    string              `mapstructure:"table"`
+	Username string              `mapstructure:"username"`
+	Password configopaque.String `mapstructure:"password"`
+}
+
+// Validate checks the endpoint is set and the database and table are identifiers.
+func (s *ClickHouseSettings) Validate() error {
+	if s.Endpoint == "" {
+		return errors.New("clickhouse endpoint not set")
+	}
+	for _, name := range []string{s.Database, s.Table} {
+		if name != "" && !clickHouseIdentifier.MatchString(name) {
+			return fmt.Errorf("invalid clickhouse identifier %q", name)
+		}
+	}
+	return nil
+}
+
+type clickHouseWriter struct {
+	client   *http.Client
+	url      string
+	username string
+	password string
+}
+
+func newClickHouseWriter(settings *ClickHouseSettings, host component.Host, telemetry component.TelemetrySettings) (recordWriter, error) {
+	client, err := settings.ToClient(host, telemetry)
+	if err != nil {
+		return nil, err
+	}
+	database, table := settings.Database, settings.Table
+	if database == "" {
+		database = defaultClickHouseDatabase
+	}
+	if table == "" {
+		table = defaultClickHouseTable
+	}
+	query := fmt.Sprintf("INSERT INTO %s.%s FORMAT JSONEachRow", database, table)
+	return &clickHouseWriter{
+		client:   client,
+		url:      strings.TrimSuffix(settings.Endpoint, "/") + "/?query=" + url.QueryEscape(query),
+		username: settings.Username,
+		password: string(settings.Password),
+	}, nil
+}
+
+// clickHouseRow is a row of the table, see the README for its definition.
+type clickHouseRow struct {
+	Timestamp string            `json:"timestamp"`
+	Logstore  string            `json:"logstore"`
+	Topic     string            `json:"topic"`
+	Source    string            `json:"source"`
+	Tags      map[string]string `json:"tags"`
+	Fields    map[string]string `json:"fields"`
+}
+
+func (w *clickHouseWriter) write(ctx context.Context, records []Record) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for i := range records {
+		r := &records[i]
+		row := clickHouseRow{
+			Timestamp: r.Time.UTC().Format(clickHouseTimeLayout),
+			Logstore:  r.Logstore,
+			Topic:     r.Topic,
+			Source:    r.Source,
+			Tags:      r.Tags,
+			Fields:    r.Fields,
+		}
+		if err := encoder.Encode(&row); err != nil {
+			return consumererror.NewPermanent(err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, &body)
+	if err != nil {
+		return consumererror.NewPermanent(err)
+	}
+	if w.username != "" {
+		req.Header.Set("X-ClickHouse-User", w.username)
+		req.Header.Set("X-ClickHouse-Key", w.password)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return statusError(resp)
+	}
+	return nil
+}
+
+func (w *clickHouseWriter) close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+)
+
+func newTestClickHouseWriter(t *testing.T, handler http.HandlerFunc) recordWriter {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	w, err := newClickHouseWriter(&ClickHouseSettings{
+		HTTPClientSettings: confighttp.HTTPClientSettings{Endpoint: server.URL},
+		Table:              "logs",
+		Username:           "user",
+		Password:           "password",
+	}, componenttest.NewNopHost(), componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, w.close()) })
+	return w
+}
+
+func TestClickHouseWrite(t *testing.T) {
+	var body string
+	w := newTestClickHouseWriter(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "INSERT INTO default.logs FORMAT JSONEachRow", r.URL.Query().Get("query"))
+		assert.Equal(t, "user", r.Header.Get("X-ClickHouse-User"))
+		assert.Equal(t, "password", r.Header.Get("X-ClickHouse-Key"))
+		data, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		body = string(data)
+	})
+	require.NoError(t, w.write(context.Background(), testRecords("a")))
+	assert.Equal(t, `{"timestamp":"2023-11-14 22:13:20.000000000","logstore":"Store","topic":"","source":"","tags":null,"fields":{"content":"a"}}`+"\n", body)
+}
+
+func TestClickHouseStatus(t *testing.T) {
+	for _, tc := range []struct {
+		status    int
+		permanent bool
+	}{
+		{status: http.StatusTooManyRequests},
+		{status: http.StatusInternalServerError},
+		{status: http.StatusServiceUnavailable},
+		{status: http.StatusBadRequest, permanent: true},
+		{status: http.StatusNotFound, permanent: true},
+		{status: http.StatusForbidden, permanent: true},
+	} {
+		w := newTestClickHouseWriter(t, func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Code: 60. DB::Exception", tc.status)
+		})
+		err := w.write(context.Background(), testRecords("a"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "DB::Exception")
+		assert.Equal(t, tc.permanent, consumererror.IsPermanent(err), tc.status)
+	}
+}
+
+func TestClickHouseValidate(t *testing.T) {
+	settings := ClickHouseSettings{HTTPClientSettings: confighttp.HTTPClientSettings{Endpoint: "http://localhost:8123"}}
+	assert.NoError(t, settings.Validate())
+	settings.Table = "logs; DROP TABLE logs"
+	assert.EqualError(t, settings.Validate(), `invalid clickhouse identifier "logs; DROP TABLE logs"`)
+}
@@ -0,0 +1,158 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+)
+
+const defaultIndexPrefix = "holoinsight-logs-"
+
+// ElasticsearchSettings configures a sink writing the logs of each logstore to the index <index_prefix><logstore>,
+// with the bulk API.
+type ElasticsearchSettings struct {
+	confighttp.HTTPClientSettings `mapstructure:",squash"`
+	// IndexPrefix is prepended to the lowercased logstores. default: holoinsight-logs-
+	IndexPrefix string              `mapstructure:"index_prefix"`
+	Username    string              `mapstructure:"username"`
+	Password    configopaque.String `mapstructure:"password"`
+}
+
+// Validate checks the endpoint is set.
+func (s *ElasticsearchSettings) Validate() error {
+	if s.Endpoint == "" {
+		return errors.New("elasticsearch endpoint not set")
+	}
+	return nil
+}
+
+type elasticsearchWriter struct {
+	client   *http.Client
+	url      string
+	prefix   string
+	username string
+	password string
+}
+
+func newElasticsearchWriter(settings *ElasticsearchSettings, host component.Host, telemetry component.TelemetrySettings) (recordWriter, error) {
+	client, err := settings.ToClient(host, telemetry)
+	if err != nil {
+		return nil, err
+	}
+	prefix := settings.IndexPrefix
+	if prefix == "" {
+		prefix = defaultIndexPrefix
+	}
+	return &elasticsearchWriter{
+		client:   client,
+		url:      strings.TrimSuffix(settings.Endpoint, "/") + "/_bulk",
+		prefix:   prefix,
+		username: settings.Username,
+		password: string(settings.Password),
+	}, nil
+}
+
+type bulkAction struct {
+	Create struct {
+		Index string `json:"_index"`
+	} `json:"create"`
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+func (w *elasticsearchWriter) write(ctx context.Context, records []Record) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for i := range records {
+		var action bulkAction
+		action.Create.Index = w.prefix + strings.ToLower(records[i].Logstore)
+		if err := encoder.Encode(&action); err != nil {
+			return consumererror.NewPermanent(err)
+		}
+		if err := encoder.Encode(&records[i]); err != nil {
+			return consumererror.NewPermanent(err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, &body)
+	if err != nil {
+		return consumererror.NewPermanent(err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return statusError(resp)
+	}
+
+	var result bulkResponse
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return consumererror.NewPermanent(fmt.Errorf("invalid bulk response: %w", err))
+	}
+	if !result.Errors {
+		return nil
+	}
+	// retry the documents which may be created later, drop the others
+	var failed []Record
+	var firstError json.RawMessage
+	rejected := 0
+	for i, item := range result.Items {
+		for _, status := range item {
+			if status.Status/100 == 2 || i >= len(records) {
+				continue
+			}
+			rejected++
+			if firstError == nil {
+				firstError = status.Error
+			}
+			if retryableStatus(status.Status) {
+				failed = append(failed, records[i])
+			}
+		}
+	}
+	err = fmt.Errorf("%d of %d documents rejected, %d to retry: %s", rejected, len(records), len(failed), firstError)
+	if len(failed) == 0 {
+		return consumererror.NewPermanent(err)
+	}
+	return &partialError{failed: failed, err: err}
+}
+
+func (w *elasticsearchWriter) close() error {
+	w.client.CloseIdleConnections()
+	return nil
+}
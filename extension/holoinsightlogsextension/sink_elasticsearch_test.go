@@ -0,0 +1,148 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+)
+
+func newTestElasticsearchWriter(t *testing.T, handler http.HandlerFunc) recordWriter {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	w, err := newElasticsearchWriter(&ElasticsearchSettings{
+		HTTPClientSettings: confighttp.HTTPClientSettings{Endpoint: server.URL + "/"},
+		Username:           "user",
+		Password:           "password",
+	}, componenttest.NewNopHost(), componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, w.close()) })
+	return w
+}
+
+func testRecords(contents ...string) []Record {
+	records := make([]Record, 0, len(contents))
+	for _, content := range contents {
+		records = append(records, Record{Time: time.Unix(1700000000, 0).UTC(), Logstore: "Store", Fields: map[string]string{"content": content}})
+	}
+	return records
+}
+
+// bulkResponseOf answers the bulk request with the statuses of its documents.
+func bulkResponseOf(statuses ...int) string {
+	var result bulkResponse
+	for _, status := range statuses {
+		item := map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		}{}
+		entry := item["create"]
+		entry.Status = status
+		if status/100 != 2 {
+			result.Errors = true
+			entry.Error = json.RawMessage(`{"type":"error"}`)
+		}
+		item["create"] = entry
+		result.Items = append(result.Items, item)
+	}
+	data, _ := json.Marshal(&result)
+	return string(data)
+}
+
+func TestElasticsearchWrite(t *testing.T) {
+	var lines []string
+	w := newTestElasticsearchWriter(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/_bulk", r.URL.Path)
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		username, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", username)
+		assert.Equal(t, "password", password)
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		_, _ = w.Write([]byte(bulkResponseOf(201)))
+	})
+	require.NoError(t, w.write(context.Background(), testRecords("a")))
+	assert.Equal(t, []string{
+		`{"create":{"_index":"holoinsight-logs-store"}}`,
+		`{"@timestamp":"2023-11-14T22:13:20Z","logstore":"Store","fields":{"content":"a"}}`,
+	}, lines)
+}
+
+func TestElasticsearchPartialErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		statuses  []int
+		retry     []string
+		permanent bool
+	}{
+		{name: "retryable", statuses: []int{201, 429, 400, 503}, retry: []string{"b", "d"}},
+		{name: "permanent", statuses: []int{201, 400, 409, 201}, permanent: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := newTestElasticsearchWriter(t, func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(bulkResponseOf(tc.statuses...)))
+			})
+			err := w.write(context.Background(), testRecords("a", "b", "c", "d"))
+			require.Error(t, err)
+			assert.Equal(t, tc.permanent, consumererror.IsPermanent(err))
+			var partial *partialError
+			if tc.permanent {
+				assert.False(t, errors.As(err, &partial))
+				return
+			}
+			require.ErrorAs(t, err, &partial)
+			var retry []string
+			for _, r := range partial.failed {
+				retry = append(retry, r.Fields["content"])
+			}
+			assert.Equal(t, tc.retry, retry)
+		})
+	}
+}
+
+func TestElasticsearchStatus(t *testing.T) {
+	for _, tc := range []struct {
+		status    int
+		permanent bool
+	}{
+		{status: http.StatusTooManyRequests},
+		{status: http.StatusServiceUnavailable},
+		{status: http.StatusBadRequest, permanent: true},
+		{status: http.StatusUnauthorized, permanent: true},
+	} {
+		w := newTestElasticsearchWriter(t, func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "failed", tc.status)
+		})
+		err := w.write(context.Background(), testRecords("a"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed")
+		assert.Equal(t, tc.permanent, consumererror.IsPermanent(err), tc.status)
+	}
+}
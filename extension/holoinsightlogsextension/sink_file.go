@@ -0,0 +1,143 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.uber.org/multierr"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	defaultMaxSizeMB  = 100
+	defaultMaxBackups = 10
+)
+
+// FileSettings configures a sink appending the logs of each logstore as JSON lines to <directory>/<logstore>.log,
+// rotated by size.
+type FileSettings struct {
+	Directory string `mapstructure:"directory"`
+	// MaxSizeMB is the size of a file over which it is rotated. default: 100
+	MaxSizeMB int `mapstructure:"max_size_mb"`
+	// MaxBackups is the number of rotated files kept. default: 10
+	MaxBackups int `mapstructure:"max_backups"`
+	// MaxAgeDays is how long rotated files are kept, 0 keeps them. default: 0
+	MaxAgeDays int `mapstructure:"max_age_days"`
+	// Compress gzips the rotated files.
+	Compress bool `mapstructure:"compress"`
+}
+
+// Validate checks the directory is set.
+func (s *FileSettings) Validate() error {
+	if s.Directory == "" {
+		return errors.New("file directory not set")
+	}
+	if s.MaxSizeMB < 0 || s.MaxBackups < 0 || s.MaxAgeDays < 0 {
+		return errors.New("file rotation settings can't be negative")
+	}
+	return nil
+}
+
+// fileWriter is only used by the goroutine of its sink, its files need no lock.
+type fileWriter struct {
+	settings FileSettings
+	// files are the open files, by name
+	files map[string]*lumberjack.Logger
+}
+
+func newFileWriter(settings *FileSettings) (recordWriter, error) {
+	w := &fileWriter{settings: *settings, files: make(map[string]*lumberjack.Logger)}
+	if w.settings.MaxSizeMB == 0 {
+		w.settings.MaxSizeMB = defaultMaxSizeMB
+	}
+	if w.settings.MaxBackups == 0 {
+		w.settings.MaxBackups = defaultMaxBackups
+	}
+	return w, nil
+}
+
+func (w *fileWriter) write(_ context.Context, records []Record) error {
+	var failed []Record
+	var errs error
+	for start := 0; start < len(records); {
+		// write the consecutive records of a logstore at once
+		end := start + 1
+		for end < len(records) && records[end].Logstore == records[start].Logstore {
+			end++
+		}
+		if err := w.writeFile(records[start:end]); err != nil {
+			failed = append(failed, records[start:end]...)
+			errs = multierr.Append(errs, err)
+		}
+		start = end
+	}
+	if errs != nil {
+		return &partialError{failed: failed, err: errs}
+	}
+	return nil
+}
+
+func (w *fileWriter) writeFile(records []Record) error {
+	name := fileName(records[0].Logstore)
+	file, ok := w.files[name]
+	if !ok {
+		file = &lumberjack.Logger{
+			Filename:   filepath.Join(w.settings.Directory, name),
+			MaxSize:    w.settings.MaxSizeMB,
+			MaxBackups: w.settings.MaxBackups,
+			MaxAge:     w.settings.MaxAgeDays,
+			Compress:   w.settings.Compress,
+		}
+		w.files[name] = file
+	}
+	out := bufio.NewWriter(file)
+	encoder := json.NewEncoder(out)
+	for i := range records {
+		if err := encoder.Encode(&records[i]); err != nil {
+			return consumererror.NewPermanent(err)
+		}
+	}
+	return out.Flush()
+}
+
+// fileName maps logstore, sent by the clients, to a file name of the directory.
+func fileName(logstore string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, logstore)
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		name = "_"
+	}
+	return name + ".log"
+}
+
+func (w *fileWriter) close() error {
+	var errs error
+	for _, file := range w.files {
+		errs = multierr.Append(errs, file.Close())
+	}
+	return errs
+}
@@ -0,0 +1,92 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileWrite(t *testing.T) {
+	dir := t.TempDir()
+	w, err := newFileWriter(&FileSettings{Directory: dir})
+	require.NoError(t, err)
+	records := append(testRecords("a", "b"), Record{Logstore: "../other", Fields: map[string]string{"content": "c"}})
+	require.NoError(t, w.write(context.Background(), records))
+	require.NoError(t, w.close())
+
+	assert.Equal(t, []string{"a", "b"}, fileContents(t, filepath.Join(dir, "Store.log")))
+	// the logstores are sanitized, the files stay in the directory
+	assert.Equal(t, []string{"c"}, fileContents(t, filepath.Join(dir, "_other.log")))
+}
+
+func TestFileRotation(t *testing.T) {
+	dir := t.TempDir()
+	w, err := newFileWriter(&FileSettings{Directory: dir, MaxSizeMB: 1, MaxBackups: 1})
+	require.NoError(t, err)
+	content := strings.Repeat("x", 100<<10)
+	for i := 0; i < 25; i++ {
+		require.NoError(t, w.write(context.Background(), testRecords(content)))
+	}
+	require.NoError(t, w.close())
+
+	// lumberjack removes the backups over max_backups in the background
+	require.Eventually(t, func() bool {
+		entries, err := os.ReadDir(dir)
+		return err == nil && len(entries) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(entry.Name(), "Store"), entry.Name())
+		assert.LessOrEqual(t, info.Size(), int64(1<<20))
+	}
+	assert.Len(t, fileContents(t, filepath.Join(dir, "Store.log")), 25-2*10)
+}
+
+func TestFileName(t *testing.T) {
+	assert.Equal(t, "store-1_a.b.log", fileName("store-1_a.b"))
+	assert.Equal(t, "_.._etc_passwd.log", fileName("/../etc/passwd"))
+	assert.Equal(t, "_.log", fileName(".."))
+	assert.Equal(t, "_.log", fileName(""))
+}
+
+// fileContents returns the content fields of the records of the file.
+func fileContents(t *testing.T, path string) []string {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	var contents []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var r Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		contents = append(contents, r.Fields["content"])
+	}
+	require.NoError(t, scanner.Err())
+	return contents
+}
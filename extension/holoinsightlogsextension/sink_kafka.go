@@ -0,0 +1,117 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/Shopify/sarama"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+)
+
+const (
+	defaultKafkaTopic           = "holoinsight_logs"
+	defaultKafkaProtocolVersion = "2.0.0"
+)
+
+// KafkaSettings configures a sink producing the logs as JSON messages keyed by their logstore.
+type KafkaSettings struct {
+	Brokers []string `mapstructure:"brokers"`
+	// Topic of the messages. default: holoinsight_logs
+	Topic string `mapstructure:"topic"`
+	// ProtocolVersion is the Kafka protocol version of the brokers. default: 2.0.0
+	ProtocolVersion string `mapstructure:"protocol_version"`
+}
+
+// Validate checks the brokers are set and the protocol version is valid.
+func (s *KafkaSettings) Validate() error {
+	if len(s.Brokers) == 0 {
+		return errors.New("kafka brokers not set")
+	}
+	if s.ProtocolVersion != "" {
+		if _, err := sarama.ParseKafkaVersion(s.ProtocolVersion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type kafkaWriter struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+func newKafkaWriter(settings *KafkaSettings) (recordWriter, error) {
+	version := settings.ProtocolVersion
+	if version == "" {
+		version = defaultKafkaProtocolVersion
+	}
+	config := sarama.NewConfig()
+	var err error
+	if config.Version, err = sarama.ParseKafkaVersion(version); err != nil {
+		return nil, err
+	}
+	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	// the retries of the sink resend the failed messages
+	config.Producer.Retry.Max = 0
+	producer, err := sarama.NewSyncProducer(settings.Brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	topic := settings.Topic
+	if topic == "" {
+		topic = defaultKafkaTopic
+	}
+	return &kafkaWriter{producer: producer, topic: topic}, nil
+}
+
+func (w *kafkaWriter) write(_ context.Context, records []Record) error {
+	messages := make([]*sarama.ProducerMessage, 0, len(records))
+	byMessage := make(map[*sarama.ProducerMessage]int, len(records))
+	for i := range records {
+		value, err := json.Marshal(&records[i])
+		if err != nil {
+			return consumererror.NewPermanent(err)
+		}
+		message := &sarama.ProducerMessage{
+			Topic: w.topic,
+			Key:   sarama.StringEncoder(records[i].Logstore),
+			Value: sarama.ByteEncoder(value),
+		}
+		messages = append(messages, message)
+		byMessage[message] = i
+	}
+
+	err := w.producer.SendMessages(messages)
+	var errs sarama.ProducerErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+	// retry the messages which were not produced
+	failed := make([]Record, 0, len(errs))
+	for _, e := range errs {
+		if i, ok := byMessage[e.Msg]; ok {
+			failed = append(failed, records[i])
+		}
+	}
+	return &partialError{failed: failed, err: err}
+}
+
+func (w *kafkaWriter) close() error {
+	return w.producer.Close()
+}
@@ -0,0 +1,263 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.uber.org/zap"
+
+	"github.com/traas-stack/holoinsight-collector/internal/webtracking"
+)
+
+// fakeWriter records the batches it writes, failing with the errors of errs first.
+type fakeWriter struct {
+	mu      sync.Mutex
+	batches [][]Record
+	errs    []error
+	// release, when set, blocks the writes until it is closed or their context is done
+	release chan struct{}
+	closed  chan struct{}
+}
+
+func newFakeWriter(errs ...error) *fakeWriter {
+	return &fakeWriter{errs: errs, closed: make(chan struct{})}
+}
+
+func (w *fakeWriter) write(ctx context.Context, records []Record) error {
+	if w.release != nil {
+		select {
+		case <-w.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.errs) > 0 {
+		err := w.errs[0]
+		w.errs = w.errs[1:]
+		var partial *partialError
+		if errors.As(err, &partial) {
+			// the records not failed are written
+			failed := make(map[string]bool, len(partial.failed))
+			for _, r := range partial.failed {
+				failed[r.Fields["content"]] = true
+			}
+			var written []Record
+			for _, r := range records {
+				if !failed[r.Fields["content"]] {
+					written = append(written, r)
+				}
+			}
+			w.batches = append(w.batches, written)
+		}
+		return err
+	}
+	w.batches = append(w.batches, append([]Record(nil), records...))
+	return nil
+}
+
+func (w *fakeWriter) close() error {
+	close(w.closed)
+	return nil
+}
+
+// contents returns the content field of the records written, by batch.
+func (w *fakeWriter) contents() [][]string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	result := make([][]string, 0, len(w.batches))
+	for _, batch := range w.batches {
+		contents := make([]string, 0, len(batch))
+		for _, r := range batch {
+			contents = append(contents, r.Fields["content"])
+		}
+		result = append(result, contents)
+	}
+	return result
+}
+
+func testSinkSettings() SinkSettings {
+	return SinkSettings{
+		Batch: BatchSettings{SendBatchSize: 2, Timeout: time.Hour, QueueSize: 4},
+		Retry: RetrySettings{InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, MaxElapsedTime: time.Minute},
+	}
+}
+
+func payloadOf(contents ...string) *webtracking.Payload {
+	payload := &webtracking.Payload{Topic: "topic", Source: "source", Tags: map[string]string{"app": "shop"}}
+	for _, content := range contents {
+		payload.Logs = append(payload.Logs, map[string]string{"content": content})
+	}
+	return payload
+}
+
+func TestToRecords(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	payload := payloadOf("a")
+	payload.Logs = append(payload.Logs, map[string]string{}, map[string]string{"content": "b", webtracking.TimeField: "1600000000"})
+	records := toRecords("store", payload, now)
+	require.Len(t, records, 2)
+	assert.Equal(t, Record{Time: now, Logstore: "store", Topic: "topic", Source: "source", Tags: map[string]string{"app": "shop"},
+		Fields: map[string]string{"content": "a"}}, records[0])
+	assert.Equal(t, time.Unix(1600000000, 0), records[1].Time)
+	assert.Equal(t, map[string]string{"content": "b"}, records[1].Fields)
+	assert.Contains(t, payload.Logs[2], webtracking.TimeField, "the payload is unchanged")
+}
+
+func TestBatchSinkFlushOnSize(t *testing.T) {
+	w := newFakeWriter()
+	s := newBatchSink("test", w, testSinkSettings(), zap.NewNop())
+	require.NoError(t, s.Send(context.Background(), "store", payloadOf("a", "b"), time.Now()))
+	require.Eventually(t, func() bool { return len(w.contents()) == 1 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, [][]string{{"a", "b"}}, w.contents())
+	require.NoError(t, s.Shutdown(context.Background()))
+}
+
+func TestBatchSinkFlushOnTimeout(t *testing.T) {
+	w := newFakeWriter()
+	settings := testSinkSettings()
+	settings.Batch.Timeout = 10 * time.Millisecond
+	s := newBatchSink("test", w, settings, zap.NewNop())
+	require.NoError(t, s.Send(context.Background(), "store", payloadOf("a"), time.Now()))
+	require.Eventually(t, func() bool { return len(w.contents()) == 1 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, [][]string{{"a"}}, w.contents())
+	require.NoError(t, s.Shutdown(context.Background()))
+}
+
+func TestBatchSinkFlushOnShutdown(t *testing.T) {
+	w := newFakeWriter()
+	s := newBatchSink("test", w, testSinkSettings(), zap.NewNop())
+	require.NoError(t, s.Send(context.Background(), "store", payloadOf("a"), time.Now()))
+	require.NoError(t, s.Send(context.Background(), "store", &webtracking.Payload{}, time.Now()))
+	assert.Empty(t, w.contents())
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.Equal(t, [][]string{{"a"}}, w.contents())
+	assert.True(t, isClosed(w.closed))
+}
+
+func TestBatchSinkQueueFull(t *testing.T) {
+	w := newFakeWriter()
+	w.release = make(chan struct{})
+	s := newBatchSink("test", w, testSinkSettings(), zap.NewNop())
+	// the batch being written still counts in the queue
+	require.NoError(t, s.Send(context.Background(), "store", payloadOf("a", "b"), time.Now()))
+	require.Eventually(t, func() bool { return pendingOf(s) == 0 }, 5*time.Second, time.Millisecond)
+	require.NoError(t, s.Send(context.Background(), "store", payloadOf("c"), time.Now()))
+	assert.ErrorIs(t, s.Send(context.Background(), "store", payloadOf("d", "e"), time.Now()), errSinkFull)
+	require.NoError(t, s.Send(context.Background(), "store", payloadOf("d"), time.Now()))
+
+	close(w.release)
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.Equal(t, [][]string{{"a", "b"}, {"c", "d"}}, w.contents())
+}
+
+func TestBatchSinkRetries(t *testing.T) {
+	w := newFakeWriter(errors.New("unavailable"), &partialError{failed: []Record{{Fields: map[string]string{"content": "b"}}}, err: errors.New("partial")})
+	s := newBatchSink("test", w, testSinkSettings(), zap.NewNop())
+	require.NoError(t, s.Send(context.Background(), "store", payloadOf("a", "b"), time.Now()))
+	require.Eventually(t, func() bool { return len(w.contents()) == 2 }, 5*time.Second, time.Millisecond)
+	// the first write failed entirely, the second wrote a, the third b
+	assert.Equal(t, [][]string{{"a"}, {"b"}}, w.contents())
+	require.NoError(t, s.Shutdown(context.Background()))
+}
+
+func TestBatchSinkDropsPermanentErrors(t *testing.T) {
+	w := newFakeWriter(consumererror.NewPermanent(errors.New("bad request")))
+	s := newBatchSink("test", w, testSinkSettings(), zap.NewNop())
+	require.NoError(t, s.Send(context.Background(), "store", payloadOf("a", "b"), time.Now()))
+	require.NoError(t, s.Send(context.Background(), "store", payloadOf("c"), time.Now()))
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.Equal(t, [][]string{{"c"}}, w.contents())
+}
+
+func TestBatchSinkShutdownTimeout(t *testing.T) {
+	w := newFakeWriter()
+	w.release = make(chan struct{})
+	s := newBatchSink("test", w, testSinkSettings(), zap.NewNop())
+	require.NoError(t, s.Send(context.Background(), "store", payloadOf("a", "b"), time.Now()))
+	require.NoError(t, s.Send(context.Background(), "store", payloadOf("c"), time.Now()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	// the blocked write is aborted, the logs left dropped and the writer closed
+	select {
+	case <-w.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writer not closed")
+	}
+	assert.Empty(t, w.contents())
+}
+
+func TestBatchSinkWrite(t *testing.T) {
+	w := newFakeWriter()
+	s := newBatchSink("test", w, testSinkSettings(), zap.NewNop())
+	// the write returns once its batch, filled by the send, is written
+	require.NoError(t, s.Send(context.Background(), "store", payloadOf("a"), time.Now()))
+	require.NoError(t, s.Write(context.Background(), "store", payloadOf("b"), time.Now()))
+	assert.Equal(t, [][]string{{"a", "b"}}, w.contents())
+	require.NoError(t, s.Write(context.Background(), "store", &webtracking.Payload{}, time.Now()))
+	require.NoError(t, s.Shutdown(context.Background()))
+}
+
+func TestBatchSinkWriteErrors(t *testing.T) {
+	w := newFakeWriter(consumererror.NewPermanent(errors.New("bad request")))
+	s := newBatchSink("test", w, testSinkSettings(), zap.NewNop())
+	err := s.Write(context.Background(), "store", payloadOf("a", "b"), time.Now())
+	assert.True(t, consumererror.IsPermanent(err))
+	assert.ErrorIs(t, s.Write(context.Background(), "store", payloadOf("c", "d", "e", "f", "g"), time.Now()), errSinkFull)
+	require.NoError(t, s.Shutdown(context.Background()))
+}
+
+func TestBatchSinkWriteCanceled(t *testing.T) {
+	w := newFakeWriter()
+	s := newBatchSink("test", w, testSinkSettings(), zap.NewNop())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	// the batch is not full, the write waits until ctx is done
+	assert.ErrorIs(t, s.Write(ctx, "store", payloadOf("a"), time.Now()), context.DeadlineExceeded)
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.Equal(t, [][]string{{"a"}}, w.contents())
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func pendingOf(s *batchSink) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+func queuedOf(s *batchSink) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queued
+}
@@ -0,0 +1,335 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/collector/config/configauth"
+	"golang.org/x/time/rate"
+
+	"github.com/traas-stack/holoinsight-collector/internal/webtracking"
+)
+
+const (
+	// tailRoute is the route of the live tail of a logstore.
+	tailRoute = "/logstores/{logstore}/tail"
+
+	defaultTailSize                = 20
+	defaultTailMaxLogstores        = 1000
+	defaultTailSamplingRate        = 1.0
+	defaultTailRecordsPerSecond    = 10
+	defaultTailMaxStreamsPerTenant = 2
+	defaultTailMaxStreams          = 32
+	defaultTailMaxDuration         = 5 * time.Minute
+
+	tailHeartbeatInterval = 15 * time.Second
+	tailDroppedInterval   = time.Second
+	// tailStreamBuffer is the number of events waiting for a slow client before the new ones are dropped.
+	tailStreamBuffer = 64
+
+	tailEventRecord  = "record"
+	tailEventError   = "error"
+	tailEventDropped = "dropped"
+)
+
+var errTailTooManyStreams = errors.New("too many tail streams")
+
+// TailSettings configures the live tail of the logstores, streaming the logs ingested for a logstore as
+// Server-Sent Events.
+type TailSettings struct {
+	// Auth is the server authenticator extension, e.g. http_forwarder_auth, authenticating the tail requests and
+	// telling their tenant. The live tail is disabled when not set.
+	Auth *configauth.Authentication `mapstructure:"auth"`
+	// AdminTenants may tail the logs of all the tenants, the other tenants only their own logs.
+	AdminTenants []string `mapstructure:"admin_tenants"`
+	// Size is the number of the last logs of a logstore sent when a tail starts. default: 20
+	Size int `mapstructure:"size"`
+	// MaxLogstores is the number of logstores whose last logs are kept, the least recently ingested are forgotten.
+	// default: 1000
+	MaxLogstores int `mapstructure:"max_logstores"`
+	// SamplingRate is the fraction of the requests whose logs are copied to the tails. default: 1
+	SamplingRate float64 `mapstructure:"sampling_rate"`
+	// RecordsPerSecond is the rate of the logs sent to a tail, the others are dropped. default: 10
+	RecordsPerSecond float64 `mapstructure:"records_per_second"`
+	// MaxStreamsPerTenant is the number of tails of a tenant at once. default: 2
+	MaxStreamsPerTenant int `mapstructure:"max_streams_per_tenant"`
+	// MaxStreams is the number of tails at once. default: 32
+	MaxStreams int `mapstructure:"max_streams"`
+	// MaxDuration ends the tails, the clients reconnecting to go on. default: 5m
+	MaxDuration time.Duration `mapstructure:"max_duration"`
+}
+
+// Validate checks the limits of the tails are positive.
+func (s *TailSettings) Validate() error {
+	if s.Auth == nil {
+		return nil
+	}
+	if s.Size <= 0 || s.MaxLogstores <= 0 || s.MaxStreamsPerTenant <= 0 || s.MaxStreams <= 0 {
+		return errors.New("tail size, max_logstores and max streams must be positive")
+	}
+	if s.SamplingRate <= 0 || s.SamplingRate > 1 {
+		return errors.New("tail sampling_rate must be in (0, 1]")
+	}
+	if s.RecordsPerSecond <= 0 || s.MaxDuration <= 0 {
+		return errors.New("tail records_per_second and max_duration must be positive")
+	}
+	return nil
+}
+
+// tailEvent is a Server-Sent Event of a logstore, seen by the tails of its tenant.
+type tailEvent struct {
+	name   string
+	tenant string
+	data   []byte
+}
+
+// tailError is the data of the error events, the requests of a logstore which couldn't be parsed.
+type tailError struct {
+	Time     time.Time `json:"@timestamp"`
+	Logstore string    `json:"logstore"`
+	Error    string    `json:"error"`
+}
+
+type tailLogstore struct {
+	name string
+	// recent is a ring of the last events, next the index of the oldest one once full.
+	recent  []tailEvent
+	next    int
+	streams map[*tailStream]struct{}
+}
+
+// tailStream is a client tailing a logstore.
+type tailStream struct {
+	tenant  string
+	admin   bool
+	events  chan tailEvent
+	dropped int64
+}
+
+func (s *tailStream) allowed(e tailEvent) bool {
+	return s.admin || e.tenant == s.tenant
+}
+
+// tailHub keeps the last events of the logstores and copies the new ones to their tails.
+type tailHub struct {
+	settings TailSettings
+	admins   map[string]bool
+	done     chan struct{}
+
+	mu            sync.Mutex
+	logstores     map[string]*list.Element
+	lru           *list.List
+	tenantStreams map[string]int
+	streams       int
+}
+
+func newTailHub(settings TailSettings) *tailHub {
+	admins := make(map[string]bool, len(settings.AdminTenants))
+	for _, tenant := range settings.AdminTenants {
+		admins[tenant] = true
+	}
+	return &tailHub{
+		settings:      settings,
+		admins:        admins,
+		done:          make(chan struct{}),
+		logstores:     make(map[string]*list.Element),
+		lru:           list.New(),
+		tenantStreams: make(map[string]int),
+	}
+}
+
+// publish copies the logs of a request of tenant to the tails of logstore, when sampled.
+func (h *tailHub) publish(logstore, tenant string, payload *webtracking.Payload, now time.Time) {
+	if h.settings.SamplingRate < 1 && rand.Float64() >= h.settings.SamplingRate { //nolint:gosec
+		return
+	}
+	records := toRecords(logstore, payload, now)
+	// the older logs would be dropped by the ring and the rate of the tails anyway
+	if len(records) > h.settings.Size {
+		records = records[len(records)-h.settings.Size:]
+	}
+	events := make([]tailEvent, 0, len(records))
+	for i := range records {
+		data, err := json.Marshal(&records[i])
+		if err != nil {
+			continue
+		}
+		events = append(events, tailEvent{name: tailEventRecord, tenant: tenant, data: data})
+	}
+	h.push(logstore, events)
+}
+
+// publishError sends the error of a request of tenant which couldn't be parsed to the tails of logstore.
+func (h *tailHub) publishError(logstore, tenant string, err error, now time.Time) {
+	data, _ := json.Marshal(&tailError{Time: now, Logstore: logstore, Error: err.Error()})
+	h.push(logstore, []tailEvent{{name: tailEventError, tenant: tenant, data: data}})
+}
+
+func (h *tailHub) push(logstore string, events []tailEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ls := h.getLocked(logstore)
+	for _, e := range events {
+		if len(ls.recent) < h.settings.Size {
+			ls.recent = append(ls.recent, e)
+		} else {
+			ls.recent[ls.next] = e
+			ls.next = (ls.next + 1) % len(ls.recent)
+		}
+		for s := range ls.streams {
+			if !s.allowed(e) {
+				continue
+			}
+			select {
+			case s.events <- e:
+			default:
+				atomic.AddInt64(&s.dropped, 1)
+			}
+		}
+	}
+}
+
+// getLocked returns the logstore, created when missing, forgetting the least recently used logstores without tails
+// over the max logstores. The logstore returned is never forgotten, even when all the others have tails.
+func (h *tailHub) getLocked(logstore string) *tailLogstore {
+	if elem, ok := h.logstores[logstore]; ok {
+		h.lru.MoveToFront(elem)
+		return elem.Value.(*tailLogstore)
+	}
+	ls := &tailLogstore{name: logstore, streams: make(map[*tailStream]struct{})}
+	front := h.lru.PushFront(ls)
+	h.logstores[logstore] = front
+	for elem := h.lru.Back(); elem != front && len(h.logstores) > h.settings.MaxLogstores; {
+		prev := elem.Prev()
+		if old := elem.Value.(*tailLogstore); len(old.streams) == 0 {
+			h.lru.Remove(elem)
+			delete(h.logstores, old.name)
+		}
+		elem = prev
+	}
+	return ls
+}
+
+// subscribe starts a tail of logstore for tenant, returning the last events it may see.
+func (h *tailHub) subscribe(logstore, tenant string) (*tailStream, []tailEvent, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.streams >= h.settings.MaxStreams || h.tenantStreams[tenant] >= h.settings.MaxStreamsPerTenant {
+		return nil, nil, errTailTooManyStreams
+	}
+	h.streams++
+	h.tenantStreams[tenant]++
+
+	s := &tailStream{tenant: tenant, admin: h.admins[tenant], events: make(chan tailEvent, tailStreamBuffer)}
+	ls := h.getLocked(logstore)
+	ls.streams[s] = struct{}{}
+	history := make([]tailEvent, 0, len(ls.recent))
+	for i := range ls.recent {
+		if e := ls.recent[(ls.next+i)%len(ls.recent)]; s.allowed(e) {
+			history = append(history, e)
+		}
+	}
+	return s, history, nil
+}
+
+func (h *tailHub) unsubscribe(logstore string, s *tailStream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.streams--
+	if h.tenantStreams[s.tenant]--; h.tenantStreams[s.tenant] <= 0 {
+		delete(h.tenantStreams, s.tenant)
+	}
+	if elem, ok := h.logstores[logstore]; ok {
+		delete(elem.Value.(*tailLogstore).streams, s)
+	}
+}
+
+// close ends the tails, for the server to shut down.
+func (h *tailHub) close() {
+	close(h.done)
+}
+
+// serve streams the events of logstore to the client of tenant, the last ones first, until it disconnects, the max
+// duration elapses or the hub is closed.
+func (h *tailHub) serve(w http.ResponseWriter, req *http.Request, logstore, tenant string) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("streaming not supported")
+	}
+	s, history, err := h.subscribe(logstore, tenant)
+	if err != nil {
+		return err
+	}
+	defer h.unsubscribe(logstore, s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	for _, e := range history {
+		if err = writeTailEvent(w, e.name, e.data); err != nil {
+			return nil
+		}
+	}
+	flusher.Flush()
+
+	limiter := rate.NewLimiter(rate.Limit(h.settings.RecordsPerSecond), int(h.settings.RecordsPerSecond)+1)
+	end := time.NewTimer(h.settings.MaxDuration)
+	defer end.Stop()
+	heartbeat := time.NewTicker(tailHeartbeatInterval)
+	defer heartbeat.Stop()
+	droppedTicker := time.NewTicker(tailDroppedInterval)
+	defer droppedTicker.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return nil
+		case <-h.done:
+			return nil
+		case <-end.C:
+			return nil
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": keepalive\n\n")
+		case <-droppedTicker.C:
+			if dropped := atomic.SwapInt64(&s.dropped, 0); dropped > 0 {
+				err = writeTailEvent(w, tailEventDropped, []byte(fmt.Sprintf(`{"count":%d}`, dropped)))
+			}
+		case e := <-s.events:
+			if !limiter.Allow() {
+				atomic.AddInt64(&s.dropped, 1)
+				continue
+			}
+			err = writeTailEvent(w, e.name, e.data)
+		}
+		if err != nil {
+			return nil
+		}
+		flusher.Flush()
+	}
+}
+
+func writeTailEvent(w http.ResponseWriter, name string, data []byte) error {
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
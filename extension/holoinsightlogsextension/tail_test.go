@@ -0,0 +1,282 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/extension/auth"
+	"go.uber.org/zap"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+)
+
+func testTailSettings() TailSettings {
+	settings := createDefaultConfig().(*Config).Tail
+	settings.AdminTenants = []string{"admin"}
+	return settings
+}
+
+// contentOf returns the content of the record of the event.
+func contentOf(t *testing.T, e tailEvent) string {
+	var r Record
+	require.NoError(t, json.Unmarshal(e.data, &r))
+	return r.Fields["content"]
+}
+
+// receivedContents returns the contents of the records the stream received.
+func receivedContents(t *testing.T, s *tailStream) []string {
+	var contents []string
+	for {
+		select {
+		case e := <-s.events:
+			contents = append(contents, contentOf(t, e))
+		default:
+			return contents
+		}
+	}
+}
+
+func historyContents(t *testing.T, history []tailEvent) []string {
+	var contents []string
+	for _, e := range history {
+		contents = append(contents, contentOf(t, e))
+	}
+	return contents
+}
+
+func TestTailHubTenants(t *testing.T) {
+	h := newTailHub(testTailSettings())
+	a, _, err := h.subscribe("store", "a")
+	require.NoError(t, err)
+	b, _, err := h.subscribe("store", "b")
+	require.NoError(t, err)
+	admin, _, err := h.subscribe("store", "admin")
+	require.NoError(t, err)
+
+	h.publish("store", "a", payloadOf("a1", "a2"), time.Now())
+	h.publish("store", "b", payloadOf("b1"), time.Now())
+	h.publish("other", "a", payloadOf("a3"), time.Now())
+	assert.Equal(t, []string{"a1", "a2"}, receivedContents(t, a))
+	assert.Equal(t, []string{"b1"}, receivedContents(t, b))
+	assert.Equal(t, []string{"a1", "a2", "b1"}, receivedContents(t, admin))
+
+	// the history is filtered the same way
+	_, history, err := h.subscribe("store", "b")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b1"}, historyContents(t, history))
+	_, history, err = h.subscribe("store", "admin")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a1", "a2", "b1"}, historyContents(t, history))
+}
+
+func TestTailHubHistory(t *testing.T) {
+	settings := testTailSettings()
+	settings.Size = 3
+	h := newTailHub(settings)
+	h.publish("store", "a", payloadOf("a1", "a2"), time.Now())
+	h.publish("store", "a", payloadOf("a3"), time.Now())
+	_, history, err := h.subscribe("store", "a")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a1", "a2", "a3"}, historyContents(t, history))
+
+	// the ring keeps the last events, oldest first
+	h.publish("store", "a", payloadOf("a4"), time.Now())
+	h.publish("store", "a", payloadOf("a5", "a6", "a7", "a8"), time.Now())
+	_, history, err = h.subscribe("store", "a")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a6", "a7", "a8"}, historyContents(t, history))
+
+	h.publishError("store", "a", errors.New("invalid body"), time.Now())
+	_, history, err = h.subscribe("store", "admin")
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, tailEventError, history[2].name)
+	assert.Contains(t, string(history[2].data), "invalid body")
+}
+
+func TestTailHubStreamLimits(t *testing.T) {
+	settings := testTailSettings()
+	settings.MaxStreamsPerTenant = 1
+	settings.MaxStreams = 2
+	h := newTailHub(settings)
+	a, _, err := h.subscribe("store", "a")
+	require.NoError(t, err)
+	_, _, err = h.subscribe("other", "a")
+	assert.ErrorIs(t, err, errTailTooManyStreams)
+	_, _, err = h.subscribe("store", "b")
+	require.NoError(t, err)
+	_, _, err = h.subscribe("store", "c")
+	assert.ErrorIs(t, err, errTailTooManyStreams)
+
+	h.unsubscribe("store", a)
+	_, _, err = h.subscribe("store", "c")
+	require.NoError(t, err)
+}
+
+func TestTailHubForgetsLogstores(t *testing.T) {
+	settings := testTailSettings()
+	settings.MaxLogstores = 1
+	h := newTailHub(settings)
+	_, _, err := h.subscribe("tailed", "a")
+	require.NoError(t, err)
+	h.publish("store", "a", payloadOf("a1"), time.Now())
+	h.publish("other", "a", payloadOf("a2"), time.Now())
+	_, history, err := h.subscribe("other", "a")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a2"}, historyContents(t, history))
+
+	// the logstores with tails are kept, the last one too
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	assert.Len(t, h.logstores, 2)
+	assert.Contains(t, h.logstores, "tailed")
+	assert.Contains(t, h.logstores, "other")
+}
+
+func TestTailHubSlowStream(t *testing.T) {
+	h := newTailHub(testTailSettings())
+	s, _, err := h.subscribe("store", "a")
+	require.NoError(t, err)
+	for i := 0; i < tailStreamBuffer+3; i++ {
+		h.publish("store", "a", payloadOf("a"), time.Now())
+	}
+	assert.Len(t, s.events, tailStreamBuffer)
+	assert.EqualValues(t, 3, s.dropped)
+}
+
+// testTailAuth authenticates the tenant of the X-Tenant header.
+var testTailAuth = auth.NewServer(auth.WithServerAuthenticate(func(ctx context.Context, headers map[string][]string) (context.Context, error) {
+	tenant := headers["X-Tenant"]
+	if len(tenant) == 0 {
+		return ctx, errors.New("missing tenant")
+	}
+	return client.NewContext(ctx, client.Info{Auth: tailAuthData{tenantauth.AttributeTenant: tenant[0]}}), nil
+}))
+
+type tailAuthData map[string]interface{}
+
+func (a tailAuthData) GetAttribute(name string) interface{} {
+	return a[name]
+}
+
+func (a tailAuthData) GetAttributeNames() []string {
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	return names
+}
+
+// newTestTailServer serves the tails of the hub.
+func newTestTailServer(t *testing.T, h *tailHub) *httptest.Server {
+	l := &logsExtension{cfg: createDefaultConfig().(*Config), logger: zap.NewNop(), tail: h, tailAuth: testTailAuth}
+	router := mux.NewRouter()
+	router.HandleFunc(tailRoute, l.handleTail).Methods(http.MethodGet)
+	server := httptest.NewServer(router)
+	t.Cleanup(func() {
+		h.close()
+		server.Close()
+	})
+	return server
+}
+
+func tail(t *testing.T, server *httptest.Server, logstore, tenant string) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/logstores/"+logstore+"/tail", nil)
+	require.NoError(t, err)
+	if tenant != "" {
+		req.Header.Set("X-Tenant", tenant)
+	}
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// readTailEvent returns the name and data of the next event of the stream, skipping the comments.
+func readTailEvent(t *testing.T, r *bufio.Reader) (string, string) {
+	var name, data string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, data
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestTailServe(t *testing.T) {
+	settings := testTailSettings()
+	settings.RecordsPerSecond = 1
+	h := newTailHub(settings)
+	server := newTestTailServer(t, h)
+	h.publish("store", "a", payloadOf("a1"), time.Now())
+	h.publish("store", "b", payloadOf("b1"), time.Now())
+
+	resp := tail(t, server, "store", "a")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	r := bufio.NewReader(resp.Body)
+	name, data := readTailEvent(t, r)
+	assert.Equal(t, tailEventRecord, name)
+	assert.Contains(t, data, `"a1"`)
+
+	// the stream is subscribed once the history is sent, a burst of 2 records is allowed, the others dropped
+	h.publish("store", "b", payloadOf("b2"), time.Now())
+	h.publish("store", "a", payloadOf("a2", "a3", "a4", "a5", "a6"), time.Now())
+	for _, content := range []string{"a2", "a3"} {
+		name, data = readTailEvent(t, r)
+		assert.Equal(t, tailEventRecord, name)
+		assert.Contains(t, data, `"`+content+`"`)
+	}
+	name, data = readTailEvent(t, r)
+	assert.Equal(t, tailEventDropped, name)
+	assert.JSONEq(t, `{"count":3}`, data)
+}
+
+func TestTailServeLimits(t *testing.T) {
+	settings := testTailSettings()
+	settings.MaxStreamsPerTenant = 1
+	settings.MaxStreams = 2
+	server := newTestTailServer(t, newTailHub(settings))
+
+	assert.Equal(t, http.StatusUnauthorized, tail(t, server, "store", "").StatusCode)
+	require.Equal(t, http.StatusOK, tail(t, server, "store", "a").StatusCode)
+	resp := tail(t, server, "other", "a")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+	require.Equal(t, http.StatusOK, tail(t, server, "store", "b").StatusCode)
+	resp = tail(t, server, "store", "c")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+}
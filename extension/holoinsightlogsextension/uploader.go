@@ -15,32 +15,76 @@
 package holoinsightlogsextension // import "github.com/open-telemetry/opentelemetry-collector-contrib/exporter/alibabacloudlogserviceexporter"
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
 	"os"
+	"time"
 
 	sls "github.com/aliyun/aliyun-log-go-sdk"
-	"github.com/aliyun/aliyun-log-go-sdk/producer"
+	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.uber.org/zap"
+
+	"github.com/traas-stack/holoinsight-collector/internal/webtracking"
+)
+
+const (
+	// PutLogs limits of a log group: https://www.alibabacloud.com/help/en/sls/developer-reference/api-putlogs
+	maxLogGroupCount = 4096
+	maxLogGroupSize  = 5 * 1024 * 1024
 )
 
+// errLogTooLarge rejects the logs over the size of a log group.
+var errLogTooLarge = errors.New("log exceeds the PutLogs size limit")
+
+// permanentErrors are the error codes of the PutLogs SLS refuses whatever the retries, e.g. of a missing logstore
+// or a malformed log group. The throttled and unauthorized ones are retried.
+var permanentErrors = map[string]bool{
+	"ProjectNotExist":         true,
+	"LogStoreNotExist":        true,
+	"ParameterInvalid":        true,
+	"PostBodyInvalid":         true,
+	"PostBodyTooLarge":        true,
+	"PostBodyUncompressError": true,
+}
+
 // LogServiceClient log Service's client wrapper
 type LogServiceClient interface {
-	// SendLogs send message to LogService
-	SendLogs(logs []*sls.Log) error
-	SetLogStore(logstore string)
-	SetTopic(topic string)
-	SetSource(source string)
+	// SendLogs send message to LogService, with the topic, source and tags of the request, the hostname and IP address
+	// of the collector when empty. The logs are split into log groups within the PutLogs limits, and stored once
+	// it returns.
+	SendLogs(topic, source string, tags []*sls.LogTag, logs []*sls.Log) error
+	// Close stops the client
+	Close() error
+}
+
+// slsSink is the Sink of a logstore stored in its SLS project. Its logs are stored by PutLogs once Send returns.
+type slsSink struct {
+	client LogServiceClient
+}
+
+func (s *slsSink) Send(_ context.Context, _ string, payload *webtracking.Payload, now time.Time) error {
+	logs, tags := dataToSLSLogs(payload, now)
+	if len(logs) == 0 {
+		return nil
+	}
+	return s.client.SendLogs(payload.Topic, payload.Source, tags, logs)
+}
+
+func (s *slsSink) Write(ctx context.Context, logstore string, payload *webtracking.Payload, now time.Time) error {
+	return s.Send(ctx, logstore, payload, now)
 }
 
 type logServiceClientImpl struct {
-	clientInstance *producer.Producer
-	project        string
-	logstore       string
-	topic          string
-	source         string
-	logger         *zap.Logger
+	clientInstance sls.ClientInterface
+	// shutdown stops the refresh of the STS tokens, nil without them.
+	shutdown chan struct{}
+	project  string
+	logstore string
+	topic    string
+	source   string
+	logger   *zap.Logger
 }
 
 func getIPAddress() (ipAddress string, err error) {
@@ -60,57 +104,112 @@ func NewLogServiceClient(config *SLSConfig, logger *zap.Logger) (LogServiceClien
 	if config == nil || config.Endpoint == "" || config.Project == "" {
 		return nil, errors.New("[holoinsightlogsextension] missing logservice params: Endpoint, Project")
 	}
+	client := sls.CreateNormalInterface(config.Endpoint, config.AccessKeyID, config.AccessKeySecret, "")
+	return newLogServiceClient(config, client, nil, logger), nil
+}
 
-	producerConfig := producer.GetDefaultProducerConfig()
-	producerConfig.Endpoint = config.Endpoint
-	producerConfig.AccessKeyID = config.AccessKeyID
-	producerConfig.AccessKeySecret = config.AccessKeySecret
+// NewSTSLogServiceClient creates a Log Service client authenticated by STS tokens, refreshed with updateToken
+// before they expire.
+func NewSTSLogServiceClient(config *SLSConfig, updateToken sls.UpdateTokenFunction, logger *zap.Logger) (LogServiceClient, error) {
+	if config == nil || config.Endpoint == "" || config.Project == "" {
+		return nil, errors.New("[holoinsightlogsextension] missing logservice params: Endpoint, Project")
+	}
+	shutdown := make(chan struct{})
+	client, err := sls.CreateTokenAutoUpdateClient(config.Endpoint, updateToken, shutdown)
+	if err != nil {
+		return nil, err
+	}
+	return newLogServiceClient(config, client, shutdown, logger), nil
+}
 
+func newLogServiceClient(config *SLSConfig, client sls.ClientInterface, shutdown chan struct{}, logger *zap.Logger) LogServiceClient {
 	c := &logServiceClientImpl{
 		project:        config.Project,
-		clientInstance: producer.InitProducer(producerConfig),
+		clientInstance: client,
+		shutdown:       shutdown,
 		logger:         logger,
 		logstore:       config.Logstore,
 	}
-	c.clientInstance.Start()
 	// do not return error if get hostname or ip address fail
 	c.topic, _ = os.Hostname()
 	c.source, _ = getIPAddress()
 	logger.Info("[holoinsightlogsextension] Create LogService client success", zap.String("project", config.Project), zap.String("logstore", config.Logstore))
-	return c, nil
+	return c
 }
 
-// SendLogs send message to LogService
-func (c *logServiceClientImpl) SendLogs(logs []*sls.Log) error {
+// SendLogs send message to LogService. The logs over the size of a log group are dropped, failing with errLogTooLarge
+// once the others are sent. The logs SLS refuses fail permanently, see permanentErrors.
+func (c *logServiceClientImpl) SendLogs(topic, source string, tags []*sls.LogTag, logs []*sls.Log) error {
 	if c.logstore == "" {
 		return errors.New("[holoinsightlogsextension] missing logservice params: LogStore")
 	}
-	return c.clientInstance.SendLogListWithCallBack(c.project, c.logstore, c.topic, c.source, logs, c)
-}
-
-// Success is impl of producer.CallBack
-func (c *logServiceClientImpl) Success(*producer.Result) {
-	c.logger.Info(fmt.Sprintf("Write successed, project: %s, logstore: %s", c.project, c.logstore))
-}
+	if topic == "" {
+		topic = c.topic
+	}
+	if source == "" {
+		source = c.source
+	}
 
-// Fail is impl of producer.CallBack
-func (c *logServiceClientImpl) Fail(result *producer.Result) {
-	c.logger.Warn("[holoinsightlogsextension] Send to LogService failed",
-		zap.String("project", c.project),
-		zap.String("store", c.logstore),
-		zap.String("code", result.GetErrorCode()),
-		zap.String("error_message", result.GetErrorMessage()),
-		zap.String("request_id", result.GetRequestId()))
+	groups, dropped := splitLogGroups(topic, source, tags, logs)
+	for _, group := range groups {
+		if err := c.clientInstance.PutLogs(c.project, c.logstore, group); err != nil {
+			c.logger.Warn("[holoinsightlogsextension] Send to LogService failed",
+				zap.String("project", c.project),
+				zap.String("store", c.logstore),
+				zap.Int("logs", len(group.Logs)),
+				zap.Error(err))
+			return putLogsError(err)
+		}
+	}
+	if dropped > 0 {
+		return fmt.Errorf("%d of %d logs dropped: %w", dropped, len(logs), errLogTooLarge)
+	}
+	return nil
 }
 
-func (c *logServiceClientImpl) SetLogStore(logstore string) {
-	c.logstore = logstore
+// Close stops the client
+func (c *logServiceClientImpl) Close() error {
+	if c.shutdown != nil {
+		close(c.shutdown)
+	}
+	return c.clientInstance.Close()
 }
 
-func (c *logServiceClientImpl) SetTopic(topic string) {
-	c.topic = topic
+// putLogsError is the error of a log group PutLogs failed to store, permanent when SLS refused it.
+func putLogsError(err error) error {
+	var slsErr *sls.Error
+	if errors.As(err, &slsErr) && permanentErrors[slsErr.Code] {
+		return consumererror.NewPermanent(err)
+	}
+	return err
 }
 
-func (c *logServiceClientImpl) SetSource(source string) {
-	c.source = source
+// splitLogGroups groups logs into log groups of at most maxLogGroupCount logs and maxLogGroupSize bytes, dropping
+// the logs too large for any group.
+func splitLogGroups(topic, source string, tags []*sls.LogTag, logs []*sls.Log) (groups []*sls.LogGroup, dropped int) {
+	newGroup := func() *sls.LogGroup {
+		return &sls.LogGroup{Topic: &topic, Source: &source, LogTags: tags}
+	}
+	group := newGroup()
+	// the size of a log in a group is the size of the log, its tag and its length
+	overhead := group.Size()
+	size := overhead
+	for _, log := range logs {
+		logSize := (&sls.LogGroup{Logs: []*sls.Log{log}}).Size()
+		if overhead+logSize > maxLogGroupSize {
+			dropped++
+			continue
+		}
+		if len(group.Logs) == maxLogGroupCount || size+logSize > maxLogGroupSize {
+			groups = append(groups, group)
+			group = newGroup()
+			size = overhead
+		}
+		group.Logs = append(group.Logs, log)
+		size += logSize
+	}
+	if len(group.Logs) > 0 {
+		groups = append(groups, group)
+	}
+	return groups, dropped
 }
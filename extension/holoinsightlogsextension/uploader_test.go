@@ -0,0 +1,141 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsextension
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	sls "github.com/aliyun/aliyun-log-go-sdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+func testLog(content string) *sls.Log {
+	return &sls.Log{
+		Time:     proto.Uint32(1700000000),
+		Contents: []*sls.LogContent{{Key: proto.String("content"), Value: proto.String(content)}},
+	}
+}
+
+func TestSplitLogGroups(t *testing.T) {
+	small := testLog("small")
+	large := testLog(strings.Repeat("x", maxLogGroupSize/3))
+	oversized := testLog(strings.Repeat("x", maxLogGroupSize))
+	tags := []*sls.LogTag{{Key: proto.String("app"), Value: proto.String("shop")}}
+
+	many := make([]*sls.Log, 2*maxLogGroupCount+1)
+	for i := range many {
+		many[i] = small
+	}
+	for _, tc := range []struct {
+		name    string
+		logs    []*sls.Log
+		sizes   []int
+		dropped int
+	}{
+		{name: "empty"},
+		{name: "one group", logs: []*sls.Log{small, small}, sizes: []int{2}},
+		{name: "count limit", logs: many, sizes: []int{maxLogGroupCount, maxLogGroupCount, 1}},
+		{name: "size limit", logs: []*sls.Log{large, large, small, large, large}, sizes: []int{3, 2}},
+		{name: "oversized log", logs: []*sls.Log{small, oversized, small}, sizes: []int{2}, dropped: 1},
+		{name: "only oversized logs", logs: []*sls.Log{oversized}, dropped: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			groups, dropped := splitLogGroups("topic", "source", tags, tc.logs)
+			assert.Equal(t, tc.dropped, dropped)
+			sizes := make([]int, 0, len(groups))
+			for _, group := range groups {
+				sizes = append(sizes, len(group.Logs))
+				assert.Equal(t, "topic", group.GetTopic())
+				assert.Equal(t, "source", group.GetSource())
+				assert.Equal(t, tags, group.LogTags)
+				assert.LessOrEqual(t, group.Size(), maxLogGroupSize)
+			}
+			if tc.sizes == nil {
+				tc.sizes = []int{}
+			}
+			assert.Equal(t, tc.sizes, sizes)
+		})
+	}
+}
+
+// putLogsClient records the log groups put, failing with err.
+type putLogsClient struct {
+	sls.ClientInterface
+	groups []*sls.LogGroup
+	err    error
+}
+
+func (c *putLogsClient) PutLogs(_, _ string, group *sls.LogGroup) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.groups = append(c.groups, group)
+	return nil
+}
+
+func (c *putLogsClient) Close() error {
+	return nil
+}
+
+func TestSendLogs(t *testing.T) {
+	config := &SLSConfig{Project: "project", Logstore: "store"}
+	tags := []*sls.LogTag{{Key: proto.String("app"), Value: proto.String("shop")}}
+
+	client := &putLogsClient{}
+	c := newLogServiceClient(config, client, nil, zap.NewNop())
+	require.NoError(t, c.SendLogs("topic", "source", tags, []*sls.Log{testLog("a"), testLog("b")}))
+	require.Len(t, client.groups, 1)
+	assert.Len(t, client.groups[0].Logs, 2)
+	assert.Equal(t, tags, client.groups[0].LogTags)
+
+	// the logs too large are dropped, the others sent
+	err := c.SendLogs("topic", "source", tags, []*sls.Log{testLog("c"), testLog(strings.Repeat("x", maxLogGroupSize))})
+	assert.ErrorIs(t, err, errLogTooLarge)
+	assert.Len(t, client.groups, 2)
+
+	for _, tc := range []struct {
+		name      string
+		err       error
+		permanent bool
+	}{
+		{name: "missing logstore", err: &sls.Error{HTTPCode: 404, Code: "LogStoreNotExist"}, permanent: true},
+		{name: "throttled", err: &sls.Error{HTTPCode: 403, Code: "WriteQuotaExceed"}},
+		{name: "network", err: errors.New("connection refused")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newLogServiceClient(config, &putLogsClient{err: tc.err}, nil, zap.NewNop())
+			err := c.SendLogs("topic", "source", tags, []*sls.Log{testLog("a")})
+			assert.ErrorIs(t, err, tc.err)
+			assert.Equal(t, tc.permanent, consumererror.IsPermanent(err))
+		})
+	}
+}
+
+func TestCloseStopsTokenRefresh(t *testing.T) {
+	shutdown := make(chan struct{})
+	c := newLogServiceClient(&SLSConfig{Project: "project", Logstore: "store"}, &putLogsClient{}, shutdown, zap.NewNop())
+	require.NoError(t, c.Close())
+	select {
+	case <-shutdown:
+	default:
+		t.Fatal("the refresh of the STS tokens isn't stopped")
+	}
+}
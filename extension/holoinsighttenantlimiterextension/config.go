@@ -0,0 +1,71 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsighttenantlimiterextension
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
+)
+
+// Config defines configuration for the holoinsight_tenant_limiter extension.
+type Config struct {
+	// Default are the limits of the tenants missing from Tenants, and of the data of no tenant.
+	Default tenantlimit.Limits `mapstructure:"default"`
+	// Tenants are the limits of each tenant.
+	Tenants map[string]tenantlimit.Limits `mapstructure:"tenants"`
+	// ProfileQuotas overrides the configured limits with the quotas of the tenant profile, the "quota.*"
+	// attributes of the authenticator, e.g. quota.spans_per_second. Default: true
+	ProfileQuotas bool `mapstructure:"profile_quotas"`
+	// Storage is the storage extension the daily usage is persisted to, so the daily quotas survive restarts.
+	// The usage is kept in memory only when not set.
+	Storage *component.ID `mapstructure:"storage"`
+	// PersistInterval is how often the daily usage is persisted. Default: 10s
+	PersistInterval time.Duration `mapstructure:"persist_interval"`
+}
+
+var _ component.Config = (*Config)(nil)
+
+// Validate checks the configuration is usable.
+func (cfg *Config) Validate() error {
+	if err := validateLimits(cfg.Default); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for tenant, limits := range cfg.Tenants {
+		if err := validateLimits(limits); err != nil {
+			return fmt.Errorf("tenant %q: %w", tenant, err)
+		}
+	}
+	if cfg.Storage != nil && cfg.PersistInterval <= 0 {
+		return errors.New("persist_interval must be positive")
+	}
+	return nil
+}
+
+func validateLimits(l tenantlimit.Limits) error {
+	for _, r := range []tenantlimit.Rate{l.Spans, l.DataPoints, l.Logs, l.Bytes} {
+		if r.PerSecond < 0 || r.Burst < 0 {
+			return errors.New("rates and bursts must not be negative")
+		}
+	}
+	if l.Daily.Spans < 0 || l.Daily.DataPoints < 0 || l.Daily.Logs < 0 || l.Daily.Bytes < 0 {
+		return errors.New("daily quotas must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsighttenantlimiterextension
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/extension"
+	"go.opentelemetry.io/collector/extension/experimental/storage"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
+)
+
+// usageKey is the storage key of the daily usage.
+const usageKey = "daily_usage"
+
+// limiterExtension throttles the data of each tenant to its limits, on behalf of the receivers.
+type limiterExtension struct {
+	cfg     *Config
+	id      component.ID
+	logger  *zap.Logger
+	buckets *tenantlimit.Buckets
+
+	client storage.Client
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+var (
+	_ extension.Extension = (*limiterExtension)(nil)
+	_ tenantlimit.Limiter = (*limiterExtension)(nil)
+)
+
+func newExtension(cfg *Config, params extension.CreateSettings) *limiterExtension {
+	return &limiterExtension{
+		cfg:     cfg,
+		id:      params.ID,
+		logger:  params.Logger,
+		buckets: tenantlimit.NewBuckets(),
+		done:    make(chan struct{}),
+	}
+}
+
+func (e *limiterExtension) Start(ctx context.Context, host component.Host) error {
+	if e.cfg.Storage == nil {
+		return nil
+	}
+	ext, ok := host.GetExtensions()[*e.cfg.Storage]
+	if !ok {
+		return fmt.Errorf("storage %q not found", e.cfg.Storage)
+	}
+	storageExt, ok := ext.(storage.Extension)
+	if !ok {
+		return fmt.Errorf("extension %q is not a storage extension", e.cfg.Storage)
+	}
+	c, err := storageExt.GetClient(ctx, component.KindExtension, e.id, "")
+	if err != nil {
+		return err
+	}
+	e.client = c
+
+	data, err := c.Get(ctx, usageKey)
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		var usage tenantlimit.Usage
+		if err = json.Unmarshal(data, &usage); err != nil {
+			e.logger.Warn("[holoinsighttenantlimiterextension] invalid persisted daily usage, starting over", zap.Error(err))
+		} else {
+			e.buckets.Restore(usage)
+		}
+	}
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		ticker := time.NewTicker(e.cfg.PersistInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := e.persist(context.Background()); err != nil {
+					e.logger.Warn("[holoinsighttenantlimiterextension] failed to persist the daily usage", zap.Error(err))
+				}
+			case <-e.done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (e *limiterExtension) Shutdown(ctx context.Context) error {
+	if e.client == nil {
+		return nil
+	}
+	close(e.done)
+	e.wg.Wait()
+	return multierr.Append(e.persist(ctx), e.client.Close(ctx))
+}
+
+func (e *limiterExtension) persist(ctx context.Context) error {
+	data, err := json.Marshal(e.buckets.Usage())
+	if err != nil {
+		return err
+	}
+	return e.client.Set(ctx, usageKey, data)
+}
+
+// Admit implements tenantlimit.Limiter.
+func (e *limiterExtension) Admit(ctx context.Context, tenant, signal string, items, bytes int) error {
+	err := e.buckets.Admit(tenant, e.limits(ctx, tenant), signal, items, bytes)
+	var throttled *tenantlimit.ThrottledError
+	if errors.As(err, &throttled) {
+		recordThrottled(tenant, signal, throttled.Reason, items)
+		e.logger.Debug("[holoinsighttenantlimiterextension] throttled", zap.Error(err))
+	}
+	return err
+}
+
+// limits returns the configured limits of tenant, overridden by the quotas of its profile when tenant is the one
+// authenticated in ctx.
+func (e *limiterExtension) limits(ctx context.Context, tenant string) tenantlimit.Limits {
+	limits, ok := e.cfg.Tenants[tenant]
+	if !ok {
+		limits = e.cfg.Default
+	}
+	auth := client.FromContext(ctx).Auth
+	if !e.cfg.ProfileQuotas || auth == nil || tenantauth.Tenant(ctx) != tenant {
+		return limits
+	}
+	return limits.WithQuotas(func(name string) (float64, bool) {
+		value, ok := auth.GetAttribute(tenantauth.QuotaPrefix + name).(string)
+		if !ok {
+			return 0, false
+		}
+		quota, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return quota, err == nil
+	})
+}
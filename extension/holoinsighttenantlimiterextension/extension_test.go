@@ -0,0 +1,208 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsighttenantlimiterextension
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/extension/experimental/storage"
+	"go.opentelemetry.io/collector/extension/extensiontest"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
+)
+
+func startLimiter(t *testing.T, cfg *Config, host component.Host) *limiterExtension {
+	e := newExtension(cfg, extensiontest.NewNopCreateSettings())
+	require.NoError(t, e.Start(context.Background(), host))
+	return e
+}
+
+func throttleReason(err error) string {
+	var throttled *tenantlimit.ThrottledError
+	if errors.As(err, &throttled) {
+		return throttled.Reason
+	}
+	return ""
+}
+
+func TestDailyUsagePersisted(t *testing.T) {
+	storageID := component.NewID("test_storage")
+	host := &storageHost{
+		Host:       componenttest.NewNopHost(),
+		extensions: map[component.ID]component.Component{storageID: &memoryStorage{}},
+	}
+	cfg := createDefaultConfig().(*Config)
+	cfg.Default.Daily.Spans = 10
+	cfg.Storage = &storageID
+
+	e := startLimiter(t, cfg, host)
+	require.NoError(t, e.Admit(context.Background(), "t1", tenantauth.SignalTraces, 8, 100))
+	require.NoError(t, e.Shutdown(context.Background()))
+
+	// the usage of the day survives the restart
+	restarted := startLimiter(t, cfg, host)
+	defer func() {
+		require.NoError(t, restarted.Shutdown(context.Background()))
+	}()
+	err := restarted.Admit(context.Background(), "t1", tenantauth.SignalTraces, 5, 100)
+	assert.Equal(t, tenantlimit.ReasonDailyQuota, throttleReason(err))
+	assert.NoError(t, restarted.Admit(context.Background(), "t1", tenantauth.SignalTraces, 2, 100))
+}
+
+func TestDailyUsageNotPersisted(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.Default.Daily.Spans = 10
+
+	e := startLimiter(t, cfg, componenttest.NewNopHost())
+	require.NoError(t, e.Admit(context.Background(), "t1", tenantauth.SignalTraces, 8, 100))
+	require.NoError(t, e.Shutdown(context.Background()))
+
+	restarted := startLimiter(t, cfg, componenttest.NewNopHost())
+	assert.NoError(t, restarted.Admit(context.Background(), "t1", tenantauth.SignalTraces, 5, 100))
+	require.NoError(t, restarted.Shutdown(context.Background()))
+}
+
+func TestStorageNotFound(t *testing.T) {
+	storageID := component.NewID("test_storage")
+	cfg := createDefaultConfig().(*Config)
+	cfg.Storage = &storageID
+	e := newExtension(cfg, extensiontest.NewNopCreateSettings())
+	assert.Error(t, e.Start(context.Background(), componenttest.NewNopHost()))
+}
+
+func TestTenantBuckets(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.Default.Spans = tenantlimit.Rate{PerSecond: 1, Burst: 10}
+	cfg.Tenants = map[string]tenantlimit.Limits{"big": {Spans: tenantlimit.Rate{PerSecond: 1, Burst: 100}}}
+	e := startLimiter(t, cfg, componenttest.NewNopHost())
+	defer func() {
+		require.NoError(t, e.Shutdown(context.Background()))
+	}()
+
+	// the tenants resolved for requests which aren't authenticated have buckets and limits of their own
+	require.NoError(t, e.Admit(context.Background(), "t1", tenantauth.SignalTraces, 10, 100))
+	assert.Equal(t, tenantlimit.ReasonRate, throttleReason(e.Admit(context.Background(), "t1", tenantauth.SignalTraces, 10, 100)))
+	assert.NoError(t, e.Admit(context.Background(), "t2", tenantauth.SignalTraces, 10, 100))
+	assert.NoError(t, e.Admit(context.Background(), "big", tenantauth.SignalTraces, 50, 100))
+}
+
+// quotaAuthData is the auth data of a tenant with a profile quota.
+type quotaAuthData struct{}
+
+func (quotaAuthData) GetAttribute(name string) interface{} {
+	switch name {
+	case tenantauth.AttributeTenant:
+		return "t1"
+	case tenantauth.QuotaPrefix + "daily_spans":
+		return "3"
+	}
+	return nil
+}
+
+func (quotaAuthData) GetAttributeNames() []string {
+	return []string{tenantauth.AttributeTenant, tenantauth.QuotaPrefix + "daily_spans"}
+}
+
+func TestProfileQuotas(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.Tenants = map[string]tenantlimit.Limits{"t1": {Daily: tenantlimit.Quota{Spans: 10}}}
+	e := startLimiter(t, cfg, componenttest.NewNopHost())
+	defer func() {
+		require.NoError(t, e.Shutdown(context.Background()))
+	}()
+
+	ctx := client.NewContext(context.Background(), client.Info{Auth: quotaAuthData{}})
+	err := e.Admit(ctx, "t1", tenantauth.SignalTraces, 5, 100)
+	assert.Equal(t, tenantlimit.ReasonDailyQuota, throttleReason(err))
+
+	// the quotas of the profile are not applied to the data of another tenant
+	assert.NoError(t, e.Admit(ctx, "t2", tenantauth.SignalTraces, 5, 100))
+
+	cfg.ProfileQuotas = false
+	assert.NoError(t, e.Admit(ctx, "t1", tenantauth.SignalTraces, 5, 100))
+}
+
+// storageHost is a host with a storage extension.
+type storageHost struct {
+	component.Host
+	extensions map[component.ID]component.Component
+}
+
+func (h *storageHost) GetExtensions() map[component.ID]component.Component {
+	return h.extensions
+}
+
+// memoryStorage is a storage extension keeping the data in memory, shared by its clients.
+type memoryStorage struct {
+	component.StartFunc
+	component.ShutdownFunc
+
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (s *memoryStorage) GetClient(context.Context, component.Kind, component.ID, string) (storage.Client, error) {
+	return s, nil
+}
+
+func (s *memoryStorage) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data[key], nil
+}
+
+func (s *memoryStorage) Set(_ context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		s.data = make(map[string][]byte)
+	}
+	s.data[key] = value
+	return nil
+}
+
+func (s *memoryStorage) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *memoryStorage) Batch(ctx context.Context, ops ...storage.Operation) error {
+	for _, op := range ops {
+		switch op.Type {
+		case storage.Get:
+			op.Value, _ = s.Get(ctx, op.Key)
+		case storage.Set:
+			_ = s.Set(ctx, op.Key, op.Value)
+		case storage.Delete:
+			_ = s.Delete(ctx, op.Key)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStorage) Close(context.Context) error {
+	return nil
+}
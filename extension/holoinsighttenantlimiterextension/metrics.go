@@ -0,0 +1,59 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsighttenantlimiterextension
+
+import (
+	"context"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+var (
+	tagTenant = tag.MustNewKey("tenant")
+	tagSignal = tag.MustNewKey("signal")
+	tagReason = tag.MustNewKey("reason")
+
+	mThrottledRequests = stats.Int64("throttled_requests", "Number of requests throttled", stats.UnitDimensionless)
+	mThrottledItems    = stats.Int64("throttled_items", "Number of spans, data points and log records throttled", stats.UnitDimensionless)
+)
+
+// metricViews returns the views of the self-telemetry metrics.
+func metricViews() []*view.View {
+	keys := []tag.Key{tagTenant, tagSignal, tagReason}
+	return []*view.View{
+		{
+			Name:        typeStr + "/" + mThrottledRequests.Name(),
+			Measure:     mThrottledRequests,
+			Description: mThrottledRequests.Description(),
+			TagKeys:     keys,
+			Aggregation: view.Sum(),
+		},
+		{
+			Name:        typeStr + "/" + mThrottledItems.Name(),
+			Measure:     mThrottledItems,
+			Description: mThrottledItems.Description(),
+			TagKeys:     keys,
+			Aggregation: view.Sum(),
+		},
+	}
+}
+
+func recordThrottled(tenant, signal, reason string, items int) {
+	_ = stats.RecordWithTags(context.Background(),
+		[]tag.Mutator{tag.Upsert(tagTenant, tenant), tag.Upsert(tagSignal, signal), tag.Upsert(tagReason, reason)},
+		mThrottledRequests.M(1), mThrottledItems.M(int64(items)))
+}
@@ -0,0 +1,49 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsighttenantresolverextension
+
+import (
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/collector/component"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+)
+
+// Config defines configuration for the holoinsight_tenant_resolver extension.
+type Config struct {
+	// Attribute is the resource attribute the receivers put the tenant in. Default: tenant
+	Attribute string `mapstructure:"attribute"`
+	// Sources are consulted in order, the first one knowing the tenant wins.
+	// Default: the built-in sources, the auth result then the tenant metadata, header and resource attribute
+	// of unauthenticated requests
+	Sources []tenantresolver.SourceSettings `mapstructure:"sources"`
+}
+
+var _ component.Config = (*Config)(nil)
+
+// Validate checks the configuration is usable.
+func (cfg *Config) Validate() error {
+	if cfg.Attribute == "" {
+		return errors.New("attribute must be set")
+	}
+	for i := range cfg.Sources {
+		if err := cfg.Sources[i].Validate(); err != nil {
+			return fmt.Errorf("source %d: %w", i, err)
+		}
+	}
+	return nil
+}
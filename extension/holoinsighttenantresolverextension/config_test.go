@@ -0,0 +1,71 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsighttenantresolverextension
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+)
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		sources []tenantresolver.SourceSettings
+		err     string
+	}{
+		{name: "default"},
+		{
+			name: "client sent when authenticated",
+			sources: []tenantresolver.SourceSettings{
+				{Type: tenantresolver.SourceAuth},
+				{Type: tenantresolver.SourceHeader, Name: "x-tenant", WhenAuthenticated: true},
+			},
+		},
+		{name: "no type", sources: []tenantresolver.SourceSettings{{}}, err: "source 0: source type must be set"},
+		{
+			name:    "unknown type",
+			sources: []tenantresolver.SourceSettings{{Type: tenantresolver.SourceAuth}, {Type: "cookie"}},
+			err:     `source 1: unknown source type "cookie"`,
+		},
+		{
+			name:    "static without tenants",
+			sources: []tenantresolver.SourceSettings{{Type: tenantresolver.SourceStatic}},
+			err:     "source 0: static source requires listeners or paths",
+		},
+		{
+			name:    "default without value",
+			sources: []tenantresolver.SourceSettings{{Type: tenantresolver.SourceDefault}},
+			err:     "source 0: default source requires a value",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := createDefaultConfig().(*Config)
+			cfg.Sources = tc.sources
+			err := cfg.Validate()
+			if tc.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.err)
+			}
+		})
+	}
+
+	cfg := createDefaultConfig().(*Config)
+	cfg.Attribute = ""
+	assert.EqualError(t, cfg.Validate(), "attribute must be set")
+}
@@ -0,0 +1,53 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsighttenantresolverextension
+
+import (
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/extension"
+	"go.uber.org/zap"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+)
+
+// resolverExtension resolves the tenant of the data on behalf of the receivers, with its chain of sources.
+type resolverExtension struct {
+	component.StartFunc
+	component.ShutdownFunc
+	*tenantresolver.Chain
+}
+
+var (
+	_ extension.Extension     = (*resolverExtension)(nil)
+	_ tenantresolver.Resolver = (*resolverExtension)(nil)
+)
+
+func newExtension(cfg *Config, params extension.CreateSettings) (*resolverExtension, error) {
+	settings := cfg.Sources
+	if len(settings) == 0 {
+		settings = tenantresolver.BuiltinSources()
+	}
+	chain, err := tenantresolver.NewChain(cfg.Attribute, settings)
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]string, 0, len(settings))
+	for _, s := range settings {
+		sources = append(sources, s.Type)
+	}
+	params.Logger.Info("[holoinsighttenantresolverextension] resolving tenants",
+		zap.String("attribute", cfg.Attribute), zap.Strings("sources", sources))
+	return &resolverExtension{Chain: chain}, nil
+}
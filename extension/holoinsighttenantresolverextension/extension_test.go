@@ -0,0 +1,144 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsighttenantresolverextension
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/extension/extensiontest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+)
+
+// authData is the auth data of a request authenticated as the tenant.
+type authData map[string]string
+
+func (a authData) GetAttribute(name string) interface{} {
+	if v, ok := a[name]; ok {
+		return v
+	}
+	return nil
+}
+
+func (a authData) GetAttributeNames() []string {
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	return names
+}
+
+func authenticated(tenant string) context.Context {
+	return client.NewContext(context.Background(), client.Info{Auth: authData{"tenant": tenant}})
+}
+
+// resolverHost is a host with the extension.
+type resolverHost struct {
+	component.Host
+	extensions map[component.ID]component.Component
+}
+
+func (h *resolverHost) GetExtensions() map[component.ID]component.Component {
+	return h.extensions
+}
+
+func newResolver(t *testing.T, cfg *Config) *resolverExtension {
+	e, err := newExtension(cfg, extensiontest.NewNopCreateSettings())
+	require.NoError(t, err)
+	require.NoError(t, e.Start(context.Background(), componenttest.NewNopHost()))
+	t.Cleanup(func() { require.NoError(t, e.Shutdown(context.Background())) })
+	return e
+}
+
+func TestTenant(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.Sources = []tenantresolver.SourceSettings{
+		{Type: tenantresolver.SourceAuth},
+		{Type: tenantresolver.SourceStatic, Paths: map[string]string{"/v1/logs": "logs-tenant"}},
+		{Type: tenantresolver.SourceHeader, Name: "x-tenant"},
+		{Type: tenantresolver.SourceDefault, Value: "default"},
+	}
+	e := newResolver(t, cfg)
+
+	header := http.Header{}
+	header.Set("x-tenant", "header-tenant")
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		req  tenantresolver.Request
+		want string
+	}{
+		{name: "auth", ctx: authenticated("auth-tenant"), req: tenantresolver.Request{Path: "/v1/logs", Header: header}, want: "auth-tenant"},
+		{name: "static", ctx: context.Background(), req: tenantresolver.Request{Path: "/v1/logs", Header: header}, want: "logs-tenant"},
+		{name: "header", ctx: context.Background(), req: tenantresolver.Request{Path: "/v1/traces", Header: header}, want: "header-tenant"},
+		{name: "default", ctx: context.Background(), req: tenantresolver.Request{Path: "/v1/traces"}, want: "default"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, e.Tenant(tc.ctx, tc.req, pcommon.NewMap()))
+		})
+	}
+	assert.Equal(t, "tenant", e.Attribute())
+}
+
+func TestGateAuthenticated(t *testing.T) {
+	header := http.Header{}
+	header.Set("tenant", "header-tenant")
+	ctx := metadata.NewIncomingContext(authenticated("auth-tenant"), metadata.Pairs("tenant", "metadata-tenant"))
+	resource := pcommon.NewMap()
+	resource.PutStr("tenant", "resource-tenant")
+
+	for _, tc := range []struct {
+		name   string
+		source tenantresolver.SourceSettings
+		want   string
+	}{
+		{name: "header", source: tenantresolver.SourceSettings{Type: tenantresolver.SourceHeader}, want: "auth-tenant"},
+		{name: "metadata", source: tenantresolver.SourceSettings{Type: tenantresolver.SourceMetadata}, want: "auth-tenant"},
+		{name: "resource attribute", source: tenantresolver.SourceSettings{Type: tenantresolver.SourceResourceAttribute}, want: "auth-tenant"},
+		{
+			name:   "header when authenticated",
+			source: tenantresolver.SourceSettings{Type: tenantresolver.SourceHeader, WhenAuthenticated: true},
+			want:   "header-tenant",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// the tenant sent by the client comes first, and yet is ignored for authenticated requests
+			cfg := createDefaultConfig().(*Config)
+			cfg.Sources = []tenantresolver.SourceSettings{tc.source, {Type: tenantresolver.SourceAuth}}
+			id := component.NewID(typeStr)
+			host := &resolverHost{
+				Host:       componenttest.NewNopHost(),
+				extensions: map[component.ID]component.Component{id: newResolver(t, cfg)},
+			}
+			var gate tenantresolver.Gate
+			require.NoError(t, gate.Resolve(host, &id))
+
+			stamped := pcommon.NewMap()
+			resource.CopyTo(stamped)
+			assert.Equal(t, tc.want, gate.Stamp(ctx, tenantresolver.Request{Header: header}, stamped))
+			tenant, _ := stamped.Get("tenant")
+			assert.Equal(t, tc.want, tenant.Str())
+		})
+	}
+}
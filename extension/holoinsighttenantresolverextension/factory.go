@@ -0,0 +1,53 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsighttenantresolverextension
+
+import (
+	"context"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/extension"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+)
+
+const (
+	// The value of extension "type" in configuration.
+	typeStr = "holoinsight_tenant_resolver"
+)
+
+// NewFactory creates a factory for the holoinsight_tenant_resolver extension.
+func NewFactory() extension.Factory {
+	return extension.NewFactory(
+		typeStr,
+		createDefaultConfig,
+		createExtension,
+		component.StabilityLevelAlpha,
+	)
+}
+
+func createDefaultConfig() component.Config {
+	return &Config{
+		Attribute: tenantresolver.DefaultName,
+	}
+}
+
+func createExtension(
+	_ context.Context,
+	params extension.CreateSettings,
+	cfg component.Config,
+) (extension.Extension, error) {
+	return newExtension(cfg.(*Config), params)
+}
@@ -0,0 +1,76 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpforwarderauthextension
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"go.opentelemetry.io/collector/client"
+)
+
+var _ client.AuthData = (*authData)(nil)
+
+// authData is the result of a successful authentication, exposed to receivers through client.Info.Auth.
+// The attribute names are defined by the tenantauth package.
+type authData struct {
+	profile    *tenantProfile
+	extendTags map[string]string
+	// apikey is the authentication header as received, attached again by the client authenticator.
+	// It is deliberately not exposed as an attribute.
+	apikey string
+}
+
+func (a *authData) GetAttribute(name string) interface{} {
+	switch name {
+	case tenantauth.AttributeTenant:
+		return a.profile.Tenant
+	case tenantauth.AttributeExtendTags:
+		return a.extendTags
+	case tenantauth.AttributeEnvironment:
+		return a.profile.Environment
+	case tenantauth.AttributeSignals:
+		return a.profile.signals()
+	}
+	if strings.HasPrefix(name, tenantauth.QuotaPrefix) {
+		if value, exists := a.profile.Quotas[strings.TrimPrefix(name, tenantauth.QuotaPrefix)]; exists {
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		}
+		return nil
+	}
+	if strings.HasPrefix(name, tenantauth.AttributePrefix) {
+		if value, exists := a.profile.Attributes[strings.TrimPrefix(name, tenantauth.AttributePrefix)]; exists {
+			return value
+		}
+	}
+	return nil
+}
+
+func (a *authData) GetAttributeNames() []string {
+	names := []string{
+		tenantauth.AttributeTenant,
+		tenantauth.AttributeExtendTags,
+		tenantauth.AttributeEnvironment,
+		tenantauth.AttributeSignals,
+	}
+	for quota := range a.profile.Quotas {
+		names = append(names, tenantauth.QuotaPrefix+quota)
+	}
+	for attribute := range a.profile.Attributes {
+		names = append(names, tenantauth.AttributePrefix+attribute)
+	}
+	return names
+}
@@ -0,0 +1,87 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpforwarderauthextension
+
+import (
+	"context"
+	"crypto/x509"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+)
+
+// credentialKind is what a client is resolved to a tenant by.
+type credentialKind int
+
+const (
+	credentialAPIKey credentialKind = iota
+	credentialIdentity
+)
+
+// param is the query parameter of the check url carrying the credential.
+func (k credentialKind) param() string {
+	if k == credentialIdentity {
+		return "identity"
+	}
+	return "apikey"
+}
+
+const (
+	// the parts of the client certificate a client can be identified by
+	identityCN       = "cn"
+	identitySANURI   = "san_uri"
+	identitySANDNS   = "san_dns"
+	identitySPIFFEID = "spiffe_id"
+
+	// how certificate and apikey authentication are combined
+	certModeEither      = "either"
+	certModeCertificate = "certificate"
+	certModeBoth        = "both"
+)
+
+// peerIdentity returns the identity of the verified client certificate of the request,
+// empty when certificate authentication is disabled or the client sent no verified certificate.
+func (e *authExtension) peerIdentity(ctx context.Context) string {
+	if e.cfg.Certificate.Identity == "" {
+		return ""
+	}
+	cert := tenantauth.PeerCertificate(ctx)
+	if cert == nil {
+		return ""
+	}
+	return certificateIdentity(cert, e.cfg.Certificate.Identity)
+}
+
+// certificateIdentity returns the part of cert selected by source, the first one of the SANs.
+func certificateIdentity(cert *x509.Certificate, source string) string {
+	switch source {
+	case identityCN:
+		return cert.Subject.CommonName
+	case identitySANURI:
+		if len(cert.URIs) > 0 {
+			return cert.URIs[0].String()
+		}
+	case identitySANDNS:
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	case identitySPIFFEID:
+		for _, uri := range cert.URIs {
+			if uri.Scheme == "spiffe" {
+				return uri.String()
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,193 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpforwarderauthextension
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/coocood/freecache"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// apikeyChecker resolves apikeys and certificate identities through the HoloInsight check url. Results are
+// cached, concurrent lookups of the same credential share one check call, and granted credentials keep
+// being accepted for a while when the check url fails.
+type apikeyChecker struct {
+	url    string
+	client *http.Client
+	retry  RetrySettings
+	ttl    CacheSettings
+	cache  *freecache.Cache
+	group  singleflight.Group
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+// cacheEntry is a cached check response, prefixed in the cache by the time it was fetched.
+type cacheEntry struct {
+	fetched time.Time
+	profile *tenantProfile
+}
+
+func newAPIKeyChecker(cfg *Config, logger *zap.Logger) *apikeyChecker {
+	return &apikeyChecker{
+		url:    cfg.URL,
+		client: &http.Client{Timeout: cfg.Timeout},
+		retry:  cfg.Retry,
+		ttl:    cfg.Cache,
+		cache:  freecache.NewCache(cfg.Cache.Size),
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// check returns the tenant profile the check url answered for the credential.
+func (c *apikeyChecker) check(kind credentialKind, value string) (*tenantProfile, error) {
+	query := kind.param() + "=" + url.QueryEscape(value)
+	cached, ok := c.lookup(query)
+	if ok && c.fresh(cached) {
+		record(cacheHit, mCacheLookups.M(1))
+		return cached.profile, nil
+	}
+	record(cacheMiss, mCacheLookups.M(1))
+
+	v, err, _ := c.group.Do(query, func() (interface{}, error) {
+		return c.refresh(query)
+	})
+	if err == nil {
+		return v.(*cacheEntry).profile, nil
+	}
+
+	if ok && cached.profile.granted() && c.now().Sub(cached.fetched) <= c.ttl.TTL+c.ttl.MaxStaleness {
+		c.logger.Debug("[httpforwarderauthextension] authentication check failed, using the stale result", zap.Error(err))
+		record(cacheStale, mCacheLookups.M(1))
+		return cached.profile, nil
+	}
+	return nil, errCheckErrAuthentication
+}
+
+func (c *apikeyChecker) fresh(entry *cacheEntry) bool {
+	ttl := c.ttl.TTL
+	if !entry.profile.granted() {
+		ttl = c.ttl.NegativeTTL
+	}
+	return c.now().Sub(entry.fetched) < ttl
+}
+
+func (c *apikeyChecker) lookup(query string) (*cacheEntry, bool) {
+	value, err := c.cache.Get([]byte(query))
+	if err != nil || len(value) < 8 {
+		return nil, false
+	}
+	profile, err := parseProfile(value[8:])
+	if err != nil {
+		return nil, false
+	}
+	return &cacheEntry{
+		fetched: time.Unix(0, int64(binary.BigEndian.Uint64(value[:8]))),
+		profile: profile,
+	}, true
+}
+
+// refresh calls the check url and caches its response.
+func (c *apikeyChecker) refresh(query string) (*cacheEntry, error) {
+	body, err := c.fetch(query)
+	if err != nil {
+		c.logger.Error("[httpforwarderauthextension] authentication check error: ", zap.Error(err))
+		return nil, err
+	}
+	profile, err := parseProfile(body)
+	if err != nil {
+		c.logger.Error("[httpforwarderauthextension] authentication unmarshal error: ", zap.Error(err))
+		return nil, err
+	}
+	entry := &cacheEntry{fetched: c.now(), profile: profile}
+
+	expire := c.ttl.TTL + c.ttl.MaxStaleness
+	if !profile.granted() {
+		expire = c.ttl.NegativeTTL
+	}
+	if expire <= 0 {
+		return entry, nil
+	}
+	value := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint64(value, uint64(entry.fetched.UnixNano()))
+	value = append(value, body...)
+	if err = c.cache.Set([]byte(query), value, expireSeconds(expire)); err != nil {
+		c.logger.Warn("[httpforwarderauthextension] cache error: ", zap.Error(err))
+	}
+	return entry, nil
+}
+
+// fetch calls the check url, retrying failed calls with an exponential backoff.
+func (c *apikeyChecker) fetch(query string) ([]byte, error) {
+	interval := c.retry.InitialInterval
+	for attempt := 1; ; attempt++ {
+		body, retryable, err := c.call(query)
+		if err == nil || !retryable || attempt >= c.retry.MaxAttempts {
+			return body, err
+		}
+		time.Sleep(interval)
+		interval *= 2
+		if interval > c.retry.MaxInterval {
+			interval = c.retry.MaxInterval
+		}
+	}
+}
+
+// call makes a single check call, reporting whether a failure is worth retrying.
+func (c *apikeyChecker) call(query string) (body []byte, retryable bool, err error) {
+	start := time.Now()
+	defer func() {
+		result := resultOK
+		if err != nil {
+			result = resultError
+		}
+		record(result, mCheckLatency.M(float64(time.Since(start))/float64(time.Millisecond)))
+	}()
+
+	resp, err := c.client.Get(c.url + "?" + query)
+	if err != nil {
+		// the url of the error holds the credential
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = c.url
+		}
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		retryable := resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+		return nil, retryable, fmt.Errorf("status code: %s", resp.Status)
+	}
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	return body, false, nil
+}
+
+// expireSeconds rounds d up to the whole seconds freecache expects.
+func expireSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,166 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpforwarderauthextension
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// checkServer answers the tenant of the apikey, "" denying it, or fails when failing is set.
+type checkServer struct {
+	*httptest.Server
+	calls   atomic.Int32
+	failing atomic.Bool
+	tenants map[string]string
+	// release, when set, blocks the calls until it is closed
+	release chan struct{}
+}
+
+func newCheckServer(t *testing.T, tenants map[string]string) *checkServer {
+	s := &checkServer{tenants: tenants}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.calls.Add(1)
+		if s.release != nil {
+			<-s.release
+		}
+		if s.failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"tenant":"` + s.tenants[r.URL.Query().Get("apikey")] + `"}`))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newTestChecker(url string, now *time.Time) *apikeyChecker {
+	cfg := createDefaultConfig().(*Config)
+	cfg.URL = url
+	cfg.Retry.MaxAttempts = 1
+	c := newAPIKeyChecker(cfg, zap.NewNop())
+	if now != nil {
+		c.now = func() time.Time { return *now }
+	}
+	return c
+}
+
+func TestCheckerCoalescesLookups(t *testing.T) {
+	server := newCheckServer(t, map[string]string{"key": "t1"})
+	server.release = make(chan struct{})
+	c := newTestChecker(server.URL, nil)
+
+	var wg sync.WaitGroup
+	profiles := make([]*tenantProfile, 10)
+	for i := range profiles {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			profiles[i], _ = c.check(credentialAPIKey, "key")
+		}(i)
+	}
+	require.Eventually(t, func() bool { return server.calls.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	close(server.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), server.calls.Load())
+	for _, profile := range profiles {
+		require.NotNil(t, profile)
+		assert.Equal(t, "t1", profile.Tenant)
+	}
+}
+
+func TestCheckerCachesDenials(t *testing.T) {
+	server := newCheckServer(t, map[string]string{})
+	now := time.Now()
+	c := newTestChecker(server.URL, &now)
+
+	profile, err := c.check(credentialAPIKey, "unknown")
+	require.NoError(t, err)
+	assert.False(t, profile.granted())
+
+	now = now.Add(c.ttl.NegativeTTL - time.Second)
+	profile, err = c.check(credentialAPIKey, "unknown")
+	require.NoError(t, err)
+	assert.False(t, profile.granted())
+	assert.Equal(t, int32(1), server.calls.Load())
+
+	now = now.Add(2 * time.Second)
+	_, err = c.check(credentialAPIKey, "unknown")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), server.calls.Load())
+}
+
+func TestCheckerServesStale(t *testing.T) {
+	server := newCheckServer(t, map[string]string{"key": "t1"})
+	now := time.Now()
+	c := newTestChecker(server.URL, &now)
+
+	profile, err := c.check(credentialAPIKey, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "t1", profile.Tenant)
+
+	// the check url fails after the ttl, the stale result is served
+	server.failing.Store(true)
+	now = now.Add(c.ttl.TTL + time.Minute)
+	profile, err = c.check(credentialAPIKey, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "t1", profile.Tenant)
+	assert.Equal(t, int32(2), server.calls.Load())
+
+	// and rejected after the max staleness
+	now = now.Add(c.ttl.MaxStaleness)
+	_, err = c.check(credentialAPIKey, "key")
+	assert.ErrorIs(t, err, errCheckErrAuthentication)
+}
+
+func TestCheckerRetries(t *testing.T) {
+	server := newCheckServer(t, map[string]string{"key": "t1"})
+	server.failing.Store(true)
+	c := newTestChecker(server.URL, nil)
+	c.retry = RetrySettings{MaxAttempts: 3, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond}
+
+	_, err := c.check(credentialAPIKey, "key")
+	assert.Error(t, err)
+	assert.Equal(t, int32(3), server.calls.Load())
+}
+
+func TestCheckerScrubsErrors(t *testing.T) {
+	server := newCheckServer(t, nil)
+	url := server.URL
+	server.Close()
+	c := newTestChecker(url, nil)
+
+	_, err := c.fetch(credentialAPIKey.param() + "=secret-apikey")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret-apikey")
+	assert.Contains(t, err.Error(), url)
+
+	server = newCheckServer(t, nil)
+	server.failing.Store(true)
+	c = newTestChecker(server.URL, nil)
+	_, err = c.fetch(credentialAPIKey.param() + "=secret-apikey")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret-apikey")
+}
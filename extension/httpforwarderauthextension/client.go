@@ -0,0 +1,303 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpforwarderauthextension
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/credentials"
+)
+
+const protobufContentType = "application/x-protobuf"
+
+// apikeyForwarder is the client authenticator of exporters forwarding to another collector. It attaches
+// the apikey the data was received with or, when it's not known, the apikey configured for its tenant.
+type apikeyForwarder struct {
+	settings *ClientSettings
+	logger   *zap.Logger
+	// warnDefault logs once that gRPC exports without a context tenant get the default apikey.
+	warnDefault sync.Once
+}
+
+func newAPIKeyForwarder(settings *ClientSettings, logger *zap.Logger) *apikeyForwarder {
+	return &apikeyForwarder{settings: settings, logger: logger}
+}
+
+// RoundTripper attaches the apikey to OTLP/HTTP exports. Without a tenant in the request context, e.g. for
+// batched data, the tenant is taken from the resources, and a request mixing tenants is split per apikey.
+func (f *apikeyForwarder) RoundTripper(base http.RoundTripper) (http.RoundTripper, error) {
+	return &forwardingRoundTripper{forwarder: f, base: base}, nil
+}
+
+// PerRPCCredentials attaches the apikey to OTLP/gRPC exports. Only the request context is known here,
+// data without a tenant in its context gets the default apikey.
+func (f *apikeyForwarder) PerRPCCredentials() (credentials.PerRPCCredentials, error) {
+	return &forwardingCredentials{forwarder: f}, nil
+}
+
+// contextAPIKey returns the apikey for the tenant of ctx, found is false when ctx carries no tenant.
+func (f *apikeyForwarder) contextAPIKey(ctx context.Context) (apikey string, found bool) {
+	info := client.FromContext(ctx)
+	if data, ok := info.Auth.(*authData); ok && data.apikey != "" {
+		return data.apikey, true
+	}
+	if info.Auth != nil {
+		if tenant, ok := info.Auth.GetAttribute(tenantauth.AttributeTenant).(string); ok && tenant != "" {
+			return f.tenantAPIKey(tenant), true
+		}
+	}
+	if vs := info.Metadata.Get(GrpcMetadataTenant); len(vs) > 0 && vs[0] != "" {
+		return f.tenantAPIKey(vs[0]), true
+	}
+	return "", false
+}
+
+func (f *apikeyForwarder) tenantAPIKey(tenant string) string {
+	if apikey, ok := f.settings.Tenants[tenant]; ok {
+		return apikey
+	}
+	return f.settings.DefaultAPIKey
+}
+
+type forwardingCredentials struct {
+	forwarder *apikeyForwarder
+}
+
+func (c *forwardingCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	apikey, found := c.forwarder.contextAPIKey(ctx)
+	if !found {
+		if len(c.forwarder.settings.Tenants) > 0 {
+			c.forwarder.warnDefault.Do(func() {
+				c.forwarder.logger.Warn("[httpforwarderauthextension] gRPC export without a tenant in its context, " +
+					"e.g. batched data, sending it with the default apikey. Use otlphttp to forward by the tenant of the resources")
+			})
+		}
+		apikey = c.forwarder.settings.DefaultAPIKey
+	}
+	if apikey == "" {
+		c.forwarder.logger.Debug("[httpforwarderauthextension] no apikey for the export, sending it unauthenticated")
+		return nil, nil
+	}
+	return map[string]string{Authentication: apikey}, nil
+}
+
+func (c *forwardingCredentials) RequireTransportSecurity() bool {
+	return c.forwarder.settings.RequireTransportSecurity
+}
+
+type forwardingRoundTripper struct {
+	forwarder *apikeyForwarder
+	base      http.RoundTripper
+}
+
+func (rt *forwardingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if apikey, found := rt.forwarder.contextAPIKey(req.Context()); found {
+		return rt.base.RoundTrip(withAPIKey(req, apikey, nil))
+	}
+	split := splitFuncs[otlpSignal(req.URL.Path)]
+	if split == nil || req.Body == nil || req.Header.Get("Content-Type") != protobufContentType {
+		return rt.base.RoundTrip(withAPIKey(req, rt.forwarder.settings.DefaultAPIKey, nil))
+	}
+
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	parts, err := split(body, rt.forwarder.tenantAPIKey)
+	if err != nil {
+		rt.forwarder.logger.Debug("[httpforwarderauthextension] cannot read the tenants of the export: ", zap.Error(err))
+		return rt.base.RoundTrip(withAPIKey(req, rt.forwarder.settings.DefaultAPIKey, body))
+	}
+	if len(parts) == 1 {
+		return rt.base.RoundTrip(withAPIKey(req, parts[0].apikey, body))
+	}
+
+	// a failed part fails the whole request, the parts already sent are sent again on retry, i.e. duplicated
+	for i, part := range parts {
+		resp, err := rt.base.RoundTrip(withAPIKey(req, part.apikey, part.body))
+		if err != nil || i == len(parts)-1 || resp.StatusCode >= http.StatusMultipleChoices {
+			return resp, err
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+	return nil, errors.New("empty export request")
+}
+
+// withAPIKey returns a copy of req carrying apikey, and body when it's not nil.
+func withAPIKey(req *http.Request, apikey string, body []byte) *http.Request {
+	out := req.Clone(req.Context())
+	if apikey != "" {
+		out.Header.Set(Authentication, apikey)
+	}
+	if body != nil {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+		out.ContentLength = int64(len(body))
+		out.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	return out
+}
+
+func otlpSignal(path string) string {
+	for _, signal := range []string{tenantauth.SignalTraces, tenantauth.SignalMetrics, tenantauth.SignalLogs} {
+		if strings.HasSuffix(path, "/v1/"+signal) {
+			return signal
+		}
+	}
+	return ""
+}
+
+// apikeyPart is the part of an export request holding the resources forwarded with one apikey.
+type apikeyPart struct {
+	apikey string
+	body   []byte
+}
+
+// splitFuncs split an export request by the apikey of the tenant of each resource.
+var splitFuncs = map[string]func(body []byte, apikeyOf func(tenant string) string) ([]apikeyPart, error){
+	tenantauth.SignalTraces:  splitTraces,
+	tenantauth.SignalMetrics: splitMetrics,
+	tenantauth.SignalLogs:    splitLogs,
+}
+
+func resourceTenant(resource pcommon.Resource) string {
+	if v, ok := resource.Attributes().Get(tenantauth.AttributeTenant); ok {
+		return v.AsString()
+	}
+	return ""
+}
+
+// distinct returns the distinct keys of n resources, in order of appearance.
+func distinct(n int, keyOf func(int) string) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for i := 0; i < n; i++ {
+		if k := keyOf(i); !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func splitTraces(body []byte, apikeyOf func(string) string) ([]apikeyPart, error) {
+	req := ptraceotlp.NewExportRequest()
+	if err := req.UnmarshalProto(body); err != nil {
+		return nil, err
+	}
+	rs := req.Traces().ResourceSpans()
+	keyOf := func(i int) string { return apikeyOf(resourceTenant(rs.At(i).Resource())) }
+	apikeys := distinct(rs.Len(), keyOf)
+	if len(apikeys) <= 1 {
+		return []apikeyPart{{apikey: firstOr(apikeys, apikeyOf("")), body: body}}, nil
+	}
+	parts := make([]apikeyPart, 0, len(apikeys))
+	for _, apikey := range apikeys {
+		td := ptrace.NewTraces()
+		for i := 0; i < rs.Len(); i++ {
+			if keyOf(i) == apikey {
+				rs.At(i).CopyTo(td.ResourceSpans().AppendEmpty())
+			}
+		}
+		partBody, err := ptraceotlp.NewExportRequestFromTraces(td).MarshalProto()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, apikeyPart{apikey: apikey, body: partBody})
+	}
+	return parts, nil
+}
+
+func splitMetrics(body []byte, apikeyOf func(string) string) ([]apikeyPart, error) {
+	req := pmetricotlp.NewExportRequest()
+	if err := req.UnmarshalProto(body); err != nil {
+		return nil, err
+	}
+	rm := req.Metrics().ResourceMetrics()
+	keyOf := func(i int) string { return apikeyOf(resourceTenant(rm.At(i).Resource())) }
+	apikeys := distinct(rm.Len(), keyOf)
+	if len(apikeys) <= 1 {
+		return []apikeyPart{{apikey: firstOr(apikeys, apikeyOf("")), body: body}}, nil
+	}
+	parts := make([]apikeyPart, 0, len(apikeys))
+	for _, apikey := range apikeys {
+		md := pmetric.NewMetrics()
+		for i := 0; i < rm.Len(); i++ {
+			if keyOf(i) == apikey {
+				rm.At(i).CopyTo(md.ResourceMetrics().AppendEmpty())
+			}
+		}
+		partBody, err := pmetricotlp.NewExportRequestFromMetrics(md).MarshalProto()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, apikeyPart{apikey: apikey, body: partBody})
+	}
+	return parts, nil
+}
+
+func splitLogs(body []byte, apikeyOf func(string) string) ([]apikeyPart, error) {
+	req := plogotlp.NewExportRequest()
+	if err := req.UnmarshalProto(body); err != nil {
+		return nil, err
+	}
+	rl := req.Logs().ResourceLogs()
+	keyOf := func(i int) string { return apikeyOf(resourceTenant(rl.At(i).Resource())) }
+	apikeys := distinct(rl.Len(), keyOf)
+	if len(apikeys) <= 1 {
+		return []apikeyPart{{apikey: firstOr(apikeys, apikeyOf("")), body: body}}, nil
+	}
+	parts := make([]apikeyPart, 0, len(apikeys))
+	for _, apikey := range apikeys {
+		ld := plog.NewLogs()
+		for i := 0; i < rl.Len(); i++ {
+			if keyOf(i) == apikey {
+				rl.At(i).CopyTo(ld.ResourceLogs().AppendEmpty())
+			}
+		}
+		partBody, err := plogotlp.NewExportRequestFromLogs(ld).MarshalProto()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, apikeyPart{apikey: apikey, body: partBody})
+	}
+	return parts, nil
+}
+
+func firstOr(keys []string, fallback string) string {
+	if len(keys) == 0 {
+		return fallback
+	}
+	return keys[0]
+}
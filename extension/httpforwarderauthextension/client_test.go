@@ -0,0 +1,193 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpforwarderauthextension
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.uber.org/zap"
+)
+
+// sentRequest is a request seen by recordingTransport.
+type sentRequest struct {
+	apikey string
+	body   []byte
+}
+
+// recordingTransport records the requests, answering status to them.
+type recordingTransport struct {
+	sent   []sentRequest
+	status func(i int) int
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+	}
+	rt.sent = append(rt.sent, sentRequest{apikey: req.Header.Get(Authentication), body: body})
+	status := http.StatusOK
+	if rt.status != nil {
+		status = rt.status(len(rt.sent) - 1)
+	}
+	return &http.Response{StatusCode: status, Body: io.NopCloser(bytes.NewReader(nil))}, nil
+}
+
+func newTestForwarder() *apikeyForwarder {
+	return newAPIKeyForwarder(&ClientSettings{
+		Tenants:                  map[string]string{"t1": "key1", "t2": "key2"},
+		DefaultAPIKey:            "default",
+		RequireTransportSecurity: true,
+	}, zap.NewNop())
+}
+
+func logsRequest(t *testing.T, tenants ...string) []byte {
+	ld := plog.NewLogs()
+	for _, tenant := range tenants {
+		rl := ld.ResourceLogs().AppendEmpty()
+		if tenant != "" {
+			rl.Resource().Attributes().PutStr("tenant", tenant)
+		}
+		rl.ScopeLogs().AppendEmpty().LogRecords().AppendEmpty().Body().SetStr("log of " + tenant)
+	}
+	body, err := plogotlp.NewExportRequestFromLogs(ld).MarshalProto()
+	require.NoError(t, err)
+	return body
+}
+
+// tenantsOf returns the tenants of the resources of a logs request.
+func tenantsOf(t *testing.T, body []byte) []string {
+	req := plogotlp.NewExportRequest()
+	require.NoError(t, req.UnmarshalProto(body))
+	var tenants []string
+	for i := 0; i < req.Logs().ResourceLogs().Len(); i++ {
+		tenants = append(tenants, resourceTenant(req.Logs().ResourceLogs().At(i).Resource()))
+	}
+	return tenants
+}
+
+func export(t *testing.T, ctx context.Context, f *apikeyForwarder, base http.RoundTripper, body []byte) (*http.Response, error) {
+	rt, err := f.RoundTripper(base)
+	require.NoError(t, err)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://central:4318/v1/logs", bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", protobufContentType)
+	return rt.RoundTrip(req)
+}
+
+func TestRoundTripContextAPIKey(t *testing.T) {
+	f := newTestForwarder()
+	body := logsRequest(t, "t1", "t2")
+
+	// the apikey the data was received with
+	base := &recordingTransport{}
+	ctx := client.NewContext(context.Background(), client.Info{Auth: &authData{profile: &tenantProfile{Tenant: "t1"}, apikey: "received"}})
+	_, err := export(t, ctx, f, base, body)
+	require.NoError(t, err)
+	require.Len(t, base.sent, 1)
+	assert.Equal(t, "received", base.sent[0].apikey)
+	assert.Equal(t, body, base.sent[0].body)
+
+	// the apikey of the tenant of the context, not split
+	base = &recordingTransport{}
+	ctx = client.NewContext(context.Background(), client.Info{Metadata: client.NewMetadata(map[string][]string{GrpcMetadataTenant: {"t2"}})})
+	_, err = export(t, ctx, f, base, body)
+	require.NoError(t, err)
+	require.Len(t, base.sent, 1)
+	assert.Equal(t, "key2", base.sent[0].apikey)
+}
+
+func TestRoundTripSplit(t *testing.T) {
+	f := newTestForwarder()
+	base := &recordingTransport{}
+	resp, err := export(t, context.Background(), f, base, logsRequest(t, "t1", "t2", "t1", "unknown"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.Len(t, base.sent, 3)
+	assert.Equal(t, "key1", base.sent[0].apikey)
+	assert.Equal(t, []string{"t1", "t1"}, tenantsOf(t, base.sent[0].body))
+	assert.Equal(t, "key2", base.sent[1].apikey)
+	assert.Equal(t, []string{"t2"}, tenantsOf(t, base.sent[1].body))
+	assert.Equal(t, "default", base.sent[2].apikey)
+	assert.Equal(t, []string{"unknown"}, tenantsOf(t, base.sent[2].body))
+
+	// a single tenant isn't split, and keeps the body as is
+	base = &recordingTransport{}
+	body := logsRequest(t, "t2", "t2")
+	_, err = export(t, context.Background(), f, base, body)
+	require.NoError(t, err)
+	require.Len(t, base.sent, 1)
+	assert.Equal(t, "key2", base.sent[0].apikey)
+	assert.Equal(t, body, base.sent[0].body)
+}
+
+func TestRoundTripSplitFailure(t *testing.T) {
+	f := newTestForwarder()
+	base := &recordingTransport{status: func(i int) int {
+		if i == 0 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	}}
+	resp, err := export(t, context.Background(), f, base, logsRequest(t, "t1", "t2"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Len(t, base.sent, 1)
+}
+
+func TestRoundTripUndecodableBody(t *testing.T) {
+	f := newTestForwarder()
+	base := &recordingTransport{}
+	body := []byte("not a protobuf request")
+	_, err := export(t, context.Background(), f, base, body)
+	require.NoError(t, err)
+	require.Len(t, base.sent, 1)
+	assert.Equal(t, "default", base.sent[0].apikey)
+	assert.Equal(t, body, base.sent[0].body)
+}
+
+func TestGetRequestMetadata(t *testing.T) {
+	f := newTestForwarder()
+	creds, err := f.PerRPCCredentials()
+	require.NoError(t, err)
+	assert.True(t, creds.RequireTransportSecurity())
+
+	ctx := client.NewContext(context.Background(), client.Info{Auth: &authData{profile: &tenantProfile{Tenant: "t2"}}})
+	md, err := creds.GetRequestMetadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{Authentication: "key2"}, md)
+
+	md, err = creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{Authentication: "default"}, md)
+
+	f.settings.DefaultAPIKey = ""
+	md, err = creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, md)
+
+	f.settings.RequireTransportSecurity = false
+	assert.False(t, creds.RequireTransportSecurity())
+}
@@ -14,13 +14,48 @@
 
 package httpforwarderauthextension
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/traas-stack/holoinsight-collector/internal/aescrypt"
+)
+
+const (
+	sourceURL   = "url"
+	sourceStore = "store"
+)
+
 type Config struct {
 	URL string `mapstructure:"url"`
+	// Timeout bounds a single apikey check call. Default: 5s
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Retry configures how failed apikey check calls are retried.
+	Retry RetrySettings `mapstructure:"retry"`
+	// Cache configures how apikey check results are cached.
+	Cache CacheSettings `mapstructure:"cache"`
+	// Store resolves apikeys from a local file, instead of or together with the check url.
+	Store StoreSettings `mapstructure:"store"`
+	// Token verifies signed apikeys (JWTs) locally against the configured keys.
+	Token TokenSettings `mapstructure:"token"`
+	// Precedence is the order the apikey sources ("url", "store") are consulted in. A source answers when it knows
+	// the apikey, otherwise (apikey missing from the store, check url failing) the next one is consulted.
+	// Default: [url, store] when both are configured.
+	Precedence []string `mapstructure:"precedence"`
 	// You can choose whether to encrypt the apikey (the configuration provided to the agent)
 	// Example: For skywalking agent SW_AGENT_AUTHENTICATION configuration item
 	// If you want to encrypt the secretKey and iv of the holoinsight collector, it needs to be consistent with the holoinsight backend
 	// The holoinsight backend encrypts the configuration, and the holoinsight collector decrypts it
 	Decrypt `mapstructure:"decrypt"`
+	// Client configures the apikeys attached to the exports when the extension is used as a client authenticator,
+	// forwarding data to another collector.
+	Client ClientSettings `mapstructure:"client"`
+	// Certificate authenticates clients by their verified TLS client certificate, instead of or together with the apikey.
+	Certificate CertificateSettings `mapstructure:"certificate"`
+	// Audit configures the audit records published to the holoinsight_auth_audit receivers.
+	Audit AuditSettings `mapstructure:"audit"`
 }
 
 type Decrypt struct {
@@ -33,4 +68,207 @@ type Decrypt struct {
 	// the same secret key produces a different ciphertext message each time it is encrypted. The IV is typically included
 	// in the encrypted message and must be kept confidential to ensure the security of the encrypted data.
 	IV string `mapstructure:"iv"`
+	// Keys are the AES-GCM keys of "v1.<key id>.<ciphertext>" values, rotated by adding the new key
+	// and removing the old one once no value encrypted with it is in use.
+	Keys []aescrypt.Key `mapstructure:"keys"`
+}
+
+// keyring returns the keys values are decrypted with, nil when decryption is disabled.
+func (d *Decrypt) keyring() (*aescrypt.Keyring, error) {
+	if !d.Enable || (d.SecretKey == "" && len(d.Keys) == 0) {
+		return nil, nil
+	}
+	return aescrypt.New(d.Keys, d.SecretKey, d.IV)
+}
+
+type ClientSettings struct {
+	// Tenants maps a tenant to the apikey forwarded for its data when the apikey the data was received with
+	// is not known, e.g. for data from other authenticators or batched data.
+	Tenants map[string]string `mapstructure:"tenants"`
+	// DefaultAPIKey is forwarded for data of a tenant missing from Tenants, or of no known tenant at all.
+	// Data without an apikey is exported without the authentication header.
+	DefaultAPIKey string `mapstructure:"default_apikey"`
+	// RequireTransportSecurity refuses to send the apikeys over gRPC connections without TLS. Default: true
+	RequireTransportSecurity bool `mapstructure:"require_transport_security"`
+}
+
+func (s *ClientSettings) enabled() bool {
+	return len(s.Tenants) > 0 || s.DefaultAPIKey != ""
+}
+
+type CertificateSettings struct {
+	// Identity is the part of the client certificate identifying the client: cn, san_uri, san_dns or spiffe_id.
+	// Certificate authentication is disabled when not set.
+	Identity string `mapstructure:"identity"`
+	// Mode combines certificate and apikey authentication. "either" authenticates with the certificate when the
+	// client sent one and with the apikey otherwise, "certificate" requires a certificate, and "both" requires
+	// a certificate and an apikey of the same tenant. Default: either
+	Mode string `mapstructure:"mode"`
+}
+
+type AuditSettings struct {
+	// SamplingRate is the fraction of the successful authentications audited. Default: 0.01
+	SamplingRate float64 `mapstructure:"sampling_rate"`
+	// DeniedSamplingRate is the fraction of the failed authentications audited. Default: 1
+	DeniedSamplingRate float64 `mapstructure:"denied_sampling_rate"`
+}
+
+type RetrySettings struct {
+	// MaxAttempts is the number of check calls made for one lookup, including the first one. Default: 3
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// InitialInterval is the wait before the first retry, it doubles on every retry. Default: 100ms
+	InitialInterval time.Duration `mapstructure:"initial_interval"`
+	// MaxInterval caps the wait between two retries. Default: 1s
+	MaxInterval time.Duration `mapstructure:"max_interval"`
+}
+
+type StoreSettings struct {
+	// Path is the YAML or JSON file mapping apikeys (plain or sha256 hashed) to tenants. The store is disabled when not set.
+	Path string `mapstructure:"path"`
+	// ReloadInterval is how often the file is checked for changes. 0 disables reloading. Default: 10s
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+}
+
+type TokenSettings struct {
+	// Keys are the keys tokens can be signed with.
+	Keys []TokenKey `mapstructure:"keys"`
+	// JWKSFile is a JSON Web Key Set file holding more keys tokens can be signed with.
+	JWKSFile string `mapstructure:"jwks_file"`
+	// Issuer, when set, must match the "iss" claim.
+	Issuer string `mapstructure:"issuer"`
+	// Audience, when set, must be part of the "aud" claim.
+	Audience string `mapstructure:"audience"`
+	// MaxLifetime, when set, caps the time between the "iat" and the "exp" claims, which are then both required.
+	MaxLifetime time.Duration `mapstructure:"max_lifetime"`
+	// RevocationCheck additionally sends verified tokens to the check url, tokens it denies are rejected.
+	// Tokens are still accepted while the check url fails.
+	RevocationCheck bool `mapstructure:"revocation_check"`
+}
+
+type TokenKey struct {
+	// KeyID matches the "kid" header of the tokens signed with this key.
+	KeyID string `mapstructure:"key_id"`
+	// Algorithm is the signing algorithm: HS256, HS384, HS512, RS256, RS384, RS512, PS256, PS384, PS512, ES256, ES384 or ES512.
+	Algorithm string `mapstructure:"algorithm"`
+	// Secret is the shared secret of the HS* algorithms.
+	Secret string `mapstructure:"secret"`
+	// PublicKeyFile is the PEM encoded public key of the RS*, PS* and ES* algorithms.
+	PublicKeyFile string `mapstructure:"public_key_file"`
+}
+
+func (s *TokenSettings) enabled() bool {
+	return len(s.Keys) > 0 || s.JWKSFile != ""
+}
+
+// Validate checks the verification keys are complete.
+func (s *TokenSettings) Validate() error {
+	for i, k := range s.Keys {
+		switch {
+		case !tokenAlgorithms[k.Algorithm]:
+			return fmt.Errorf("token key %d: invalid algorithm %q", i, k.Algorithm)
+		case strings.HasPrefix(k.Algorithm, "HS") && k.Secret == "":
+			return fmt.Errorf("token key %d: %s requires a secret", i, k.Algorithm)
+		case !strings.HasPrefix(k.Algorithm, "HS") && k.PublicKeyFile == "":
+			return fmt.Errorf("token key %d: %s requires a public_key_file", i, k.Algorithm)
+		}
+	}
+	return nil
+}
+
+type CacheSettings struct {
+	// Size is the cache size in bytes. Default: 1MiB
+	Size int `mapstructure:"size"`
+	// TTL is how long a granted apikey is trusted without checking it again. Default: 2m
+	TTL time.Duration `mapstructure:"ttl"`
+	// NegativeTTL is how long a denied apikey is rejected without checking it again. Default: 30s
+	NegativeTTL time.Duration `mapstructure:"negative_ttl"`
+	// MaxStaleness is how long after TTL a granted apikey is still accepted while the check url is failing,
+	// so agents keep reporting through an outage of the HoloInsight server. 0 disables it. Default: 1h
+	MaxStaleness time.Duration `mapstructure:"max_staleness"`
+}
+
+// Validate checks the configuration is usable.
+func (cfg *Config) Validate() error {
+	if cfg.URL == "" && cfg.Store.Path == "" && !cfg.Token.enabled() && !cfg.Client.enabled() {
+		return errURLNotSet
+	}
+	switch cfg.Certificate.Identity {
+	case "", identityCN, identitySANURI, identitySANDNS, identitySPIFFEID:
+	default:
+		return fmt.Errorf("invalid certificate identity %q, must be %s, %s, %s or %s",
+			cfg.Certificate.Identity, identityCN, identitySANURI, identitySANDNS, identitySPIFFEID)
+	}
+	switch cfg.Certificate.Mode {
+	case certModeEither, certModeCertificate, certModeBoth:
+	default:
+		return fmt.Errorf("invalid certificate mode %q, must be %s, %s or %s",
+			cfg.Certificate.Mode, certModeEither, certModeCertificate, certModeBoth)
+	}
+	if cfg.Certificate.Identity != "" && cfg.URL == "" && cfg.Store.Path == "" {
+		return errors.New("certificate authentication requires the url or the store")
+	}
+	if cfg.Token.RevocationCheck && cfg.URL == "" {
+		return errors.New("token revocation_check requires the url")
+	}
+	if cfg.Token.MaxLifetime < 0 {
+		return errors.New("token max_lifetime must not be negative")
+	}
+	if cfg.Store.ReloadInterval < 0 {
+		return errors.New("store reload_interval must not be negative")
+	}
+	if _, err := cfg.Decrypt.keyring(); err != nil {
+		return fmt.Errorf("invalid decrypt keys: %w", err)
+	}
+	seen := make(map[string]bool)
+	for _, source := range cfg.Precedence {
+		switch {
+		case seen[source]:
+			return fmt.Errorf("precedence lists %q twice", source)
+		case source == sourceURL && cfg.URL == "":
+			return errors.New("precedence lists url but url is not set")
+		case source == sourceStore && cfg.Store.Path == "":
+			return errors.New("precedence lists store but store path is not set")
+		case source != sourceURL && source != sourceStore:
+			return fmt.Errorf("invalid precedence source %q, must be %q or %q", source, sourceURL, sourceStore)
+		}
+		seen[source] = true
+	}
+	if cfg.Audit.SamplingRate < 0 || cfg.Audit.SamplingRate > 1 ||
+		cfg.Audit.DeniedSamplingRate < 0 || cfg.Audit.DeniedSamplingRate > 1 {
+		return errors.New("audit sampling rates must be between 0 and 1")
+	}
+	if cfg.Timeout <= 0 {
+		return errors.New("timeout must be positive")
+	}
+	if cfg.Retry.MaxAttempts < 1 {
+		return errors.New("retry max_attempts must be at least 1")
+	}
+	if cfg.Retry.InitialInterval < 0 || cfg.Retry.MaxInterval < 0 {
+		return errors.New("retry intervals must not be negative")
+	}
+	if cfg.Cache.Size <= 0 {
+		return errors.New("cache size must be positive")
+	}
+	if cfg.Cache.TTL <= 0 {
+		return errors.New("cache ttl must be positive")
+	}
+	if cfg.Cache.NegativeTTL < 0 || cfg.Cache.MaxStaleness < 0 {
+		return errors.New("cache negative_ttl and max_staleness must not be negative")
+	}
+	return nil
+}
+
+// precedence returns the configured apikey sources in lookup order.
+func (cfg *Config) precedence() []string {
+	if len(cfg.Precedence) > 0 {
+		return cfg.Precedence
+	}
+	var sources []string
+	if cfg.URL != "" {
+		sources = append(sources, sourceURL)
+	}
+	if cfg.Store.Path != "" {
+		sources = append(sources, sourceStore)
+	}
+	return sources
 }
@@ -16,24 +16,37 @@ package httpforwarderauthextension
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"github.com/traas-stack/holoinsight-collector/internal/utils"
-	"net/url"
+	"math/rand"
+	"net"
+	"net/http"
 	"strings"
+	"time"
 
-	"github.com/coocood/freecache"
+	"github.com/traas-stack/holoinsight-collector/internal/aescrypt"
+	"github.com/traas-stack/holoinsight-collector/internal/authaudit"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+	"go.opentelemetry.io/collector/client"
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/extension"
 	"go.opentelemetry.io/collector/extension/auth"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 )
 
 type authExtension struct {
-	cfg    *Config
-	logger *zap.Logger
-	cache  *freecache.Cache
+	cfg      *Config
+	logger   *zap.Logger
+	checker  *apikeyChecker
+	store    *apikeyStore
+	tokens   *tokenVerifier
+	keys     *aescrypt.Keyring
+	auditHub *authaudit.Hub
 }
 
 const (
@@ -42,7 +55,6 @@ const (
 	ExtendTags                 = "extend_tags"
 	GrpcMetadataTenant         = "tenant"
 	GrpcTraceStatus            = "traceStatus"
-	CacheExpire                = 2 * 60 // 2 minutes
 )
 
 var (
@@ -50,95 +62,303 @@ var (
 	errNotAuthenticated               = errors.New("authentication didn't set")
 	errCheckErrAuthentication         = errors.New("authentication check api call error")
 	errAuthenticationPermissionDenied = errors.New("authentication permission denied")
-	errTraceNotEnabled                = errors.New("trace is not enabled")
+	errNoSignalEnabled                = errors.New("no signal is enabled")
+	errSignalDisabled                 = errors.New("signal of the request is disabled")
+	errNoCertificate                  = errors.New("no verified client certificate")
 )
 
-func newExtension(cfg *Config, logger *zap.Logger) (auth.Server, error) {
-	if cfg.URL == "" {
+// forwarderAuth is both the server authenticator of the receivers and the client authenticator
+// of the exporters forwarding to another collector.
+// It also publishes the audit records of the authentications.
+type forwarderAuth struct {
+	auth.Server
+	*apikeyForwarder
+	*authaudit.Hub
+}
+
+var (
+	_ auth.Server      = (*forwarderAuth)(nil)
+	_ auth.Client      = (*forwarderAuth)(nil)
+	_ authaudit.Source = (*forwarderAuth)(nil)
+)
+
+func newExtension(cfg *Config, logger *zap.Logger) (extension.Extension, error) {
+	if cfg.URL == "" && cfg.Store.Path == "" && !cfg.Token.enabled() && !cfg.Client.enabled() {
 		return nil, errURLNotSet
 	}
 
-	cacheSize := 1024 * 1024 // 1KB
-	cache := freecache.NewCache(cacheSize)
-
 	e := &authExtension{
-		cfg:    cfg,
-		logger: logger,
-		cache:  cache,
-	}
-	return auth.NewServer(
-		auth.WithServerStart(e.start),
-		auth.WithServerAuthenticate(e.authenticate),
-	), nil
+		cfg:      cfg,
+		logger:   logger,
+		auditHub: &authaudit.Hub{},
+	}
+	if cfg.URL != "" {
+		e.checker = newAPIKeyChecker(cfg, logger)
+	}
+	if cfg.Store.Path != "" {
+		e.store = newAPIKeyStore(&cfg.Store, logger)
+	}
+	if cfg.Token.enabled() {
+		e.tokens = newTokenVerifier(&cfg.Token)
+	}
+	keys, err := cfg.Decrypt.keyring()
+	if err != nil {
+		return nil, err
+	}
+	e.keys = keys
+	return &forwarderAuth{
+		Server: auth.NewServer(
+			auth.WithServerStart(e.start),
+			auth.WithServerShutdown(e.shutdown),
+			auth.WithServerAuthenticate(e.authenticate),
+		),
+		apikeyForwarder: newAPIKeyForwarder(&cfg.Client, logger),
+		Hub:             e.auditHub,
+	}, nil
 }
 
 func (e *authExtension) start(context.Context, component.Host) error {
+	if e.tokens != nil {
+		if err := e.tokens.load(); err != nil {
+			return err
+		}
+	}
+	if e.store != nil {
+		return e.store.start()
+	}
 	return nil
 }
 
-// authenticate checks whether the given context contains valid auth data. Successfully authenticated calls will always return a nil error and a context with the auth data.
-func (e *authExtension) authenticate(ctx context.Context, headers map[string][]string) (context.Context, error) {
-	authHeaders := headers[Authentication]
-	if len(authHeaders) == 0 || authHeaders[0] == "" {
-		return ctx, errNotAuthenticated
+func (e *authExtension) shutdown(context.Context) error {
+	if e.store != nil {
+		e.store.shutdown()
 	}
-	apikey := authHeaders[0]
+	return nil
+}
+
+// revoked reports whether the check url denies a verified token. Tokens stay valid while the check url fails.
+func (e *authExtension) revoked(token string) bool {
+	if !e.cfg.Token.RevocationCheck {
+		return false
+	}
+	profile, err := e.checker.check(credentialAPIKey, token)
+	return err == nil && !profile.granted()
+}
+
+// resolve looks the apikey or certificate identity up in the configured sources, in order of precedence.
+// A credential unknown to every source resolves to no profile, i.e. it is denied.
+func (e *authExtension) resolve(kind credentialKind, value string) (*tenantProfile, error) {
 	var err error
-	if e.cfg.Enable && e.cfg.SecretKey != "" {
-		apikey, err = AesDecrypt(authHeaders[0], e.cfg.SecretKey, e.cfg.IV)
-		if err != nil {
-			e.logger.Debug("[httpforwarderauthextension] aes decrypt error: ", zap.Error(err))
+	for _, source := range e.cfg.precedence() {
+		switch source {
+		case sourceURL:
+			profile, cerr := e.checker.check(kind, value)
+			if cerr == nil {
+				return profile, nil
+			}
+			err = cerr
+		case sourceStore:
+			if profile, ok := e.store.lookup(kind, value); ok {
+				return profile, nil
+			}
 		}
 	}
+	return nil, err
+}
 
-	// extend{"authentication":"xx", "custom_tag1":"xx", "custom_tag2":"xx"}
-	// authentication is required, custom tags will be added to span tags
-	if strings.HasPrefix(apikey, ExtendAuthenticationPrefix) {
-		split := strings.Split(apikey, ExtendAuthenticationPrefix)
-		m := make(map[string]string)
-		err = json.Unmarshal([]byte(split[1]), &m)
-		if err != nil {
-			e.logger.Error("[httpforwarderauthextension] extend authentication unmarshal error: ", zap.Error(err))
-			return nil, err
+// authenticate checks whether the given context contains valid auth data. Successfully authenticated calls will always return a nil error and a context with the auth data.
+func (e *authExtension) authenticate(ctx context.Context, headers map[string][]string) (context.Context, error) {
+	authHeader := getHeader(headers, Authentication)
+	identity := e.peerIdentity(ctx)
+	newCtx, profile, err := e.authenticateClient(ctx, headers, authHeader, identity)
+	result := resultOf(err)
+	record(result, mRequests.M(1))
+	e.audit(ctx, authHeader, identity, profile, result, err)
+	return newCtx, err
+}
+
+// authenticateClient authenticates the client by its certificate identity, its apikey or both, as the certificate mode says.
+func (e *authExtension) authenticateClient(ctx context.Context, headers map[string][]string, authHeader, identity string) (context.Context, *tenantProfile, error) {
+	if e.cfg.Certificate.Identity == "" {
+		return e.authenticateAPIKey(ctx, headers, authHeader)
+	}
+	if identity == "" {
+		if e.cfg.Certificate.Mode != certModeEither {
+			return ctx, nil, errNoCertificate
 		}
-		delete(m, Authentication)
-		ctx = context.WithValue(ctx, ExtendTags, m)
+		return e.authenticateAPIKey(ctx, headers, authHeader)
 	}
 
-	// Get from cache
-	response, _ := e.cache.Get([]byte(apikey))
-	if response == nil || len(response) == 0 {
-		// Get from holoinsight gateway
-		response, err = utils.HTTPGet(e.cfg.URL + "?apikey=" + url.QueryEscape(apikey))
+	if e.cfg.Certificate.Mode == certModeBoth {
+		newCtx, profile, err := e.authenticateAPIKey(ctx, headers, authHeader)
 		if err != nil {
-			e.logger.Error("[httpforwarderauthextension] authentication check error: ", zap.Error(err))
-			return ctx, errCheckErrAuthentication
+			return newCtx, profile, err
 		}
-
-		err = e.cache.Set([]byte(apikey), response, CacheExpire)
+		certProfile, err := e.resolve(credentialIdentity, identity)
 		if err != nil {
-			e.logger.Error("[httpforwarderauthextension] cache error: ", zap.Error(err))
-			return ctx, errCheckErrAuthentication
+			return ctx, nil, err
 		}
+		if certProfile == nil || !certProfile.granted() || certProfile.Tenant != profile.Tenant {
+			e.logger.Warn("[httpforwarderauthextension] certificate and apikey of different tenants!",
+				zap.String("identity", identity), zap.String("apikey", fingerprint(authHeader)))
+			return ctx, profile, errAuthenticationPermissionDenied
+		}
+		return newCtx, profile, nil
 	}
 
-	m := make(map[string]string)
-	err = json.Unmarshal(response, &m)
+	profile, err := e.resolve(credentialIdentity, identity)
 	if err != nil {
-		e.logger.Error("[httpforwarderauthextension] authentication unmarshal error: ", zap.Error(err))
-		return nil, err
+		return ctx, nil, err
 	}
+	return e.authorize(ctx, headers, profile, nil, "", zap.String("identity", identity))
+}
 
-	if len(m) == 0 || m[GrpcMetadataTenant] == "" {
-		e.logger.Warn(fmt.Sprintf("[httpforwarderauthextension] authentication %s permission denied!", apikey))
-		return ctx, errAuthenticationPermissionDenied
+func (e *authExtension) authenticateAPIKey(ctx context.Context, headers map[string][]string, authHeader string) (context.Context, *tenantProfile, error) {
+	if authHeader == "" {
+		return ctx, nil, errNotAuthenticated
 	}
-	if m[GrpcTraceStatus] == "false" {
-		e.logger.Warn(fmt.Sprintf("[httpforwarderauthextension] authentication %s trace is not enabled!", apikey))
-		return ctx, errTraceNotEnabled
+	apikey := authHeader
+	var err error
+	if e.keys != nil {
+		// apikeys which can't be decrypted are taken as plain apikeys
+		if decrypted, derr := e.keys.Decrypt(authHeader); derr == nil {
+			apikey = decrypted
+		} else {
+			e.logger.Debug("[httpforwarderauthextension] aes decrypt error: ", zap.Error(derr))
+		}
+	}
+
+	var extendTags map[string]string
+	var profile *tenantProfile
+	if e.tokens != nil && isToken(apikey) {
+		claims, verr := e.tokens.verify(apikey)
+		if verr != nil {
+			e.logger.Warn("[httpforwarderauthextension] token verification failed: ",
+				zap.String("apikey", fingerprint(authHeader)), zap.Error(verr))
+			return ctx, nil, errInvalidToken
+		}
+		if e.revoked(apikey) {
+			return ctx, nil, errAuthenticationPermissionDenied
+		}
+		profile = claims.profile()
+		extendTags = claims.Tags
+		if len(extendTags) > 0 {
+			ctx = context.WithValue(ctx, ExtendTags, extendTags)
+		}
+	} else {
+		// extend{"authentication":"xx", "custom_tag1":"xx", "custom_tag2":"xx"}
+		// authentication is required, custom tags will be added to span tags
+		if strings.HasPrefix(apikey, ExtendAuthenticationPrefix) {
+			split := strings.Split(apikey, ExtendAuthenticationPrefix)
+			tags := make(map[string]string)
+			err = json.Unmarshal([]byte(split[1]), &tags)
+			if err != nil {
+				e.logger.Error("[httpforwarderauthextension] extend authentication unmarshal error: ",
+					zap.String("apikey", fingerprint(authHeader)), zap.Error(err))
+				return nil, nil, err
+			}
+			delete(tags, Authentication)
+			extendTags = tags
+			ctx = context.WithValue(ctx, ExtendTags, tags)
+		}
+
+		profile, err = e.resolve(credentialAPIKey, apikey)
+		if err != nil {
+			return ctx, nil, err
+		}
 	}
+	return e.authorize(ctx, headers, profile, extendTags, authHeader, zap.String("apikey", fingerprint(authHeader)))
+}
 
-	ctx = context.WithValue(ctx, GrpcMetadataTenant, m[GrpcMetadataTenant])
+// authorize accepts a client whose profile is granted with a signal enabled, the signal of the request when it tells one,
+// and puts the profile in the context.
+// apikey is the header the client authenticated with, empty for certificates, and caller identifies the client in logs.
+func (e *authExtension) authorize(ctx context.Context, headers map[string][]string, profile *tenantProfile,
+	extendTags map[string]string, apikey string, caller zap.Field) (context.Context, *tenantProfile, error) {
+	if profile == nil || !profile.granted() {
+		e.logger.Warn("[httpforwarderauthextension] authentication permission denied!", caller)
+		return ctx, profile, errAuthenticationPermissionDenied
+	}
+	if len(profile.signals()) == 0 {
+		e.logger.Warn("[httpforwarderauthextension] authentication has no signal enabled!",
+			caller, zap.String("tenant", profile.Tenant))
+		return ctx, profile, errNoSignalEnabled
+	}
+	if signal := requestSignal(ctx); signal != "" && !profile.allows(signal) {
+		e.logger.Warn("[httpforwarderauthextension] authentication has the signal of the request disabled!",
+			caller, zap.String("tenant", profile.Tenant), zap.String("signal", signal))
+		return ctx, profile, errSignalDisabled
+	}
+
+	ctx = context.WithValue(ctx, GrpcMetadataTenant, profile.Tenant)
+	cl := client.FromContext(ctx)
+	cl.Auth = &authData{
+		profile:    profile,
+		extendTags: extendTags,
+		apikey:     apikey,
+	}
+	ctx = client.NewContext(ctx, cl)
 	newCtx := metadata.NewIncomingContext(ctx, headers)
-	return newCtx, nil
+	return newCtx, profile, nil
+}
+
+// audit publishes a sampled record of the authentication to the audit subscribers.
+func (e *authExtension) audit(ctx context.Context, authHeader, identity string, profile *tenantProfile, result string, err error) {
+	if !e.auditHub.Subscribed() {
+		return
+	}
+	rate := e.cfg.Audit.DeniedSamplingRate
+	if result == resultOK {
+		rate = e.cfg.Audit.SamplingRate
+	}
+	if rate <= 0 || rand.Float64() >= rate {
+		return
+	}
+
+	r := authaudit.Record{Time: time.Now(), Identity: identity, Result: result}
+	if authHeader != "" {
+		r.APIKeyFingerprint = fingerprint(authHeader)
+	}
+	if profile != nil {
+		r.Tenant = profile.Tenant
+	}
+	if err != nil {
+		r.Reason = err.Error()
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.Peer = p.Addr.String()
+	} else if addr := client.FromContext(ctx).Addr; addr != nil {
+		r.Peer = addr.String()
+	}
+	if method, ok := grpc.Method(ctx); ok {
+		r.Method = method
+	}
+	// the HoloInsight receivers describe their HTTP requests in the context, see tenantresolver.Handler
+	req := tenantresolver.RequestOf(ctx, "")
+	r.Receiver, r.Path = req.Listener, req.Path
+	if addr, ok := ctx.Value(http.LocalAddrContextKey).(net.Addr); ok && r.Receiver == "" {
+		r.Receiver = addr.String()
+	}
+	e.auditHub.Publish(r)
+}
+
+// fingerprint identifies an apikey in logs and audit records without revealing it:
+// the first 8 hex digits of its SHA-256 digest.
+func fingerprint(apikey string) string {
+	sum := sha256.Sum256([]byte(apikey))
+	return hex.EncodeToString(sum[:4])
+}
+
+// getHeader returns the first value of the given header. gRPC metadata keys are lowercase while
+// HTTP headers are canonicalized, so the lookup is case-insensitive.
+func getHeader(headers map[string][]string, name string) string {
+	if vs := headers[name]; len(vs) > 0 {
+		return vs[0]
+	}
+	for k, vs := range headers {
+		if strings.EqualFold(k, name) && len(vs) > 0 {
+			return vs[0]
+		}
+	}
+	return ""
 }
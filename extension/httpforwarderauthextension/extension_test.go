@@ -0,0 +1,92 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpforwarderauthextension
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/traas-stack/holoinsight-collector/internal/authaudit"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/extension/auth"
+	"go.uber.org/zap"
+)
+
+func TestAuditReceiver(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.Store.Path = filepath.Join(t.TempDir(), "apikeys.yaml")
+	cfg.Audit.SamplingRate = 1
+	writeStore(t, cfg.Store.Path, "apikeys:\n  - apikey: key1\n    tenant: t1\n")
+	ext, err := newExtension(cfg, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, ext.Start(context.Background(), componenttest.NewNopHost()))
+	defer func() {
+		require.NoError(t, ext.Shutdown(context.Background()))
+	}()
+
+	var records []authaudit.Record
+	unsubscribe := ext.(authaudit.Source).SubscribeAudit(func(r authaudit.Record) {
+		records = append(records, r)
+	})
+	defer unsubscribe()
+
+	// an HTTP request received by a HoloInsight receiver
+	server := httptest.NewServer(tenantresolver.Handler("0.0.0.0:4318", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ext.(auth.Server).Authenticate(r.Context(), r.Header); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})))
+	defer server.Close()
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/traces", nil)
+	require.NoError(t, err)
+	req.Header.Set(Authentication, "key1")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// an HTTP request of another receiver, known by its local address only
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ext.(auth.Server).Authenticate(r.Context(), r.Header)
+	}))
+	defer plain.Close()
+	resp, err = http.Post(plain.URL+"/v1/logs", "application/json", nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	// a gRPC call
+	ctx := methodContext("/opentelemetry.proto.collector.trace.v1.TraceService/Export")
+	_, err = ext.(auth.Server).Authenticate(ctx, map[string][]string{Authentication: {"key1"}})
+	require.NoError(t, err)
+
+	require.Len(t, records, 3)
+	assert.Equal(t, "t1", records[0].Tenant)
+	assert.Equal(t, "0.0.0.0:4318", records[0].Receiver)
+	assert.Equal(t, "/v1/traces", records[0].Path)
+	assert.Empty(t, records[0].Method)
+
+	assert.Equal(t, resultUnauthenticated, records[1].Result)
+	assert.Equal(t, plain.Listener.Addr().String(), records[1].Receiver)
+	assert.Empty(t, records[1].Path)
+
+	assert.Equal(t, "/opentelemetry.proto.collector.trace.v1.TraceService/Export", records[2].Path)
+	assert.Equal(t, records[2].Path, records[2].Method)
+}
@@ -16,7 +16,10 @@ package httpforwarderauthextension
 
 import (
 	"context"
+	"sync"
+	"time"
 
+	"go.opencensus.io/stats/view"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/extension"
 )
@@ -24,10 +27,27 @@ import (
 const (
 	// The value of extension "type" in configuration.
 	typeStr = "http_forwarder_auth"
+
+	defaultTimeout          = 5 * time.Second
+	defaultMaxAttempts      = 3
+	defaultInitialInterval  = 100 * time.Millisecond
+	defaultMaxInterval      = time.Second
+	defaultCacheSize        = 1024 * 1024 // 1MiB
+	defaultCacheTTL         = 2 * time.Minute
+	defaultNegativeCacheTTL = 30 * time.Second
+	defaultMaxStaleness     = time.Hour
+	defaultReloadInterval   = 10 * time.Second
+	defaultAuditSampling    = 0.01
+	defaultDeniedSampling   = 1
 )
 
+var registerViews sync.Once
+
 // NewFactory creates a factory for the http_forwarder_auth Authenticator extension.
 func NewFactory() extension.Factory {
+	registerViews.Do(func() {
+		_ = view.Register(metricViews()...)
+	})
 	return extension.NewFactory(
 		typeStr,
 		createDefaultConfig,
@@ -37,7 +57,33 @@ func NewFactory() extension.Factory {
 }
 
 func createDefaultConfig() component.Config {
-	return &Config{}
+	return &Config{
+		Timeout: defaultTimeout,
+		Retry: RetrySettings{
+			MaxAttempts:     defaultMaxAttempts,
+			InitialInterval: defaultInitialInterval,
+			MaxInterval:     defaultMaxInterval,
+		},
+		Cache: CacheSettings{
+			Size:         defaultCacheSize,
+			TTL:          defaultCacheTTL,
+			NegativeTTL:  defaultNegativeCacheTTL,
+			MaxStaleness: defaultMaxStaleness,
+		},
+		Store: StoreSettings{
+			ReloadInterval: defaultReloadInterval,
+		},
+		Client: ClientSettings{
+			RequireTransportSecurity: true,
+		},
+		Certificate: CertificateSettings{
+			Mode: certModeEither,
+		},
+		Audit: AuditSettings{
+			SamplingRate:       defaultAuditSampling,
+			DeniedSamplingRate: defaultDeniedSampling,
+		},
+	}
 }
 
 func createExtension(
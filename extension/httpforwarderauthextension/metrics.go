@@ -0,0 +1,96 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpforwarderauthextension
+
+import (
+	"context"
+	"errors"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+const (
+	// results of an authentication
+	resultOK              = "ok"
+	resultDenied          = "denied"
+	resultDisabled        = "disabled"
+	resultInvalidToken    = "invalid_token"
+	resultUnauthenticated = "unauthenticated"
+	resultError           = "error"
+
+	// results of an apikey cache lookup
+	cacheHit   = "hit"
+	cacheMiss  = "miss"
+	cacheStale = "stale"
+)
+
+var (
+	tagResult = tag.MustNewKey("result")
+
+	mRequests     = stats.Int64("requests", "Number of authentications by result", stats.UnitDimensionless)
+	mCacheLookups = stats.Int64("cache_lookups", "Number of apikey cache lookups by result", stats.UnitDimensionless)
+	mCheckLatency = stats.Float64("check_latency", "Latency of the apikey check url calls by result", stats.UnitMilliseconds)
+)
+
+// metricViews returns the views of the self-telemetry metrics.
+func metricViews() []*view.View {
+	return []*view.View{
+		{
+			Name:        typeStr + "/" + mRequests.Name(),
+			Measure:     mRequests,
+			Description: mRequests.Description(),
+			TagKeys:     []tag.Key{tagResult},
+			Aggregation: view.Sum(),
+		},
+		{
+			Name:        typeStr + "/" + mCacheLookups.Name(),
+			Measure:     mCacheLookups,
+			Description: mCacheLookups.Description(),
+			TagKeys:     []tag.Key{tagResult},
+			Aggregation: view.Sum(),
+		},
+		{
+			Name:        typeStr + "/" + mCheckLatency.Name(),
+			Measure:     mCheckLatency,
+			Description: mCheckLatency.Description(),
+			TagKeys:     []tag.Key{tagResult},
+			Aggregation: view.Distribution(5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000),
+		},
+	}
+}
+
+func record(result string, m stats.Measurement) {
+	_ = stats.RecordWithTags(context.Background(), []tag.Mutator{tag.Upsert(tagResult, result)}, m)
+}
+
+// resultOf classifies the error returned by authenticate.
+func resultOf(err error) string {
+	switch {
+	case err == nil:
+		return resultOK
+	case errors.Is(err, errAuthenticationPermissionDenied):
+		return resultDenied
+	case errors.Is(err, errNoSignalEnabled), errors.Is(err, errSignalDisabled):
+		return resultDisabled
+	case errors.Is(err, errInvalidToken):
+		return resultInvalidToken
+	case errors.Is(err, errNotAuthenticated), errors.Is(err, errNoCertificate):
+		return resultUnauthenticated
+	default:
+		return resultError
+	}
+}
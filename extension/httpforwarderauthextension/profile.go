@@ -0,0 +1,97 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpforwarderauthextension
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+)
+
+// tenantProfile is what an apikey resolves to, parsed from the check url response:
+//
+//	{"tenant": "default", "traceStatus": "true", "metricStatus": "true", "logStatus": "false",
+//	 "environment": "prod", "quotas": {"spans_per_second": 1000}, "attributes": {"region": "cn-hangzhou"}}
+type tenantProfile struct {
+	Tenant string `json:"tenant"`
+	// TraceStatus, MetricStatus and LogStatus enable or disable a signal, unset means enabled.
+	TraceStatus  *flexBool          `json:"traceStatus"`
+	MetricStatus *flexBool          `json:"metricStatus"`
+	LogStatus    *flexBool          `json:"logStatus"`
+	Environment  string             `json:"environment"`
+	Quotas       map[string]float64 `json:"quotas"`
+	Attributes   map[string]string  `json:"attributes"`
+}
+
+func parseProfile(body []byte) (*tenantProfile, error) {
+	profile := &tenantProfile{}
+	if err := json.Unmarshal(body, profile); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// granted reports whether the apikey belongs to a tenant.
+func (p *tenantProfile) granted() bool {
+	return p.Tenant != ""
+}
+
+// signals returns the signals the tenant may send.
+func (p *tenantProfile) signals() []string {
+	signals := make([]string, 0, 3)
+	for _, s := range []struct {
+		name   string
+		status *flexBool
+	}{
+		{tenantauth.SignalTraces, p.TraceStatus},
+		{tenantauth.SignalMetrics, p.MetricStatus},
+		{tenantauth.SignalLogs, p.LogStatus},
+	} {
+		if s.status == nil || bool(*s.status) {
+			signals = append(signals, s.name)
+		}
+	}
+	return signals
+}
+
+// flexBool accepts both JSON booleans and the "true"/"false" strings the check url answers.
+type flexBool bool
+
+func newFlexBool(b bool) *flexBool {
+	f := flexBool(b)
+	return &f
+}
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case bool:
+		*b = flexBool(v)
+	case string:
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		*b = flexBool(parsed)
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpforwarderauthextension
+
+import (
+	"context"
+	"strings"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+)
+
+// signalMethods are the prefixes of the gRPC methods of each signal.
+var signalMethods = map[string][]string{
+	tenantauth.SignalTraces: {
+		"/opentelemetry.proto.collector.trace.",
+		"/skywalking.v3.TraceSegmentReportService/",
+	},
+	tenantauth.SignalMetrics: {
+		"/opentelemetry.proto.collector.metrics.",
+		"/skywalking.v3.JVMMetricReportService/",
+		"/skywalking.v3.MeterReportService/",
+		"/skywalking.v3.CLRMetricReportService/",
+	},
+	tenantauth.SignalLogs: {
+		"/opentelemetry.proto.collector.logs.",
+		"/skywalking.v3.LogReportService/",
+	},
+}
+
+// signalPaths are the suffixes of the HTTP paths of each signal, below any apikey-carrying prefix.
+var signalPaths = map[string][]string{
+	tenantauth.SignalTraces:  {"/v1/traces", "/v0.3/traces", "/v0.4/traces", "/v0.5/traces", "/v0.7/traces", "/v3/segments"},
+	tenantauth.SignalMetrics: {"/v1/metrics"},
+	tenantauth.SignalLogs:    {"/v1/logs", "/track", "/track_ua.gif"},
+}
+
+// requestSignal returns the signal of the request authenticated with ctx, told by its gRPC method or, for the
+// HoloInsight receivers describing their HTTP requests, its path. It is empty when the request doesn't tell, e.g. the
+// SkyWalking management calls or the requests of the other receivers.
+func requestSignal(ctx context.Context) string {
+	path := tenantresolver.RequestOf(ctx, "").Path
+	if path == "" {
+		return ""
+	}
+	for signal, prefixes := range signalMethods {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(path, prefix) {
+				return signal
+			}
+		}
+	}
+	for signal, suffixes := range signalPaths {
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(path, suffix) {
+				return signal
+			}
+		}
+	}
+	return ""
+}
+
+// allows reports whether the tenant may send signal.
+func (p *tenantProfile) allows(signal string) bool {
+	for _, s := range p.signals() {
+		if s == signal {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpforwarderauthextension
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/extension/auth"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+)
+
+// methodStream carries the method of a gRPC call.
+type methodStream struct {
+	grpc.ServerTransportStream
+	method string
+}
+
+func (s *methodStream) Method() string {
+	return s.method
+}
+
+// methodContext is the context of a gRPC call of method.
+func methodContext(method string) context.Context {
+	return grpc.NewContextWithServerTransportStream(context.Background(), &methodStream{method: method})
+}
+
+// pathContext is the context of an HTTP request of path received by a HoloInsight receiver.
+func pathContext(path string) context.Context {
+	var ctx context.Context
+	handler := tenantresolver.Handler("0.0.0.0:4318", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+	return ctx
+}
+
+func TestRequestSignal(t *testing.T) {
+	for _, tc := range []struct {
+		ctx    context.Context
+		signal string
+	}{
+		{methodContext("/opentelemetry.proto.collector.trace.v1.TraceService/Export"), tenantauth.SignalTraces},
+		{methodContext("/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"), tenantauth.SignalMetrics},
+		{methodContext("/opentelemetry.proto.collector.logs.v1.LogsService/Export"), tenantauth.SignalLogs},
+		{methodContext("/skywalking.v3.TraceSegmentReportService/collect"), tenantauth.SignalTraces},
+		{methodContext("/skywalking.v3.JVMMetricReportService/collect"), tenantauth.SignalMetrics},
+		{methodContext("/skywalking.v3.ManagementService/keepAlive"), ""},
+		{pathContext("/v1/traces"), tenantauth.SignalTraces},
+		{pathContext("/apikey/v1/metrics"), tenantauth.SignalMetrics},
+		{pathContext("/v0.4/traces"), tenantauth.SignalTraces},
+		{pathContext("/v3/segments"), tenantauth.SignalTraces},
+		{pathContext("/logstores/store/track"), tenantauth.SignalLogs},
+		{pathContext("/logstores/store/track_ua.gif"), tenantauth.SignalLogs},
+		{pathContext("/info"), ""},
+		{context.Background(), ""},
+	} {
+		assert.Equal(t, tc.signal, requestSignal(tc.ctx), tenantresolver.RequestOf(tc.ctx, "").Path)
+	}
+}
+
+func TestAuthenticateDisabledSignal(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.Store.Path = filepath.Join(t.TempDir(), "apikeys.yaml")
+	writeStore(t, cfg.Store.Path, "apikeys:\n  - apikey: key1\n    tenant: t1\n    trace_status: false\n")
+	ext, err := newExtension(cfg, zap.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, ext.Start(context.Background(), componenttest.NewNopHost()))
+	defer func() {
+		require.NoError(t, ext.Shutdown(context.Background()))
+	}()
+
+	headers := map[string][]string{Authentication: {"key1"}}
+	for _, tc := range []struct {
+		ctx context.Context
+		err error
+	}{
+		// the requests of the disabled signal are denied
+		{methodContext("/opentelemetry.proto.collector.trace.v1.TraceService/Export"), errSignalDisabled},
+		{methodContext("/skywalking.v3.TraceSegmentReportService/collect"), errSignalDisabled},
+		{pathContext("/apikey/v1/traces"), errSignalDisabled},
+		{pathContext("/v0.4/traces"), errSignalDisabled},
+		// the requests of the enabled signals, or not telling their signal, are accepted
+		{methodContext("/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"), nil},
+		{methodContext("/skywalking.v3.ManagementService/keepAlive"), nil},
+		{pathContext("/logstores/store/track"), nil},
+		{context.Background(), nil},
+	} {
+		_, err = ext.(auth.Server).Authenticate(tc.ctx, headers)
+		if tc.err != nil {
+			assert.ErrorIs(t, err, tc.err, tenantresolver.RequestOf(tc.ctx, "").Path)
+		} else {
+			assert.NoError(t, err, tenantresolver.RequestOf(tc.ctx, "").Path)
+		}
+	}
+}
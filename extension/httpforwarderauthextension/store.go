@@ -0,0 +1,220 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpforwarderauthextension
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// storeFile is the layout of the apikey store file. JSON files use the same field names.
+//
+//	apikeys:
+//	  - apikey: 0a1b2c
+//	    tenant: default
+//	  - apikey_sha256: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+//	    tenant: edge
+//	    trace_status: false
+//	    environment: prod
+//	    quotas:
+//	      spans_per_second: 1000
+//	    attributes:
+//	      region: cn-hangzhou
+//	  - identity: spiffe://holoinsight/agent/edge
+//	    tenant: edge
+type storeFile struct {
+	APIKeys []storeEntry `yaml:"apikeys"`
+}
+
+type storeEntry struct {
+	APIKey       string             `yaml:"apikey"`
+	APIKeySHA256 string             `yaml:"apikey_sha256"`
+	Identity     string             `yaml:"identity"`
+	Tenant       string             `yaml:"tenant"`
+	TraceStatus  *bool              `yaml:"trace_status"`
+	MetricStatus *bool              `yaml:"metric_status"`
+	LogStatus    *bool              `yaml:"log_status"`
+	Environment  string             `yaml:"environment"`
+	Quotas       map[string]float64 `yaml:"quotas"`
+	Attributes   map[string]string  `yaml:"attributes"`
+}
+
+func (e *storeEntry) profile() *tenantProfile {
+	profile := &tenantProfile{
+		Tenant:      e.Tenant,
+		Environment: e.Environment,
+		Quotas:      e.Quotas,
+		Attributes:  e.Attributes,
+	}
+	if e.TraceStatus != nil {
+		profile.TraceStatus = newFlexBool(*e.TraceStatus)
+	}
+	if e.MetricStatus != nil {
+		profile.MetricStatus = newFlexBool(*e.MetricStatus)
+	}
+	if e.LogStatus != nil {
+		profile.LogStatus = newFlexBool(*e.LogStatus)
+	}
+	return profile
+}
+
+// apikeyStore resolves apikeys and certificate identities from a local file, reloaded when it changes.
+type apikeyStore struct {
+	path           string
+	reloadInterval time.Duration
+	logger         *zap.Logger
+
+	mu         sync.RWMutex
+	plain      map[string]*tenantProfile
+	hashed     map[string]*tenantProfile
+	identities map[string]*tenantProfile
+	modTime    time.Time
+	size       int64
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newAPIKeyStore(settings *StoreSettings, logger *zap.Logger) *apikeyStore {
+	return &apikeyStore{
+		path:           settings.Path,
+		reloadInterval: settings.ReloadInterval,
+		logger:         logger,
+		done:           make(chan struct{}),
+	}
+}
+
+// start loads the file and watches it for changes.
+func (s *apikeyStore) start() error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	if s.reloadInterval <= 0 {
+		return nil
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.reloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.reload()
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *apikeyStore) shutdown() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+// reload loads the file again when its modification time or size changed,
+// keeping the current apikeys when the new content is invalid.
+func (s *apikeyStore) reload() {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		s.logger.Warn("[httpforwarderauthextension] apikey store stat error: ", zap.Error(err))
+		return
+	}
+	s.mu.RLock()
+	changed := !info.ModTime().Equal(s.modTime) || info.Size() != s.size
+	s.mu.RUnlock()
+	if !changed {
+		return
+	}
+	if err = s.load(); err != nil {
+		s.logger.Error("[httpforwarderauthextension] apikey store reload error, keeping the previous apikeys: ", zap.Error(err))
+		return
+	}
+	s.logger.Info("[httpforwarderauthextension] apikey store reloaded", zap.String("path", s.path))
+}
+
+func (s *apikeyStore) load() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var file storeFile
+	if err = yaml.Unmarshal(content, &file); err != nil {
+		return fmt.Errorf("invalid apikey store %q: %w", s.path, err)
+	}
+
+	plain := make(map[string]*tenantProfile)
+	hashed := make(map[string]*tenantProfile)
+	identities := make(map[string]*tenantProfile)
+	for i, entry := range file.APIKeys {
+		if entry.Tenant == "" {
+			return fmt.Errorf("invalid apikey store %q: entry %d has no tenant", s.path, i)
+		}
+		profile := entry.profile()
+		switch {
+		case entry.APIKey != "" && entry.APIKeySHA256 == "" && entry.Identity == "":
+			plain[entry.APIKey] = profile
+		case entry.APIKey == "" && entry.APIKeySHA256 != "" && entry.Identity == "":
+			hashed[strings.ToLower(entry.APIKeySHA256)] = profile
+		case entry.APIKey == "" && entry.APIKeySHA256 == "" && entry.Identity != "":
+			identities[entry.Identity] = profile
+		default:
+			return fmt.Errorf("invalid apikey store %q: entry %d must set exactly one of apikey, apikey_sha256 and identity", s.path, i)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.plain = plain
+	s.hashed = hashed
+	s.identities = identities
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return nil
+}
+
+// lookup returns the profile stored for the credential, found is false when the store doesn't know it.
+func (s *apikeyStore) lookup(kind credentialKind, value string) (*tenantProfile, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if kind == credentialIdentity {
+		profile, ok := s.identities[value]
+		return profile, ok
+	}
+	apikey := value
+	if profile, ok := s.plain[apikey]; ok {
+		return profile, true
+	}
+	if len(s.hashed) == 0 {
+		return nil, false
+	}
+	sum := sha256.Sum256([]byte(apikey))
+	profile, ok := s.hashed[hex.EncodeToString(sum[:])]
+	return profile, ok
+}
@@ -0,0 +1,162 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpforwarderauthextension
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// writeStore replaces the store file at once, the reload never reading it half written.
+func writeStore(t *testing.T, path, content string) {
+	tmp := path + ".tmp"
+	require.NoError(t, os.WriteFile(tmp, []byte(content), 0600))
+	require.NoError(t, os.Rename(tmp, path))
+}
+
+func newTestStore(t *testing.T, content string, reloadInterval time.Duration) (*apikeyStore, string) {
+	path := filepath.Join(t.TempDir(), "apikeys.yaml")
+	writeStore(t, path, content)
+	s := newAPIKeyStore(&StoreSettings{Path: path, ReloadInterval: reloadInterval}, zap.NewNop())
+	return s, path
+}
+
+func TestStoreLoad(t *testing.T) {
+	sum := sha256.Sum256([]byte("hashed-key"))
+	s, _ := newTestStore(t, `
+apikeys:
+  - apikey: plain-key
+    tenant: t1
+    log_status: false
+    environment: prod
+  - apikey_sha256: `+strings.ToUpper(hex.EncodeToString(sum[:]))+`
+    tenant: t2
+    quotas:
+      spans_per_second: 10
+  - identity: spiffe://holoinsight/agent
+    tenant: t3
+`, 0)
+	require.NoError(t, s.start())
+	defer s.shutdown()
+
+	profile, ok := s.lookup(credentialAPIKey, "plain-key")
+	require.True(t, ok)
+	assert.Equal(t, "t1", profile.Tenant)
+	assert.Equal(t, "prod", profile.Environment)
+	assert.Equal(t, []string{"traces", "metrics"}, profile.signals())
+
+	profile, ok = s.lookup(credentialAPIKey, "hashed-key")
+	require.True(t, ok)
+	assert.Equal(t, "t2", profile.Tenant)
+	assert.Equal(t, 10.0, profile.Quotas["spans_per_second"])
+
+	profile, ok = s.lookup(credentialIdentity, "spiffe://holoinsight/agent")
+	require.True(t, ok)
+	assert.Equal(t, "t3", profile.Tenant)
+
+	// identities and apikeys don't resolve each other
+	_, ok = s.lookup(credentialAPIKey, "spiffe://holoinsight/agent")
+	assert.False(t, ok)
+	_, ok = s.lookup(credentialIdentity, "plain-key")
+	assert.False(t, ok)
+	_, ok = s.lookup(credentialAPIKey, "unknown")
+	assert.False(t, ok)
+}
+
+func TestStoreInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "two credentials",
+			content: "apikeys:\n  - apikey: a\n    identity: b\n    tenant: t1\n",
+		},
+		{
+			name:    "no credential",
+			content: "apikeys:\n  - tenant: t1\n",
+		},
+		{
+			name:    "no tenant",
+			content: "apikeys:\n  - apikey: a\n",
+		},
+		{
+			name:    "not yaml",
+			content: "apikeys: [",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestStore(t, tt.content, 0)
+			assert.Error(t, s.start())
+		})
+	}
+}
+
+func TestStoreReload(t *testing.T) {
+	s, path := newTestStore(t, "apikeys:\n  - apikey: a\n    tenant: t1\n", 10*time.Millisecond)
+	require.NoError(t, s.start())
+	defer s.shutdown()
+
+	// the size changes, the file being written within the time granularity of the file system
+	writeStore(t, path, "apikeys:\n  - apikey: b\n    tenant: t22\n")
+	require.Eventually(t, func() bool {
+		_, ok := s.lookup(credentialAPIKey, "b")
+		return ok
+	}, time.Second, 5*time.Millisecond)
+	_, ok := s.lookup(credentialAPIKey, "a")
+	assert.False(t, ok)
+
+	// an invalid file keeps the previous apikeys
+	writeStore(t, path, "apikeys:\n  - apikey: c\n")
+	s.reload()
+	profile, ok := s.lookup(credentialAPIKey, "b")
+	require.True(t, ok)
+	assert.Equal(t, "t22", profile.Tenant)
+	_, ok = s.lookup(credentialAPIKey, "c")
+	assert.False(t, ok)
+}
+
+func TestStoreReloadOnModTime(t *testing.T) {
+	s, path := newTestStore(t, "apikeys:\n  - apikey: a\n    tenant: t1\n", 0)
+	require.NoError(t, s.start())
+	defer s.shutdown()
+
+	// same size, only the modification time tells the file changed
+	writeStore(t, path, "apikeys:\n  - apikey: a\n    tenant: t2\n")
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(path, future, future))
+	s.reload()
+	profile, ok := s.lookup(credentialAPIKey, "a")
+	require.True(t, ok)
+	assert.Equal(t, "t2", profile.Tenant)
+
+	// unchanged files aren't parsed again
+	s.mu.Lock()
+	s.plain = nil
+	s.mu.Unlock()
+	s.reload()
+	_, ok = s.lookup(credentialAPIKey, "a")
+	assert.False(t, ok)
+}
@@ -0,0 +1,258 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpforwarderauthextension
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"gopkg.in/square/go-jose.v2"
+)
+
+var (
+	errInvalidToken = errors.New("invalid apikey token")
+
+	tokenAlgorithms = map[string]bool{
+		"HS256": true, "HS384": true, "HS512": true,
+		"RS256": true, "RS384": true, "RS512": true,
+		"PS256": true, "PS384": true, "PS512": true,
+		"ES256": true, "ES384": true, "ES512": true,
+	}
+)
+
+// tokenClaims are the claims of a signed apikey.
+//
+//	{"tenant": "default", "permissions": {"traces": true, "logs": false}, "tags": {"env": "prod"}, "exp": 1700000000,
+//	 "environment": "prod", "quotas": {"spans_per_second": 1000}, "attributes": {"region": "cn-hangzhou"}}
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Tenant string `json:"tenant"`
+	// Permissions enables or disables a signal (traces, metrics, logs), signals not listed are enabled.
+	Permissions map[string]bool `json:"permissions"`
+	// Tags are added to the resource of the received data, like the extend tags of a plain apikey.
+	Tags        map[string]string  `json:"tags"`
+	Environment string             `json:"environment"`
+	Quotas      map[string]float64 `json:"quotas"`
+	Attributes  map[string]string  `json:"attributes"`
+}
+
+// profile returns the tenant profile the claims describe.
+func (c *tokenClaims) profile() *tenantProfile {
+	profile := &tenantProfile{
+		Tenant:      c.Tenant,
+		Environment: c.Environment,
+		Quotas:      c.Quotas,
+		Attributes:  c.Attributes,
+	}
+	if enabled, ok := c.Permissions[tenantauth.SignalTraces]; ok {
+		profile.TraceStatus = newFlexBool(enabled)
+	}
+	if enabled, ok := c.Permissions[tenantauth.SignalMetrics]; ok {
+		profile.MetricStatus = newFlexBool(enabled)
+	}
+	if enabled, ok := c.Permissions[tenantauth.SignalLogs]; ok {
+		profile.LogStatus = newFlexBool(enabled)
+	}
+	return profile
+}
+
+// verificationKey is a key tokens can be signed with.
+type verificationKey struct {
+	id        string
+	algorithm string
+	key       interface{}
+}
+
+// tokenVerifier verifies signed apikeys against the configured keys, without calling the check url.
+type tokenVerifier struct {
+	settings *TokenSettings
+	keys     []verificationKey
+	parser   *jwt.Parser
+}
+
+func newTokenVerifier(settings *TokenSettings) *tokenVerifier {
+	return &tokenVerifier{settings: settings}
+}
+
+// load reads the configured key files.
+func (v *tokenVerifier) load() error {
+	methods := make(map[string]bool)
+	for _, k := range v.settings.Keys {
+		key, err := k.load()
+		if err != nil {
+			return fmt.Errorf("invalid token key %q: %w", k.KeyID, err)
+		}
+		v.keys = append(v.keys, verificationKey{id: k.KeyID, algorithm: k.Algorithm, key: key})
+		methods[k.Algorithm] = true
+	}
+
+	if v.settings.JWKSFile != "" {
+		content, err := os.ReadFile(v.settings.JWKSFile)
+		if err != nil {
+			return err
+		}
+		var set jose.JSONWebKeySet
+		if err = json.Unmarshal(content, &set); err != nil {
+			return fmt.Errorf("invalid jwks file %q: %w", v.settings.JWKSFile, err)
+		}
+		for _, k := range set.Keys {
+			if !k.IsPublic() && !isSecret(k.Key) {
+				return fmt.Errorf("invalid jwks file %q: key %q is a private key", v.settings.JWKSFile, k.KeyID)
+			}
+			v.keys = append(v.keys, verificationKey{id: k.KeyID, algorithm: k.Algorithm, key: k.Key})
+			if k.Algorithm != "" {
+				methods[k.Algorithm] = true
+			} else {
+				for _, alg := range algorithmsOf(k.Key) {
+					methods[alg] = true
+				}
+			}
+		}
+	}
+
+	validMethods := make([]string, 0, len(methods))
+	for method := range methods {
+		if tokenAlgorithms[method] {
+			validMethods = append(validMethods, method)
+		}
+	}
+	v.parser = jwt.NewParser(jwt.WithValidMethods(validMethods))
+	return nil
+}
+
+// verify checks the signature and the time, issuer and audience claims of token.
+func (v *tokenVerifier) verify(token string) (*tokenClaims, error) {
+	claims := &tokenClaims{}
+	if _, err := v.parser.ParseWithClaims(token, claims, v.keyFunc); err != nil {
+		return nil, err
+	}
+	if v.settings.Issuer != "" && !claims.VerifyIssuer(v.settings.Issuer, true) {
+		return nil, errors.New("unexpected token issuer")
+	}
+	if v.settings.Audience != "" && !claims.VerifyAudience(v.settings.Audience, true) {
+		return nil, errors.New("unexpected token audience")
+	}
+	// tokens without expiry would be valid forever
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("token has no expiry")
+	}
+	if v.settings.MaxLifetime > 0 {
+		if claims.IssuedAt == nil {
+			return nil, errors.New("token has no issue time")
+		}
+		if claims.ExpiresAt.Sub(claims.IssuedAt.Time) > v.settings.MaxLifetime {
+			return nil, fmt.Errorf("token lifetime exceeds %s", v.settings.MaxLifetime)
+		}
+	}
+	if claims.Tenant == "" {
+		return nil, errors.New("token has no tenant")
+	}
+	return claims, nil
+}
+
+// keyFunc picks the key matching the token key id, or the only key usable with its algorithm.
+func (v *tokenVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	alg := token.Method.Alg()
+	kid, _ := token.Header["kid"].(string)
+	var candidates []verificationKey
+	for _, k := range v.keys {
+		if kid != "" && k.id != kid {
+			continue
+		}
+		if k.algorithm != "" && k.algorithm != alg {
+			continue
+		}
+		if !usableWith(k.key, alg) {
+			continue
+		}
+		candidates = append(candidates, k)
+	}
+	if len(candidates) != 1 {
+		return nil, fmt.Errorf("no unique key for key id %q and algorithm %s", kid, alg)
+	}
+	return candidates[0].key, nil
+}
+
+// load reads the key of a configured verification key.
+func (k *TokenKey) load() (interface{}, error) {
+	if strings.HasPrefix(k.Algorithm, "HS") {
+		return []byte(k.Secret), nil
+	}
+	content, err := os.ReadFile(k.PublicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(k.Algorithm, "ES") {
+		return jwt.ParseECPublicKeyFromPEM(content)
+	}
+	return jwt.ParseRSAPublicKeyFromPEM(content)
+}
+
+func isSecret(key interface{}) bool {
+	_, ok := key.([]byte)
+	return ok
+}
+
+// usableWith reports whether key has the type required by the signing algorithm alg,
+// so a public key can never be used as an HMAC secret.
+func usableWith(key interface{}, alg string) bool {
+	switch key.(type) {
+	case []byte:
+		return strings.HasPrefix(alg, "HS")
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(alg, "ES")
+	default:
+		return false
+	}
+}
+
+func algorithmsOf(key interface{}) []string {
+	switch key.(type) {
+	case []byte:
+		return []string{"HS256", "HS384", "HS512"}
+	case *rsa.PublicKey:
+		return []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}
+	case *ecdsa.PublicKey:
+		return []string{"ES256", "ES384", "ES512"}
+	default:
+		return nil
+	}
+}
+
+// isToken reports whether apikey is a JWS compact serialization rather than a plain apikey.
+func isToken(apikey string) bool {
+	parts := strings.Split(apikey, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	return json.Unmarshal(header, &h) == nil && h.Alg != ""
+}
@@ -0,0 +1,250 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpforwarderauthextension
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// writePublicKey writes the PEM encoded public key to a file of dir.
+func writePublicKey(t *testing.T, dir, name string, key interface{}) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+	return path
+}
+
+func writeJWKS(t *testing.T, dir string, keys ...jose.JSONWebKey) string {
+	content, err := json.Marshal(jose.JSONWebKeySet{Keys: keys})
+	require.NoError(t, err)
+	path := filepath.Join(dir, "jwks.json")
+	require.NoError(t, os.WriteFile(path, content, 0600))
+	return path
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"tenant": "t1",
+		"iss":    "holoinsight",
+		"aud":    "collector",
+		"iat":    now.Unix(),
+		"exp":    now.Add(time.Hour).Unix(),
+	}
+}
+
+func withClaim(name string, value interface{}) jwt.MapClaims {
+	claims := validClaims()
+	if value == nil {
+		delete(claims, name)
+	} else {
+		claims[name] = value
+	}
+	return claims
+}
+
+func TestTokenVerify(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	jwksKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaPath := writePublicKey(t, dir, "rsa.pem", &rsaKey.PublicKey)
+	rsaPEM, err := os.ReadFile(rsaPath)
+	require.NoError(t, err)
+
+	settings := &TokenSettings{
+		Keys: []TokenKey{
+			{KeyID: "hs", Algorithm: "HS256", Secret: testSecret},
+			{KeyID: "rs", Algorithm: "RS256", PublicKeyFile: rsaPath},
+			{KeyID: "es", Algorithm: "ES256", PublicKeyFile: writePublicKey(t, dir, "ec.pem", &ecKey.PublicKey)},
+			{KeyID: "dup", Algorithm: "HS256", Secret: testSecret},
+			{KeyID: "dup", Algorithm: "HS256", Secret: "another secret"},
+		},
+		JWKSFile:    writeJWKS(t, dir, jose.JSONWebKey{Key: &jwksKey.PublicKey, KeyID: "jwks", Algorithm: "ES256"}),
+		Issuer:      "holoinsight",
+		Audience:    "collector",
+		MaxLifetime: 24 * time.Hour,
+	}
+	v := newTokenVerifier(settings)
+	require.NoError(t, v.load())
+
+	now := time.Now()
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "HS256", token: sign(t, jwt.SigningMethodHS256, "hs", []byte(testSecret), validClaims())},
+		{name: "RS256", token: sign(t, jwt.SigningMethodRS256, "rs", rsaKey, validClaims())},
+		{name: "ES256", token: sign(t, jwt.SigningMethodES256, "es", ecKey, validClaims())},
+		{name: "JWKS", token: sign(t, jwt.SigningMethodES256, "jwks", jwksKey, validClaims())},
+		{name: "no kid", token: sign(t, jwt.SigningMethodRS256, "", rsaKey, validClaims())},
+		{
+			name:    "RSA public key as HMAC secret",
+			token:   sign(t, jwt.SigningMethodHS256, "rs", rsaPEM, validClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "RSA public key as HMAC secret without kid",
+			token:   sign(t, jwt.SigningMethodHS256, "", rsaPEM, validClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "alg none",
+			token:   sign(t, jwt.SigningMethodNone, "hs", jwt.UnsafeAllowNoneSignatureType, validClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "wrong secret",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", []byte("wrong"), validClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "unknown kid",
+			token:   sign(t, jwt.SigningMethodHS256, "unknown", []byte(testSecret), validClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "duplicate kid",
+			token:   sign(t, jwt.SigningMethodHS256, "dup", []byte(testSecret), validClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "algorithm of another key",
+			token:   sign(t, jwt.SigningMethodES256, "rs", ecKey, validClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "wrong issuer",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", []byte(testSecret), withClaim("iss", "other")),
+			wantErr: true,
+		},
+		{
+			name:    "wrong audience",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", []byte(testSecret), withClaim("aud", "other")),
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", []byte(testSecret), withClaim("exp", now.Add(-time.Minute).Unix())),
+			wantErr: true,
+		},
+		{
+			name:    "not yet valid",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", []byte(testSecret), withClaim("nbf", now.Add(time.Hour).Unix())),
+			wantErr: true,
+		},
+		{
+			name:    "no expiry",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", []byte(testSecret), withClaim("exp", nil)),
+			wantErr: true,
+		},
+		{
+			name:    "no issue time",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", []byte(testSecret), withClaim("iat", nil)),
+			wantErr: true,
+		},
+		{
+			name:    "lifetime over max_lifetime",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", []byte(testSecret), withClaim("exp", now.Add(48*time.Hour).Unix())),
+			wantErr: true,
+		},
+		{
+			name:    "no tenant",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", []byte(testSecret), withClaim("tenant", nil)),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.verify(tt.token)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "t1", claims.Tenant)
+		})
+	}
+}
+
+func TestTokenVerifyWithoutMaxLifetime(t *testing.T) {
+	v := newTokenVerifier(&TokenSettings{Keys: []TokenKey{{Algorithm: "HS256", Secret: testSecret}}})
+	require.NoError(t, v.load())
+
+	claims := withClaim("iat", nil)
+	claims["exp"] = time.Now().Add(365 * 24 * time.Hour).Unix()
+	_, err := v.verify(sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims))
+	assert.NoError(t, err)
+
+	_, err = v.verify(sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), withClaim("exp", nil)))
+	assert.Error(t, err)
+}
+
+func TestTokenJWKSPrivateKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	v := newTokenVerifier(&TokenSettings{JWKSFile: writeJWKS(t, t.TempDir(), jose.JSONWebKey{Key: rsaKey, KeyID: "private", Algorithm: "RS256"})})
+	assert.ErrorContains(t, v.load(), "private key")
+}
+
+func TestIsToken(t *testing.T) {
+	tests := []struct {
+		apikey string
+		want   bool
+	}{
+		{apikey: sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), validClaims()), want: true},
+		{apikey: "c2VjcmV0"},
+		{apikey: "0123456789abcdef"},
+		{apikey: "v1.key1.Y2lwaGVydGV4dA"},
+		{apikey: "a.b.c"},
+		{apikey: "eyJmb28iOiJiYXIifQ.e30.c2ln"},
+		{apikey: ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, isToken(tt.apikey), tt.apikey)
+	}
+}
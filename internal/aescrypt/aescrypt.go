@@ -0,0 +1,206 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package aescrypt encrypts and decrypts the values HoloInsight hands to agents, like apikeys and logstores.
+//
+// Values are encrypted with AES-GCM as "v1.<key id>.<base64url(nonce|ciphertext)>", the key id selecting one
+// of several active keys so keys can be rotated. The hex encoded AES-CBC (with an IV) and AES-ECB (without)
+// values of the HoloInsight backend can still be decrypted with a legacy key.
+package aescrypt // import "github.com/traas-stack/holoinsight-collector/internal/aescrypt"
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const versionPrefix = "v1."
+
+// ErrDecrypt is returned for every value which can't be decrypted, whatever the reason,
+// so failures don't tell anything about the value or the keys.
+var ErrDecrypt = errors.New("cannot decrypt value")
+
+// Key is a key used for authenticated encryption.
+type Key struct {
+	// ID names the key in the encrypted values, letters, digits, '-' and '_' only.
+	ID string `mapstructure:"id"`
+	// Secret is the base64 encoded 16, 24 or 32 byte AES key.
+	Secret string `mapstructure:"secret"`
+}
+
+// Keyring holds the keys values are decrypted with. The first key encrypts new values.
+type Keyring struct {
+	primary  string
+	aeads    map[string]cipher.AEAD
+	legacy   cipher.Block
+	legacyIV []byte
+}
+
+// New creates a Keyring from the AES-GCM keys and the optional legacy key and IV of the HoloInsight backend.
+// The legacy key is truncated or zero padded to 16 bytes, like the backend does.
+func New(keys []Key, legacyKey, legacyIV string) (*Keyring, error) {
+	k := &Keyring{aeads: make(map[string]cipher.AEAD, len(keys))}
+	for i, key := range keys {
+		if !validID(key.ID) {
+			return nil, fmt.Errorf("key %d: invalid key id %q", i, key.ID)
+		}
+		if _, ok := k.aeads[key.ID]; ok {
+			return nil, fmt.Errorf("key %d: duplicate key id %q", i, key.ID)
+		}
+		secret, err := base64.StdEncoding.DecodeString(key.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: secret is not base64 encoded: %w", key.ID, err)
+		}
+		block, err := aes.NewCipher(secret)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", key.ID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", key.ID, err)
+		}
+		k.aeads[key.ID] = aead
+		if i == 0 {
+			k.primary = key.ID
+		}
+	}
+
+	if legacyKey != "" {
+		keyBytes := make([]byte, aes.BlockSize)
+		copy(keyBytes, legacyKey)
+		block, err := aes.NewCipher(keyBytes)
+		if err != nil {
+			return nil, err
+		}
+		k.legacy = block
+		if legacyIV != "" {
+			k.legacyIV = make([]byte, aes.BlockSize)
+			copy(k.legacyIV, legacyIV)
+		}
+	} else if legacyIV != "" {
+		return nil, errors.New("legacy iv requires a legacy secret key")
+	}
+	return k, nil
+}
+
+// Encrypt encrypts value with the first key.
+func (k *Keyring) Encrypt(value string) (string, error) {
+	if k.primary == "" {
+		return "", errors.New("no encryption key")
+	}
+	aead := k.aeads[k.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	header := versionPrefix + k.primary
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(header))
+	return header + "." + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value encrypted with any key of the keyring, or with the legacy key.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if strings.HasPrefix(value, versionPrefix) {
+		return k.decryptGCM(value)
+	}
+	if k.legacy != nil {
+		return k.decryptLegacy(value)
+	}
+	return "", ErrDecrypt
+}
+
+func (k *Keyring) decryptGCM(value string) (string, error) {
+	idx := strings.LastIndexByte(value, '.')
+	if idx < len(versionPrefix) {
+		return "", ErrDecrypt
+	}
+	header := value[:idx]
+	aead, ok := k.aeads[header[len(versionPrefix):]]
+	if !ok {
+		return "", ErrDecrypt
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(value[idx+1:])
+	if err != nil || len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return "", ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(header))
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(plaintext), nil
+}
+
+// decryptLegacy decrypts the hex encoded, PKCS#7 padded AES-CBC or AES-ECB values of the HoloInsight backend.
+func (k *Keyring) decryptLegacy(value string) (string, error) {
+	data, err := hex.DecodeString(value)
+	if err != nil || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return "", ErrDecrypt
+	}
+	result := make([]byte, len(data))
+	if k.legacyIV != nil {
+		cipher.NewCBCDecrypter(k.legacy, k.legacyIV).CryptBlocks(result, data)
+	} else {
+		for i := 0; i < len(data); i += aes.BlockSize {
+			k.legacy.Decrypt(result[i:i+aes.BlockSize], data[i:i+aes.BlockSize])
+		}
+	}
+	plaintext, ok := unpad(result)
+	if !ok {
+		return "", ErrDecrypt
+	}
+	return string(plaintext), nil
+}
+
+// unpad removes the PKCS#7 padding of b, checking it in constant time. len(b) is a non-zero multiple of the block size.
+func unpad(b []byte) ([]byte, bool) {
+	n := len(b)
+	pad := int(b[n-1])
+	good := subtle.ConstantTimeLessOrEq(1, pad) & subtle.ConstantTimeLessOrEq(pad, aes.BlockSize)
+	for i := 0; i < aes.BlockSize; i++ {
+		inPad := subtle.ConstantTimeLessOrEq(i+1, pad)
+		good &= subtle.ConstantTimeSelect(inPad, subtle.ConstantTimeByteEq(b[n-1-i], byte(pad)), 1)
+	}
+	if good != 1 {
+		return nil, false
+	}
+	return b[:n-pad], true
+}
+
+// GenerateKey returns a new random base64 encoded AES-256 key.
+func GenerateKey() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(secret), nil
+}
+
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
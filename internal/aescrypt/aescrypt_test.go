@@ -0,0 +1,124 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aescrypt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKey(t *testing.T, id string) Key {
+	secret, err := GenerateKey()
+	require.NoError(t, err)
+	return Key{ID: id, Secret: secret}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	k, err := New([]Key{newKey(t, "2024-01")}, "", "")
+	require.NoError(t, err)
+
+	encrypted, err := k.Encrypt("apikey-1")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, "v1.2024-01."))
+	again, err := k.Encrypt("apikey-1")
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, again)
+
+	decrypted, err := k.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "apikey-1", decrypted)
+}
+
+func TestKeyRotation(t *testing.T) {
+	old, current := newKey(t, "old"), newKey(t, "current")
+	before, err := New([]Key{old}, "", "")
+	require.NoError(t, err)
+	encrypted, err := before.Encrypt("logstore-1")
+	require.NoError(t, err)
+
+	after, err := New([]Key{current, old}, "", "")
+	require.NoError(t, err)
+	decrypted, err := after.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "logstore-1", decrypted)
+
+	encrypted, err = after.Encrypt("logstore-1")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, "v1.current."))
+	_, err = before.Decrypt(encrypted)
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestDecryptFailures(t *testing.T) {
+	k, err := New([]Key{newKey(t, "a")}, "1234567890abcdef", "")
+	require.NoError(t, err)
+	encrypted, err := k.Encrypt("apikey-1")
+	require.NoError(t, err)
+
+	tampered := []byte(encrypted)
+	tampered[len(tampered)-2] ^= 'A' ^ 'B'
+	for _, value := range []string{
+		"",
+		"v1.",
+		"v1.a.",
+		"v1.b" + encrypted[len("v1.a"):],
+		"v1.a.!!!",
+		string(tampered),
+		"not hex",
+		"abcd",
+		"00112233445566778899aabbccddeeff",
+	} {
+		_, err := k.Decrypt(value)
+		assert.ErrorIs(t, err, ErrDecrypt, value)
+	}
+}
+
+func TestDecryptLegacy(t *testing.T) {
+	cbc, err := New(nil, "1234567890abcdef", "abcdef1234567890")
+	require.NoError(t, err)
+	decrypted, err := cbc.Decrypt("19fee191c382d913cd825d1553f116f0")
+	require.NoError(t, err)
+	assert.Equal(t, "apikey-1", decrypted)
+
+	ecb, err := New(nil, "1234567890abcdef", "")
+	require.NoError(t, err)
+	decrypted, err = ecb.Decrypt("314f6330c575b5ea61683255ab186ff7")
+	require.NoError(t, err)
+	assert.Equal(t, "apikey-1", decrypted)
+
+	_, err = ecb.Decrypt("19fee191c382d913cd825d1553f116f0")
+	assert.ErrorIs(t, err, ErrDecrypt)
+	_, err = ecb.Encrypt("apikey-1")
+	assert.Error(t, err)
+}
+
+func TestNewInvalidKeys(t *testing.T) {
+	valid := newKey(t, "a")
+	for name, keys := range map[string][]Key{
+		"empty id":     {{Secret: valid.Secret}},
+		"invalid id":   {{ID: "a.b", Secret: valid.Secret}},
+		"duplicate id": {valid, valid},
+		"not base64":   {{ID: "a", Secret: "%%%"}},
+		"short secret": {{ID: "a", Secret: "c2hvcnQ="}},
+	} {
+		_, err := New(keys, "", "")
+		assert.Error(t, err, name)
+	}
+	_, err := New(nil, "", "abcdef1234567890")
+	assert.Error(t, err)
+}
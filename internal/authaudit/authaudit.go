@@ -0,0 +1,93 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package authaudit carries the audit records of authentication decisions from the authenticators
+// producing them to the components shipping them, like the holoinsight_auth_audit receiver.
+package authaudit // import "github.com/traas-stack/holoinsight-collector/internal/authaudit"
+
+import (
+	"sync"
+	"time"
+)
+
+// Record is an authentication decision.
+type Record struct {
+	Time time.Time
+	// Tenant is the tenant the apikey resolved to, empty when it was denied.
+	Tenant string
+	// APIKeyFingerprint identifies the apikey without revealing it.
+	APIKeyFingerprint string
+	// Identity is the identity of the verified client certificate, when the client sent one.
+	Identity string
+	// Peer is the address of the client.
+	Peer string
+	// Receiver is the endpoint of the receiver the request was received on, e.g. 0.0.0.0:4318, when known.
+	Receiver string
+	// Path is the URL path of an HTTP request, or the full method of a gRPC call.
+	Path string
+	// Method is the gRPC method called, empty for HTTP requests.
+	Method string
+	// Result is the outcome, e.g. "ok" or "denied".
+	Result string
+	// Reason explains a failed authentication.
+	Reason string
+}
+
+// Source is implemented by the authenticators producing audit records.
+type Source interface {
+	// SubscribeAudit calls fn for every audit record until unsubscribe is called.
+	// fn is called on the request path and must not block.
+	SubscribeAudit(fn func(Record)) (unsubscribe func())
+}
+
+// Hub fans audit records out to the subscribers. The zero value is ready to use.
+type Hub struct {
+	mu   sync.RWMutex
+	next int
+	subs map[int]func(Record)
+}
+
+var _ Source = (*Hub)(nil)
+
+func (h *Hub) SubscribeAudit(fn func(Record)) func() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs == nil {
+		h.subs = make(map[int]func(Record))
+	}
+	id := h.next
+	h.next++
+	h.subs[id] = fn
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs, id)
+	}
+}
+
+// Subscribed reports whether any subscriber is interested, so records aren't built for nothing.
+func (h *Hub) Subscribed() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs) > 0
+}
+
+// Publish hands r to every subscriber.
+func (h *Hub) Publish(r Record) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, fn := range h.subs {
+		fn(r)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authaudit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHub(t *testing.T) {
+	var h Hub
+	assert.False(t, h.Subscribed())
+	h.Publish(Record{Result: "ok"})
+
+	var first, second []string
+	unsubscribe := h.SubscribeAudit(func(r Record) { first = append(first, r.Result) })
+	h.SubscribeAudit(func(r Record) { second = append(second, r.Result) })
+	assert.True(t, h.Subscribed())
+
+	h.Publish(Record{Result: "ok"})
+	unsubscribe()
+	h.Publish(Record{Result: "denied"})
+
+	assert.Equal(t, []string{"ok"}, first)
+	assert.Equal(t, []string{"ok", "denied"}, second)
+}
@@ -0,0 +1,153 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sharedgrpc lets receivers of different types serve their gRPC services
+// on one grpc.Server, so several protocols are available on one port behind one authenticator.
+package sharedgrpc // import "github.com/traas-stack/holoinsight-collector/internal/sharedgrpc"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configgrpc"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	"github.com/traas-stack/holoinsight-collector/internal/sharedcomponent"
+)
+
+// RegisterFunc registers the services of one receiver on the shared server.
+// It is called once, when the server is started.
+type RegisterFunc func(server *grpc.Server)
+
+var (
+	mu      sync.Mutex
+	servers = sharedcomponent.NewSharedComponents()
+)
+
+// Server is a grpc.Server shared by the receivers configured with the same endpoint.
+type Server struct {
+	settings  configgrpc.GRPCServerSettings
+	telemetry component.TelemetrySettings
+
+	registrations []RegisterFunc
+	users         int
+	started       bool
+	// startErr is the error of the start, returned to every receiver as the server is started once.
+	startErr error
+
+	server     *grpc.Server
+	shutdownWG sync.WaitGroup
+}
+
+// Handle is the reference a receiver holds on a shared Server.
+type Handle struct {
+	shared *sharedcomponent.SharedComponent
+	server *Server
+	once   sync.Once
+}
+
+// Register adds the services of a receiver to the server listening on the endpoint of settings,
+// creating it if needed. All receivers sharing an endpoint must use identical gRPC settings.
+// Receivers must register before the server is started, i.e. when they are created.
+func Register(settings *configgrpc.GRPCServerSettings, telemetry component.TelemetrySettings, register RegisterFunc) (*Handle, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	key := settings.NetAddr.Transport + "://" + settings.NetAddr.Endpoint
+	shared := servers.GetOrAdd(key, func() component.Component {
+		return &Server{settings: *settings, telemetry: telemetry}
+	})
+	s := shared.Unwrap().(*Server)
+	if !reflect.DeepEqual(s.settings, *settings) {
+		return nil, fmt.Errorf("receivers sharing the gRPC endpoint %q must use identical gRPC settings", settings.NetAddr.Endpoint)
+	}
+	if s.started {
+		return nil, fmt.Errorf("the shared gRPC server on %q is already started", settings.NetAddr.Endpoint)
+	}
+	s.registrations = append(s.registrations, register)
+	s.users++
+	return &Handle{shared: shared, server: s}, nil
+}
+
+// Start starts the shared server, the first call builds it with the services of every registered receiver.
+// When the server failed to start, every call returns the error.
+func (h *Handle) Start(ctx context.Context, host component.Host) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := h.shared.Start(ctx, host); err != nil {
+		return err
+	}
+	return h.server.startErr
+}
+
+// Shutdown releases the handle, the shared server is stopped once every receiver released it.
+func (h *Handle) Shutdown(ctx context.Context) error {
+	var err error
+	h.once.Do(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		h.server.users--
+		if h.server.users > 0 {
+			return
+		}
+		err = h.shared.Shutdown(ctx)
+	})
+	return err
+}
+
+// Start implements component.Component.
+func (s *Server) Start(_ context.Context, host component.Host) error {
+	s.startErr = s.start(host)
+	return s.startErr
+}
+
+func (s *Server) start(host component.Host) error {
+	var err error
+	s.server, err = s.settings.ToServer(host, s.telemetry)
+	if err != nil {
+		return err
+	}
+	for _, register := range s.registrations {
+		register(s.server)
+	}
+
+	s.telemetry.Logger.Info("Starting shared GRPC server", zap.String("endpoint", s.settings.NetAddr.Endpoint))
+	gln, err := s.settings.ToListener()
+	if err != nil {
+		return fmt.Errorf("failed to bind to gRPC address %q: %w", s.settings.NetAddr.Endpoint, err)
+	}
+	s.started = true
+	s.shutdownWG.Add(1)
+	go func() {
+		defer s.shutdownWG.Done()
+		if errGrpc := s.server.Serve(gln); errGrpc != nil && !errors.Is(errGrpc, grpc.ErrServerStopped) {
+			host.ReportFatalError(errGrpc)
+		}
+	}()
+	return nil
+}
+
+// Shutdown implements component.Component.
+func (s *Server) Shutdown(context.Context) error {
+	if s.server != nil {
+		s.server.GracefulStop()
+	}
+	s.shutdownWG.Wait()
+	return nil
+}
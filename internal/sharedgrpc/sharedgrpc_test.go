@@ -0,0 +1,126 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sharedgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config/configgrpc"
+	"go.opentelemetry.io/collector/config/confignet"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func testSettings(t *testing.T) *configgrpc.GRPCServerSettings {
+	ln, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	endpoint := ln.Addr().String()
+	require.NoError(t, ln.Close())
+	return &configgrpc.GRPCServerSettings{
+		NetAddr: confignet.NetAddr{Endpoint: endpoint, Transport: "tcp"},
+	}
+}
+
+func TestRegisterServesAllReceivers(t *testing.T) {
+	settings := testSettings(t)
+	set := componenttest.NewNopTelemetrySettings()
+
+	var registered []string
+	first, err := Register(settings, set, func(server *grpc.Server) {
+		registered = append(registered, "first")
+		grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	})
+	require.NoError(t, err)
+	second, err := Register(settings, set, func(*grpc.Server) {
+		registered = append(registered, "second")
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, first.Start(context.Background(), componenttest.NewNopHost()))
+	require.NoError(t, second.Start(context.Background(), componenttest.NewNopHost()))
+	assert.Equal(t, []string{"first", "second"}, registered)
+
+	conn, err := grpc.Dial(settings.NetAddr.Endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+
+	// the server keeps serving until the last receiver shuts down
+	require.NoError(t, first.Shutdown(context.Background()))
+	require.NoError(t, first.Shutdown(context.Background()))
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	require.NoError(t, second.Shutdown(context.Background()))
+
+	// a stopped server is forgotten, so the endpoint can be registered again
+	h, err := Register(settings, set, func(*grpc.Server) {})
+	require.NoError(t, err)
+	require.NoError(t, h.Shutdown(context.Background()))
+}
+
+func TestRegisterConflictingSettings(t *testing.T) {
+	settings := testSettings(t)
+	set := componenttest.NewNopTelemetrySettings()
+
+	h, err := Register(settings, set, func(*grpc.Server) {})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, h.Shutdown(context.Background())) })
+
+	other := *settings
+	other.MaxRecvMsgSizeMiB = 16
+	_, err = Register(&other, set, func(*grpc.Server) {})
+	assert.ErrorContains(t, err, "identical gRPC settings")
+}
+
+func TestStartError(t *testing.T) {
+	settings := testSettings(t)
+	set := componenttest.NewNopTelemetrySettings()
+	ln, err := net.Listen("tcp", settings.NetAddr.Endpoint)
+	require.NoError(t, err)
+	defer ln.Close()
+
+	first, err := Register(settings, set, func(*grpc.Server) {})
+	require.NoError(t, err)
+	second, err := Register(settings, set, func(*grpc.Server) {})
+	require.NoError(t, err)
+	// every receiver sharing the server is told it failed to bind, not only the first one
+	assert.ErrorContains(t, first.Start(context.Background(), componenttest.NewNopHost()), "failed to bind")
+	assert.ErrorContains(t, second.Start(context.Background(), componenttest.NewNopHost()), "failed to bind")
+	require.NoError(t, first.Shutdown(context.Background()))
+	require.NoError(t, second.Shutdown(context.Background()))
+}
+
+func TestRegisterAfterStart(t *testing.T) {
+	settings := testSettings(t)
+	set := componenttest.NewNopTelemetrySettings()
+
+	h, err := Register(settings, set, func(*grpc.Server) {})
+	require.NoError(t, err)
+	require.NoError(t, h.Start(context.Background(), componenttest.NewNopHost()))
+	t.Cleanup(func() { require.NoError(t, h.Shutdown(context.Background())) })
+
+	_, err = Register(settings, set, func(*grpc.Server) {})
+	assert.ErrorContains(t, err, "already started")
+}
@@ -0,0 +1,54 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenantauth // import "github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+type connKey struct{}
+
+// ConnContext is the http.Server ConnContext of the receivers. It keeps TLS connections in the
+// request context, so authenticators can read the client certificate with PeerCertificate.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	if tc, ok := c.(*tls.Conn); ok {
+		return context.WithValue(ctx, connKey{}, tc)
+	}
+	return ctx
+}
+
+// PeerCertificate returns the verified certificate of the client of a gRPC call or of an HTTP request
+// served with ConnContext, nil when the client sent none or it wasn't verified against a client CA.
+func PeerCertificate(ctx context.Context) *x509.Certificate {
+	var state tls.ConnectionState
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state = info.State
+		}
+	}
+	if tc, ok := ctx.Value(connKey{}).(*tls.Conn); ok && len(state.VerifiedChains) == 0 {
+		state = tc.ConnectionState()
+	}
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
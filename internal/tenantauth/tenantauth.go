@@ -0,0 +1,72 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tenantauth defines the client.Info.Auth attributes describing an authenticated tenant,
+// shared by the authenticators producing them and the components consuming them, and gives
+// the authenticators access to the client certificates.
+package tenantauth // import "github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+
+import (
+	"context"
+
+	"go.opentelemetry.io/collector/client"
+)
+
+const (
+	// AttributeTenant is the tenant name, a string.
+	AttributeTenant = "tenant"
+	// AttributeExtendTags are the custom tags the client sent with its apikey, a map[string]string.
+	AttributeExtendTags = "extend_tags"
+	// AttributeEnvironment is the environment of the tenant, a string.
+	AttributeEnvironment = "environment"
+	// AttributeSignals are the signals the tenant may send, a []string of SignalTraces, SignalMetrics and SignalLogs.
+	AttributeSignals = "signals"
+	// QuotaPrefix prefixes the quotas of the tenant, e.g. "quota.spans_per_second", formatted as strings.
+	QuotaPrefix = "quota."
+	// AttributePrefix prefixes the extra attributes of the tenant, e.g. "attribute.region", strings.
+	AttributePrefix = "attribute."
+
+	SignalTraces  = "traces"
+	SignalMetrics = "metrics"
+	SignalLogs    = "logs"
+)
+
+// Tenant returns the tenant authenticated in ctx, empty when there is none.
+func Tenant(ctx context.Context) string {
+	info := client.FromContext(ctx)
+	if info.Auth == nil {
+		return ""
+	}
+	tenant, _ := info.Auth.GetAttribute(AttributeTenant).(string)
+	return tenant
+}
+
+// SignalAllowed reports whether the tenant authenticated in ctx may send signal. Requests without
+// auth data, or authenticated by an authenticator not reporting signals, are allowed.
+func SignalAllowed(ctx context.Context, signal string) bool {
+	info := client.FromContext(ctx)
+	if info.Auth == nil {
+		return true
+	}
+	signals, ok := info.Auth.GetAttribute(AttributeSignals).([]string)
+	if !ok {
+		return true
+	}
+	for _, s := range signals {
+		if s == signal {
+			return true
+		}
+	}
+	return false
+}
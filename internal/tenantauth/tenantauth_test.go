@@ -0,0 +1,59 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenantauth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/client"
+)
+
+type authData map[string]interface{}
+
+func (a authData) GetAttribute(name string) interface{} {
+	return a[name]
+}
+
+func (a authData) GetAttributeNames() []string {
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestSignalAllowed(t *testing.T) {
+	withAuth := func(auth client.AuthData) context.Context {
+		return client.NewContext(context.Background(), client.Info{Auth: auth})
+	}
+
+	assert.True(t, SignalAllowed(context.Background(), SignalTraces))
+	assert.True(t, SignalAllowed(withAuth(authData{AttributeTenant: "t"}), SignalTraces))
+
+	ctx := withAuth(authData{AttributeSignals: []string{SignalMetrics, SignalLogs}})
+	assert.False(t, SignalAllowed(ctx, SignalTraces))
+	assert.True(t, SignalAllowed(ctx, SignalMetrics))
+	assert.True(t, SignalAllowed(ctx, SignalLogs))
+
+	assert.False(t, SignalAllowed(withAuth(authData{AttributeSignals: []string{}}), SignalLogs))
+}
+
+func TestTenant(t *testing.T) {
+	assert.Equal(t, "", Tenant(context.Background()))
+	ctx := client.NewContext(context.Background(), client.Info{Auth: authData{AttributeTenant: "t"}})
+	assert.Equal(t, "t", Tenant(ctx))
+}
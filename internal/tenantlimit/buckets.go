@@ -0,0 +1,254 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenantlimit // import "github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+)
+
+// Rate is a token bucket: PerSecond items (or bytes) per second, up to Burst at once.
+type Rate struct {
+	// PerSecond is the sustained rate, 0 is unlimited.
+	PerSecond float64 `mapstructure:"per_second"`
+	// Burst is the size of the bucket. Default: one second of PerSecond
+	Burst int `mapstructure:"burst"`
+}
+
+func (r Rate) limiter() *rate.Limiter {
+	if r.PerSecond <= 0 {
+		return nil
+	}
+	burst := r.Burst
+	if burst <= 0 {
+		burst = int(math.Ceil(r.PerSecond))
+	}
+	return rate.NewLimiter(rate.Limit(r.PerSecond), burst)
+}
+
+// Quota caps what a tenant sends in a UTC day, 0 is unlimited.
+type Quota struct {
+	Spans      int64 `mapstructure:"spans" json:"spans,omitempty"`
+	DataPoints int64 `mapstructure:"datapoints" json:"datapoints,omitempty"`
+	Logs       int64 `mapstructure:"logs" json:"logs,omitempty"`
+	Bytes      int64 `mapstructure:"bytes" json:"bytes,omitempty"`
+}
+
+func (q *Quota) items(signal string) *int64 {
+	switch signal {
+	case tenantauth.SignalTraces:
+		return &q.Spans
+	case tenantauth.SignalMetrics:
+		return &q.DataPoints
+	case tenantauth.SignalLogs:
+		return &q.Logs
+	}
+	return nil
+}
+
+// Limits are the limits of a tenant.
+type Limits struct {
+	Spans      Rate  `mapstructure:"spans"`
+	DataPoints Rate  `mapstructure:"datapoints"`
+	Logs       Rate  `mapstructure:"logs"`
+	Bytes      Rate  `mapstructure:"bytes"`
+	Daily      Quota `mapstructure:"daily"`
+}
+
+func (l *Limits) items(signal string) Rate {
+	switch signal {
+	case tenantauth.SignalTraces:
+		return l.Spans
+	case tenantauth.SignalMetrics:
+		return l.DataPoints
+	case tenantauth.SignalLogs:
+		return l.Logs
+	}
+	return Rate{}
+}
+
+// WithQuotas returns l overridden by the quotas of a tenant profile, named like the keys of the
+// configuration: spans_per_second, spans_burst, ..., bytes_burst, daily_spans, ..., daily_bytes.
+func (l Limits) WithQuotas(quota func(name string) (float64, bool)) Limits {
+	rates := map[string]*Rate{"spans": &l.Spans, "datapoints": &l.DataPoints, "logs": &l.Logs, "bytes": &l.Bytes}
+	for name, r := range rates {
+		if v, ok := quota(name + "_per_second"); ok {
+			r.PerSecond = v
+		}
+		if v, ok := quota(name + "_burst"); ok {
+			r.Burst = int(v)
+		}
+	}
+	daily := map[string]*int64{"spans": &l.Daily.Spans, "datapoints": &l.Daily.DataPoints, "logs": &l.Daily.Logs, "bytes": &l.Daily.Bytes}
+	for name, q := range daily {
+		if v, ok := quota("daily_" + name); ok {
+			*q = int64(v)
+		}
+	}
+	return l
+}
+
+// Usage is what the tenants sent during a UTC day, persisted to enforce the daily quotas across restarts.
+type Usage struct {
+	// Day is the UTC day, formatted as 2006-01-02.
+	Day     string            `json:"day"`
+	Tenants map[string]*Quota `json:"tenants"`
+}
+
+// Buckets holds the token buckets and the daily usage of the tenants.
+type Buckets struct {
+	mu      sync.Mutex
+	tenants map[string]*tenantBuckets
+	usage   Usage
+	now     func() time.Time
+}
+
+type tenantBuckets struct {
+	limits Limits
+	items  map[string]*rate.Limiter
+	bytes  *rate.Limiter
+}
+
+// NewBuckets returns empty buckets.
+func NewBuckets() *Buckets {
+	return &Buckets{tenants: make(map[string]*tenantBuckets), now: time.Now}
+}
+
+// Admit admits items of signal weighing bytes when tenant is within limits, see Limiter.
+// A request bigger than a bucket is admitted when the bucket is full.
+func (b *Buckets) Admit(tenant string, limits Limits, signal string, items, bytes int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	throttled := func(reason string, retryAfter time.Duration) error {
+		return &ThrottledError{Tenant: tenant, Signal: signal, Reason: reason, RetryAfter: retryAfter}
+	}
+
+	used := b.used(tenant, now)
+	untilTomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+	if quota := limits.Daily.items(signal); quota != nil && *quota > 0 && *used.items(signal)+int64(items) > *quota {
+		return throttled(ReasonDailyQuota, untilTomorrow)
+	}
+	if limits.Daily.Bytes > 0 && used.Bytes+int64(bytes) > limits.Daily.Bytes {
+		return throttled(ReasonDailyQuota, untilTomorrow)
+	}
+
+	tb := b.buckets(tenant, limits)
+	itemsReservation := reserve(tb.items[signal], now, items)
+	bytesReservation := reserve(tb.bytes, now, bytes)
+	if d := itemsReservation.DelayFrom(now); d > 0 {
+		itemsReservation.CancelAt(now)
+		bytesReservation.CancelAt(now)
+		return throttled(ReasonRate, d)
+	}
+	if d := bytesReservation.DelayFrom(now); d > 0 {
+		itemsReservation.CancelAt(now)
+		bytesReservation.CancelAt(now)
+		return throttled(ReasonBytes, d)
+	}
+
+	if counter := used.items(signal); counter != nil {
+		*counter += int64(items)
+	}
+	used.Bytes += int64(bytes)
+	return nil
+}
+
+// reserve reserves n tokens of l, capped to its burst. A nil limiter is unlimited.
+func reserve(l *rate.Limiter, now time.Time, n int) *reservation {
+	if l == nil || n <= 0 {
+		return &reservation{}
+	}
+	if n > l.Burst() {
+		n = l.Burst()
+	}
+	return &reservation{l.ReserveN(now, n)}
+}
+
+// reservation is a rate.Reservation, the zero value reserving nothing.
+type reservation struct {
+	r *rate.Reservation
+}
+
+func (r *reservation) DelayFrom(now time.Time) time.Duration {
+	if r.r == nil {
+		return 0
+	}
+	return r.r.DelayFrom(now)
+}
+
+func (r *reservation) CancelAt(now time.Time) {
+	if r.r != nil {
+		r.r.CancelAt(now)
+	}
+}
+
+// buckets returns the buckets of tenant, rebuilt when its limits changed.
+func (b *Buckets) buckets(tenant string, limits Limits) *tenantBuckets {
+	if tb, ok := b.tenants[tenant]; ok && tb.limits == limits {
+		return tb
+	}
+	tb := &tenantBuckets{
+		limits: limits,
+		items: map[string]*rate.Limiter{
+			tenantauth.SignalTraces:  limits.Spans.limiter(),
+			tenantauth.SignalMetrics: limits.DataPoints.limiter(),
+			tenantauth.SignalLogs:    limits.Logs.limiter(),
+		},
+		bytes: limits.Bytes.limiter(),
+	}
+	b.tenants[tenant] = tb
+	return tb
+}
+
+// used returns the usage of tenant today, starting a new day when the day changed.
+func (b *Buckets) used(tenant string, now time.Time) *Quota {
+	if day := now.UTC().Format("2006-01-02"); b.usage.Day != day {
+		b.usage = Usage{Day: day, Tenants: make(map[string]*Quota)}
+	}
+	used, ok := b.usage.Tenants[tenant]
+	if !ok {
+		used = &Quota{}
+		b.usage.Tenants[tenant] = used
+	}
+	return used
+}
+
+// Usage returns a copy of the daily usage.
+func (b *Buckets) Usage() Usage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	usage := Usage{Day: b.usage.Day, Tenants: make(map[string]*Quota, len(b.usage.Tenants))}
+	for tenant, used := range b.usage.Tenants {
+		u := *used
+		usage.Tenants[tenant] = &u
+	}
+	return usage
+}
+
+// Restore restores the usage persisted by a previous run, when it is of today.
+func (b *Buckets) Restore(usage Usage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if usage.Day != b.now().UTC().Format("2006-01-02") || usage.Tenants == nil {
+		return
+	}
+	b.usage = usage
+}
@@ -0,0 +1,109 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenantlimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+)
+
+func newTestBuckets(now *time.Time) *Buckets {
+	b := NewBuckets()
+	b.now = func() time.Time { return *now }
+	return b
+}
+
+func reasonOf(t *testing.T, err error) string {
+	require.IsType(t, &ThrottledError{}, err)
+	return err.(*ThrottledError).Reason
+}
+
+func TestBucketsRate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	b := newTestBuckets(&now)
+	limits := Limits{Spans: Rate{PerSecond: 10, Burst: 20}}
+
+	assert.NoError(t, b.Admit("t1", limits, tenantauth.SignalTraces, 15, 0))
+	err := b.Admit("t1", limits, tenantauth.SignalTraces, 10, 0)
+	assert.Equal(t, ReasonRate, reasonOf(t, err))
+	assert.Equal(t, 500*time.Millisecond, err.(*ThrottledError).RetryAfter)
+
+	// other tenants and signals have their own buckets
+	assert.NoError(t, b.Admit("t2", limits, tenantauth.SignalTraces, 20, 0))
+	assert.NoError(t, b.Admit("t1", limits, tenantauth.SignalLogs, 1000, 0))
+
+	now = now.Add(time.Second)
+	assert.NoError(t, b.Admit("t1", limits, tenantauth.SignalTraces, 10, 0))
+
+	// a request bigger than the bucket is admitted when the bucket is full
+	now = now.Add(time.Minute)
+	assert.NoError(t, b.Admit("t1", limits, tenantauth.SignalTraces, 100, 0))
+	assert.Error(t, b.Admit("t1", limits, tenantauth.SignalTraces, 100, 0))
+}
+
+func TestBucketsBytes(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	b := newTestBuckets(&now)
+	limits := Limits{Spans: Rate{PerSecond: 10}, Bytes: Rate{PerSecond: 1000}}
+
+	assert.NoError(t, b.Admit("t1", limits, tenantauth.SignalTraces, 1, 900))
+	assert.Equal(t, ReasonBytes, reasonOf(t, b.Admit("t1", limits, tenantauth.SignalMetrics, 1, 200)))
+	// the spans of the refused request were given back
+	assert.NoError(t, b.Admit("t1", limits, tenantauth.SignalTraces, 9, 100))
+}
+
+func TestBucketsDailyQuota(t *testing.T) {
+	now := time.Date(2024, 6, 1, 23, 0, 0, 0, time.UTC)
+	b := newTestBuckets(&now)
+	limits := Limits{Daily: Quota{Logs: 100, Bytes: 1000}}
+
+	assert.NoError(t, b.Admit("t1", limits, tenantauth.SignalLogs, 60, 100))
+	err := b.Admit("t1", limits, tenantauth.SignalLogs, 60, 100)
+	assert.Equal(t, ReasonDailyQuota, reasonOf(t, err))
+	assert.Equal(t, time.Hour, err.(*ThrottledError).RetryAfter)
+	assert.Equal(t, ReasonDailyQuota, reasonOf(t, b.Admit("t1", limits, tenantauth.SignalTraces, 1, 1000)))
+
+	usage := b.Usage()
+	assert.Equal(t, "2024-06-01", usage.Day)
+	assert.Equal(t, &Quota{Logs: 60, Bytes: 100}, usage.Tenants["t1"])
+
+	restarted := newTestBuckets(&now)
+	restarted.Restore(usage)
+	assert.Error(t, restarted.Admit("t1", limits, tenantauth.SignalLogs, 60, 100))
+
+	now = now.Add(time.Hour)
+	assert.NoError(t, b.Admit("t1", limits, tenantauth.SignalLogs, 60, 100))
+	tomorrow := newTestBuckets(&now)
+	tomorrow.Restore(usage)
+	assert.NoError(t, tomorrow.Admit("t1", limits, tenantauth.SignalLogs, 100, 0), "yesterday's usage is not restored")
+}
+
+func TestLimitsWithQuotas(t *testing.T) {
+	quotas := map[string]float64{"spans_per_second": 5, "bytes_burst": 4096, "daily_logs": 1e6}
+	limits := Limits{Spans: Rate{PerSecond: 10, Burst: 20}}.WithQuotas(func(name string) (float64, bool) {
+		v, ok := quotas[name]
+		return v, ok
+	})
+	assert.Equal(t, Limits{
+		Spans: Rate{PerSecond: 5, Burst: 20},
+		Bytes: Rate{Burst: 4096},
+		Daily: Quota{Logs: 1e6},
+	}, limits)
+}
@@ -0,0 +1,174 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tenantlimit throttles the data of each tenant to its rate limits and daily quotas. The receivers
+// consult a Limiter, provided by an extension like holoinsight_tenant_limiter, through a Gate.
+package tenantlimit // import "github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	// ReasonRate is the reason of data over the items per second limit of its signal.
+	ReasonRate = "rate"
+	// ReasonBytes is the reason of data over the bytes per second limit.
+	ReasonBytes = "bytes"
+	// ReasonDailyQuota is the reason of data over a daily quota.
+	ReasonDailyQuota = "daily_quota"
+)
+
+// Limiter admits the data of the tenants.
+type Limiter interface {
+	// Admit returns a *ThrottledError when tenant may not send, now, items of signal (tenantauth.SignalTraces,
+	// SignalMetrics or SignalLogs) weighing bytes. tenant is the tenant the data was resolved to, see tenantresolver,
+	// the authenticated tenant of ctx when there is one. Admitted data counts against its limits.
+	Admit(ctx context.Context, tenant, signal string, items, bytes int) error
+}
+
+// ThrottledError rejects data over the limits of its tenant.
+type ThrottledError struct {
+	Tenant string
+	Signal string
+	Reason string
+	// RetryAfter is when the data would be admitted.
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s of tenant %q throttled (%s), retry after %s", e.Signal, e.Tenant, e.Reason, e.RetryAfter)
+}
+
+// GRPCError turns a *ThrottledError into a ResourceExhausted status carrying the retry delay as RetryInfo,
+// which the OTLP exporters honor. Other errors are returned unchanged.
+func GRPCError(err error) error {
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) {
+		return err
+	}
+	s := status.New(codes.ResourceExhausted, throttled.Error())
+	if detailed, derr := s.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(throttled.RetryAfter)}); derr == nil {
+		s = detailed
+	}
+	return s.Err()
+}
+
+// RetryAfter returns the retry delay of a *ThrottledError or of a status returned by GRPCError.
+func RetryAfter(err error) (time.Duration, bool) {
+	var throttled *ThrottledError
+	if errors.As(err, &throttled) {
+		return throttled.RetryAfter, true
+	}
+	if s, ok := status.FromError(err); ok {
+		for _, detail := range s.Details() {
+			if info, ok := detail.(*errdetails.RetryInfo); ok {
+				return info.RetryDelay.AsDuration(), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// SetRetryAfter sets the Retry-After header of a throttled HTTP response, in whole seconds rounded up.
+func SetRetryAfter(header http.Header, d time.Duration) {
+	header.Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
+
+// Gate is how a receiver consults its limiter. Handlers are given the Gate when they are created,
+// the limiter is set once the extensions are known, on Start. A nil Gate or a Gate without limiter admits everything.
+type Gate struct {
+	limiter atomic.Value // holder
+}
+
+type holder struct {
+	Limiter
+}
+
+// Resolve sets the limiter to the extension id of host, the Gate admits everything when id is nil.
+func (g *Gate) Resolve(host component.Host, id *component.ID) error {
+	if id == nil {
+		return nil
+	}
+	ext, ok := host.GetExtensions()[*id]
+	if !ok {
+		return fmt.Errorf("limiter %q not found", id)
+	}
+	limiter, ok := ext.(Limiter)
+	if !ok {
+		return fmt.Errorf("extension %q is not a tenant limiter", id)
+	}
+	g.limiter.Store(holder{limiter})
+	return nil
+}
+
+// Admit asks the limiter to admit the data of tenant, see Limiter.
+func (g *Gate) Admit(ctx context.Context, tenant, signal string, items, bytes int) error {
+	if g == nil {
+		return nil
+	}
+	if h, ok := g.limiter.Load().(holder); ok {
+		return h.Admit(ctx, tenant, signal, items, bytes)
+	}
+	return nil
+}
+
+// AdmitTenants asks the limiter to admit the items of each tenant of a request of signal weighing bytes, each tenant
+// weighing its share of bytes. The request is refused as a whole with the error of the first tenant throttled.
+func (g *Gate) AdmitTenants(ctx context.Context, signal string, tenants *Tenants, bytes int) error {
+	total := 0
+	for _, items := range tenants.items {
+		total += items
+	}
+	for _, tenant := range tenants.names {
+		items, share := tenants.items[tenant], bytes
+		if total > 0 {
+			share = int(int64(bytes) * int64(items) / int64(total))
+		}
+		if err := g.Admit(ctx, tenant, signal, items, share); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tenants counts the items of a request per tenant: a request which isn't authenticated, e.g. forwarded by an agent,
+// may carry the data of several tenants.
+type Tenants struct {
+	names []string
+	items map[string]int
+}
+
+// Add counts items of tenant.
+func (t *Tenants) Add(tenant string, items int) {
+	if t.items == nil {
+		t.items = make(map[string]int)
+	}
+	if _, ok := t.items[tenant]; !ok {
+		t.names = append(t.names, tenant)
+	}
+	t.items[tenant] += items
+}
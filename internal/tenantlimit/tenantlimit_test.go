@@ -0,0 +1,125 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenantlimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCError(t *testing.T) {
+	err := GRPCError(&ThrottledError{Tenant: "t1", Signal: "traces", Reason: ReasonRate, RetryAfter: 1500 * time.Millisecond})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	retryAfter, ok := RetryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, retryAfter)
+
+	header := http.Header{}
+	SetRetryAfter(header, retryAfter)
+	assert.Equal(t, "2", header.Get("Retry-After"))
+
+	other := errors.New("other")
+	assert.Equal(t, other, GRPCError(other))
+	_, ok = RetryAfter(other)
+	assert.False(t, ok)
+}
+
+type limiterExtension struct {
+	component.StartFunc
+	component.ShutdownFunc
+	admitted int
+	// requests are the items and bytes admitted of each tenant, throttled when listed in throttled.
+	requests  map[string][2]int
+	throttled map[string]bool
+}
+
+func (l *limiterExtension) Admit(_ context.Context, tenant, signal string, items, bytes int) error {
+	if l.throttled[tenant] {
+		return &ThrottledError{Tenant: tenant, Signal: signal, Reason: ReasonRate}
+	}
+	l.admitted += items
+	if l.requests == nil {
+		l.requests = make(map[string][2]int)
+	}
+	l.requests[tenant] = [2]int{items, bytes}
+	return nil
+}
+
+type extensionsHost struct {
+	component.Host
+	extensions map[component.ID]component.Component
+}
+
+func (h *extensionsHost) GetExtensions() map[component.ID]component.Component {
+	return h.extensions
+}
+
+func TestGate(t *testing.T) {
+	var nilGate *Gate
+	assert.NoError(t, nilGate.Admit(context.Background(), "t1", "traces", 1, 1))
+
+	limiter := &limiterExtension{}
+	id := component.NewID("holoinsight_tenant_limiter")
+	notLimiter := component.NewID("zpages")
+	host := &extensionsHost{
+		Host: componenttest.NewNopHost(),
+		extensions: map[component.ID]component.Component{id: limiter, notLimiter: &struct {
+			component.StartFunc
+			component.ShutdownFunc
+		}{}},
+	}
+
+	gate := &Gate{}
+	require.NoError(t, gate.Resolve(host, nil))
+	assert.NoError(t, gate.Admit(context.Background(), "t1", "traces", 1, 1))
+	missing := component.NewID("missing")
+	assert.Error(t, gate.Resolve(host, &missing))
+	assert.Error(t, gate.Resolve(host, &notLimiter))
+
+	require.NoError(t, gate.Resolve(host, &id))
+	assert.NoError(t, gate.Admit(context.Background(), "t1", "traces", 3, 1))
+	assert.Equal(t, 3, limiter.admitted)
+}
+
+func TestAdmitTenants(t *testing.T) {
+	limiter := &limiterExtension{}
+	id := component.NewID("holoinsight_tenant_limiter")
+	gate := &Gate{}
+	require.NoError(t, gate.Resolve(&extensionsHost{Host: componenttest.NewNopHost(), extensions: map[component.ID]component.Component{id: limiter}}, &id))
+
+	// each tenant is admitted its items and share of the bytes
+	var tenants Tenants
+	tenants.Add("t1", 1)
+	tenants.Add("t2", 2)
+	tenants.Add("t1", 1)
+	require.NoError(t, gate.AdmitTenants(context.Background(), "traces", &tenants, 100))
+	assert.Equal(t, map[string][2]int{"t1": {2, 50}, "t2": {2, 50}}, limiter.requests)
+
+	limiter.throttled = map[string]bool{"t2": true}
+	err := gate.AdmitTenants(context.Background(), "traces", &tenants, 100)
+	var throttled *ThrottledError
+	require.ErrorAs(t, err, &throttled)
+	assert.Equal(t, "t2", throttled.Tenant)
+}
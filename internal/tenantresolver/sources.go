@@ -0,0 +1,230 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenantresolver // import "github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+)
+
+const (
+	// SourceAuth is the tenant of the authentication result, or of the context decorated by the authenticator.
+	SourceAuth = "auth"
+	// SourceHeader is a header of the HTTP requests.
+	SourceHeader = "header"
+	// SourceMetadata is a metadata key of the gRPC calls, or of the client metadata of receivers including it.
+	SourceMetadata = "metadata"
+	// SourceResourceAttribute is a resource attribute of the data.
+	SourceResourceAttribute = "resource_attribute"
+	// SourceStatic maps the listeners and paths the data was received on to tenants.
+	SourceStatic = "static"
+	// SourceDefault is a fixed tenant.
+	SourceDefault = "default"
+
+	// DefaultName is the auth attribute, header, metadata key and resource attribute holding the tenant by default.
+	DefaultName = tenantauth.AttributeTenant
+)
+
+// SourceSettings configures a source of the tenant.
+type SourceSettings struct {
+	// Type is auth, header, metadata, resource_attribute, static or default.
+	Type string `mapstructure:"type"`
+	// Name is the auth attribute, header, metadata key or resource attribute holding the tenant. Default: tenant
+	Name string `mapstructure:"name"`
+	// WhenAuthenticated also consults the header, metadata or resource attribute sent with authenticated requests.
+	// They are ignored by default, so a client can't claim another tenant than the one it authenticated as.
+	WhenAuthenticated bool `mapstructure:"when_authenticated"`
+	// Listeners maps the endpoints of the receivers, as configured, to tenants, for static.
+	Listeners map[string]string `mapstructure:"listeners"`
+	// Paths maps URL path (or gRPC method) prefixes to tenants, for static. The longest matching prefix wins,
+	// over the listeners.
+	Paths map[string]string `mapstructure:"paths"`
+	// Value is the tenant of default.
+	Value string `mapstructure:"value"`
+}
+
+// Validate checks the source is usable.
+func (s *SourceSettings) Validate() error {
+	switch s.Type {
+	case SourceAuth, SourceHeader, SourceMetadata, SourceResourceAttribute:
+	case SourceStatic:
+		if len(s.Listeners) == 0 && len(s.Paths) == 0 {
+			return errors.New("static source requires listeners or paths")
+		}
+	case SourceDefault:
+		if s.Value == "" {
+			return errors.New("default source requires a value")
+		}
+	case "":
+		return errors.New("source type must be set")
+	default:
+		return fmt.Errorf("unknown source type %q", s.Type)
+	}
+	return nil
+}
+
+func (s *SourceSettings) name() string {
+	if s.Name == "" {
+		return DefaultName
+	}
+	return s.Name
+}
+
+// source returns the tenant of the data, empty when it doesn't know it.
+type source func(ctx context.Context, req Request, resource pcommon.Map) string
+
+// Chain resolves the tenant with the first of its sources knowing it.
+type Chain struct {
+	attribute string
+	sources   []source
+}
+
+var _ Resolver = (*Chain)(nil)
+
+// builtin is the resolver of the receivers configured without tenant resolver.
+var builtin = func() *Chain {
+	chain, err := NewChain(DefaultName, BuiltinSources())
+	if err != nil {
+		panic(err)
+	}
+	return chain
+}()
+
+// BuiltinSources are the sources of the receivers configured without tenant resolver: the authentication result,
+// then, for unauthenticated requests only, the tenant metadata, header and resource attribute.
+func BuiltinSources() []SourceSettings {
+	return []SourceSettings{
+		{Type: SourceAuth},
+		{Type: SourceMetadata},
+		{Type: SourceHeader},
+		{Type: SourceResourceAttribute},
+	}
+}
+
+// NewChain returns a Chain putting the tenant in attribute, DefaultName when empty.
+func NewChain(attribute string, settings []SourceSettings) (*Chain, error) {
+	if attribute == "" {
+		attribute = DefaultName
+	}
+	c := &Chain{attribute: attribute}
+	for i := range settings {
+		s := settings[i]
+		if err := s.Validate(); err != nil {
+			return nil, fmt.Errorf("source %d: %w", i, err)
+		}
+		c.sources = append(c.sources, newSource(s))
+	}
+	return c, nil
+}
+
+func newSource(s SourceSettings) source {
+	name := s.name()
+	clientSent := func(lookup source) source {
+		if s.WhenAuthenticated {
+			return lookup
+		}
+		return func(ctx context.Context, req Request, resource pcommon.Map) string {
+			if client.FromContext(ctx).Auth != nil {
+				return ""
+			}
+			return lookup(ctx, req, resource)
+		}
+	}
+
+	switch s.Type {
+	case SourceAuth:
+		return func(ctx context.Context, _ Request, _ pcommon.Map) string {
+			if auth := client.FromContext(ctx).Auth; auth != nil {
+				if tenant, ok := auth.GetAttribute(name).(string); ok && tenant != "" {
+					return tenant
+				}
+			}
+			// authenticators that only decorate the context with the tenant
+			tenant, _ := ctx.Value(name).(string)
+			return tenant
+		}
+	case SourceHeader:
+		return clientSent(func(_ context.Context, req Request, _ pcommon.Map) string {
+			return req.Header.Get(name)
+		})
+	case SourceMetadata:
+		return clientSent(func(ctx context.Context, _ Request, _ pcommon.Map) string {
+			if md, ok := metadata.FromIncomingContext(ctx); ok {
+				if vs := md.Get(name); len(vs) > 0 && vs[0] != "" {
+					return vs[0]
+				}
+			}
+			if vs := client.FromContext(ctx).Metadata.Get(name); len(vs) > 0 {
+				return vs[0]
+			}
+			return ""
+		})
+	case SourceResourceAttribute:
+		return clientSent(func(_ context.Context, _ Request, resource pcommon.Map) string {
+			if v, ok := resource.Get(name); ok {
+				return v.AsString()
+			}
+			return ""
+		})
+	case SourceStatic:
+		return func(_ context.Context, req Request, _ pcommon.Map) string {
+			if tenant := matchPath(s.Paths, req.Path); tenant != "" {
+				return tenant
+			}
+			return s.Listeners[req.Listener]
+		}
+	default:
+		return func(context.Context, Request, pcommon.Map) string {
+			return s.Value
+		}
+	}
+}
+
+// matchPath returns the tenant of the longest prefix of path in paths, matching whole path segments.
+func matchPath(paths map[string]string, path string) string {
+	var longest, tenant string
+	for prefix, t := range paths {
+		if len(prefix) <= len(longest) || !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		if len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/' {
+			longest, tenant = prefix, t
+		}
+	}
+	return tenant
+}
+
+// Tenant returns the tenant of the first source knowing it, see Resolver.
+func (c *Chain) Tenant(ctx context.Context, req Request, resource pcommon.Map) string {
+	for _, s := range c.sources {
+		if tenant := s(ctx, req, resource); tenant != "" {
+			return tenant
+		}
+	}
+	return ""
+}
+
+// Attribute is the resource attribute the tenant is put in.
+func (c *Chain) Attribute() string {
+	return c.attribute
+}
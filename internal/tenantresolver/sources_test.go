@@ -0,0 +1,139 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenantresolver
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"google.golang.org/grpc/metadata"
+)
+
+type testAuthData map[string]interface{}
+
+func (a testAuthData) GetAttribute(name string) interface{} {
+	return a[name]
+}
+
+func (a testAuthData) GetAttributeNames() []string {
+	var names []string
+	for k := range a {
+		names = append(names, k)
+	}
+	return names
+}
+
+func resourceWith(tenant string) pcommon.Map {
+	m := pcommon.NewMap()
+	if tenant != "" {
+		m.PutStr(DefaultName, tenant)
+	}
+	return m
+}
+
+func TestBuiltin(t *testing.T) {
+	grpcReq := Request{Listener: "0.0.0.0:4317", Path: "/opentelemetry.proto.collector.trace.v1.TraceService/Export"}
+	httpReq := Request{Listener: "0.0.0.0:4318", Path: "/v1/traces", Header: http.Header{"Tenant": {"header-tenant"}}}
+
+	authenticated := client.NewContext(
+		metadata.NewIncomingContext(context.Background(), metadata.Pairs(DefaultName, "spoofed")),
+		client.Info{Auth: testAuthData{DefaultName: "auth-tenant"}},
+	)
+	assert.Equal(t, "auth-tenant", builtin.Tenant(authenticated, httpReq, resourceWith("spoofed")))
+
+	// what the client sent must not be trusted for an authenticated request
+	noTenant := client.NewContext(
+		metadata.NewIncomingContext(context.Background(), metadata.Pairs(DefaultName, "spoofed")),
+		client.Info{Auth: testAuthData{}},
+	)
+	assert.Equal(t, "", builtin.Tenant(noTenant, httpReq, resourceWith("spoofed")))
+
+	decorated := context.WithValue(client.NewContext(context.Background(), client.Info{Auth: testAuthData{}}), DefaultName, "ctx-tenant")
+	assert.Equal(t, "ctx-tenant", builtin.Tenant(decorated, grpcReq, resourceWith("")))
+
+	grpcMetadata := metadata.NewIncomingContext(context.Background(), metadata.Pairs(DefaultName, "grpc-tenant"))
+	assert.Equal(t, "grpc-tenant", builtin.Tenant(grpcMetadata, grpcReq, resourceWith("resource-tenant")))
+
+	clientMetadata := client.NewContext(context.Background(), client.Info{
+		Metadata: client.NewMetadata(map[string][]string{"Tenant": {"metadata-tenant"}}),
+	})
+	assert.Equal(t, "metadata-tenant", builtin.Tenant(clientMetadata, httpReq, resourceWith("")))
+
+	assert.Equal(t, "header-tenant", builtin.Tenant(context.Background(), httpReq, resourceWith("resource-tenant")))
+	assert.Equal(t, "resource-tenant", builtin.Tenant(context.Background(), grpcReq, resourceWith("resource-tenant")))
+	assert.Equal(t, "", builtin.Tenant(context.Background(), grpcReq, resourceWith("")))
+	assert.Equal(t, DefaultName, builtin.Attribute())
+}
+
+func TestChain(t *testing.T) {
+	chain, err := NewChain("tenant.id", []SourceSettings{
+		{Type: SourceHeader, Name: "X-Tenant", WhenAuthenticated: true},
+		{Type: SourceResourceAttribute, Name: "app.tenant"},
+		{Type: SourceStatic, Listeners: map[string]string{"0.0.0.0:4318": "listener-tenant"}, Paths: map[string]string{
+			"/tenant-a":    "a",
+			"/tenant-a/v1": "a-v1",
+			"/opentelemetry.proto.collector.logs.v1.LogsService/": "logs",
+		}},
+		{Type: SourceDefault, Value: "fallback"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "tenant.id", chain.Attribute())
+
+	authenticated := client.NewContext(context.Background(), client.Info{Auth: testAuthData{}})
+	header := Request{Header: http.Header{"X-Tenant": {"header-tenant"}}}
+	assert.Equal(t, "header-tenant", chain.Tenant(authenticated, header, pcommon.NewMap()))
+
+	resource := pcommon.NewMap()
+	resource.PutStr("app.tenant", "resource-tenant")
+	assert.Equal(t, "resource-tenant", chain.Tenant(context.Background(), Request{}, resource))
+	assert.Equal(t, "fallback", chain.Tenant(authenticated, Request{}, resource))
+
+	assert.Equal(t, "a", chain.Tenant(context.Background(), Request{Path: "/tenant-a/v2/traces"}, pcommon.NewMap()))
+	assert.Equal(t, "a-v1", chain.Tenant(context.Background(), Request{Path: "/tenant-a/v1/traces"}, pcommon.NewMap()))
+	assert.Equal(t, "fallback", chain.Tenant(context.Background(), Request{Path: "/tenant-ab/v1/traces"}, pcommon.NewMap()))
+	assert.Equal(t, "logs", chain.Tenant(context.Background(),
+		Request{Path: "/opentelemetry.proto.collector.logs.v1.LogsService/Export"}, pcommon.NewMap()))
+	assert.Equal(t, "listener-tenant", chain.Tenant(context.Background(),
+		Request{Listener: "0.0.0.0:4318", Path: "/tenant-ab/v1/traces"}, pcommon.NewMap()))
+}
+
+func TestSourceSettingsValidate(t *testing.T) {
+	for _, tc := range []struct {
+		source SourceSettings
+		err    string
+	}{
+		{source: SourceSettings{}, err: "source type must be set"},
+		{source: SourceSettings{Type: "cookie"}, err: `unknown source type "cookie"`},
+		{source: SourceSettings{Type: SourceStatic}, err: "static source requires listeners or paths"},
+		{source: SourceSettings{Type: SourceDefault}, err: "default source requires a value"},
+		{source: SourceSettings{Type: SourceAuth}},
+		{source: SourceSettings{Type: SourceStatic, Paths: map[string]string{"/a": "a"}}},
+	} {
+		err := tc.source.Validate()
+		if tc.err == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tc.err)
+		}
+	}
+
+	_, err := NewChain("", []SourceSettings{{Type: SourceAuth}, {Type: SourceDefault}})
+	assert.EqualError(t, err, "source 1: default source requires a value")
+}
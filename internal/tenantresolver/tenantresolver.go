@@ -0,0 +1,130 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tenantresolver resolves the tenant of the data received by the HoloInsight receivers. The receivers
+// consult a Resolver, provided by an extension like holoinsight_tenant_resolver or else the built-in chain of
+// sources, through a Gate.
+package tenantresolver // import "github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"google.golang.org/grpc"
+)
+
+// Request describes how data was received.
+type Request struct {
+	// Listener is the endpoint the data was received on, as configured in the receiver, e.g. 0.0.0.0:4318.
+	Listener string
+	// Path is the URL path of an HTTP request, or the full method of a gRPC call.
+	Path string
+	// Header is the header of an HTTP request, nil for a gRPC call whose metadata is in the context.
+	Header http.Header
+}
+
+// Resolver resolves the tenant of the data.
+type Resolver interface {
+	// Tenant returns the tenant of the data of resource received with ctx as described by req, empty when unknown.
+	// resource is empty for requests carrying no data, e.g. the SkyWalking configuration discovery.
+	Tenant(ctx context.Context, req Request, resource pcommon.Map) string
+	// Attribute is the resource attribute the tenant is put in.
+	Attribute() string
+}
+
+type requestKey struct{}
+
+// Handler stores the Request of the HTTP requests received on listener in their context, see RequestOf.
+func Handler(listener string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := Request{Listener: listener, Path: r.URL.Path, Header: r.Header}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestKey{}, req)))
+	})
+}
+
+// RequestOf returns the Request of the HTTP request handled with ctx, stored by Handler, or else
+// describes the gRPC call of ctx received on grpcListener.
+func RequestOf(ctx context.Context, grpcListener string) Request {
+	if req, ok := ctx.Value(requestKey{}).(Request); ok {
+		return req
+	}
+	method, _ := grpc.Method(ctx)
+	return Request{Listener: grpcListener, Path: method}
+}
+
+// Gate is how a receiver consults its resolver. Handlers are given the Gate when they are created,
+// the resolver is set once the extensions are known, on Start. A nil Gate or a Gate without resolver
+// uses the built-in chain, see Builtin.
+type Gate struct {
+	resolver atomic.Value // holder
+	// fallback replaces the built-in chain, see SetFallback.
+	fallback Resolver
+}
+
+type holder struct {
+	Resolver
+}
+
+// Resolve sets the resolver to the extension id of host, the Gate uses the built-in chain when id is nil.
+func (g *Gate) Resolve(host component.Host, id *component.ID) error {
+	if id == nil {
+		return nil
+	}
+	ext, ok := host.GetExtensions()[*id]
+	if !ok {
+		return fmt.Errorf("tenant resolver %q not found", id)
+	}
+	resolver, ok := ext.(Resolver)
+	if !ok {
+		return fmt.Errorf("extension %q is not a tenant resolver", id)
+	}
+	g.resolver.Store(holder{resolver})
+	return nil
+}
+
+// SetFallback sets the resolver used instead of the built-in chain when no resolver extension is configured,
+// e.g. to keep the tenant a receiver always gave the data of no tenant. It must be called before the Gate is used.
+func (g *Gate) SetFallback(r Resolver) {
+	g.fallback = r
+}
+
+func (g *Gate) get() Resolver {
+	if g != nil {
+		if h, ok := g.resolver.Load().(holder); ok {
+			return h.Resolver
+		}
+		if g.fallback != nil {
+			return g.fallback
+		}
+	}
+	return builtin
+}
+
+// Tenant returns the tenant of the data of resource, see Resolver.
+func (g *Gate) Tenant(ctx context.Context, req Request, resource pcommon.Map) string {
+	return g.get().Tenant(ctx, req, resource)
+}
+
+// Stamp puts the tenant of the data of resource in its tenant attribute, replacing the value sent by the
+// client, and returns it. The attribute is emptied when the tenant is unknown.
+func (g *Gate) Stamp(ctx context.Context, req Request, resource pcommon.Map) string {
+	resolver := g.get()
+	tenant := resolver.Tenant(ctx, req, resource)
+	resource.PutStr(resolver.Attribute(), tenant)
+	return tenant
+}
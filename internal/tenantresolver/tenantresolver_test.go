@@ -0,0 +1,113 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenantresolver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+func TestRequestOf(t *testing.T) {
+	var got Request
+	handler := Handler("0.0.0.0:4318", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = RequestOf(r.Context(), "0.0.0.0:4317")
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/v1/traces", nil)
+	req.Header.Set("X-Tenant", "t1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "0.0.0.0:4318", got.Listener)
+	assert.Equal(t, "/v1/traces", got.Path)
+	assert.Equal(t, "t1", got.Header.Get("X-Tenant"))
+
+	assert.Equal(t, Request{Listener: "0.0.0.0:4317"}, RequestOf(context.Background(), "0.0.0.0:4317"))
+}
+
+type resolverExtension struct {
+	component.StartFunc
+	component.ShutdownFunc
+}
+
+func (resolverExtension) Tenant(context.Context, Request, pcommon.Map) string {
+	return "extension-tenant"
+}
+
+func (resolverExtension) Attribute() string {
+	return "tenant.id"
+}
+
+type extensionsHost struct {
+	component.Host
+	extensions map[component.ID]component.Component
+}
+
+func (h *extensionsHost) GetExtensions() map[component.ID]component.Component {
+	return h.extensions
+}
+
+func TestGate(t *testing.T) {
+	var nilGate *Gate
+	resource := pcommon.NewMap()
+	resource.PutStr(DefaultName, "spoofed")
+	assert.Equal(t, "spoofed", nilGate.Tenant(context.Background(), Request{}, resource))
+
+	gate := &Gate{}
+	assert.Equal(t, "", gate.Stamp(client.NewContext(context.Background(), client.Info{Auth: testAuthData{}}), Request{}, resource))
+	tenant, _ := resource.Get(DefaultName)
+	assert.Equal(t, "", tenant.Str())
+
+	id := component.NewID("holoinsight_tenant_resolver")
+	notResolver := component.NewID("zpages")
+	host := &extensionsHost{
+		Host: componenttest.NewNopHost(),
+		extensions: map[component.ID]component.Component{id: resolverExtension{}, notResolver: &struct {
+			component.StartFunc
+			component.ShutdownFunc
+		}{}},
+	}
+	missing := component.NewID("missing")
+	assert.EqualError(t, gate.Resolve(host, &missing), `tenant resolver "missing" not found`)
+	assert.EqualError(t, gate.Resolve(host, &notResolver), `extension "zpages" is not a tenant resolver`)
+	assert.NoError(t, gate.Resolve(host, nil))
+	require.NoError(t, gate.Resolve(host, &id))
+
+	resource = pcommon.NewMap()
+	assert.Equal(t, "extension-tenant", gate.Stamp(context.Background(), Request{}, resource))
+	tenant, _ = resource.Get("tenant.id")
+	assert.Equal(t, "extension-tenant", tenant.Str())
+}
+
+func TestGateFallback(t *testing.T) {
+	fallback, err := NewChain("", append(BuiltinSources(), SourceSettings{Type: SourceDefault, Value: "default"}))
+	require.NoError(t, err)
+	gate := &Gate{}
+	gate.SetFallback(fallback)
+	assert.Equal(t, "default", gate.Tenant(context.Background(), Request{}, pcommon.NewMap()))
+	assert.Equal(t, "header-tenant", gate.Tenant(context.Background(), Request{Header: http.Header{"Tenant": {"header-tenant"}}}, pcommon.NewMap()))
+
+	// the resolver extension replaces the fallback
+	id := component.NewID("holoinsight_tenant_resolver")
+	host := &extensionsHost{Host: componenttest.NewNopHost(), extensions: map[component.ID]component.Component{id: resolverExtension{}}}
+	require.NoError(t, gate.Resolve(host, &id))
+	assert.Equal(t, "extension-tenant", gate.Tenant(context.Background(), Request{}, pcommon.NewMap()))
+}
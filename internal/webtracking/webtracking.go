@@ -0,0 +1,266 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package webtracking decodes the logs sent to the /logstores/{logstore}/track endpoints, compatible with the
+// Alibaba Cloud SLS WebTracking API, for the holoinsight_logs extension and receiver.
+package webtracking // import "github.com/traas-stack/holoinsight-collector/internal/webtracking"
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pierrec/lz4/v4"
+	"go.uber.org/multierr"
+
+	"github.com/traas-stack/holoinsight-collector/internal/aescrypt"
+)
+
+const (
+	// Route is the gorilla/mux route of the endpoint, the logstore being the "logstore" variable.
+	Route = "/logstores/{logstore}/track"
+	// PixelRoute is the route of the beacons, the logs of GET requests answered with a transparent GIF.
+	PixelRoute  = "/logstores/{logstore}/track_ua.gif"
+	pixelSuffix = "/track_ua.gif"
+
+	apiVersionParam    = "APIVersion"
+	topicParam         = "__topic__"
+	compressTypeHeader = "x-log-compresstype"
+	bodyRawSizeHeader  = "x-log-bodyrawsize"
+
+	// tags of the beacons
+	userAgentTag = "__user_agent__"
+	refererTag   = "__referer__"
+
+	// maxBodySize is the size of a body over which it is rejected, before it is decompressed.
+	maxBodySize = 16 << 20
+	// maxRawSize is the size of a decompressed body over which it is rejected.
+	maxRawSize = 64 << 20
+	// maxCompressionRatio bounds the x-log-bodyrawsize of an lz4 body, allocated before it is decompressed.
+	maxCompressionRatio = 64
+)
+
+// TimeField is the optional field of a log entry holding its time.
+const TimeField = "__time__"
+
+// Payload is the body of a request: logs sharing tags, a topic and a source.
+type Payload struct {
+	Logs   []map[string]string `mapstructure:"__logs__" json:"__logs__"`
+	Tags   map[string]string   `mapstructure:"__tags__" json:"__tags__"`
+	Topic  string              `mapstructure:"__topic__" json:"__topic__"`
+	Source string              `mapstructure:"__source__" json:"__source__"`
+}
+
+var (
+	errEmptyPayload = errors.New("empty payload")
+	// ErrBodyTooLarge rejects the bodies over the size limits, before or after they are decompressed.
+	ErrBodyTooLarge = errors.New("body too large")
+)
+
+// pixel is a transparent 1x1 GIF.
+var pixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	buffer := bufferPool.Get().(*bytes.Buffer)
+	buffer.Reset()
+	return buffer
+}
+
+func putBuffer(buffer *bytes.Buffer) {
+	bufferPool.Put(buffer)
+}
+
+// Decode reads the logs of req and closes its body: the logs of the JSON body of a POST, possibly compressed as
+// told by the x-log-compresstype header, or the log of the query string of a GET. The beacons of PixelRoute
+// also have the User-Agent and Referer headers as tags. size is the length of the body, or the query.
+// The bodies over 16 MiB, or 64 MiB decompressed, fail with ErrBodyTooLarge.
+func Decode(req *http.Request) (payload *Payload, size int, err error) {
+	defer func() {
+		_, errs := io.Copy(io.Discard, req.Body)
+		err = multierr.Combine(err, errs, req.Body.Close())
+	}()
+	if req.Method == http.MethodGet {
+		payload = decodeQuery(req)
+		return payload, len(req.URL.RawQuery), nil
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if _, err = io.Copy(buf, io.LimitReader(req.Body, maxBodySize+1)); err != nil {
+		return nil, 0, err
+	}
+	size = buf.Len()
+	if size > maxBodySize {
+		return nil, size, ErrBodyTooLarge
+	}
+	body, err := decompress(req.Header, buf.Bytes())
+	if err != nil {
+		return nil, size, err
+	}
+	if err = json.Unmarshal(body, &payload); err != nil {
+		return nil, size, err
+	}
+	if payload == nil {
+		return nil, size, errEmptyPayload
+	}
+	return payload, size, nil
+}
+
+// decodeQuery returns the log of the query string of req, but for the API version and the topic.
+func decodeQuery(req *http.Request) *Payload {
+	query := req.URL.Query()
+	payload := &Payload{Topic: query.Get(topicParam)}
+	entry := make(map[string]string, len(query))
+	for k, v := range query {
+		if k != apiVersionParam && k != topicParam && len(v) > 0 {
+			entry[k] = v[0]
+		}
+	}
+	if len(entry) > 0 {
+		payload.Logs = []map[string]string{entry}
+	}
+	if isPixel(req) {
+		payload.Tags = make(map[string]string, 2)
+		if ua := req.UserAgent(); ua != "" {
+			payload.Tags[userAgentTag] = ua
+		}
+		if referer := req.Referer(); referer != "" {
+			payload.Tags[refererTag] = referer
+		}
+	}
+	return payload
+}
+
+// decompress returns the body, decompressed by the algorithm of the x-log-compresstype header. The lz4 blocks
+// of the SLS SDKs are decompressed to x-log-bodyrawsize bytes, at most maxCompressionRatio times the body.
+func decompress(header http.Header, body []byte) ([]byte, error) {
+	switch compressType := header.Get(compressTypeHeader); compressType {
+	case "":
+		return body, nil
+	case "lz4":
+		rawSize, err := strconv.Atoi(header.Get(bodyRawSizeHeader))
+		if err != nil || rawSize < 0 {
+			return nil, fmt.Errorf("invalid %s header for an lz4 body", bodyRawSizeHeader)
+		}
+		if rawSize > maxRawSize || rawSize > maxCompressionRatio*len(body) {
+			return nil, ErrBodyTooLarge
+		}
+		raw := make([]byte, rawSize)
+		n, err := lz4.UncompressBlock(body, raw)
+		if err != nil {
+			return nil, err
+		}
+		return raw[:n], nil
+	case "deflate":
+		r, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		raw, err := io.ReadAll(io.LimitReader(r, maxRawSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) > maxRawSize {
+			return nil, ErrBodyTooLarge
+		}
+		return raw, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", compressType)
+	}
+}
+
+// Handle routes the requests of the WebTracking API to handler: the POSTed and GET logs of Route and the beacons
+// of PixelRoute.
+func Handle(router *mux.Router, handler http.HandlerFunc) {
+	router.HandleFunc(Route, handler).Methods(http.MethodPost, http.MethodGet)
+	router.HandleFunc(PixelRoute, handler).Methods(http.MethodGet)
+}
+
+// Succeed answers a request whose logs were accepted: with a transparent GIF for the beacons, an empty body otherwise.
+func Succeed(w http.ResponseWriter, req *http.Request) {
+	if !isPixel(req) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(pixel)
+}
+
+func isPixel(req *http.Request) bool {
+	return strings.HasSuffix(req.URL.Path, pixelSuffix)
+}
+
+// EntryTime returns the time of a log entry, from its TimeField: Unix seconds, Unix milliseconds or RFC3339.
+// ok is false when the entry has no valid time.
+func EntryTime(entry map[string]string) (t time.Time, ok bool) {
+	value, ok := entry[TimeField]
+	if !ok || value == "" {
+		return time.Time{}, false
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		// Unix milliseconds are over 1e12 since 2001, Unix seconds until the year 33658
+		if n >= 1e12 || n <= -1e12 {
+			return time.UnixMilli(n), true
+		}
+		return time.Unix(n, 0), true
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	return t, err == nil
+}
+
+// Decrypt configures the decryption of the encrypted logstores handed to the clients.
+type Decrypt struct {
+	// default: false
+	Enable bool `mapstructure:"enable"`
+	// A secret key is a piece of information that is used to aes encrypt and decrypt data in a symmetric encryption algorithm.
+	SecretKey string `mapstructure:"secretKey"`
+	// IV (Initialization Vector): An initialization vector is a random value that is used in conjunction with a secret key to
+	// encrypt data in a symmetric encryption algorithm. It is used to ensure that the same plaintext message encrypted with
+	// the same secret key produces a different ciphertext message each time it is encrypted. The IV is typically included
+	// in the encrypted message and must be kept confidential to ensure the security of the encrypted data.
+	IV string `mapstructure:"iv"`
+	// Keys are the AES-GCM keys of "v1.<key id>.<ciphertext>" values, rotated by adding the new key
+	// and removing the old one once no value encrypted with it is in use.
+	Keys []aescrypt.Key `mapstructure:"keys"`
+}
+
+// Keyring returns the keys logstores are decrypted with, nil when decryption is disabled.
+func (d *Decrypt) Keyring() (*aescrypt.Keyring, error) {
+	if !d.Enable || (d.SecretKey == "" && len(d.Keys) == 0) {
+		return nil, nil
+	}
+	return aescrypt.New(d.Keys, d.SecretKey, d.IV)
+}
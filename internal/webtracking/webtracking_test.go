@@ -0,0 +1,210 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webtracking
+
+import (
+	"bytes"
+	"compress/zlib"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pierrec/lz4/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/traas-stack/holoinsight-collector/internal/aescrypt"
+)
+
+func TestDecode(t *testing.T) {
+	body := `{"__logs__":[{"msg":"a"},{"msg":"b"}],"__tags__":{"env":"prod"},"__topic__":"web","__source__":"10.0.0.1"}`
+	payload, size, err := Decode(httptest.NewRequest(http.MethodPost, "/logstores/web/track", strings.NewReader(body)))
+	require.NoError(t, err)
+	assert.Equal(t, len(body), size)
+	assert.Equal(t, &Payload{
+		Logs:   []map[string]string{{"msg": "a"}, {"msg": "b"}},
+		Tags:   map[string]string{"env": "prod"},
+		Topic:  "web",
+		Source: "10.0.0.1",
+	}, payload)
+
+	_, _, err = Decode(httptest.NewRequest(http.MethodPost, "/logstores/web/track", strings.NewReader("null")))
+	assert.Equal(t, errEmptyPayload, err)
+	_, _, err = Decode(httptest.NewRequest(http.MethodPost, "/logstores/web/track", strings.NewReader("{")))
+	assert.Error(t, err)
+}
+
+func TestDecodeQuery(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/logstores/web/track?APIVersion=0.6.0&__topic__=web&page=home&user=a&user=b", nil)
+	payload, size, err := Decode(req)
+	require.NoError(t, err)
+	assert.Equal(t, len(req.URL.RawQuery), size)
+	assert.Equal(t, &Payload{Logs: []map[string]string{{"page": "home", "user": "a"}}, Topic: "web"}, payload)
+
+	req = httptest.NewRequest(http.MethodGet, "/logstores/web/track_ua.gif?APIVersion=0.6.0&page=home", nil)
+	req.Header.Set("User-Agent", "browser")
+	req.Header.Set("Referer", "https://example.com/")
+	payload, _, err = Decode(req)
+	require.NoError(t, err)
+	assert.Equal(t, &Payload{
+		Logs: []map[string]string{{"page": "home"}},
+		Tags: map[string]string{userAgentTag: "browser", refererTag: "https://example.com/"},
+	}, payload)
+
+	payload, _, err = Decode(httptest.NewRequest(http.MethodGet, "/logstores/web/track?APIVersion=0.6.0", nil))
+	require.NoError(t, err)
+	assert.Empty(t, payload.Logs)
+}
+
+func TestDecodeCompressed(t *testing.T) {
+	body := []byte(`{"__logs__":[{"msg":"a"}]}`)
+	want := &Payload{Logs: []map[string]string{{"msg": "a"}}}
+
+	compressed := make([]byte, lz4.CompressBlockBound(len(body)))
+	n, err := lz4.CompressBlock(body, compressed, nil)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/logstores/web/track", bytes.NewReader(compressed[:n]))
+	req.Header.Set("x-log-apiversion", "0.6.0")
+	req.Header.Set(compressTypeHeader, "lz4")
+	req.Header.Set(bodyRawSizeHeader, strconv.Itoa(len(body)))
+	payload, size, err := Decode(req)
+	require.NoError(t, err)
+	assert.Equal(t, n, size)
+	assert.Equal(t, want, payload)
+
+	var deflated bytes.Buffer
+	zw := zlib.NewWriter(&deflated)
+	_, err = zw.Write(body)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	req = httptest.NewRequest(http.MethodPost, "/logstores/web/track", &deflated)
+	req.Header.Set(compressTypeHeader, "deflate")
+	payload, _, err = Decode(req)
+	require.NoError(t, err)
+	assert.Equal(t, want, payload)
+
+	for _, header := range []map[string]string{
+		{compressTypeHeader: "lz4"},
+		{compressTypeHeader: "lz4", bodyRawSizeHeader: strconv.Itoa(maxRawSize + 1)},
+		{compressTypeHeader: "brotli"},
+	} {
+		req = httptest.NewRequest(http.MethodPost, "/logstores/web/track", bytes.NewReader(compressed[:n]))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		_, _, err = Decode(req)
+		assert.Error(t, err, header)
+	}
+}
+
+func TestDecodeTooLarge(t *testing.T) {
+	_, _, err := Decode(httptest.NewRequest(http.MethodPost, "/logstores/web/track", bytes.NewReader(make([]byte, maxBodySize+1))))
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// the raw size of an lz4 body is bounded by its size
+	body := []byte(`{"__logs__":[{"msg":"a"}]}`)
+	compressed := make([]byte, lz4.CompressBlockBound(len(body)))
+	n, err := lz4.CompressBlock(body, compressed, nil)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/logstores/web/track", bytes.NewReader(compressed[:n]))
+	req.Header.Set(compressTypeHeader, "lz4")
+	req.Header.Set(bodyRawSizeHeader, strconv.Itoa(maxCompressionRatio*n+1))
+	_, _, err = Decode(req)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// a deflated body is decompressed up to maxRawSize
+	var deflated bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&deflated, zlib.BestCompression)
+	require.NoError(t, err)
+	_, err = zw.Write(make([]byte, maxRawSize+1))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	req = httptest.NewRequest(http.MethodPost, "/logstores/web/track", &deflated)
+	req.Header.Set(compressTypeHeader, "deflate")
+	_, _, err = Decode(req)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func TestHandle(t *testing.T) {
+	router := mux.NewRouter()
+	Handle(router, func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "web", mux.Vars(req)["logstore"])
+		Succeed(w, req)
+	})
+	for _, tc := range []struct {
+		method, path string
+		code         int
+		gif          bool
+	}{
+		{method: http.MethodPost, path: "/logstores/web/track", code: http.StatusOK},
+		{method: http.MethodGet, path: "/logstores/web/track?k=v", code: http.StatusOK},
+		{method: http.MethodGet, path: "/logstores/web/track_ua.gif?k=v", code: http.StatusOK, gif: true},
+		{method: http.MethodPut, path: "/logstores/web/track", code: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, path: "/logstores/web/track_ua.gif", code: http.StatusMethodNotAllowed},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+		assert.Equal(t, tc.code, rec.Code, tc.path)
+		if tc.gif {
+			assert.Equal(t, "image/gif", rec.Header().Get("Content-Type"))
+			assert.Equal(t, pixel, rec.Body.Bytes())
+		}
+	}
+}
+
+func TestEntryTime(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  time.Time
+		ok    bool
+	}{
+		{value: "1700000000", want: time.Unix(1700000000, 0), ok: true},
+		{value: "1700000000123", want: time.UnixMilli(1700000000123), ok: true},
+		{value: "2023-11-14T22:13:20.5Z", want: time.Date(2023, 11, 14, 22, 13, 20, 5e8, time.UTC), ok: true},
+		{value: "2023-11-14T22:13:20+08:00", want: time.Date(2023, 11, 14, 14, 13, 20, 0, time.UTC), ok: true},
+		{value: "yesterday"},
+		{value: ""},
+	} {
+		got, ok := EntryTime(map[string]string{TimeField: tc.value})
+		assert.Equal(t, tc.ok, ok, tc.value)
+		if tc.ok {
+			assert.True(t, tc.want.Equal(got), tc.value)
+		}
+	}
+	_, ok := EntryTime(map[string]string{"msg": "a"})
+	assert.False(t, ok)
+}
+
+func TestKeyring(t *testing.T) {
+	keys, err := (&Decrypt{Keys: []aescrypt.Key{{ID: "k1", Secret: "MDEyMzQ1Njc4OWFiY2RlZg=="}}}).Keyring()
+	require.NoError(t, err)
+	assert.Nil(t, keys)
+
+	keys, err = (&Decrypt{Enable: true}).Keyring()
+	require.NoError(t, err)
+	assert.Nil(t, keys)
+
+	keys, err = (&Decrypt{Enable: true, Keys: []aescrypt.Key{{ID: "k1", Secret: "MDEyMzQ1Njc4OWFiY2RlZg=="}}}).Keyring()
+	require.NoError(t, err)
+	encrypted, err := keys.Encrypt("logstore-1")
+	require.NoError(t, err)
+	decrypted, err := keys.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "logstore-1", decrypted)
+}
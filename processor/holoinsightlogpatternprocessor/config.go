@@ -0,0 +1,76 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogpatternprocessor // import "github.com/traas-stack/holoinsight-collector/processor/holoinsightlogpatternprocessor"
+
+import (
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+)
+
+// Config defines the configuration of the holoinsight_log_pattern processor.
+type Config struct {
+	// TenantAttribute and ServiceAttribute are the resource attributes the logs are clustered by, with separate
+	// patterns. default: tenant, service.name
+	TenantAttribute  string `mapstructure:"tenant_attribute"`
+	ServiceAttribute string `mapstructure:"service_attribute"`
+	// IDAttribute and TemplateAttribute are the log attributes the pattern is put in.
+	// default: log.pattern.id, log.pattern.template
+	IDAttribute       string `mapstructure:"id_attribute"`
+	TemplateAttribute string `mapstructure:"template_attribute"`
+	// Depth is the depth of the parse tree, the logs being told apart by their first Depth-2 tokens. default: 4
+	Depth int `mapstructure:"depth"`
+	// SimilarityThreshold is the fraction of the tokens of a log equal to a template's for the log to match it.
+	// default: 0.4
+	SimilarityThreshold float64 `mapstructure:"similarity_threshold"`
+	// MaxChildren is the number of children of a node, the other tokens share a wildcard child. default: 100
+	MaxChildren int `mapstructure:"max_children"`
+	// MaxClusters is the number of patterns, the least recently seen are evicted. default: 10000
+	MaxClusters int `mapstructure:"max_clusters"`
+	// MetricsInterval is how often the number of logs of each pattern is recorded. default: 1m
+	MetricsInterval time.Duration `mapstructure:"metrics_interval"`
+	// MetricsExporter is the metrics exporter, e.g. otlp, the number of logs of the most frequent patterns is
+	// exported to every MetricsInterval. The patterns are not exported when not set.
+	MetricsExporter *component.ID `mapstructure:"metrics_exporter"`
+	// TopPatterns is the number of patterns of each tenant and service exported, the ones with the most logs
+	// in the interval. default: 100
+	TopPatterns int `mapstructure:"top_patterns"`
+	// Storage is the storage extension, e.g. file_storage, the patterns are checkpointed in, restored on start.
+	// The patterns are learned again after a restart when not set.
+	Storage *component.ID `mapstructure:"storage"`
+	// CheckpointInterval is how often the patterns are checkpointed, and on shutdown. default: 1m
+	CheckpointInterval time.Duration `mapstructure:"checkpoint_interval"`
+}
+
+// Validate checks the parse tree and the intervals are bounded.
+func (cfg *Config) Validate() error {
+	if cfg.TenantAttribute == "" || cfg.ServiceAttribute == "" || cfg.IDAttribute == "" || cfg.TemplateAttribute == "" {
+		return errors.New("tenant, service, id and template attributes must be set")
+	}
+	if cfg.Depth < 3 {
+		return errors.New("depth must be at least 3")
+	}
+	if cfg.SimilarityThreshold <= 0 || cfg.SimilarityThreshold > 1 {
+		return errors.New("similarity_threshold must be in (0, 1]")
+	}
+	if cfg.MaxChildren <= 0 || cfg.MaxClusters <= 0 || cfg.TopPatterns <= 0 {
+		return errors.New("max_children, max_clusters and top_patterns must be positive")
+	}
+	if cfg.MetricsInterval <= 0 || cfg.CheckpointInterval <= 0 {
+		return errors.New("metrics_interval and checkpoint_interval must be positive")
+	}
+	return nil
+}
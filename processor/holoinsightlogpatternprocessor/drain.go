@@ -0,0 +1,252 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogpatternprocessor // import "github.com/traas-stack/holoinsight-collector/processor/holoinsightlogpatternprocessor"
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// wildcard is the token of the variable parts of the templates.
+const wildcard = "<*>"
+
+// cluster is a pattern of the logs of a tenant and a service, its template having wildcards where they differ.
+type cluster struct {
+	// id is derived from the first log of the pattern, it doesn't change as the template does.
+	id       string
+	tenant   string
+	service  string
+	tokens   []string
+	count    int64
+	pending  int64
+	lastSeen time.Time
+
+	leaf *node
+	elem *list.Element
+}
+
+func (c *cluster) template() string {
+	return strings.Join(c.tokens, " ")
+}
+
+// similarity returns the fraction of the tokens equal to the template's, and the number of its wildcards.
+func (c *cluster) similarity(tokens []string) (float64, int) {
+	same, wildcards := 0, 0
+	for i, token := range c.tokens {
+		if token == wildcard {
+			wildcards++
+		} else if token == tokens[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(tokens)), wildcards
+}
+
+// merge replaces the tokens of the template differing from tokens by wildcards.
+func (c *cluster) merge(tokens []string) {
+	for i, token := range c.tokens {
+		if token != wildcard && token != tokens[i] {
+			c.tokens[i] = wildcard
+		}
+	}
+}
+
+// node is a node of the parse tree: the first levels are the number of tokens, then the first tokens of the logs,
+// the leaves holding the clusters.
+type node struct {
+	parent   *node
+	key      string
+	children map[string]*node
+	clusters []*cluster
+}
+
+func (n *node) child(key string) *node {
+	if n.children == nil {
+		n.children = make(map[string]*node)
+	}
+	child, ok := n.children[key]
+	if !ok {
+		child = &node{parent: n, key: key}
+		n.children[key] = child
+	}
+	return child
+}
+
+// drain clusters the logs of each tenant and service with a fixed depth parse tree, see
+// https://jiemingzhu.github.io/pub/pjhe_icws2017.pdf. The least recently seen clusters are evicted over maxClusters.
+type drain struct {
+	depth       int
+	similarity  float64
+	maxChildren int
+	maxClusters int
+
+	// roots are the parse trees of the tenants and services.
+	roots map[string]*node
+	lru   *list.List
+}
+
+func newDrain(cfg *Config) *drain {
+	return &drain{
+		depth:       cfg.Depth,
+		similarity:  cfg.SimilarityThreshold,
+		maxChildren: cfg.MaxChildren,
+		maxClusters: cfg.MaxClusters,
+		roots:       make(map[string]*node),
+		lru:         list.New(),
+	}
+}
+
+func treeKey(tenant, service string) string {
+	return tenant + "\x00" + service
+}
+
+// add returns the cluster of the log of tenant and service, created when no cluster is similar enough, and the
+// clusters evicted to make room for it.
+func (d *drain) add(tenant, service, body string, now time.Time) (c *cluster, created bool, evicted []*cluster) {
+	tokens := strings.Fields(body)
+	if len(tokens) == 0 {
+		return nil, false, nil
+	}
+	leaf := d.leaf(tenant, service, tokens)
+
+	var best *cluster
+	bestSimilarity, bestWildcards := -1.0, -1
+	for _, candidate := range leaf.clusters {
+		s, wildcards := candidate.similarity(tokens)
+		if s > bestSimilarity || (s == bestSimilarity && wildcards > bestWildcards) {
+			best, bestSimilarity, bestWildcards = candidate, s, wildcards
+		}
+	}
+	if best != nil && bestSimilarity >= d.similarity {
+		best.merge(tokens)
+		c = best
+		d.lru.MoveToFront(c.elem)
+	} else {
+		c = &cluster{
+			id:      clusterID(tenant, service, tokens),
+			tenant:  tenant,
+			service: service,
+			tokens:  append([]string(nil), tokens...),
+			leaf:    leaf,
+		}
+		leaf.clusters = append(leaf.clusters, c)
+		c.elem = d.lru.PushFront(c)
+		created = true
+		evicted = d.evict()
+	}
+	c.count++
+	c.pending++
+	c.lastSeen = now
+	return c, created, evicted
+}
+
+// leaf returns the leaf of the tokens, created when missing. Tokens with digits, and the tokens of the nodes
+// with max children, share the wildcard child.
+func (d *drain) leaf(tenant, service string, tokens []string) *node {
+	key := treeKey(tenant, service)
+	root, ok := d.roots[key]
+	if !ok {
+		root = &node{key: key}
+		d.roots[key] = root
+	}
+	n := root.child(strconv.Itoa(len(tokens)))
+	for i := 0; i < d.depth-2 && i < len(tokens); i++ {
+		token := tokens[i]
+		if hasDigit(token) {
+			token = wildcard
+		}
+		if _, ok = n.children[token]; !ok && token != wildcard && len(n.children) >= d.maxChildren {
+			token = wildcard
+		}
+		n = n.child(token)
+	}
+	return n
+}
+
+// evict removes the least recently seen clusters over the max clusters, and the nodes left empty.
+func (d *drain) evict() []*cluster {
+	var evicted []*cluster
+	for d.lru.Len() > d.maxClusters {
+		c := d.lru.Remove(d.lru.Back()).(*cluster)
+		d.remove(c)
+		evicted = append(evicted, c)
+	}
+	return evicted
+}
+
+func (d *drain) remove(c *cluster) {
+	leaf := c.leaf
+	for i, other := range leaf.clusters {
+		if other == c {
+			leaf.clusters = append(leaf.clusters[:i], leaf.clusters[i+1:]...)
+			break
+		}
+	}
+	for n := leaf; n != nil && len(n.clusters) == 0 && len(n.children) == 0; n = n.parent {
+		if n.parent == nil {
+			delete(d.roots, n.key)
+		} else {
+			delete(n.parent.children, n.key)
+		}
+	}
+}
+
+// restore adds a cluster of a checkpoint, seen before the clusters already restored.
+func (d *drain) restore(c *cluster) {
+	c.leaf = d.leaf(c.tenant, c.service, c.tokens)
+	c.leaf.clusters = append(c.leaf.clusters, c)
+	c.elem = d.lru.PushBack(c)
+	d.evict()
+}
+
+// clusters returns the clusters, the most recently seen first.
+func (d *drain) clusters() []*cluster {
+	clusters := make([]*cluster, 0, d.lru.Len())
+	for elem := d.lru.Front(); elem != nil; elem = elem.Next() {
+		clusters = append(clusters, elem.Value.(*cluster))
+	}
+	return clusters
+}
+
+func clusterID(tenant, service string, tokens []string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(treeKey(tenant, service)))
+	for _, token := range tokens {
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(token))
+	}
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+func hasDigit(token string) bool {
+	for _, r := range token {
+		if unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortByLastSeen sorts the clusters, the most recently seen first.
+func sortByLastSeen(clusters []*cluster) {
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return clusters[i].lastSeen.After(clusters[j].lastSeen)
+	})
+}
@@ -0,0 +1,115 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogpatternprocessor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDrain(maxClusters int) *drain {
+	cfg := createDefaultConfig().(*Config)
+	cfg.MaxClusters = maxClusters
+	return newDrain(cfg)
+}
+
+func TestDrainClusters(t *testing.T) {
+	d := newTestDrain(100)
+	now := time.Now()
+
+	first, created, _ := d.add("t1", "app", "connected to 10.0.0.1 in 3 ms", now)
+	require.NotNil(t, first)
+	assert.True(t, created)
+	assert.Equal(t, "connected to 10.0.0.1 in 3 ms", first.template())
+
+	second, created, _ := d.add("t1", "app", "connected to 10.0.0.2 in 15 ms", now)
+	assert.False(t, created)
+	assert.Same(t, first, second)
+	assert.Equal(t, "connected to <*> in <*> ms", second.template())
+	assert.Equal(t, int64(2), second.count)
+
+	// the id doesn't change as the template does
+	assert.Equal(t, clusterID("t1", "app", []string{"connected", "to", "10.0.0.1", "in", "3", "ms"}), second.id)
+
+	other, created, _ := d.add("t1", "app", "user logged out", now)
+	assert.True(t, created)
+	assert.NotEqual(t, first.id, other.id)
+
+	// the logs of another tenant have their own patterns
+	tenant, created, _ := d.add("t2", "app", "connected to 10.0.0.1 in 3 ms", now)
+	assert.True(t, created)
+	assert.NotEqual(t, first.id, tenant.id)
+
+	c, _, _ := d.add("t1", "app", "   ", now)
+	assert.Nil(t, c)
+}
+
+func TestDrainSimilarity(t *testing.T) {
+	d := newTestDrain(100)
+	now := time.Now()
+
+	a, _, _ := d.add("t", "app", "cache miss for key user order", now)
+	// same leaf, but only 2 of the 6 tokens are the same
+	b, created, _ := d.add("t", "app", "cache miss at disk page item", now)
+	assert.True(t, created)
+	assert.NotSame(t, a, b)
+
+	c, created, _ := d.add("t", "app", "cache miss for key user invoice", now)
+	assert.False(t, created)
+	assert.Same(t, a, c)
+	assert.Equal(t, "cache miss for key user <*>", c.template())
+}
+
+func TestDrainEvict(t *testing.T) {
+	d := newTestDrain(2)
+	now := time.Now()
+
+	a, _, _ := d.add("t", "app", "alpha event", now)
+	b, _, _ := d.add("t", "app", "beta event happened", now)
+	d.add("t", "app", "alpha event", now)
+	c, created, evicted := d.add("t", "app", "gamma event happened here", now)
+	assert.True(t, created)
+	require.Len(t, evicted, 1)
+	assert.Same(t, b, evicted[0])
+	assert.Equal(t, []*cluster{c, a}, d.clusters())
+
+	// the nodes left empty are pruned
+	_, ok := d.roots[treeKey("t", "app")].children["3"]
+	assert.False(t, ok)
+
+	d.add("t", "other", "delta", now)
+	d.add("t", "other", "epsilon", now)
+	assert.Len(t, d.roots, 1)
+	_, ok = d.roots[treeKey("t", "app")]
+	assert.False(t, ok)
+}
+
+func TestDrainMaxChildren(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.MaxChildren = 2
+	d := newDrain(cfg)
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		d.add("t", "app", fmt.Sprintf("op%c done", 'a'+i), now)
+	}
+	root := d.roots[treeKey("t", "app")].children["2"]
+	assert.Len(t, root.children, 3)
+	assert.Contains(t, root.children, wildcard)
+}
@@ -0,0 +1,54 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogpatternprocessor // import "github.com/traas-stack/holoinsight-collector/processor/holoinsightlogpatternprocessor"
+
+import (
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// metricPatternLogs is the metric of the number of logs of the patterns.
+const metricPatternLogs = "log.pattern.logs"
+
+// patternMetrics returns the logs of the top patterns of each tenant and service between since and now, as a delta
+// sum per tenant and service with a data point per pattern.
+func (p *patternProcessor) patternMetrics(top map[tenantService][]patternLogs, since, now time.Time) pmetric.Metrics {
+	md := pmetric.NewMetrics()
+	for k, patterns := range top {
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr(p.cfg.TenantAttribute, k.tenant)
+		rm.Resource().Attributes().PutStr(p.cfg.ServiceAttribute, k.service)
+		sm := rm.ScopeMetrics().AppendEmpty()
+		sm.Scope().SetName(scopeName)
+		m := sm.Metrics().AppendEmpty()
+		m.SetName(metricPatternLogs)
+		m.SetDescription("Number of logs put in the pattern")
+		m.SetUnit("1")
+		sum := m.SetEmptySum()
+		sum.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+		sum.SetIsMonotonic(true)
+		for _, pattern := range patterns {
+			dp := sum.DataPoints().AppendEmpty()
+			dp.SetStartTimestamp(pcommon.NewTimestampFromTime(since))
+			dp.SetTimestamp(pcommon.NewTimestampFromTime(now))
+			dp.SetIntValue(pattern.logs)
+			dp.Attributes().PutStr(p.cfg.IDAttribute, pattern.id)
+			dp.Attributes().PutStr(p.cfg.TemplateAttribute, pattern.template)
+		}
+	}
+	return md
+}
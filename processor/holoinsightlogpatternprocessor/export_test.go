@@ -0,0 +1,107 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogpatternprocessor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/processor/processortest"
+)
+
+// exporterHost is a host with exporters.
+type exporterHost struct {
+	component.Host
+	exporters map[component.DataType]map[component.ID]component.Component
+}
+
+func (h *exporterHost) GetExporters() map[component.DataType]map[component.ID]component.Component {
+	return h.exporters
+}
+
+// metricsExporter is a metrics exporter keeping the metrics.
+type metricsExporter struct {
+	component.StartFunc
+	component.ShutdownFunc
+	*consumertest.MetricsSink
+}
+
+func TestExportPatterns(t *testing.T) {
+	exporterID := component.NewID("test_exporter")
+	sink := new(consumertest.MetricsSink)
+	host := &exporterHost{
+		Host: componenttest.NewNopHost(),
+		exporters: map[component.DataType]map[component.ID]component.Component{
+			component.DataTypeMetrics: {exporterID: metricsExporter{MetricsSink: sink}},
+		},
+	}
+	cfg := createDefaultConfig().(*Config)
+	cfg.MetricsExporter = &exporterID
+	cfg.TopPatterns = 1
+	p := newPatternProcessor(cfg, processortest.NewNopCreateSettings())
+	require.NoError(t, p.start(context.Background(), host))
+
+	_, err := p.processLogs(context.Background(), appLogs("t1", "app", "order 1 paid by alice", "cache refreshed", "order 2 paid by bob"))
+	require.NoError(t, err)
+	_, err = p.processLogs(context.Background(), appLogs("t2", "app", "cache refreshed"))
+	require.NoError(t, err)
+	p.recordMetrics()
+
+	// the most frequent pattern of each tenant and service is exported
+	require.Len(t, sink.AllMetrics(), 1)
+	md := sink.AllMetrics()[0]
+	require.Equal(t, 2, md.ResourceMetrics().Len())
+	patterns := make(map[string]map[string]int64)
+	for i := 0; i < md.ResourceMetrics().Len(); i++ {
+		rm := md.ResourceMetrics().At(i)
+		tenant, _ := rm.Resource().Attributes().Get("tenant")
+		service, _ := rm.Resource().Attributes().Get("service.name")
+		assert.Equal(t, "app", service.Str())
+		m := rm.ScopeMetrics().At(0).Metrics().At(0)
+		assert.Equal(t, metricPatternLogs, m.Name())
+		assert.Equal(t, pmetric.AggregationTemporalityDelta, m.Sum().AggregationTemporality())
+		patterns[tenant.Str()] = make(map[string]int64)
+		for j := 0; j < m.Sum().DataPoints().Len(); j++ {
+			dp := m.Sum().DataPoints().At(j)
+			id, _ := dp.Attributes().Get(defaultIDAttribute)
+			assert.NotEmpty(t, id.Str())
+			template, _ := dp.Attributes().Get(defaultTemplateAttribute)
+			patterns[tenant.Str()][template.Str()] = dp.IntValue()
+		}
+	}
+	assert.Equal(t, map[string]map[string]int64{
+		"t1": {"order <*> paid by <*>": 2},
+		"t2": {"cache refreshed": 1},
+	}, patterns)
+
+	// the patterns without logs since the last time are not exported
+	p.recordMetrics()
+	assert.Len(t, sink.AllMetrics(), 1)
+	require.NoError(t, p.shutdown(context.Background()))
+}
+
+func TestMetricsExporterNotFound(t *testing.T) {
+	exporterID := component.NewID("test_exporter")
+	cfg := createDefaultConfig().(*Config)
+	cfg.MetricsExporter = &exporterID
+	p := newPatternProcessor(cfg, processortest.NewNopCreateSettings())
+	assert.Error(t, p.start(context.Background(), &exporterHost{Host: componenttest.NewNopHost()}))
+}
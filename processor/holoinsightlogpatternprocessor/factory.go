@@ -0,0 +1,101 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogpatternprocessor // import "github.com/traas-stack/holoinsight-collector/processor/holoinsightlogpatternprocessor"
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/processor"
+	"go.opentelemetry.io/collector/processor/processorhelper"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+)
+
+const (
+	// The value of processor "type" in configuration.
+	typeStr = "holoinsight_log_pattern"
+
+	defaultServiceAttribute    = "service.name"
+	defaultIDAttribute         = "log.pattern.id"
+	defaultTemplateAttribute   = "log.pattern.template"
+	defaultDepth               = 4
+	defaultSimilarityThreshold = 0.4
+	defaultMaxChildren         = 100
+	defaultMaxClusters         = 10000
+	defaultMetricsInterval     = time.Minute
+	defaultTopPatterns         = 100
+	defaultCheckpointInterval  = time.Minute
+
+	// scopeName is the instrumentation scope of the metrics of the patterns.
+	scopeName = "github.com/traas-stack/holoinsight-collector/processor/holoinsightlogpatternprocessor"
+)
+
+var registerViews sync.Once
+
+// NewFactory creates a factory for the holoinsight_log_pattern processor.
+func NewFactory() processor.Factory {
+	registerViews.Do(func() {
+		_ = view.Register(metricViews()...)
+	})
+	return processor.NewFactory(
+		typeStr,
+		createDefaultConfig,
+		processor.WithLogs(createLogsProcessor, component.StabilityLevelAlpha),
+	)
+}
+
+func createDefaultConfig() component.Config {
+	return &Config{
+		TenantAttribute:     tenantresolver.DefaultName,
+		ServiceAttribute:    defaultServiceAttribute,
+		IDAttribute:         defaultIDAttribute,
+		TemplateAttribute:   defaultTemplateAttribute,
+		Depth:               defaultDepth,
+		SimilarityThreshold: defaultSimilarityThreshold,
+		MaxChildren:         defaultMaxChildren,
+		MaxClusters:         defaultMaxClusters,
+		MetricsInterval:     defaultMetricsInterval,
+		TopPatterns:         defaultTopPatterns,
+		CheckpointInterval:  defaultCheckpointInterval,
+	}
+}
+
+func createLogsProcessor(
+	ctx context.Context,
+	params processor.CreateSettings,
+	cfg component.Config,
+	next consumer.Logs,
+) (processor.Logs, error) {
+	oCfg := cfg.(*Config)
+	if err := oCfg.Validate(); err != nil {
+		return nil, err
+	}
+	p := newPatternProcessor(oCfg, params)
+	return processorhelper.NewLogsProcessor(
+		ctx,
+		params,
+		cfg,
+		next,
+		p.processLogs,
+		processorhelper.WithStart(p.start),
+		processorhelper.WithShutdown(p.shutdown),
+		processorhelper.WithCapabilities(consumer.Capabilities{MutatesData: true}),
+	)
+}
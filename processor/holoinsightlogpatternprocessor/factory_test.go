@@ -0,0 +1,53 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogpatternprocessor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/processor/processortest"
+)
+
+func TestCreateDefaultConfig(t *testing.T) {
+	cfg := NewFactory().CreateDefaultConfig().(*Config)
+	assert.Equal(t, "tenant", cfg.TenantAttribute)
+	assert.Equal(t, defaultServiceAttribute, cfg.ServiceAttribute)
+	assert.Equal(t, defaultDepth, cfg.Depth)
+	assert.Equal(t, defaultTopPatterns, cfg.TopPatterns)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Depth = 2
+	assert.Error(t, cfg.Validate())
+
+	cfg.Depth = defaultDepth
+	cfg.SimilarityThreshold = 1.5
+	assert.Error(t, cfg.Validate())
+
+	cfg.SimilarityThreshold = defaultSimilarityThreshold
+	cfg.TopPatterns = 0
+	assert.Error(t, cfg.Validate())
+}
+
+func TestCreateLogsProcessor(t *testing.T) {
+	factory := NewFactory()
+	cfg := factory.CreateDefaultConfig()
+	p, err := factory.CreateLogsProcessor(context.Background(), processortest.NewNopCreateSettings(), cfg, consumertest.NewNop())
+	require.NoError(t, err)
+	assert.True(t, p.Capabilities().MutatesData)
+}
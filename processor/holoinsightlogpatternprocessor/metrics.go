@@ -0,0 +1,78 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogpatternprocessor // import "github.com/traas-stack/holoinsight-collector/processor/holoinsightlogpatternprocessor"
+
+import (
+	"context"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+var (
+	tagTenant  = tag.MustNewKey("tenant")
+	tagService = tag.MustNewKey("service")
+
+	// the logs are not tagged by pattern, the rows of the views being never forgotten while the patterns are evicted
+	mPatternLogs     = stats.Int64("pattern_logs", "Number of logs put in a pattern", stats.UnitDimensionless)
+	mNewPatterns     = stats.Int64("new_patterns", "Number of patterns seen for the first time", stats.UnitDimensionless)
+	mEvictedPatterns = stats.Int64("evicted_patterns", "Number of patterns evicted, the least recently seen", stats.UnitDimensionless)
+)
+
+// metricViews returns the views of the self-telemetry metrics.
+func metricViews() []*view.View {
+	return []*view.View{
+		{
+			Name:        typeStr + "/" + mPatternLogs.Name(),
+			Measure:     mPatternLogs,
+			Description: mPatternLogs.Description(),
+			TagKeys:     []tag.Key{tagTenant, tagService},
+			Aggregation: view.Sum(),
+		},
+		{
+			Name:        typeStr + "/" + mNewPatterns.Name(),
+			Measure:     mNewPatterns,
+			Description: mNewPatterns.Description(),
+			TagKeys:     []tag.Key{tagTenant, tagService},
+			Aggregation: view.Sum(),
+		},
+		{
+			Name:        typeStr + "/" + mEvictedPatterns.Name(),
+			Measure:     mEvictedPatterns,
+			Description: mEvictedPatterns.Description(),
+			TagKeys:     []tag.Key{tagTenant, tagService},
+			Aggregation: view.Sum(),
+		},
+	}
+}
+
+func recordPatternLogs(tenant, service string, logs int64) {
+	_ = stats.RecordWithTags(context.Background(),
+		[]tag.Mutator{tag.Upsert(tagTenant, tenant), tag.Upsert(tagService, service)},
+		mPatternLogs.M(logs))
+}
+
+func recordNewPattern(tenant, service string) {
+	_ = stats.RecordWithTags(context.Background(),
+		[]tag.Mutator{tag.Upsert(tagTenant, tenant), tag.Upsert(tagService, service)},
+		mNewPatterns.M(1))
+}
+
+func recordEvictedPattern(tenant, service string) {
+	_ = stats.RecordWithTags(context.Background(),
+		[]tag.Mutator{tag.Upsert(tagTenant, tenant), tag.Upsert(tagService, service)},
+		mEvictedPatterns.M(1))
+}
@@ -0,0 +1,317 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogpatternprocessor // import "github.com/traas-stack/holoinsight-collector/processor/holoinsightlogpatternprocessor"
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/extension/experimental/storage"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/processor"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// checkpointKey is the storage key of the patterns.
+const checkpointKey = "patterns"
+
+// checkpointCluster is a pattern in the storage.
+type checkpointCluster struct {
+	ID       string    `json:"id"`
+	Tenant   string    `json:"tenant"`
+	Service  string    `json:"service"`
+	Tokens   []string  `json:"tokens"`
+	Count    int64     `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// patternProcessor puts the pattern of each log, clustered by drain, in its attributes.
+type patternProcessor struct {
+	cfg    *Config
+	logger *zap.Logger
+	id     component.ID
+
+	mu    sync.Mutex
+	drain *drain
+	// since is the start of the interval of the metrics.
+	since time.Time
+
+	exporter consumer.Metrics
+
+	client storage.Client
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newPatternProcessor(cfg *Config, params processor.CreateSettings) *patternProcessor {
+	return &patternProcessor{
+		cfg:    cfg,
+		logger: params.Logger,
+		id:     params.ID,
+		drain:  newDrain(cfg),
+		done:   make(chan struct{}),
+	}
+}
+
+// start restores the patterns of the storage, then records the metrics and checkpoints the patterns periodically.
+func (p *patternProcessor) start(ctx context.Context, host component.Host) error {
+	if p.cfg.MetricsExporter != nil {
+		exp, ok := host.GetExporters()[component.DataTypeMetrics][*p.cfg.MetricsExporter]
+		if !ok {
+			return fmt.Errorf("[holoinsightlogpatternprocessor] metrics exporter %q not found", p.cfg.MetricsExporter)
+		}
+		metricsExp, ok := exp.(consumer.Metrics)
+		if !ok {
+			return fmt.Errorf("[holoinsightlogpatternprocessor] exporter %q is not a metrics exporter", p.cfg.MetricsExporter)
+		}
+		p.exporter = metricsExp
+	}
+	if p.cfg.Storage != nil {
+		ext, ok := host.GetExtensions()[*p.cfg.Storage]
+		if !ok {
+			return fmt.Errorf("[holoinsightlogpatternprocessor] storage %q not found", p.cfg.Storage)
+		}
+		storageExt, ok := ext.(storage.Extension)
+		if !ok {
+			return fmt.Errorf("[holoinsightlogpatternprocessor] extension %q is not a storage extension", p.cfg.Storage)
+		}
+		client, err := storageExt.GetClient(ctx, component.KindProcessor, p.id, "")
+		if err != nil {
+			return fmt.Errorf("[holoinsightlogpatternprocessor] failed to get storage client: %w", err)
+		}
+		p.client = client
+		if err = p.restore(ctx); err != nil {
+			p.logger.Warn("[holoinsightlogpatternprocessor] failed to restore the patterns, learning them again", zap.Error(err))
+		}
+	}
+
+	p.mu.Lock()
+	p.since = time.Now()
+	p.mu.Unlock()
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		metrics := time.NewTicker(p.cfg.MetricsInterval)
+		defer metrics.Stop()
+		checkpoint := time.NewTicker(p.cfg.CheckpointInterval)
+		defer checkpoint.Stop()
+		for {
+			select {
+			case <-metrics.C:
+				p.recordMetrics()
+			case <-checkpoint.C:
+				if err := p.checkpoint(context.Background()); err != nil {
+					p.logger.Warn("[holoinsightlogpatternprocessor] failed to checkpoint the patterns", zap.Error(err))
+				}
+			case <-p.done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// shutdown records the metrics and checkpoints the patterns a last time.
+func (p *patternProcessor) shutdown(ctx context.Context) error {
+	close(p.done)
+	p.wg.Wait()
+	p.recordMetrics()
+	if p.client == nil {
+		return nil
+	}
+	return multierr.Append(p.checkpoint(ctx), p.client.Close(ctx))
+}
+
+func (p *patternProcessor) restore(ctx context.Context) error {
+	data, err := p.client.Get(ctx, checkpointKey)
+	if err != nil || data == nil {
+		return err
+	}
+	var clusters []checkpointCluster
+	if err = json.Unmarshal(data, &clusters); err != nil {
+		return err
+	}
+	restored := make([]*cluster, 0, len(clusters))
+	for _, c := range clusters {
+		if len(c.Tokens) == 0 {
+			continue
+		}
+		restored = append(restored, &cluster{
+			id:       c.ID,
+			tenant:   c.Tenant,
+			service:  c.Service,
+			tokens:   c.Tokens,
+			count:    c.Count,
+			lastSeen: c.LastSeen,
+		})
+	}
+	sortByLastSeen(restored)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range restored {
+		p.drain.restore(c)
+	}
+	p.logger.Info("[holoinsightlogpatternprocessor] patterns restored", zap.Int("patterns", p.drain.lru.Len()))
+	return nil
+}
+
+// checkpoint stores the patterns, the most recently seen first.
+func (p *patternProcessor) checkpoint(ctx context.Context) error {
+	p.mu.Lock()
+	current := p.drain.clusters()
+	clusters := make([]checkpointCluster, len(current))
+	for i, c := range current {
+		clusters[i] = checkpointCluster{
+			ID:       c.id,
+			Tenant:   c.tenant,
+			Service:  c.service,
+			Tokens:   append([]string(nil), c.tokens...),
+			Count:    c.count,
+			LastSeen: c.lastSeen,
+		}
+	}
+	p.mu.Unlock()
+
+	data, err := json.Marshal(clusters)
+	if err != nil {
+		return err
+	}
+	return p.client.Set(ctx, checkpointKey, data)
+}
+
+// tenantService are the tenant and service of patterns.
+type tenantService struct {
+	tenant, service string
+}
+
+// patternLogs is the number of logs of a pattern in an interval.
+type patternLogs struct {
+	id, template string
+	logs         int64
+}
+
+// recordMetrics records the logs of the patterns of each tenant and service since the last time, and exports the
+// logs of their TopPatterns most frequent patterns.
+func (p *patternProcessor) recordMetrics() {
+	now := time.Now()
+	totals := make(map[tenantService]int64)
+	var top map[tenantService][]patternLogs
+	p.mu.Lock()
+	if p.exporter != nil {
+		top = p.topPatternsLocked()
+	}
+	for elem := p.drain.lru.Front(); elem != nil; elem = elem.Next() {
+		c := elem.Value.(*cluster)
+		if c.pending > 0 {
+			totals[tenantService{tenant: c.tenant, service: c.service}] += c.pending
+			c.pending = 0
+		}
+	}
+	since := p.since
+	p.since = now
+	p.mu.Unlock()
+
+	for k, logs := range totals {
+		recordPatternLogs(k.tenant, k.service, logs)
+	}
+	if len(top) == 0 {
+		return
+	}
+	if err := p.exporter.ConsumeMetrics(context.Background(), p.patternMetrics(top, since, now)); err != nil {
+		p.logger.Warn("[holoinsightlogpatternprocessor] failed to export the patterns", zap.Error(err))
+	}
+}
+
+// topPatternsLocked returns the TopPatterns patterns of each tenant and service with the most logs since the last time.
+func (p *patternProcessor) topPatternsLocked() map[tenantService][]patternLogs {
+	clusters := make(map[tenantService][]*cluster)
+	for elem := p.drain.lru.Front(); elem != nil; elem = elem.Next() {
+		c := elem.Value.(*cluster)
+		if c.pending > 0 {
+			k := tenantService{tenant: c.tenant, service: c.service}
+			clusters[k] = append(clusters[k], c)
+		}
+	}
+	top := make(map[tenantService][]patternLogs, len(clusters))
+	for k, cs := range clusters {
+		sort.SliceStable(cs, func(i, j int) bool {
+			return cs[i].pending > cs[j].pending
+		})
+		if len(cs) > p.cfg.TopPatterns {
+			cs = cs[:p.cfg.TopPatterns]
+		}
+		patterns := make([]patternLogs, len(cs))
+		for i, c := range cs {
+			patterns[i] = patternLogs{id: c.id, template: c.template(), logs: c.pending}
+		}
+		top[k] = patterns
+	}
+	return top
+}
+
+func (p *patternProcessor) processLogs(_ context.Context, ld plog.Logs) (plog.Logs, error) {
+	now := time.Now()
+	var created, evicted []*cluster
+	p.mu.Lock()
+	for i := 0; i < ld.ResourceLogs().Len(); i++ {
+		rl := ld.ResourceLogs().At(i)
+		tenant := attribute(rl.Resource().Attributes(), p.cfg.TenantAttribute)
+		service := attribute(rl.Resource().Attributes(), p.cfg.ServiceAttribute)
+		for j := 0; j < rl.ScopeLogs().Len(); j++ {
+			records := rl.ScopeLogs().At(j).LogRecords()
+			for k := 0; k < records.Len(); k++ {
+				record := records.At(k)
+				if record.Body().Type() != pcommon.ValueTypeStr {
+					continue
+				}
+				c, isNew, gone := p.drain.add(tenant, service, record.Body().Str(), now)
+				if c == nil {
+					continue
+				}
+				if isNew {
+					created = append(created, c)
+				}
+				evicted = append(evicted, gone...)
+				record.Attributes().PutStr(p.cfg.IDAttribute, c.id)
+				record.Attributes().PutStr(p.cfg.TemplateAttribute, c.template())
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	for _, c := range created {
+		recordNewPattern(c.tenant, c.service)
+	}
+	for _, c := range evicted {
+		recordEvictedPattern(c.tenant, c.service)
+	}
+	return ld, nil
+}
+
+func attribute(attributes pcommon.Map, name string) string {
+	if v, ok := attributes.Get(name); ok {
+		return v.AsString()
+	}
+	return ""
+}
@@ -0,0 +1,206 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogpatternprocessor
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/extension/experimental/storage"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/processor/processortest"
+)
+
+func appLogs(tenant, service string, bodies ...string) plog.Logs {
+	ld := plog.NewLogs()
+	rl := ld.ResourceLogs().AppendEmpty()
+	rl.Resource().Attributes().PutStr("tenant", tenant)
+	rl.Resource().Attributes().PutStr("service.name", service)
+	records := rl.ScopeLogs().AppendEmpty().LogRecords()
+	for _, body := range bodies {
+		records.AppendEmpty().Body().SetStr(body)
+	}
+	return ld
+}
+
+func patternsOf(t *testing.T, ld plog.Logs) (ids, templates []string) {
+	records := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+	for i := 0; i < records.Len(); i++ {
+		id, ok := records.At(i).Attributes().Get(defaultIDAttribute)
+		require.True(t, ok)
+		template, ok := records.At(i).Attributes().Get(defaultTemplateAttribute)
+		require.True(t, ok)
+		ids = append(ids, id.Str())
+		templates = append(templates, template.Str())
+	}
+	return ids, templates
+}
+
+func TestProcessLogs(t *testing.T) {
+	p := newPatternProcessor(createDefaultConfig().(*Config), processortest.NewNopCreateSettings())
+	require.NoError(t, p.start(context.Background(), componenttest.NewNopHost()))
+
+	ld := appLogs("t1", "app", "order 1 paid by alice", "order 2 paid by bob", "cache refreshed")
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().AppendEmpty().Body().SetInt(1)
+	ld, err := p.processLogs(context.Background(), ld)
+	require.NoError(t, err)
+
+	records := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+	_, ok := records.At(3).Attributes().Get(defaultIDAttribute)
+	assert.False(t, ok)
+	records.RemoveIf(func(record plog.LogRecord) bool {
+		return record.Body().Str() == ""
+	})
+
+	ids, templates := patternsOf(t, ld)
+	assert.Equal(t, ids[0], ids[1])
+	assert.NotEqual(t, ids[0], ids[2])
+	assert.Equal(t, []string{"order 1 paid by alice", "order <*> paid by <*>", "cache refreshed"}, templates)
+
+	require.NoError(t, p.shutdown(context.Background()))
+	for _, c := range p.drain.clusters() {
+		assert.Zero(t, c.pending)
+	}
+}
+
+func TestPatternLogsMetric(t *testing.T) {
+	require.NoError(t, view.Register(metricViews()...))
+	p := newPatternProcessor(createDefaultConfig().(*Config), processortest.NewNopCreateSettings())
+	require.NoError(t, p.start(context.Background(), componenttest.NewNopHost()))
+	_, err := p.processLogs(context.Background(), appLogs("metrics", "app", "order 1 paid by alice", "order 2 paid by bob", "cache refreshed"))
+	require.NoError(t, err)
+	require.NoError(t, p.shutdown(context.Background()))
+
+	// the logs of the patterns of the tenant and service are summed in a single row
+	rows, err := view.RetrieveData(typeStr + "/" + mPatternLogs.Name())
+	require.NoError(t, err)
+	var logs []float64
+	for _, row := range rows {
+		if assert.Len(t, row.Tags, 2) && row.Tags[0] == (tag.Tag{Key: tagService, Value: "app"}) && row.Tags[1] == (tag.Tag{Key: tagTenant, Value: "metrics"}) {
+			logs = append(logs, row.Data.(*view.SumData).Value)
+		}
+	}
+	assert.Equal(t, []float64{3}, logs)
+}
+
+func TestCheckpoint(t *testing.T) {
+	storageID := component.NewID("test_storage")
+	host := &storageHost{extensions: map[component.ID]component.Component{storageID: &memoryStorage{}}}
+	cfg := createDefaultConfig().(*Config)
+	cfg.Storage = &storageID
+
+	p := newPatternProcessor(cfg, processortest.NewNopCreateSettings())
+	require.NoError(t, p.start(context.Background(), host))
+	ld, err := p.processLogs(context.Background(), appLogs("t1", "app", "order 1 paid by alice", "order 2 paid by bob", "cache refreshed"))
+	require.NoError(t, err)
+	ids, _ := patternsOf(t, ld)
+	require.NoError(t, p.shutdown(context.Background()))
+
+	restored := newPatternProcessor(cfg, processortest.NewNopCreateSettings())
+	require.NoError(t, restored.start(context.Background(), host))
+	defer func() {
+		require.NoError(t, restored.shutdown(context.Background()))
+	}()
+	clusters := restored.drain.clusters()
+	require.Len(t, clusters, 2)
+	assert.Equal(t, "cache refreshed", clusters[0].template())
+	assert.Equal(t, int64(2), clusters[1].count)
+
+	ld, err = restored.processLogs(context.Background(), appLogs("t1", "app", "order 3 paid by carol", "cache refreshed"))
+	require.NoError(t, err)
+	restoredIDs, templates := patternsOf(t, ld)
+	assert.Equal(t, []string{ids[0], ids[2]}, restoredIDs)
+	assert.Equal(t, "order <*> paid by <*>", templates[0])
+	assert.Len(t, restored.drain.clusters(), 2)
+}
+
+func TestStorageNotFound(t *testing.T) {
+	storageID := component.NewID("test_storage")
+	cfg := createDefaultConfig().(*Config)
+	cfg.Storage = &storageID
+	p := newPatternProcessor(cfg, processortest.NewNopCreateSettings())
+	assert.Error(t, p.start(context.Background(), componenttest.NewNopHost()))
+}
+
+// storageHost is a host with a storage extension.
+type storageHost struct {
+	component.Host
+	extensions map[component.ID]component.Component
+}
+
+func (h *storageHost) GetExtensions() map[component.ID]component.Component {
+	return h.extensions
+}
+
+// memoryStorage is a storage extension keeping the data in memory, shared by its clients.
+type memoryStorage struct {
+	component.StartFunc
+	component.ShutdownFunc
+
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (s *memoryStorage) GetClient(context.Context, component.Kind, component.ID, string) (storage.Client, error) {
+	return s, nil
+}
+
+func (s *memoryStorage) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data[key], nil
+}
+
+func (s *memoryStorage) Set(_ context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		s.data = make(map[string][]byte)
+	}
+	s.data[key] = value
+	return nil
+}
+
+func (s *memoryStorage) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *memoryStorage) Batch(ctx context.Context, ops ...storage.Operation) error {
+	for _, op := range ops {
+		switch op.Type {
+		case storage.Get:
+			op.Value, _ = s.Get(ctx, op.Key)
+		case storage.Set:
+			_ = s.Set(ctx, op.Key, op.Value)
+		case storage.Delete:
+			_ = s.Delete(ctx, op.Key)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStorage) Close(context.Context) error {
+	return nil
+}
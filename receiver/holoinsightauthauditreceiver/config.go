@@ -0,0 +1,49 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightauthauditreceiver // import "github.com/traas-stack/holoinsight-collector/receiver/holoinsightauthauditreceiver"
+
+import (
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+)
+
+// Config defines configuration for the holoinsight_auth_audit receiver.
+type Config struct {
+	// Authenticator is the id of the authenticator extension whose audit records are received,
+	// e.g. http_forwarder_auth.
+	Authenticator component.ID `mapstructure:"authenticator"`
+	// QueueSize is the number of records waiting to be flushed, records are dropped when it's full. Default: 1000
+	QueueSize int `mapstructure:"queue_size"`
+	// FlushInterval is how often the queued records are sent to the pipeline. Default: 1s
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+}
+
+var _ component.Config = (*Config)(nil)
+
+// Validate checks the configuration is usable.
+func (cfg *Config) Validate() error {
+	if cfg.Authenticator.Type() == "" {
+		return errors.New("authenticator must be set")
+	}
+	if cfg.QueueSize <= 0 {
+		return errors.New("queue_size must be positive")
+	}
+	if cfg.FlushInterval <= 0 {
+		return errors.New("flush_interval must be positive")
+	}
+	return nil
+}
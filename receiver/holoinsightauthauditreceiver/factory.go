@@ -0,0 +1,51 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightauthauditreceiver // import "github.com/traas-stack/holoinsight-collector/receiver/holoinsightauthauditreceiver"
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/receiver"
+)
+
+const (
+	typeStr   = "holoinsight_auth_audit"
+	stability = component.StabilityLevelAlpha
+
+	defaultQueueSize     = 1000
+	defaultFlushInterval = time.Second
+)
+
+// NewFactory creates a factory for the holoinsight_auth_audit receiver.
+func NewFactory() receiver.Factory {
+	return receiver.NewFactory(
+		typeStr,
+		createDefaultConfig,
+		receiver.WithLogs(createLogsReceiver, stability))
+}
+
+func createDefaultConfig() component.Config {
+	return &Config{
+		QueueSize:     defaultQueueSize,
+		FlushInterval: defaultFlushInterval,
+	}
+}
+
+func createLogsReceiver(_ context.Context, params receiver.CreateSettings, cfg component.Config, next consumer.Logs) (receiver.Logs, error) {
+	return newAuditReceiver(cfg.(*Config), params, next), nil
+}
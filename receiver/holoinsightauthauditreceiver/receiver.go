@@ -0,0 +1,180 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightauthauditreceiver // import "github.com/traas-stack/holoinsight-collector/receiver/holoinsightauthauditreceiver"
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/receiver"
+	"go.uber.org/zap"
+
+	"github.com/traas-stack/holoinsight-collector/internal/authaudit"
+)
+
+// auditReceiver turns the audit records of an authenticator into logs. Records are queued without
+// blocking the authentications, and dropped when the pipeline can't keep up.
+type auditReceiver struct {
+	cfg      *Config
+	settings receiver.CreateSettings
+	next     consumer.Logs
+
+	records     chan authaudit.Record
+	unsubscribe func()
+	done        chan struct{}
+	wg          sync.WaitGroup
+
+	mu      sync.Mutex
+	dropped int
+}
+
+func newAuditReceiver(cfg *Config, settings receiver.CreateSettings, next consumer.Logs) *auditReceiver {
+	return &auditReceiver{
+		cfg:      cfg,
+		settings: settings,
+		next:     next,
+		records:  make(chan authaudit.Record, cfg.QueueSize),
+		done:     make(chan struct{}),
+	}
+}
+
+func (r *auditReceiver) Start(_ context.Context, host component.Host) error {
+	ext, ok := host.GetExtensions()[r.cfg.Authenticator]
+	if !ok {
+		return fmt.Errorf("authenticator %q not found", r.cfg.Authenticator)
+	}
+	source, ok := ext.(authaudit.Source)
+	if !ok {
+		return fmt.Errorf("authenticator %q does not produce audit records", r.cfg.Authenticator)
+	}
+	r.unsubscribe = source.SubscribeAudit(r.enqueue)
+
+	r.wg.Add(1)
+	go r.run()
+	return nil
+}
+
+func (r *auditReceiver) Shutdown(context.Context) error {
+	if r.unsubscribe == nil {
+		return nil
+	}
+	r.unsubscribe()
+	close(r.done)
+	r.wg.Wait()
+	return nil
+}
+
+func (r *auditReceiver) enqueue(record authaudit.Record) {
+	select {
+	case r.records <- record:
+	default:
+		r.mu.Lock()
+		r.dropped++
+		r.mu.Unlock()
+	}
+}
+
+func (r *auditReceiver) run() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []authaudit.Record
+	for {
+		select {
+		case record := <-r.records:
+			batch = append(batch, record)
+			if len(batch) >= r.cfg.QueueSize {
+				r.flush(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			r.flush(batch)
+			batch = nil
+		case <-r.done:
+			for {
+				select {
+				case record := <-r.records:
+					batch = append(batch, record)
+				default:
+					r.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *auditReceiver) flush(batch []authaudit.Record) {
+	r.mu.Lock()
+	dropped := r.dropped
+	r.dropped = 0
+	r.mu.Unlock()
+	if dropped > 0 {
+		r.settings.Logger.Warn("[holoinsightauthauditreceiver] audit queue full, records dropped", zap.Int("dropped", dropped))
+	}
+	if len(batch) == 0 {
+		return
+	}
+	if err := r.next.ConsumeLogs(context.Background(), toLogs(r.cfg.Authenticator, batch)); err != nil {
+		r.settings.Logger.Error("[holoinsightauthauditreceiver] failed to send audit records", zap.Error(err))
+	}
+}
+
+// toLogs converts the records into one log per record.
+func toLogs(authenticator component.ID, records []authaudit.Record) plog.Logs {
+	ld := plog.NewLogs()
+	rl := ld.ResourceLogs().AppendEmpty()
+	rl.Resource().Attributes().PutStr("authenticator", authenticator.String())
+	sl := rl.ScopeLogs().AppendEmpty()
+	sl.Scope().SetName(typeStr)
+
+	now := pcommon.NewTimestampFromTime(time.Now())
+	for _, record := range records {
+		lr := sl.LogRecords().AppendEmpty()
+		lr.SetTimestamp(pcommon.NewTimestampFromTime(record.Time))
+		lr.SetObservedTimestamp(now)
+		if record.Result == "ok" {
+			lr.SetSeverityNumber(plog.SeverityNumberInfo)
+		} else {
+			lr.SetSeverityNumber(plog.SeverityNumberWarn)
+		}
+		lr.Body().SetStr("authentication " + record.Result)
+
+		attrs := lr.Attributes()
+		attrs.PutStr("result", record.Result)
+		putNotEmpty(attrs, "tenant", record.Tenant)
+		putNotEmpty(attrs, "apikey_fingerprint", record.APIKeyFingerprint)
+		putNotEmpty(attrs, "identity", record.Identity)
+		putNotEmpty(attrs, "peer", record.Peer)
+		putNotEmpty(attrs, "receiver", record.Receiver)
+		putNotEmpty(attrs, "path", record.Path)
+		putNotEmpty(attrs, "method", record.Method)
+		putNotEmpty(attrs, "reason", record.Reason)
+	}
+	return ld
+}
+
+func putNotEmpty(attrs pcommon.Map, key, value string) {
+	if value != "" {
+		attrs.PutStr(key, value)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightauthauditreceiver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/receiver/receivertest"
+
+	"github.com/traas-stack/holoinsight-collector/internal/authaudit"
+)
+
+type nopExtension struct {
+	component.StartFunc
+	component.ShutdownFunc
+}
+
+type auditExtension struct {
+	component.StartFunc
+	component.ShutdownFunc
+	*authaudit.Hub
+}
+
+type extensionsHost struct {
+	component.Host
+	extensions map[component.ID]component.Component
+}
+
+func (h *extensionsHost) GetExtensions() map[component.ID]component.Component {
+	return h.extensions
+}
+
+func TestReceiverForwardsRecords(t *testing.T) {
+	id := component.NewID("http_forwarder_auth")
+	hub := &authaudit.Hub{}
+	host := &extensionsHost{
+		Host:       componenttest.NewNopHost(),
+		extensions: map[component.ID]component.Component{id: &auditExtension{Hub: hub}},
+	}
+	sink := new(consumertest.LogsSink)
+	cfg := &Config{Authenticator: id, QueueSize: 10, FlushInterval: time.Hour}
+	r := newAuditReceiver(cfg, receivertest.NewNopCreateSettings(), sink)
+
+	require.NoError(t, r.Start(context.Background(), host))
+	assert.True(t, hub.Subscribed())
+	hub.Publish(authaudit.Record{Time: time.Unix(1, 0), Tenant: "t1", APIKeyFingerprint: "0badc0de", Peer: "10.0.0.1:1234",
+		Receiver: "0.0.0.0:4318", Path: "/v1/traces", Result: "ok"})
+	hub.Publish(authaudit.Record{Result: "denied", Reason: "permission denied"})
+	require.NoError(t, r.Shutdown(context.Background()))
+	assert.False(t, hub.Subscribed())
+
+	require.Equal(t, 2, sink.LogRecordCount())
+	rl := sink.AllLogs()[0].ResourceLogs().At(0)
+	authenticator, _ := rl.Resource().Attributes().Get("authenticator")
+	assert.Equal(t, "http_forwarder_auth", authenticator.Str())
+
+	records := rl.ScopeLogs().At(0).LogRecords()
+	ok := records.At(0)
+	assert.Equal(t, plog.SeverityNumberInfo, ok.SeverityNumber())
+	assert.Equal(t, time.Unix(1, 0).UnixNano(), int64(ok.Timestamp()))
+	assert.Equal(t, map[string]interface{}{
+		"result":             "ok",
+		"tenant":             "t1",
+		"apikey_fingerprint": "0badc0de",
+		"peer":               "10.0.0.1:1234",
+		"receiver":           "0.0.0.0:4318",
+		"path":               "/v1/traces",
+	}, ok.Attributes().AsRaw())
+
+	denied := records.At(1)
+	assert.Equal(t, plog.SeverityNumberWarn, denied.SeverityNumber())
+	assert.Equal(t, map[string]interface{}{"result": "denied", "reason": "permission denied"}, denied.Attributes().AsRaw())
+}
+
+func TestReceiverDropsWhenQueueFull(t *testing.T) {
+	cfg := &Config{QueueSize: 1, FlushInterval: time.Hour}
+	r := newAuditReceiver(cfg, receivertest.NewNopCreateSettings(), consumertest.NewNop())
+	r.enqueue(authaudit.Record{Result: "ok"})
+	r.enqueue(authaudit.Record{Result: "ok"})
+	assert.Equal(t, 1, r.dropped)
+}
+
+func TestReceiverRequiresAuditSource(t *testing.T) {
+	id := component.NewID("basicauth")
+	host := &extensionsHost{
+		Host:       componenttest.NewNopHost(),
+		extensions: map[component.ID]component.Component{id: &nopExtension{}},
+	}
+	cfg := &Config{Authenticator: id, QueueSize: 1, FlushInterval: time.Second}
+	r := newAuditReceiver(cfg, receivertest.NewNopCreateSettings(), consumertest.NewNop())
+	assert.Error(t, r.Start(context.Background(), host))
+	assert.Error(t, r.Start(context.Background(), componenttest.NewNopHost()))
+	assert.NoError(t, r.Shutdown(context.Background()))
+}
@@ -7,6 +7,7 @@ package holoinsightdatadogreceiver // import "github.com/open-telemetry/opentele
 import (
 	"time"
 
+	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/config/confighttp"
 )
 
@@ -14,4 +15,11 @@ type Config struct {
 	confighttp.HTTPServerSettings `mapstructure:",squash"`
 	// ReadTimeout of the http server
 	ReadTimeout time.Duration `mapstructure:"read_timeout"`
+	// SpanMapping overrides how datadog span types, resources and peers are translated
+	SpanMapping SpanMapping `mapstructure:"span_mapping"`
+	// Limiter is the tenant limiter extension throttling the data of each tenant, e.g. holoinsight_tenant_limiter.
+	Limiter *component.ID `mapstructure:"limiter"`
+	// TenantResolver is the tenant resolver extension stamping the tenant of the data, e.g. holoinsight_tenant_resolver.
+	// The built-in sources are used when not set.
+	TenantResolver *component.ID `mapstructure:"tenant_resolver"`
 }
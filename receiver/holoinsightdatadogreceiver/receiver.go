@@ -10,9 +10,13 @@ import (
 	"net/http"
 
 	"github.com/DataDog/datadog-agent/pkg/trace/pb"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/obsreport"
+	"go.opentelemetry.io/collector/pdata/ptrace"
 	"go.opentelemetry.io/collector/receiver"
 )
 
@@ -23,8 +27,22 @@ type datadogReceiver struct {
 	nextConsumer consumer.Traces
 	server       *http.Server
 	tReceiver    *obsreport.Receiver
+	mapper       *spanMapper
+	limits       tenantlimit.Gate
+	tenants      tenantresolver.Gate
 }
 
+// builtinTenants is the tenant resolver without resolver extension, the built-in chain giving the traces of no
+// known tenant the "default" tenant, as this receiver always did.
+var builtinTenants = func() tenantresolver.Resolver {
+	chain, err := tenantresolver.NewChain("", append(tenantresolver.BuiltinSources(),
+		tenantresolver.SourceSettings{Type: tenantresolver.SourceDefault, Value: "default"}))
+	if err != nil {
+		panic(err)
+	}
+	return chain
+}()
+
 func newDataDogReceiver(config *Config, nextConsumer consumer.Traces, params receiver.CreateSettings) (receiver.Traces, error) {
 	if nextConsumer == nil {
 		return nil, component.ErrNilNextConsumer
@@ -35,7 +53,7 @@ func newDataDogReceiver(config *Config, nextConsumer consumer.Traces, params rec
 		return nil, err
 	}
 
-	return &datadogReceiver{
+	ddr := &datadogReceiver{
 		params:       params,
 		config:       config,
 		nextConsumer: nextConsumer,
@@ -43,10 +61,19 @@ func newDataDogReceiver(config *Config, nextConsumer consumer.Traces, params rec
 			ReadTimeout: config.ReadTimeout,
 		},
 		tReceiver: instance,
-	}, nil
+		mapper:    newSpanMapper(config.SpanMapping),
+	}
+	ddr.tenants.SetFallback(builtinTenants)
+	return ddr, nil
 }
 
 func (ddr *datadogReceiver) Start(_ context.Context, host component.Host) error {
+	if err := ddr.limits.Resolve(host, ddr.config.Limiter); err != nil {
+		return err
+	}
+	if err := ddr.tenants.Resolve(host, ddr.config.TenantResolver); err != nil {
+		return err
+	}
 	ddmux := http.NewServeMux()
 	ddmux.HandleFunc("/v0.3/traces", ddr.handleTraces)
 	ddmux.HandleFunc("/v0.4/traces", ddr.handleTraces)
@@ -62,6 +89,8 @@ func (ddr *datadogReceiver) Start(_ context.Context, host component.Host) error
 	if err != nil {
 		return fmt.Errorf("failed to create server definition: %w", err)
 	}
+	ddr.server.ConnContext = tenantauth.ConnContext
+	ddr.server.Handler = tenantresolver.Handler(ddr.config.Endpoint, ddr.server.Handler)
 	hln, err := ddr.config.HTTPServerSettings.ToListener()
 	if err != nil {
 		return fmt.Errorf("failed to create datadog listener: %w", err)
@@ -82,6 +111,10 @@ func (ddr *datadogReceiver) Shutdown(ctx context.Context) (err error) {
 }
 
 func (ddr *datadogReceiver) handleTraces(w http.ResponseWriter, req *http.Request) {
+	if !tenantauth.SignalAllowed(req.Context(), tenantauth.SignalTraces) {
+		http.Error(w, "Traces are not enabled for the tenant", http.StatusForbidden)
+		return
+	}
 	obsCtx := ddr.tReceiver.StartTracesOp(req.Context())
 	var err error
 	var spanCount int
@@ -97,8 +130,21 @@ func (ddr *datadogReceiver) handleTraces(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	otelTraces := toTraces(ddTraces, req)
+	otelTraces := toTraces(ddTraces, req, ddr.mapper)
 	spanCount = otelTraces.SpanCount()
+	var tenants tenantlimit.Tenants
+	received := tenantresolver.RequestOf(req.Context(), "")
+	rs := otelTraces.ResourceSpans()
+	for i := 0; i < rs.Len(); i++ {
+		tenants.Add(ddr.tenants.Stamp(req.Context(), received, rs.At(i).Resource().Attributes()), resourceSpanCount(rs.At(i)))
+	}
+	if err = ddr.limits.AdmitTenants(req.Context(), tenantauth.SignalTraces, &tenants, (&ptrace.ProtoMarshaler{}).TracesSize(otelTraces)); err != nil {
+		if retryAfter, throttled := tenantlimit.RetryAfter(err); throttled {
+			tenantlimit.SetRetryAfter(w.Header(), retryAfter)
+		}
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
 	err = ddr.nextConsumer.ConsumeTraces(obsCtx, otelTraces)
 	if err != nil {
 		http.Error(w, "Trace consumer errored out", http.StatusInternalServerError)
@@ -107,3 +153,12 @@ func (ddr *datadogReceiver) handleTraces(w http.ResponseWriter, req *http.Reques
 		_, _ = w.Write([]byte("OK"))
 	}
 }
+
+// resourceSpanCount returns the number of spans of a resource.
+func resourceSpanCount(rs ptrace.ResourceSpans) int {
+	count := 0
+	for i := 0; i < rs.ScopeSpans().Len(); i++ {
+		count += rs.ScopeSpans().At(i).Spans().Len()
+	}
+	return count
+}
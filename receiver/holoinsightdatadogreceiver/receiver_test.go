@@ -4,19 +4,25 @@
 package holoinsightdatadogreceiver
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/DataDog/datadog-agent/pkg/trace/pb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/component/componenttest"
 	"go.opentelemetry.io/collector/consumer/consumertest"
 	"go.opentelemetry.io/collector/receiver/receivertest"
 	"go.uber.org/multierr"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
 )
 
 func TestDatadogReceiver_Lifecycle(t *testing.T) {
@@ -88,3 +94,106 @@ func TestDatadogServer(t *testing.T) {
 		})
 	}
 }
+
+// limiterHost is a host with a limiter extension.
+type limiterHost struct {
+	component.Host
+	extensions map[component.ID]component.Component
+}
+
+func (h *limiterHost) GetExtensions() map[component.ID]component.Component {
+	return h.extensions
+}
+
+// throttlingLimiter throttles the data of every tenant but admitted.
+type throttlingLimiter struct {
+	component.StartFunc
+	component.ShutdownFunc
+	admitted string
+}
+
+func (l throttlingLimiter) Admit(_ context.Context, tenant, signal string, _, _ int) error {
+	if tenant == l.admitted {
+		return nil
+	}
+	return &tenantlimit.ThrottledError{Tenant: tenant, Signal: signal, Reason: tenantlimit.ReasonRate, RetryAfter: 1500 * time.Millisecond}
+}
+
+func TestDatadogServerThrottled(t *testing.T) {
+	limiterID := component.NewID("test_limiter")
+	host := &limiterHost{
+		Host:       componenttest.NewNopHost(),
+		extensions: map[component.ID]component.Component{limiterID: throttlingLimiter{admitted: "admitted"}},
+	}
+
+	cfg := createDefaultConfig().(*Config)
+	cfg.Endpoint = "localhost:0"
+	cfg.Limiter = &limiterID
+	sink := new(consumertest.TracesSink)
+	dd, err := newDataDogReceiver(cfg, sink, receivertest.NewNopCreateSettings())
+	require.NoError(t, err)
+	require.NoError(t, dd.Start(context.Background(), host))
+	t.Cleanup(func() { require.NoError(t, dd.Shutdown(context.Background())) })
+
+	payload := pb.TracerPayload{Chunks: traceChunksFromSpans([]pb.Span{{Service: "svc", Name: "op", TraceID: 1, SpanID: 1}})}
+	body, err := payload.MarshalMsg(nil)
+	require.NoError(t, err)
+	resp, err := http.Post(fmt.Sprintf("http://%s/v0.7/traces", dd.(*datadogReceiver).address), "application/msgpack", bytes.NewReader(body))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+	assert.Len(t, sink.AllTraces(), 0)
+
+	// the spans are admitted in the limits of the tenant they are resolved to
+	payload = pb.TracerPayload{Chunks: traceChunksFromSpans([]pb.Span{
+		{Service: "svc", Name: "op", TraceID: 1, SpanID: 1, Meta: map[string]string{"tenant": "admitted"}},
+	})}
+	body, err = payload.MarshalMsg(nil)
+	require.NoError(t, err)
+	resp, err = http.Post(fmt.Sprintf("http://%s/v0.7/traces", dd.(*datadogReceiver).address), "application/msgpack", bytes.NewReader(body))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, sink.AllTraces(), 1)
+}
+
+func TestDatadogServerTenant(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.Endpoint = "localhost:0"
+	sink := new(consumertest.TracesSink)
+	dd, err := newDataDogReceiver(cfg, sink, receivertest.NewNopCreateSettings())
+	require.NoError(t, err)
+	require.NoError(t, dd.Start(context.Background(), componenttest.NewNopHost()))
+	t.Cleanup(func() { require.NoError(t, dd.Shutdown(context.Background())) })
+
+	for _, tc := range []struct {
+		meta   map[string]string
+		header string
+		want   string
+	}{
+		{meta: map[string]string{"tenant": "meta-tenant"}, want: "meta-tenant"},
+		{meta: map[string]string{"tenant": "meta-tenant"}, header: "header-tenant", want: "header-tenant"},
+		{want: "default"},
+	} {
+		payload := pb.TracerPayload{Chunks: traceChunksFromSpans([]pb.Span{
+			{Service: "svc", Name: "op", TraceID: 1, SpanID: 1, Meta: tc.meta},
+		})}
+		body, err := payload.MarshalMsg(nil)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s/v0.7/traces", dd.(*datadogReceiver).address), bytes.NewReader(body))
+		require.NoError(t, err)
+		if tc.header != "" {
+			req.Header.Set("Tenant", tc.header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		traces := sink.AllTraces()
+		tenant, ok := traces[len(traces)-1].ResourceSpans().At(0).Resource().Attributes().Get("tenant")
+		require.True(t, ok)
+		assert.Equal(t, tc.want, tenant.Str())
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright The OpenTelemetry Authors
+// SPDX-License-Identifier: Apache-2.0
+
+package holoinsightdatadogreceiver // import "github.com/traas-stack/holoinsight-collector/receiver/holoinsightdatadogreceiver"
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/DataDog/datadog-agent/pkg/trace/pb"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	semconv "go.opentelemetry.io/collector/semconv/v1.16.0"
+)
+
+const (
+	datadogTopLevelKey = "_dd.top_level"
+	datadogMeasuredKey = "_dd.measured"
+
+	datadogErrorTypeKey    = "error.type"
+	datadogErrorMsgKey     = "error.msg"
+	datadogErrorMessageKey = "error.message"
+	datadogErrorStackKey   = "error.stack"
+	datadogErrorStackTrace = "error.stacktrace"
+	datadogDBTypeKey       = "db.type"
+
+	spanTypeWeb  = "web"
+	spanTypeGRPC = "grpc"
+
+	// attributeDatadogResource keeps the raw datadog resource name on every span.
+	attributeDatadogResource = "dd.span.Resource"
+	// exceptionEventName is the span event name defined by the OpenTelemetry exception conventions.
+	exceptionEventName = "exception"
+)
+
+// defaultTypeKinds is the span kind implied by a datadog span type when the
+// tracer didn't set `span.kind` explicitly.
+var defaultTypeKinds = map[string]string{
+	spanTypeWeb:     "server",
+	"http":          "client",
+	spanTypeGRPC:    "client",
+	"sql":           "client",
+	"db":            "client",
+	"redis":         "client",
+	"cache":         "client",
+	"memcached":     "client",
+	"mongodb":       "client",
+	"cassandra":     "client",
+	"elasticsearch": "client",
+}
+
+// defaultResourceAttributes is the attribute the datadog resource is copied to, by span type.
+var defaultResourceAttributes = map[string]string{
+	spanTypeWeb:     semconv.AttributeHTTPRoute,
+	spanTypeGRPC:    semconv.AttributeRPCMethod,
+	"sql":           semconv.AttributeDBStatement,
+	"db":            semconv.AttributeDBStatement,
+	"redis":         semconv.AttributeDBStatement,
+	"cache":         semconv.AttributeDBStatement,
+	"memcached":     semconv.AttributeDBStatement,
+	"mongodb":       semconv.AttributeDBStatement,
+	"cassandra":     semconv.AttributeDBStatement,
+	"elasticsearch": semconv.AttributeDBStatement,
+}
+
+// defaultPeerAttributes translates the datadog network peer tags.
+var defaultPeerAttributes = map[string]string{
+	"out.host":      semconv.AttributeNetPeerName,
+	"peer.hostname": semconv.AttributeNetPeerName,
+	"out.port":      semconv.AttributeNetPeerPort,
+	"peer.service":  semconv.AttributePeerService,
+	"db.instance":   semconv.AttributeDBName,
+}
+
+// datastoreTypes are the span types whose type name doubles as `db.system`
+// when the tracer didn't report `db.type`.
+var datastoreTypes = map[string]bool{
+	"redis":         true,
+	"memcached":     true,
+	"mongodb":       true,
+	"cassandra":     true,
+	"elasticsearch": true,
+}
+
+var spanKinds = map[string]ptrace.SpanKind{
+	"server":   ptrace.SpanKindServer,
+	"client":   ptrace.SpanKindClient,
+	"producer": ptrace.SpanKindProducer,
+	"consumer": ptrace.SpanKindConsumer,
+	"internal": ptrace.SpanKindInternal,
+}
+
+// SpanMapping controls how datadog span semantics are translated.
+// Every map is merged over the built-in defaults; an empty value disables the default entry.
+type SpanMapping struct {
+	// EntryMetrics are the span metrics which, when non-zero, mark a span as the entry span of its service.
+	// Default: [_dd.top_level, _dd.measured]
+	EntryMetrics []string `mapstructure:"entry_metrics"`
+	// TypeKinds maps a datadog span type (web, http, sql, ...) to a span kind (server, client, producer, consumer, internal).
+	TypeKinds map[string]string `mapstructure:"type_kinds"`
+	// ResourceAttributes maps a datadog span type to the attribute receiving the span resource, e.g. web: http.route.
+	ResourceAttributes map[string]string `mapstructure:"resource_attributes"`
+	// PeerAttributes maps a datadog meta key to the network peer attribute it is translated to, e.g. out.host: net.peer.name.
+	PeerAttributes map[string]string `mapstructure:"peer_attributes"`
+}
+
+// Validate checks the span kinds configured in TypeKinds.
+func (m *SpanMapping) Validate() error {
+	for typ, kind := range m.TypeKinds {
+		if _, ok := spanKinds[kind]; kind != "" && !ok {
+			return fmt.Errorf("invalid span kind %q for span type %q", kind, typ)
+		}
+	}
+	return nil
+}
+
+type spanMapper struct {
+	entryMetrics       []string
+	typeKinds          map[string]ptrace.SpanKind
+	resourceAttributes map[string]string
+	peerAttributes     map[string]string
+}
+
+func newSpanMapper(cfg SpanMapping) *spanMapper {
+	m := &spanMapper{
+		entryMetrics:       cfg.EntryMetrics,
+		typeKinds:          make(map[string]ptrace.SpanKind),
+		resourceAttributes: mergeMapping(defaultResourceAttributes, cfg.ResourceAttributes),
+		peerAttributes:     mergeMapping(defaultPeerAttributes, cfg.PeerAttributes),
+	}
+	if m.entryMetrics == nil {
+		m.entryMetrics = []string{datadogTopLevelKey, datadogMeasuredKey}
+	}
+	for typ, kind := range mergeMapping(defaultTypeKinds, cfg.TypeKinds) {
+		if k, ok := spanKinds[kind]; ok {
+			m.typeKinds[typ] = k
+		}
+	}
+	return m
+}
+
+func mergeMapping(defaults, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(defaults)+len(overrides))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		if v == "" {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// isEntry reports whether the tracer flagged the span as the entry of its service.
+func (m *spanMapper) isEntry(span *pb.Span) bool {
+	for _, key := range m.entryMetrics {
+		if span.GetMetrics()[key] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// spanKind resolves the span kind from, in order: the explicit `span.kind` tag,
+// the entry flags (unless the span type denotes an outgoing datastore or http call)
+// and finally the span type.
+func (m *spanMapper) spanKind(span *pb.Span) ptrace.SpanKind {
+	if kind, ok := spanKinds[span.GetMeta()[datadogSpanKindKey]]; ok {
+		return kind
+	}
+	kind, known := m.typeKinds[span.Type]
+	if m.isEntry(span) && (!known || kind == ptrace.SpanKindServer || span.Type == spanTypeGRPC) {
+		return ptrace.SpanKindServer
+	}
+	if known {
+		return kind
+	}
+	return ptrace.SpanKindUnspecified
+}
+
+// mapResource copies the datadog resource to the attribute matching the span type.
+func (m *spanMapper) mapResource(span *pb.Span, kind ptrace.SpanKind, attrs pcommon.Map) {
+	attrs.PutStr(attributeDatadogResource, span.Resource)
+	if span.Resource == "" {
+		return
+	}
+	key, ok := m.resourceAttributes[span.Type]
+	if !ok {
+		return
+	}
+	// the route of a web span is only meaningful for the endpoint it serves
+	if key == semconv.AttributeHTTPRoute && kind != ptrace.SpanKindServer {
+		return
+	}
+	if _, exists := attrs.Get(key); exists {
+		return
+	}
+
+	switch key {
+	case semconv.AttributeHTTPRoute:
+		// web resources look like "GET /users/{id}"
+		route := span.Resource
+		if idx := strings.IndexByte(route, ' '); idx > 0 {
+			route = strings.TrimSpace(route[idx+1:])
+		}
+		attrs.PutStr(key, route)
+	case semconv.AttributeRPCMethod:
+		attrs.PutStr(semconv.AttributeRPCSystem, span.Type)
+		// grpc resources look like "/package.Service/Method"
+		resource := strings.TrimPrefix(span.Resource, "/")
+		if idx := strings.LastIndex(resource, "/"); idx > 0 {
+			attrs.PutStr(semconv.AttributeRPCService, resource[:idx])
+			attrs.PutStr(semconv.AttributeRPCMethod, resource[idx+1:])
+			return
+		}
+		attrs.PutStr(semconv.AttributeRPCMethod, resource)
+	case semconv.AttributeDBStatement:
+		if _, exists := attrs.Get(semconv.AttributeDBSystem); !exists {
+			if dbType := span.GetMeta()[datadogDBTypeKey]; dbType != "" {
+				attrs.PutStr(semconv.AttributeDBSystem, dbType)
+			} else if datastoreTypes[span.Type] {
+				attrs.PutStr(semconv.AttributeDBSystem, span.Type)
+			}
+		}
+		attrs.PutStr(key, span.Resource)
+	default:
+		attrs.PutStr(key, span.Resource)
+	}
+}
+
+// peerAttribute translates a datadog network peer tag, returning false when key isn't one.
+func (m *spanMapper) peerAttribute(key, value string, attrs pcommon.Map) bool {
+	target, ok := m.peerAttributes[key]
+	if !ok {
+		return false
+	}
+	if target == semconv.AttributeNetPeerPort {
+		if port, err := strconv.ParseInt(value, 10, 64); err == nil {
+			attrs.PutInt(target, port)
+			return true
+		}
+	}
+	attrs.PutStr(target, value)
+	return true
+}
+
+// mapError records the datadog error tags as an exception event.
+func (m *spanMapper) mapError(span *pb.Span, dest ptrace.Span) {
+	meta := span.GetMeta()
+	errType := meta[datadogErrorTypeKey]
+	errMsg := meta[datadogErrorMsgKey]
+	if errMsg == "" {
+		errMsg = meta[datadogErrorMessageKey]
+	}
+	stack := meta[datadogErrorStackKey]
+	if stack == "" {
+		stack = meta[datadogErrorStackTrace]
+	}
+	if errType == "" && errMsg == "" && stack == "" {
+		return
+	}
+
+	event := dest.Events().AppendEmpty()
+	event.SetName(exceptionEventName)
+	event.SetTimestamp(pcommon.Timestamp(span.Start + span.Duration))
+	if errType != "" {
+		event.Attributes().PutStr(semconv.AttributeExceptionType, errType)
+	}
+	if errMsg != "" {
+		event.Attributes().PutStr(semconv.AttributeExceptionMessage, errMsg)
+		if span.Error > 0 {
+			dest.Status().SetMessage(errMsg)
+		}
+	}
+	if stack != "" {
+		event.Attributes().PutStr(semconv.AttributeExceptionStacktrace, stack)
+	}
+}
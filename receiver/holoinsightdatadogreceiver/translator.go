@@ -46,7 +46,7 @@ func upsertHeadersAttributes(req *http.Request, attrs pcommon.Map) {
 	}
 }
 
-func toTraces(payload *pb.TracerPayload, req *http.Request) ptrace.Traces {
+func toTraces(payload *pb.TracerPayload, req *http.Request, mapper *spanMapper) ptrace.Traces {
 	var traces pb.Traces
 	for _, p := range payload.GetChunks() {
 		traces = append(traces, p.GetSpans())
@@ -80,7 +80,7 @@ func toTraces(payload *pb.TracerPayload, req *http.Request) ptrace.Traces {
 	// is added as a resource attribute in most systems
 	// now instead of being a span level attribute.
 	groupByService := make(map[string]ptrace.SpanSlice)
-	tenant := "default"
+	var tenant string
 
 	for _, trace := range traces {
 		for _, span := range trace {
@@ -98,7 +98,6 @@ func toTraces(payload *pb.TracerPayload, req *http.Request) ptrace.Traces {
 			newSpan.SetParentSpanID(uInt64ToSpanID(span.ParentID))
 			newSpan.SetName(span.Name)
 			newSpan.Status().SetCode(ptrace.StatusCodeOk)
-			newSpan.Attributes().PutStr("dd.span.Resource", span.Resource)
 
 			if span.Error > 0 {
 				newSpan.Status().SetCode(ptrace.StatusCodeError)
@@ -106,6 +105,9 @@ func toTraces(payload *pb.TracerPayload, req *http.Request) ptrace.Traces {
 			newSpan.Attributes().PutStr(attributeDatadogSpanID, strconv.FormatUint(span.SpanID, 10))
 			newSpan.Attributes().PutStr(attributeDatadogTraceID, strconv.FormatUint(span.TraceID, 10))
 			for k, v := range span.GetMeta() {
+				if mapper.peerAttribute(k, v, newSpan.Attributes()) {
+					continue
+				}
 				if k = translateDataDogKeyToOtel(k); len(k) > 0 {
 					newSpan.Attributes().PutStr(k, v)
 					if k == "tenant" {
@@ -117,27 +119,10 @@ func toTraces(payload *pb.TracerPayload, req *http.Request) ptrace.Traces {
 				newSpan.Attributes().PutDouble(k, v)
 			}
 
-			switch span.Meta[datadogSpanKindKey] {
-			case "server":
-				newSpan.SetKind(ptrace.SpanKindServer)
-			case "client":
-				newSpan.SetKind(ptrace.SpanKindClient)
-			case "producer":
-				newSpan.SetKind(ptrace.SpanKindProducer)
-			case "consumer":
-				newSpan.SetKind(ptrace.SpanKindConsumer)
-			case "internal":
-				newSpan.SetKind(ptrace.SpanKindInternal)
-			default:
-				switch span.Type {
-				case "web":
-					newSpan.SetKind(ptrace.SpanKindServer)
-				case "http":
-					newSpan.SetKind(ptrace.SpanKindClient)
-				default:
-					newSpan.SetKind(ptrace.SpanKindUnspecified)
-				}
-			}
+			kind := mapper.spanKind(span)
+			newSpan.SetKind(kind)
+			mapper.mapResource(span, kind, newSpan.Attributes())
+			mapper.mapError(span, newSpan)
 		}
 	}
 
@@ -147,7 +132,10 @@ func toTraces(payload *pb.TracerPayload, req *http.Request) ptrace.Traces {
 		rs.SetSchemaUrl(semconv.SchemaURL)
 		sharedAttributes.CopyTo(rs.Resource().Attributes())
 		rs.Resource().Attributes().PutStr(semconv.AttributeServiceName, service)
-		rs.Resource().Attributes().PutStr("tenant", tenant)
+		// the tenant tag of the spans, a resource attribute for the tenant resolver
+		if tenant != "" {
+			rs.Resource().Attributes().PutStr("tenant", tenant)
+		}
 
 		in := rs.ScopeSpans().AppendEmpty()
 		in.Scope().SetName("Datadog")
@@ -13,6 +13,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	vmsgp "github.com/vmihailenco/msgpack/v4"
+	"go.opentelemetry.io/collector/pdata/ptrace"
 )
 
 var data = [2]interface{}{
@@ -70,17 +71,20 @@ func TestTracePayloadV05Unmarshalling(t *testing.T) {
 		LanguageVersion: req.Header.Get("Datadog-Meta-Lang-Version"),
 		TracerVersion:   req.Header.Get("Datadog-Meta-Tracer-Version"),
 		Chunks:          traceChunksFromTraces(traces),
-	}, req)
+	}, req, newSpanMapper(SpanMapping{}))
 	assert.Equal(t, 1, translated.SpanCount(), "Span Count wrong")
 	span := translated.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
 	assert.NotNil(t, span)
-	assert.Equal(t, 7, span.Attributes().Len(), "missing attributes")
+	assert.Equal(t, 9, span.Attributes().Len(), "missing attributes")
 	value, exists := span.Attributes().Get("service.name")
 	assert.True(t, exists, "service.name missing")
 	assert.Equal(t, "my-service", value.AsString(), "service.name attribute value incorrect")
 	assert.Equal(t, "my-name", span.Name())
 	spanResource, _ := span.Attributes().Get("dd.span.Resource")
 	assert.Equal(t, "my-resource", spanResource.Str())
+	statement, _ := span.Attributes().Get("db.statement")
+	assert.Equal(t, "my-resource", statement.Str())
+	assert.Equal(t, ptrace.SpanKindClient, span.Kind())
 }
 
 func TestTracePayloadV07Unmarshalling(t *testing.T) {
@@ -126,3 +130,143 @@ func BenchmarkTranslatorv07(b *testing.B) {
 	}
 	b.StopTimer()
 }
+
+func translateSpan(t *testing.T, mapping SpanMapping, span *pb.Span) ptrace.Span {
+	req, _ := http.NewRequest(http.MethodPost, "/v0.4/traces", nil)
+	translated := toTraces(&pb.TracerPayload{
+		Chunks: traceChunksFromSpans([]pb.Span{*span}),
+	}, req, newSpanMapper(mapping))
+	require.Equal(t, 1, translated.SpanCount())
+	return translated.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+}
+
+func TestSpanMappingKind(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		mapping SpanMapping
+		span    pb.Span
+		kind    ptrace.SpanKind
+	}{
+		{
+			name: "explicit span.kind wins",
+			span: pb.Span{Type: "web", Meta: map[string]string{"span.kind": "consumer"}},
+			kind: ptrace.SpanKindConsumer,
+		},
+		{
+			name: "web type",
+			span: pb.Span{Type: "web"},
+			kind: ptrace.SpanKindServer,
+		},
+		{
+			name: "top level custom span is the entry",
+			span: pb.Span{Type: "custom", Metrics: map[string]float64{"_dd.top_level": 1}},
+			kind: ptrace.SpanKindServer,
+		},
+		{
+			name: "top level grpc span is the entry",
+			span: pb.Span{Type: "grpc", Metrics: map[string]float64{"_dd.top_level": 1}},
+			kind: ptrace.SpanKindServer,
+		},
+		{
+			name: "nested grpc span is a client",
+			span: pb.Span{Type: "grpc"},
+			kind: ptrace.SpanKindClient,
+		},
+		{
+			name: "measured sql span stays a client",
+			span: pb.Span{Type: "sql", Metrics: map[string]float64{"_dd.measured": 1}},
+			kind: ptrace.SpanKindClient,
+		},
+		{
+			name:    "entry metrics override",
+			mapping: SpanMapping{EntryMetrics: []string{}},
+			span:    pb.Span{Type: "custom", Metrics: map[string]float64{"_dd.top_level": 1}},
+			kind:    ptrace.SpanKindUnspecified,
+		},
+		{
+			name:    "type kind override",
+			mapping: SpanMapping{TypeKinds: map[string]string{"queue": "consumer"}},
+			span:    pb.Span{Type: "queue"},
+			kind:    ptrace.SpanKindConsumer,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			span := translateSpan(t, tc.mapping, &tc.span)
+			assert.Equal(t, tc.kind, span.Kind())
+		})
+	}
+}
+
+func TestSpanMappingResource(t *testing.T) {
+	span := translateSpan(t, SpanMapping{}, &pb.Span{
+		Type:     "web",
+		Resource: "GET /users/{id}",
+		Metrics:  map[string]float64{"_dd.top_level": 1},
+	})
+	route, _ := span.Attributes().Get("http.route")
+	assert.Equal(t, "/users/{id}", route.Str())
+
+	span = translateSpan(t, SpanMapping{}, &pb.Span{
+		Type:     "redis",
+		Resource: "GET",
+	})
+	statement, _ := span.Attributes().Get("db.statement")
+	assert.Equal(t, "GET", statement.Str())
+	system, _ := span.Attributes().Get("db.system")
+	assert.Equal(t, "redis", system.Str())
+
+	span = translateSpan(t, SpanMapping{}, &pb.Span{
+		Type:     "grpc",
+		Resource: "/helloworld.Greeter/SayHello",
+	})
+	service, _ := span.Attributes().Get("rpc.service")
+	assert.Equal(t, "helloworld.Greeter", service.Str())
+	method, _ := span.Attributes().Get("rpc.method")
+	assert.Equal(t, "SayHello", method.Str())
+
+	span = translateSpan(t, SpanMapping{ResourceAttributes: map[string]string{"sql": ""}}, &pb.Span{
+		Type:     "sql",
+		Resource: "SELECT 1",
+	})
+	_, exists := span.Attributes().Get("db.statement")
+	assert.False(t, exists)
+}
+
+func TestSpanMappingPeerAndError(t *testing.T) {
+	span := translateSpan(t, SpanMapping{}, &pb.Span{
+		Type:  "http",
+		Error: 1,
+		Meta: map[string]string{
+			"out.host":     "orders.internal",
+			"out.port":     "8080",
+			"peer.service": "orders",
+			"error.type":   "java.net.SocketTimeoutException",
+			"error.msg":    "Read timed out",
+			"error.stack":  "at Foo.bar()",
+		},
+	})
+	attrs := span.Attributes()
+	host, _ := attrs.Get("net.peer.name")
+	assert.Equal(t, "orders.internal", host.Str())
+	port, _ := attrs.Get("net.peer.port")
+	assert.Equal(t, int64(8080), port.Int())
+	peer, _ := attrs.Get("peer.service")
+	assert.Equal(t, "orders", peer.Str())
+	_, exists := attrs.Get("out.host")
+	assert.False(t, exists)
+
+	assert.Equal(t, ptrace.StatusCodeError, span.Status().Code())
+	assert.Equal(t, "Read timed out", span.Status().Message())
+	require.Equal(t, 1, span.Events().Len())
+	event := span.Events().At(0)
+	assert.Equal(t, "exception", event.Name())
+	excType, _ := event.Attributes().Get("exception.type")
+	assert.Equal(t, "java.net.SocketTimeoutException", excType.Str())
+	stack, _ := event.Attributes().Get("exception.stacktrace")
+	assert.Equal(t, "at Foo.bar()", stack.Str())
+}
+
+func TestSpanMappingValidate(t *testing.T) {
+	assert.NoError(t, (&SpanMapping{TypeKinds: map[string]string{"queue": "consumer", "sql": ""}}).Validate())
+	assert.Error(t, (&SpanMapping{TypeKinds: map[string]string{"queue": "inbound"}}).Validate())
+}
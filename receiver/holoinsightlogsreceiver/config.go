@@ -0,0 +1,42 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsreceiver // import "github.com/traas-stack/holoinsight-collector/receiver/holoinsightlogsreceiver"
+
+import (
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/confighttp"
+
+	"github.com/traas-stack/holoinsight-collector/internal/webtracking"
+)
+
+// Config defines configuration for the holoinsight_logs receiver.
+type Config struct {
+	confighttp.HTTPServerSettings `mapstructure:",squash"`
+	// Decrypt decrypts the logstores of the request paths, encrypted by the HoloInsight backend.
+	Decrypt webtracking.Decrypt `mapstructure:"decrypt"`
+	// TenantResolver is the tenant resolver extension stamping the tenant of the data, e.g. holoinsight_tenant_resolver.
+	// The built-in sources are used when not set.
+	TenantResolver *component.ID `mapstructure:"tenant_resolver"`
+	// Limiter is the tenant limiter extension throttling the data of each tenant, e.g. holoinsight_tenant_limiter.
+	Limiter *component.ID `mapstructure:"limiter"`
+}
+
+var _ component.Config = (*Config)(nil)
+
+// Validate checks the configuration is usable.
+func (cfg *Config) Validate() error {
+	_, err := cfg.Decrypt.Keyring()
+	return err
+}
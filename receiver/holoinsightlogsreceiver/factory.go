@@ -0,0 +1,51 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsreceiver // import "github.com/traas-stack/holoinsight-collector/receiver/holoinsightlogsreceiver"
+
+import (
+	"context"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/receiver"
+)
+
+const (
+	typeStr   = "holoinsight_logs"
+	stability = component.StabilityLevelAlpha
+
+	defaultEndpoint = "0.0.0.0:5551"
+)
+
+// NewFactory creates a factory for the holoinsight_logs receiver.
+func NewFactory() receiver.Factory {
+	return receiver.NewFactory(
+		typeStr,
+		createDefaultConfig,
+		receiver.WithLogs(createLogsReceiver, stability))
+}
+
+func createDefaultConfig() component.Config {
+	return &Config{
+		HTTPServerSettings: confighttp.HTTPServerSettings{
+			Endpoint: defaultEndpoint,
+		},
+	}
+}
+
+func createLogsReceiver(_ context.Context, params receiver.CreateSettings, cfg component.Config, next consumer.Logs) (receiver.Logs, error) {
+	return newLogsReceiver(cfg.(*Config), params, next)
+}
@@ -0,0 +1,87 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsreceiver // import "github.com/traas-stack/holoinsight-collector/receiver/holoinsightlogsreceiver"
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+
+	"github.com/traas-stack/holoinsight-collector/internal/webtracking"
+)
+
+const (
+	// resource attributes of the logs of a request
+	attributeLogstore  = "holoinsight.logstore"
+	attributeTopic     = "holoinsight.log.topic"
+	attributeSource    = "holoinsight.log.source"
+	attributeTagPrefix = "holoinsight.log.tag."
+
+	// fieldContent is the field of a log entry which is its body.
+	fieldContent = "content"
+)
+
+// toLogs converts the payload posted to logstore into logs of one resource, one log record per entry, timestamped by
+// its __time__, else now. The fields of an entry are the attributes of its record, but for "content" which is the
+// body. A record without content has the JSON of its fields as body, so exporters requiring a body keep it.
+func toLogs(logstore string, payload *webtracking.Payload, now time.Time) plog.Logs {
+	ld := plog.NewLogs()
+	rl := ld.ResourceLogs().AppendEmpty()
+	attrs := rl.Resource().Attributes()
+	attrs.PutStr(attributeLogstore, logstore)
+	putNotEmpty(attrs, attributeTopic, payload.Topic)
+	putNotEmpty(attrs, attributeSource, payload.Source)
+	for k, v := range payload.Tags {
+		attrs.PutStr(attributeTagPrefix+k, v)
+	}
+
+	sl := rl.ScopeLogs().AppendEmpty()
+	sl.Scope().SetName(typeStr)
+	observed := pcommon.NewTimestampFromTime(now)
+	records := sl.LogRecords()
+	records.EnsureCapacity(len(payload.Logs))
+	for _, entry := range payload.Logs {
+		if len(entry) == 0 {
+			continue
+		}
+		lr := records.AppendEmpty()
+		lr.SetObservedTimestamp(observed)
+		if t, ok := webtracking.EntryTime(entry); ok {
+			lr.SetTimestamp(pcommon.NewTimestampFromTime(t))
+		} else {
+			lr.SetTimestamp(observed)
+		}
+		for k, v := range entry {
+			if k != fieldContent && k != webtracking.TimeField {
+				lr.Attributes().PutStr(k, v)
+			}
+		}
+		if content, ok := entry[fieldContent]; ok {
+			lr.Body().SetStr(content)
+		} else {
+			body, _ := json.Marshal(lr.Attributes().AsRaw())
+			lr.Body().SetStr(string(body))
+		}
+	}
+	return ld
+}
+
+func putNotEmpty(attrs pcommon.Map, key, value string) {
+	if value != "" {
+		attrs.PutStr(key, value)
+	}
+}
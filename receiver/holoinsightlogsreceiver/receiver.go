@@ -0,0 +1,175 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsreceiver // import "github.com/traas-stack/holoinsight-collector/receiver/holoinsightlogsreceiver"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/obsreport"
+	"go.opentelemetry.io/collector/receiver"
+	"go.uber.org/zap"
+
+	"github.com/traas-stack/holoinsight-collector/internal/aescrypt"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+	"github.com/traas-stack/holoinsight-collector/internal/webtracking"
+)
+
+const dataFormat = "webtracking"
+
+// logsReceiver serves the WebTracking endpoints of the holoinsight_logs extension, feeding the logs to the pipeline
+// instead of writing them to a log store.
+type logsReceiver struct {
+	cfg      *Config
+	settings receiver.CreateSettings
+	next     consumer.Logs
+	obsrecv  *obsreport.Receiver
+	keys     *aescrypt.Keyring
+	limits   tenantlimit.Gate
+	tenants  tenantresolver.Gate
+	server   *http.Server
+	address  string
+}
+
+func newLogsReceiver(cfg *Config, settings receiver.CreateSettings, next consumer.Logs) (*logsReceiver, error) {
+	if next == nil {
+		return nil, component.ErrNilNextConsumer
+	}
+	keys, err := cfg.Decrypt.Keyring()
+	if err != nil {
+		return nil, fmt.Errorf("invalid decrypt keys: %w", err)
+	}
+	obsrecv, err := obsreport.NewReceiver(obsreport.ReceiverSettings{
+		ReceiverID:             settings.ID,
+		Transport:              "http",
+		ReceiverCreateSettings: settings,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &logsReceiver{
+		cfg:      cfg,
+		settings: settings,
+		next:     next,
+		obsrecv:  obsrecv,
+		keys:     keys,
+	}, nil
+}
+
+func (r *logsReceiver) Start(_ context.Context, host component.Host) error {
+	if err := r.limits.Resolve(host, r.cfg.Limiter); err != nil {
+		return err
+	}
+	if err := r.tenants.Resolve(host, r.cfg.TenantResolver); err != nil {
+		return err
+	}
+
+	router := mux.NewRouter()
+	webtracking.Handle(router, r.handleLogs)
+	var err error
+	r.server, err = r.cfg.HTTPServerSettings.ToServer(host, r.settings.TelemetrySettings, router)
+	if err != nil {
+		return fmt.Errorf("failed to create server definition: %w", err)
+	}
+	r.server.ConnContext = tenantauth.ConnContext
+	r.server.Handler = tenantresolver.Handler(r.cfg.Endpoint, r.server.Handler)
+	ln, err := r.cfg.HTTPServerSettings.ToListener()
+	if err != nil {
+		return fmt.Errorf("failed to create holoinsight logs listener: %w", err)
+	}
+	r.address = ln.Addr().String()
+
+	go func() {
+		if err := r.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			host.ReportFatalError(fmt.Errorf("error starting holoinsight logs receiver: %w", err))
+		}
+	}()
+	return nil
+}
+
+func (r *logsReceiver) Shutdown(ctx context.Context) error {
+	if r.server == nil {
+		return nil
+	}
+	return r.server.Shutdown(ctx)
+}
+
+func (r *logsReceiver) handleLogs(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	if !tenantauth.SignalAllowed(ctx, tenantauth.SignalLogs) {
+		http.Error(w, "logs are not enabled for the tenant", http.StatusForbidden)
+		return
+	}
+	logstore := mux.Vars(req)["logstore"]
+	if r.keys != nil {
+		decrypted, err := r.keys.Decrypt(logstore)
+		if err != nil {
+			http.Error(w, "Unauthorized access", http.StatusUnauthorized)
+			r.settings.Logger.Warn("[holoinsightlogsreceiver] logstore can't be decrypted", zap.String("logstore", logstore))
+			return
+		}
+		logstore = decrypted
+	}
+
+	payload, size, err := webtracking.Decode(req)
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, webtracking.ErrBodyTooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, "Unable to decode the logs", code)
+		r.settings.Logger.Debug("[holoinsightlogsreceiver] invalid payload", zap.String("logstore", logstore), zap.Error(err))
+		return
+	}
+	ld := toLogs(logstore, payload, time.Now())
+	count := ld.LogRecordCount()
+	if count == 0 {
+		webtracking.Succeed(w, req)
+		return
+	}
+	obsCtx := r.obsrecv.StartLogsOp(ctx)
+	tenant := r.tenants.Stamp(ctx, tenantresolver.RequestOf(ctx, ""), ld.ResourceLogs().At(0).Resource().Attributes())
+	if err = r.limits.Admit(ctx, tenant, tenantauth.SignalLogs, count, size); err != nil {
+		// throttled logs are refused, like the ones the pipeline refuses
+		r.obsrecv.EndLogsOp(obsCtx, dataFormat, count, err)
+		if retryAfter, throttled := tenantlimit.RetryAfter(err); throttled {
+			tenantlimit.SetRetryAfter(w.Header(), retryAfter)
+		}
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	err = r.next.ConsumeLogs(obsCtx, ld)
+	r.obsrecv.EndLogsOp(obsCtx, dataFormat, count, err)
+	if err != nil {
+		code := http.StatusServiceUnavailable
+		if consumererror.IsPermanent(err) {
+			code = http.StatusBadRequest
+		}
+		http.Error(w, "Logs consumer errored out", code)
+		r.settings.Logger.Error("[holoinsightlogsreceiver] failed to consume logs", zap.String("logstore", logstore), zap.Error(err))
+		return
+	}
+	webtracking.Succeed(w, req)
+}
@@ -0,0 +1,250 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightlogsreceiver
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/obsreport/obsreporttest"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/receiver/receivertest"
+
+	"github.com/traas-stack/holoinsight-collector/internal/aescrypt"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
+	"github.com/traas-stack/holoinsight-collector/internal/webtracking"
+)
+
+const payload = `{"__topic__":"web","__source__":"10.0.0.1","__tags__":{"app":"shop"},"__logs__":[{"content":"hello","level":"info"},{"level":"warn"},{}]}`
+
+func startReceiver(t *testing.T, cfg *Config, next consumer.Logs, host component.Host) *logsReceiver {
+	cfg.Endpoint = "localhost:0"
+	r, err := newLogsReceiver(cfg, receivertest.NewNopCreateSettings(), next)
+	require.NoError(t, err)
+	require.NoError(t, r.Start(context.Background(), host))
+	t.Cleanup(func() { require.NoError(t, r.Shutdown(context.Background())) })
+	return r
+}
+
+func post(t *testing.T, r *logsReceiver, logstore, body string, header http.Header) *http.Response {
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s/logstores/%s/track", r.address, logstore), strings.NewReader(body))
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp
+}
+
+func TestToLogs(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ld := toLogs("store", &webtracking.Payload{
+		Logs:   []map[string]string{{"content": "hello", "level": "info"}, {"level": "warn", "__time__": "1600000000"}, {}},
+		Tags:   map[string]string{"app": "shop"},
+		Topic:  "web",
+		Source: "10.0.0.1",
+	}, now)
+
+	require.Equal(t, 1, ld.ResourceLogs().Len())
+	attrs := ld.ResourceLogs().At(0).Resource().Attributes().AsRaw()
+	assert.Equal(t, map[string]interface{}{
+		attributeLogstore:          "store",
+		attributeTopic:             "web",
+		attributeSource:            "10.0.0.1",
+		attributeTagPrefix + "app": "shop",
+	}, attrs)
+
+	records := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+	require.Equal(t, 2, records.Len())
+	assert.Equal(t, "hello", records.At(0).Body().Str())
+	assert.Equal(t, map[string]interface{}{"level": "info"}, records.At(0).Attributes().AsRaw())
+	assert.Equal(t, now.UnixNano(), records.At(0).Timestamp().AsTime().UnixNano())
+	assert.Equal(t, int64(1600000000), records.At(1).Timestamp().AsTime().Unix())
+	assert.Equal(t, now.UnixNano(), records.At(1).ObservedTimestamp().AsTime().UnixNano())
+	assert.Equal(t, `{"level":"warn"}`, records.At(1).Body().Str())
+	assert.Equal(t, map[string]interface{}{"level": "warn"}, records.At(1).Attributes().AsRaw())
+
+	ld = toLogs("store", &webtracking.Payload{}, now)
+	assert.Equal(t, map[string]interface{}{attributeLogstore: "store"}, ld.ResourceLogs().At(0).Resource().Attributes().AsRaw())
+	assert.Equal(t, 0, ld.LogRecordCount())
+}
+
+func TestReceiveLogs(t *testing.T) {
+	sink := new(consumertest.LogsSink)
+	r := startReceiver(t, createDefaultConfig().(*Config), sink, componenttest.NewNopHost())
+
+	resp := post(t, r, "store", payload, http.Header{"Tenant": {"header-tenant"}})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, sink.AllLogs(), 1)
+	ld := sink.AllLogs()[0]
+	assert.Equal(t, 2, ld.LogRecordCount())
+	attrs := ld.ResourceLogs().At(0).Resource().Attributes()
+	logstore, _ := attrs.Get(attributeLogstore)
+	assert.Equal(t, "store", logstore.Str())
+	tenant, _ := attrs.Get("tenant")
+	assert.Equal(t, "header-tenant", tenant.Str())
+
+	resp = post(t, r, "store", `{"__logs__":[]}`, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, sink.AllLogs(), 1)
+
+	for _, body := range []string{"not json", "null"} {
+		resp = post(t, r, "store", body, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+	resp = post(t, r, "store", strings.Repeat(" ", 16<<20+1), nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestReceiveWebTrackingQuery(t *testing.T) {
+	sink := new(consumertest.LogsSink)
+	r := startReceiver(t, createDefaultConfig().(*Config), sink, componenttest.NewNopHost())
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/logstores/store/track?APIVersion=0.6.0&__topic__=web&content=hello", r.address))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/logstores/store/track_ua.gif?APIVersion=0.6.0&content=beacon", r.address), nil)
+	require.NoError(t, err)
+	req.Header.Set("User-Agent", "browser")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/gif", resp.Header.Get("Content-Type"))
+
+	require.Len(t, sink.AllLogs(), 2)
+	query := sink.AllLogs()[0].ResourceLogs().At(0)
+	topic, _ := query.Resource().Attributes().Get(attributeTopic)
+	assert.Equal(t, "web", topic.Str())
+	assert.Equal(t, "hello", query.ScopeLogs().At(0).LogRecords().At(0).Body().Str())
+	beacon := sink.AllLogs()[1].ResourceLogs().At(0)
+	ua, _ := beacon.Resource().Attributes().Get(attributeTagPrefix + "__user_agent__")
+	assert.Equal(t, "browser", ua.Str())
+	assert.Equal(t, "beacon", beacon.ScopeLogs().At(0).LogRecords().At(0).Body().Str())
+}
+
+func TestReceiveLogsDecrypt(t *testing.T) {
+	key := aescrypt.Key{ID: "k1", Secret: base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))}
+	keys, err := aescrypt.New([]aescrypt.Key{key}, "", "")
+	require.NoError(t, err)
+	encrypted, err := keys.Encrypt("store")
+	require.NoError(t, err)
+
+	cfg := createDefaultConfig().(*Config)
+	cfg.Decrypt = webtracking.Decrypt{Enable: true, Keys: []aescrypt.Key{key}}
+	sink := new(consumertest.LogsSink)
+	r := startReceiver(t, cfg, sink, componenttest.NewNopHost())
+
+	resp := post(t, r, "store", payload, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Len(t, sink.AllLogs(), 0)
+
+	resp = post(t, r, encrypted, payload, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, sink.AllLogs(), 1)
+	logstore, _ := sink.AllLogs()[0].ResourceLogs().At(0).Resource().Attributes().Get(attributeLogstore)
+	assert.Equal(t, "store", logstore.Str())
+}
+
+// limiterHost is a host with a limiter extension.
+type limiterHost struct {
+	component.Host
+	extensions map[component.ID]component.Component
+}
+
+func (h *limiterHost) GetExtensions() map[component.ID]component.Component {
+	return h.extensions
+}
+
+// throttlingLimiter throttles every request.
+type throttlingLimiter struct {
+	component.StartFunc
+	component.ShutdownFunc
+}
+
+func (throttlingLimiter) Admit(_ context.Context, tenant, signal string, _, _ int) error {
+	return &tenantlimit.ThrottledError{Tenant: tenant, Signal: signal, Reason: tenantlimit.ReasonRate, RetryAfter: 1500 * time.Millisecond}
+}
+
+func TestReceiveLogsThrottled(t *testing.T) {
+	limiterID := component.NewID("test_limiter")
+	host := &limiterHost{
+		Host:       componenttest.NewNopHost(),
+		extensions: map[component.ID]component.Component{limiterID: throttlingLimiter{}},
+	}
+	cfg := createDefaultConfig().(*Config)
+	cfg.Limiter = &limiterID
+	cfg.Endpoint = "localhost:0"
+	sink := new(consumertest.LogsSink)
+
+	id := component.NewID(typeStr)
+	tt, err := obsreporttest.SetupTelemetry(id)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, tt.Shutdown(context.Background())) })
+	set := tt.ToReceiverCreateSettings()
+	set.ID = id
+	r, err := newLogsReceiver(cfg, set, sink)
+	require.NoError(t, err)
+	require.NoError(t, r.Start(context.Background(), host))
+	t.Cleanup(func() { require.NoError(t, r.Shutdown(context.Background())) })
+
+	resp := post(t, r, "store", payload, nil)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+	assert.Len(t, sink.AllLogs(), 0)
+
+	// the throttled logs are refused in the receiver metrics
+	require.NoError(t, tt.CheckReceiverLogs("http", 0, 2))
+}
+
+// erroringSink fails every batch with err.
+type erroringSink struct {
+	consumertest.LogsSink
+	err error
+}
+
+func (s *erroringSink) ConsumeLogs(context.Context, plog.Logs) error {
+	return s.err
+}
+
+func TestReceiveLogsConsumerError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code int
+	}{
+		{err: fmt.Errorf("queue is full"), code: http.StatusServiceUnavailable},
+		{err: consumererror.NewPermanent(fmt.Errorf("invalid")), code: http.StatusBadRequest},
+	} {
+		r := startReceiver(t, createDefaultConfig().(*Config), &erroringSink{err: tc.err}, componenttest.NewNopHost())
+		resp := post(t, r, "store", payload, nil)
+		assert.Equal(t, tc.code, resp.StatusCode)
+	}
+}
@@ -17,6 +17,7 @@ package holoinsightotlpreceiver // import "go.opentelemetry.io/collector/receive
 import (
 	"errors"
 
+	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/validation"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/config/configgrpc"
 	"go.opentelemetry.io/collector/config/confighttp"
@@ -27,6 +28,9 @@ const (
 	// Protocol values.
 	protoGRPC = "protocols::grpc"
 	protoHTTP = "protocols::http"
+
+	tenantPath = "tenant_path"
+	validate   = "validation"
 )
 
 // Protocols is the configuration for the supported protocols.
@@ -39,6 +43,19 @@ type Protocols struct {
 type Config struct {
 	// Protocols is the configuration for the supported protocols, currently gRPC and HTTP (Proto and JSON).
 	Protocols `mapstructure:"protocols"`
+	// TenantPath additionally serves the OTLP/HTTP endpoints below a path carrying the apikey.
+	TenantPath *TenantPathSettings `mapstructure:"tenant_path"`
+	// Validation drops invalid spans, data points and log records and reports them
+	// in the OTLP partial_success response fields. Disabled when not set.
+	Validation *validation.Settings `mapstructure:"validation"`
+	// SharedGRPC serves the OTLP gRPC services on the gRPC server shared with the other receivers
+	// configured with the same gRPC endpoint, e.g. holoinsight_skywalking.
+	SharedGRPC bool `mapstructure:"shared_grpc"`
+	// Limiter is the tenant limiter extension throttling the data of each tenant, e.g. holoinsight_tenant_limiter.
+	Limiter *component.ID `mapstructure:"limiter"`
+	// TenantResolver is the tenant resolver extension stamping the tenant of the data, e.g. holoinsight_tenant_resolver.
+	// The built-in sources are used when not set.
+	TenantResolver *component.ID `mapstructure:"tenant_resolver"`
 }
 
 var _ component.Config = (*Config)(nil)
@@ -49,6 +66,15 @@ func (cfg *Config) Validate() error {
 	if cfg.GRPC == nil && cfg.HTTP == nil {
 		return errors.New("must specify at least one protocol when using the OTLP receiver")
 	}
+	if cfg.SharedGRPC && cfg.GRPC == nil {
+		return errors.New("shared_grpc requires the grpc protocol")
+	}
+	if cfg.TenantPath != nil {
+		if cfg.HTTP == nil || cfg.HTTP.Auth == nil {
+			return errors.New("tenant_path requires the http protocol with an authenticator")
+		}
+		return cfg.TenantPath.Validate()
+	}
 	return nil
 }
 
@@ -68,5 +94,13 @@ func (cfg *Config) Unmarshal(conf *confmap.Conf) error {
 		cfg.HTTP = nil
 	}
 
+	if conf.IsSet(tenantPath) && cfg.TenantPath == nil {
+		cfg.TenantPath = &TenantPathSettings{}
+	}
+
+	if conf.IsSet(validate) && cfg.Validation == nil {
+		cfg.Validation = &validation.Settings{}
+	}
+
 	return nil
 }
@@ -199,3 +199,16 @@ func TestUnmarshalConfigEmpty(t *testing.T) {
 	assert.NoError(t, component.UnmarshalConfig(confmap.New(), cfg))
 	assert.EqualError(t, component.ValidateConfig(cfg), "must specify at least one protocol when using the OTLP receiver")
 }
+
+func TestUnmarshalConfigTenantPath(t *testing.T) {
+	cm, err := confmaptest.LoadConf(filepath.Join("testdata", "tenant_path.yaml"))
+	require.NoError(t, err)
+	factory := NewFactory()
+	cfg := factory.CreateDefaultConfig()
+	assert.NoError(t, component.UnmarshalConfig(cm, cfg))
+	assert.NoError(t, component.ValidateConfig(cfg))
+	assert.Equal(t, &TenantPathSettings{}, cfg.(*Config).TenantPath)
+
+	cfg.(*Config).HTTP.Auth = nil
+	assert.EqualError(t, component.ValidateConfig(cfg), "tenant_path requires the http protocol with an authenticator")
+}
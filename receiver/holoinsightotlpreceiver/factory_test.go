@@ -27,7 +27,6 @@ import (
 	"go.opentelemetry.io/collector/config/confignet"
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/consumer/consumertest"
-	"go.opentelemetry.io/collector/internal/testutil"
 	"go.opentelemetry.io/collector/receiver/receivertest"
 )
 
@@ -41,8 +40,8 @@ func TestCreateDefaultConfig(t *testing.T) {
 func TestCreateReceiver(t *testing.T) {
 	factory := NewFactory()
 	cfg := factory.CreateDefaultConfig().(*Config)
-	cfg.GRPC.NetAddr.Endpoint = testutil.GetAvailableLocalAddress(t)
-	cfg.HTTP.Endpoint = testutil.GetAvailableLocalAddress(t)
+	cfg.GRPC.NetAddr.Endpoint = getAvailableLocalAddress(t)
+	cfg.HTTP.Endpoint = getAvailableLocalAddress(t)
 
 	creationSet := receivertest.NewNopCreateSettings()
 	tReceiver, err := factory.CreateTracesReceiver(context.Background(), creationSet, cfg, consumertest.NewNop())
@@ -58,12 +57,12 @@ func TestCreateTracesReceiver(t *testing.T) {
 	factory := NewFactory()
 	defaultGRPCSettings := &configgrpc.GRPCServerSettings{
 		NetAddr: confignet.NetAddr{
-			Endpoint:  testutil.GetAvailableLocalAddress(t),
+			Endpoint:  getAvailableLocalAddress(t),
 			Transport: "tcp",
 		},
 	}
 	defaultHTTPSettings := &confighttp.HTTPServerSettings{
-		Endpoint: testutil.GetAvailableLocalAddress(t),
+		Endpoint: getAvailableLocalAddress(t),
 	}
 
 	tests := []struct {
@@ -131,12 +130,12 @@ func TestCreateMetricReceiver(t *testing.T) {
 	factory := NewFactory()
 	defaultGRPCSettings := &configgrpc.GRPCServerSettings{
 		NetAddr: confignet.NetAddr{
-			Endpoint:  testutil.GetAvailableLocalAddress(t),
+			Endpoint:  getAvailableLocalAddress(t),
 			Transport: "tcp",
 		},
 	}
 	defaultHTTPSettings := &confighttp.HTTPServerSettings{
-		Endpoint: testutil.GetAvailableLocalAddress(t),
+		Endpoint: getAvailableLocalAddress(t),
 	}
 
 	tests := []struct {
@@ -203,12 +202,12 @@ func TestCreateLogReceiver(t *testing.T) {
 	factory := NewFactory()
 	defaultGRPCSettings := &configgrpc.GRPCServerSettings{
 		NetAddr: confignet.NetAddr{
-			Endpoint:  testutil.GetAvailableLocalAddress(t),
+			Endpoint:  getAvailableLocalAddress(t),
 			Transport: "tcp",
 		},
 	}
 	defaultHTTPSettings := &confighttp.HTTPServerSettings{
-		Endpoint: testutil.GetAvailableLocalAddress(t),
+		Endpoint: getAvailableLocalAddress(t),
 	}
 
 	tests := []struct {
@@ -0,0 +1,69 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightotlpreceiver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// getAvailableLocalAddress finds an available local port and returns an endpoint
+// describing it. The port is available for opening when this function returns
+// provided that there is no race by some other code to grab the same port.
+func getAvailableLocalAddress(t *testing.T) string {
+	ln, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err, "Failed to get a free local port")
+	// There is a possible race if something else takes this same port before
+	// the test uses it, however, that is unlikely in practice.
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// generateTestTraces creates traces with one resource and spanCount spans.
+func generateTestTraces(spanCount int) ptrace.Traces {
+	td := ptrace.NewTraces()
+	rs := td.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("resource-attr", "resource-attr-val-1")
+	ss := rs.ScopeSpans().AppendEmpty()
+	ss.Scope().SetName("test-scope")
+	startTime := pcommon.NewTimestampFromTime(time.Date(2020, 2, 11, 20, 26, 12, 321, time.UTC))
+	endTime := pcommon.NewTimestampFromTime(time.Date(2020, 2, 11, 20, 26, 13, 789, time.UTC))
+	for i := 0; i < spanCount; i++ {
+		span := ss.Spans().AppendEmpty()
+		span.SetName("operationA")
+		span.SetTraceID([16]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10})
+		span.SetSpanID([8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, byte(i)})
+		span.SetStartTimestamp(startTime)
+		span.SetEndTimestamp(endTime)
+		span.Status().SetCode(ptrace.StatusCodeError)
+		span.Status().SetMessage("status-cancelled")
+	}
+	return td
+}
+
+// withTenant returns a copy of td with the tenant stamped by the receiver.
+func withTenant(td ptrace.Traces, tenant string) ptrace.Traces {
+	stamped := ptrace.NewTraces()
+	td.CopyTo(stamped)
+	for i := 0; i < stamped.ResourceSpans().Len(); i++ {
+		stamped.ResourceSpans().At(i).Resource().Attributes().PutStr("tenant", tenant)
+	}
+	return stamped
+}
@@ -16,10 +16,20 @@ package logs // import "go.opentelemetry.io/collector/receiver/otlpreceiver/inte
 
 import (
 	"context"
+	"errors"
 
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/tenant"
+	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/validation"
 	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/obsreport"
+	"go.opentelemetry.io/collector/pdata/plog"
 	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const dataFormatProtobuf = "protobuf"
@@ -29,27 +39,85 @@ type Receiver struct {
 	plogotlp.UnimplementedGRPCServer
 	nextConsumer consumer.Logs
 	obsrecv      *obsreport.Receiver
+	validator    *validation.Validator
+	limits       *tenantlimit.Gate
+	tenants      *tenantresolver.Gate
+	grpcListener string
 }
 
-// New creates a new Receiver reference.
-func New(nextConsumer consumer.Logs, obsrecv *obsreport.Receiver) *Receiver {
+// New creates a new Receiver reference. grpcListener is the endpoint of the gRPC server the Receiver serves,
+// empty when it serves HTTP requests.
+func New(nextConsumer consumer.Logs, obsrecv *obsreport.Receiver, validator *validation.Validator, limits *tenantlimit.Gate,
+	tenants *tenantresolver.Gate, grpcListener string) *Receiver {
 	return &Receiver{
 		nextConsumer: nextConsumer,
 		obsrecv:      obsrecv,
+		validator:    validator,
+		limits:       limits,
+		tenants:      tenants,
+		grpcListener: grpcListener,
 	}
 }
 
 // Export implements the service Export logs func.
 func (r *Receiver) Export(ctx context.Context, req plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+	if !tenantauth.SignalAllowed(ctx, tenantauth.SignalLogs) {
+		return plogotlp.NewExportResponse(), status.Error(codes.PermissionDenied, "logs are not enabled for the tenant")
+	}
 	ld := req.Logs()
-	numSpans := ld.LogRecordCount()
-	if numSpans == 0 {
-		return plogotlp.NewExportResponse(), nil
+	// invalid items are dropped and reported back as a partial success
+	result := r.validator.Logs(ld)
+	if result.Rejected > 0 {
+		// invalid items are refused, like the ones the pipeline refuses
+		obsCtx := r.obsrecv.StartLogsOp(ctx)
+		r.obsrecv.EndLogsOp(obsCtx, dataFormatProtobuf, result.Rejected, errors.New(result.Message()))
+	}
+	numRecords := ld.LogRecordCount()
+	if numRecords == 0 {
+		return response(result), nil
 	}
 
 	ctx = r.obsrecv.StartLogsOp(ctx)
+	// the data is admitted in the limits of the tenants it was resolved to
+	var tenants tenantlimit.Tenants
+	received := tenantresolver.RequestOf(ctx, r.grpcListener)
+	rs := ld.ResourceLogs()
+	for i := 0; i < rs.Len(); i++ {
+		tenants.Add(r.tenants.Stamp(ctx, received, rs.At(i).Resource().Attributes()), logRecordCount(rs.At(i)))
+		tenant.StampInstance(rs.At(i).Resource())
+	}
+	if err := r.limits.AdmitTenants(ctx, tenantauth.SignalLogs, &tenants, (&plog.ProtoMarshaler{}).LogsSize(ld)); err != nil {
+		// throttled items are refused, like the ones the pipeline refuses
+		r.obsrecv.EndLogsOp(ctx, dataFormatProtobuf, numRecords, err)
+		return plogotlp.NewExportResponse(), tenantlimit.GRPCError(err)
+	}
+
 	err := r.nextConsumer.ConsumeLogs(ctx, ld)
-	r.obsrecv.EndLogsOp(ctx, dataFormatProtobuf, numSpans, err)
+	r.obsrecv.EndLogsOp(ctx, dataFormatProtobuf, numRecords, err)
+
+	// retrying data the pipeline refused permanently is pointless, report it as rejected instead
+	if consumererror.IsPermanent(err) {
+		result.Refuse(numRecords, err)
+		err = nil
+	}
+	return response(result), err
+}
+
+// response reports the rejected log records as a partial success.
+func response(result validation.Result) plogotlp.ExportResponse {
+	resp := plogotlp.NewExportResponse()
+	if result.Rejected > 0 {
+		resp.PartialSuccess().SetRejectedLogRecords(int64(result.Rejected))
+		resp.PartialSuccess().SetErrorMessage(result.Message())
+	}
+	return resp
+}
 
-	return plogotlp.NewExportResponse(), err
+// logRecordCount returns the number of log records of a resource.
+func logRecordCount(rl plog.ResourceLogs) int {
+	count := 0
+	for i := 0; i < rl.ScopeLogs().Len(); i++ {
+		count += rl.ScopeLogs().At(i).LogRecords().Len()
+	}
+	return count
 }
@@ -16,10 +16,20 @@ package metrics // import "go.opentelemetry.io/collector/receiver/otlpreceiver/i
 
 import (
 	"context"
+	"errors"
 
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/tenant"
+	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/validation"
 	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/obsreport"
+	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const dataFormatProtobuf = "protobuf"
@@ -29,27 +39,99 @@ type Receiver struct {
 	pmetricotlp.UnimplementedGRPCServer
 	nextConsumer consumer.Metrics
 	obsrecv      *obsreport.Receiver
+	validator    *validation.Validator
+	limits       *tenantlimit.Gate
+	tenants      *tenantresolver.Gate
+	grpcListener string
 }
 
-// New creates a new Receiver reference.
-func New(nextConsumer consumer.Metrics, obsrecv *obsreport.Receiver) *Receiver {
+// New creates a new Receiver reference. grpcListener is the endpoint of the gRPC server the Receiver serves,
+// empty when it serves HTTP requests.
+func New(nextConsumer consumer.Metrics, obsrecv *obsreport.Receiver, validator *validation.Validator, limits *tenantlimit.Gate,
+	tenants *tenantresolver.Gate, grpcListener string) *Receiver {
 	return &Receiver{
 		nextConsumer: nextConsumer,
 		obsrecv:      obsrecv,
+		validator:    validator,
+		limits:       limits,
+		tenants:      tenants,
+		grpcListener: grpcListener,
 	}
 }
 
 // Export implements the service Export metrics func.
 func (r *Receiver) Export(ctx context.Context, req pmetricotlp.ExportRequest) (pmetricotlp.ExportResponse, error) {
+	if !tenantauth.SignalAllowed(ctx, tenantauth.SignalMetrics) {
+		return pmetricotlp.NewExportResponse(), status.Error(codes.PermissionDenied, "metrics are not enabled for the tenant")
+	}
 	md := req.Metrics()
+	// invalid items are dropped and reported back as a partial success
+	result := r.validator.Metrics(md)
+	if result.Rejected > 0 {
+		// invalid items are refused, like the ones the pipeline refuses
+		obsCtx := r.obsrecv.StartMetricsOp(ctx)
+		r.obsrecv.EndMetricsOp(obsCtx, dataFormatProtobuf, result.Rejected, errors.New(result.Message()))
+	}
 	dataPointCount := md.DataPointCount()
 	if dataPointCount == 0 {
-		return pmetricotlp.NewExportResponse(), nil
+		return response(result), nil
 	}
 
 	ctx = r.obsrecv.StartMetricsOp(ctx)
+	// the data is admitted in the limits of the tenants it was resolved to
+	var tenants tenantlimit.Tenants
+	received := tenantresolver.RequestOf(ctx, r.grpcListener)
+	rs := md.ResourceMetrics()
+	for i := 0; i < rs.Len(); i++ {
+		tenants.Add(r.tenants.Stamp(ctx, received, rs.At(i).Resource().Attributes()), resourceDataPointCount(rs.At(i)))
+		tenant.StampInstance(rs.At(i).Resource())
+	}
+	if err := r.limits.AdmitTenants(ctx, tenantauth.SignalMetrics, &tenants, (&pmetric.ProtoMarshaler{}).MetricsSize(md)); err != nil {
+		// throttled items are refused, like the ones the pipeline refuses
+		r.obsrecv.EndMetricsOp(ctx, dataFormatProtobuf, dataPointCount, err)
+		return pmetricotlp.NewExportResponse(), tenantlimit.GRPCError(err)
+	}
+
 	err := r.nextConsumer.ConsumeMetrics(ctx, md)
 	r.obsrecv.EndMetricsOp(ctx, dataFormatProtobuf, dataPointCount, err)
 
-	return pmetricotlp.NewExportResponse(), err
+	// retrying data the pipeline refused permanently is pointless, report it as rejected instead
+	if consumererror.IsPermanent(err) {
+		result.Refuse(dataPointCount, err)
+		err = nil
+	}
+	return response(result), err
+}
+
+// response reports the rejected data points as a partial success.
+func response(result validation.Result) pmetricotlp.ExportResponse {
+	resp := pmetricotlp.NewExportResponse()
+	if result.Rejected > 0 {
+		resp.PartialSuccess().SetRejectedDataPoints(int64(result.Rejected))
+		resp.PartialSuccess().SetErrorMessage(result.Message())
+	}
+	return resp
+}
+
+// resourceDataPointCount returns the number of data points of a resource.
+func resourceDataPointCount(rm pmetric.ResourceMetrics) int {
+	count := 0
+	for i := 0; i < rm.ScopeMetrics().Len(); i++ {
+		ms := rm.ScopeMetrics().At(i).Metrics()
+		for j := 0; j < ms.Len(); j++ {
+			switch m := ms.At(j); m.Type() {
+			case pmetric.MetricTypeGauge:
+				count += m.Gauge().DataPoints().Len()
+			case pmetric.MetricTypeSum:
+				count += m.Sum().DataPoints().Len()
+			case pmetric.MetricTypeHistogram:
+				count += m.Histogram().DataPoints().Len()
+			case pmetric.MetricTypeExponentialHistogram:
+				count += m.ExponentialHistogram().DataPoints().Len()
+			case pmetric.MetricTypeSummary:
+				count += m.Summary().DataPoints().Len()
+			}
+		}
+	}
+	return count
 }
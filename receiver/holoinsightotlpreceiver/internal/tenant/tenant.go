@@ -0,0 +1,32 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenant // import "github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/tenant"
+
+import (
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+const (
+	AttributeInstance = "service.instance.name"
+	AttributeHostName = "host.name"
+)
+
+// StampInstance derives service.instance.name from host.name. The tenant is stamped by the tenant resolver.
+func StampInstance(resource pcommon.Resource) {
+	attrs := resource.Attributes()
+	if hostName, ok := attrs.Get(AttributeHostName); ok {
+		attrs.PutStr(AttributeInstance, hostName.Str())
+	}
+}
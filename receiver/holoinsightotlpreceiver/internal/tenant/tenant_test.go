@@ -0,0 +1,36 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenant
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+func TestStampInstance(t *testing.T) {
+	resource := pcommon.NewResource()
+	resource.Attributes().PutStr(AttributeHostName, "host-1")
+	StampInstance(resource)
+
+	instance, _ := resource.Attributes().Get(AttributeInstance)
+	assert.Equal(t, "host-1", instance.Str())
+
+	resource = pcommon.NewResource()
+	StampInstance(resource)
+	_, ok := resource.Attributes().Get(AttributeInstance)
+	assert.False(t, ok)
+}
@@ -16,66 +16,109 @@ package trace // import "go.opentelemetry.io/collector/receiver/otlpreceiver/int
 
 import (
 	"context"
-	"fmt"
-	"google.golang.org/grpc/metadata"
+	"errors"
 
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/tenant"
+	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/validation"
 	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/obsreport"
+	"go.opentelemetry.io/collector/pdata/ptrace"
 	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-const (
-	dataFormatProtobuf = "protobuf"
-	Tenant             = "tenant"
-	AttributeInstance  = "service.instance.name"
-	AttributeHostName  = "host.name"
-)
+const dataFormatProtobuf = "protobuf"
 
 // Receiver is the type used to handle spans from OpenTelemetry exporters.
 type Receiver struct {
 	ptraceotlp.UnimplementedGRPCServer
 	nextConsumer consumer.Traces
 	obsrecv      *obsreport.Receiver
+	validator    *validation.Validator
+	limits       *tenantlimit.Gate
+	tenants      *tenantresolver.Gate
+	grpcListener string
 }
 
-// New creates a new Receiver reference.
-func New(nextConsumer consumer.Traces, obsrecv *obsreport.Receiver) *Receiver {
+// New creates a new Receiver reference. grpcListener is the endpoint of the gRPC server the Receiver serves,
+// empty when it serves HTTP requests.
+func New(nextConsumer consumer.Traces, obsrecv *obsreport.Receiver, validator *validation.Validator, limits *tenantlimit.Gate,
+	tenants *tenantresolver.Gate, grpcListener string) *Receiver {
 	return &Receiver{
 		nextConsumer: nextConsumer,
 		obsrecv:      obsrecv,
+		validator:    validator,
+		limits:       limits,
+		tenants:      tenants,
+		grpcListener: grpcListener,
 	}
 }
 
 // Export implements the service Export traces func.
 func (r *Receiver) Export(ctx context.Context, req ptraceotlp.ExportRequest) (ptraceotlp.ExportResponse, error) {
+	if !tenantauth.SignalAllowed(ctx, tenantauth.SignalTraces) {
+		return ptraceotlp.NewExportResponse(), status.Error(codes.PermissionDenied, "traces are not enabled for the tenant")
+	}
 	td := req.Traces()
+	// invalid items are dropped and reported back as a partial success
+	result := r.validator.Traces(td)
+	if result.Rejected > 0 {
+		// invalid items are refused, like the ones the pipeline refuses
+		obsCtx := r.obsrecv.StartTracesOp(ctx)
+		r.obsrecv.EndTracesOp(obsCtx, dataFormatProtobuf, result.Rejected, errors.New(result.Message()))
+	}
 	// We need to ensure that it propagates the receiver name as a tag
 	numSpans := td.SpanCount()
 	if numSpans == 0 {
-		return ptraceotlp.NewExportResponse(), nil
+		return response(result), nil
 	}
 
-	// get tenant
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		fmt.Printf("Grpc from metadata error!")
-	}
-	var tenant string
-	if vs, ok := md["tenant"]; ok && len(vs) > 0 {
-		tenant = vs[0]
+	ctx = r.obsrecv.StartTracesOp(ctx)
+	// the data is admitted in the limits of the tenants it was resolved to
+	var tenants tenantlimit.Tenants
+	received := tenantresolver.RequestOf(ctx, r.grpcListener)
+	rs := td.ResourceSpans()
+	for i := 0; i < rs.Len(); i++ {
+		tenants.Add(r.tenants.Stamp(ctx, received, rs.At(i).Resource().Attributes()), spanCount(rs.At(i)))
+		tenant.StampInstance(rs.At(i).Resource())
 	}
-	rss := td.ResourceSpans()
-	for i := 0; i < rss.Len(); i++ {
-		rs := rss.At(i)
-		rs.Resource().Attributes().PutStr(Tenant, tenant)
-		if hostName, ok := rs.Resource().Attributes().Get(AttributeHostName); ok {
-			rs.Resource().Attributes().PutStr(AttributeInstance, hostName.Str())
-		}
+	if err := r.limits.AdmitTenants(ctx, tenantauth.SignalTraces, &tenants, (&ptrace.ProtoMarshaler{}).TracesSize(td)); err != nil {
+		// throttled items are refused, like the ones the pipeline refuses
+		r.obsrecv.EndTracesOp(ctx, dataFormatProtobuf, numSpans, err)
+		return ptraceotlp.NewExportResponse(), tenantlimit.GRPCError(err)
 	}
 
-	ctx = r.obsrecv.StartTracesOp(ctx)
 	err := r.nextConsumer.ConsumeTraces(ctx, td)
 	r.obsrecv.EndTracesOp(ctx, dataFormatProtobuf, numSpans, err)
 
-	return ptraceotlp.NewExportResponse(), err
+	// retrying data the pipeline refused permanently is pointless, report it as rejected instead
+	if consumererror.IsPermanent(err) {
+		result.Refuse(numSpans, err)
+		err = nil
+	}
+	return response(result), err
+}
+
+// response reports the rejected spans as a partial success.
+func response(result validation.Result) ptraceotlp.ExportResponse {
+	resp := ptraceotlp.NewExportResponse()
+	if result.Rejected > 0 {
+		resp.PartialSuccess().SetRejectedSpans(int64(result.Rejected))
+		resp.PartialSuccess().SetErrorMessage(result.Message())
+	}
+	return resp
+}
+
+// spanCount returns the number of spans of a resource.
+func spanCount(rs ptrace.ResourceSpans) int {
+	count := 0
+	for i := 0; i < rs.ScopeSpans().Len(); i++ {
+		count += rs.ScopeSpans().At(i).Spans().Len()
+	}
+	return count
 }
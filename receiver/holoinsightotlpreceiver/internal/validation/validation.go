@@ -0,0 +1,303 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation // import "github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/validation"
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	conventions "go.opentelemetry.io/collector/semconv/v1.8.0"
+)
+
+const (
+	reasonMissingServiceName = "missing service.name"
+	reasonInvalidTraceID     = "empty or invalid trace id"
+	reasonInvalidSpanID      = "empty or invalid span id"
+	reasonFutureTimestamp    = "timestamp too far in the future"
+	reasonPastTimestamp      = "timestamp too far in the past"
+	reasonTooManyAttributes  = "too many attributes"
+	reasonAttributeTooLong   = "attribute value too long"
+)
+
+// Settings defines which incoming items are rejected. Zero values disable the corresponding check.
+type Settings struct {
+	// RequireServiceName rejects every item of a resource without a service.name attribute.
+	RequireServiceName bool `mapstructure:"require_service_name"`
+	// MaxFutureSkew rejects items timestamped further than this in the future.
+	MaxFutureSkew time.Duration `mapstructure:"max_future_skew"`
+	// MaxAge rejects items timestamped further than this in the past.
+	MaxAge time.Duration `mapstructure:"max_age"`
+	// MaxAttributes rejects items (or resources) carrying more attributes than this.
+	MaxAttributes int `mapstructure:"max_attributes"`
+	// MaxAttributeValueLength rejects items (or resources) with a string attribute value longer than this.
+	MaxAttributeValueLength int `mapstructure:"max_attribute_value_length"`
+}
+
+// Validator drops invalid spans, data points and log records from incoming requests
+// and describes what it dropped, to be reported as an OTLP partial success.
+type Validator struct {
+	settings Settings
+	now      func() time.Time
+}
+
+// New creates a Validator, nil settings disable validation.
+func New(settings *Settings) *Validator {
+	if settings == nil {
+		return nil
+	}
+	return &Validator{
+		settings: *settings,
+		now:      time.Now,
+	}
+}
+
+// Result counts the rejected items by reason.
+type Result struct {
+	Rejected int
+	reasons  map[string]int
+}
+
+func (r *Result) reject(reason string, count int) {
+	if reason == "" || count == 0 {
+		return
+	}
+	if r.reasons == nil {
+		r.reasons = make(map[string]int)
+	}
+	r.Rejected += count
+	r.reasons[reason] += count
+}
+
+// Refuse records count items the pipeline refused permanently with err.
+func (r *Result) Refuse(count int, err error) {
+	r.reject(err.Error(), count)
+}
+
+// Message describes the rejected items, e.g. "2 rejected: 1 missing service.name, 1 empty or invalid trace id".
+func (r *Result) Message() string {
+	if r.Rejected == 0 {
+		return ""
+	}
+	reasons := make([]string, 0, len(r.reasons))
+	for reason := range r.reasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for i, reason := range reasons {
+		reasons[i] = fmt.Sprintf("%d %s", r.reasons[reason], reason)
+	}
+	return fmt.Sprintf("%d rejected: %s", r.Rejected, strings.Join(reasons, ", "))
+}
+
+// Traces removes the invalid spans from td.
+func (v *Validator) Traces(td ptrace.Traces) Result {
+	var result Result
+	if v == nil {
+		return result
+	}
+	now := v.now()
+	td.ResourceSpans().RemoveIf(func(rs ptrace.ResourceSpans) bool {
+		if reason := v.checkResource(rs.Resource()); reason != "" {
+			result.reject(reason, spanCount(rs))
+			return true
+		}
+		rs.ScopeSpans().RemoveIf(func(ss ptrace.ScopeSpans) bool {
+			ss.Spans().RemoveIf(func(span ptrace.Span) bool {
+				reason := v.checkSpan(span, now)
+				result.reject(reason, 1)
+				return reason != ""
+			})
+			return ss.Spans().Len() == 0
+		})
+		return rs.ScopeSpans().Len() == 0
+	})
+	return result
+}
+
+// Metrics removes the invalid data points from md.
+func (v *Validator) Metrics(md pmetric.Metrics) Result {
+	var result Result
+	if v == nil {
+		return result
+	}
+	now := v.now()
+	md.ResourceMetrics().RemoveIf(func(rm pmetric.ResourceMetrics) bool {
+		if reason := v.checkResource(rm.Resource()); reason != "" {
+			result.reject(reason, dataPointCount(rm))
+			return true
+		}
+		rm.ScopeMetrics().RemoveIf(func(sm pmetric.ScopeMetrics) bool {
+			sm.Metrics().RemoveIf(func(m pmetric.Metric) bool {
+				return v.removeDataPoints(m, now, &result) == 0
+			})
+			return sm.Metrics().Len() == 0
+		})
+		return rm.ScopeMetrics().Len() == 0
+	})
+	return result
+}
+
+// Logs removes the invalid log records from ld.
+func (v *Validator) Logs(ld plog.Logs) Result {
+	var result Result
+	if v == nil {
+		return result
+	}
+	now := v.now()
+	ld.ResourceLogs().RemoveIf(func(rl plog.ResourceLogs) bool {
+		if reason := v.checkResource(rl.Resource()); reason != "" {
+			result.reject(reason, logRecordCount(rl))
+			return true
+		}
+		rl.ScopeLogs().RemoveIf(func(sl plog.ScopeLogs) bool {
+			sl.LogRecords().RemoveIf(func(lr plog.LogRecord) bool {
+				ts := lr.Timestamp()
+				if ts == 0 {
+					ts = lr.ObservedTimestamp()
+				}
+				reason := v.checkTimestamp(ts, now)
+				if reason == "" {
+					reason = v.checkAttributes(lr.Attributes())
+				}
+				result.reject(reason, 1)
+				return reason != ""
+			})
+			return sl.LogRecords().Len() == 0
+		})
+		return rl.ScopeLogs().Len() == 0
+	})
+	return result
+}
+
+func (v *Validator) checkResource(resource pcommon.Resource) string {
+	if v.settings.RequireServiceName {
+		if name, ok := resource.Attributes().Get(conventions.AttributeServiceName); !ok || name.AsString() == "" {
+			return reasonMissingServiceName
+		}
+	}
+	return v.checkAttributes(resource.Attributes())
+}
+
+func (v *Validator) checkSpan(span ptrace.Span, now time.Time) string {
+	if span.TraceID().IsEmpty() {
+		return reasonInvalidTraceID
+	}
+	if span.SpanID().IsEmpty() {
+		return reasonInvalidSpanID
+	}
+	if reason := v.checkTimestamp(span.StartTimestamp(), now); reason != "" {
+		return reason
+	}
+	return v.checkAttributes(span.Attributes())
+}
+
+// checkTimestamp accepts unset timestamps, the backend stamps those on arrival.
+func (v *Validator) checkTimestamp(ts pcommon.Timestamp, now time.Time) string {
+	if ts == 0 {
+		return ""
+	}
+	t := ts.AsTime()
+	if v.settings.MaxFutureSkew > 0 && t.After(now.Add(v.settings.MaxFutureSkew)) {
+		return reasonFutureTimestamp
+	}
+	if v.settings.MaxAge > 0 && t.Before(now.Add(-v.settings.MaxAge)) {
+		return reasonPastTimestamp
+	}
+	return ""
+}
+
+func (v *Validator) checkAttributes(attrs pcommon.Map) string {
+	if v.settings.MaxAttributes > 0 && attrs.Len() > v.settings.MaxAttributes {
+		return reasonTooManyAttributes
+	}
+	if v.settings.MaxAttributeValueLength <= 0 {
+		return ""
+	}
+	reason := ""
+	attrs.Range(func(_ string, value pcommon.Value) bool {
+		if value.Type() == pcommon.ValueTypeStr && len(value.Str()) > v.settings.MaxAttributeValueLength {
+			reason = reasonAttributeTooLong
+			return false
+		}
+		return true
+	})
+	return reason
+}
+
+// removeDataPoints removes the invalid data points of m and returns how many are left.
+func (v *Validator) removeDataPoints(m pmetric.Metric, now time.Time, result *Result) int {
+	check := func(ts pcommon.Timestamp, attrs pcommon.Map) bool {
+		reason := v.checkTimestamp(ts, now)
+		if reason == "" {
+			reason = v.checkAttributes(attrs)
+		}
+		result.reject(reason, 1)
+		return reason != ""
+	}
+
+	switch m.Type() {
+	case pmetric.MetricTypeGauge:
+		dps := m.Gauge().DataPoints()
+		dps.RemoveIf(func(dp pmetric.NumberDataPoint) bool { return check(dp.Timestamp(), dp.Attributes()) })
+		return dps.Len()
+	case pmetric.MetricTypeSum:
+		dps := m.Sum().DataPoints()
+		dps.RemoveIf(func(dp pmetric.NumberDataPoint) bool { return check(dp.Timestamp(), dp.Attributes()) })
+		return dps.Len()
+	case pmetric.MetricTypeHistogram:
+		dps := m.Histogram().DataPoints()
+		dps.RemoveIf(func(dp pmetric.HistogramDataPoint) bool { return check(dp.Timestamp(), dp.Attributes()) })
+		return dps.Len()
+	case pmetric.MetricTypeExponentialHistogram:
+		dps := m.ExponentialHistogram().DataPoints()
+		dps.RemoveIf(func(dp pmetric.ExponentialHistogramDataPoint) bool { return check(dp.Timestamp(), dp.Attributes()) })
+		return dps.Len()
+	case pmetric.MetricTypeSummary:
+		dps := m.Summary().DataPoints()
+		dps.RemoveIf(func(dp pmetric.SummaryDataPoint) bool { return check(dp.Timestamp(), dp.Attributes()) })
+		return dps.Len()
+	default:
+		// metrics without data points are kept as they are
+		return 1
+	}
+}
+
+func spanCount(rs ptrace.ResourceSpans) int {
+	count := 0
+	for i := 0; i < rs.ScopeSpans().Len(); i++ {
+		count += rs.ScopeSpans().At(i).Spans().Len()
+	}
+	return count
+}
+
+func logRecordCount(rl plog.ResourceLogs) int {
+	count := 0
+	for i := 0; i < rl.ScopeLogs().Len(); i++ {
+		count += rl.ScopeLogs().At(i).LogRecords().Len()
+	}
+	return count
+}
+
+func dataPointCount(rm pmetric.ResourceMetrics) int {
+	md := pmetric.NewMetrics()
+	rm.CopyTo(md.ResourceMetrics().AppendEmpty())
+	return md.DataPointCount()
+}
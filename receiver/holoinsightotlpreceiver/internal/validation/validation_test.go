@@ -0,0 +1,123 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+var now = time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestValidator() *Validator {
+	v := New(&Settings{
+		RequireServiceName:      true,
+		MaxFutureSkew:           time.Hour,
+		MaxAge:                  24 * time.Hour,
+		MaxAttributes:           3,
+		MaxAttributeValueLength: 8,
+	})
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func TestNilValidator(t *testing.T) {
+	var v *Validator = New(nil)
+	td := ptrace.NewTraces()
+	td.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	result := v.Traces(td)
+	assert.Equal(t, 0, result.Rejected)
+	assert.Equal(t, 1, td.SpanCount())
+}
+
+func TestTraces(t *testing.T) {
+	td := ptrace.NewTraces()
+	missing := td.ResourceSpans().AppendEmpty()
+	missing.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+
+	rs := td.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "svc")
+	spans := rs.ScopeSpans().AppendEmpty().Spans()
+	newSpan := func(start time.Time) ptrace.Span {
+		span := spans.AppendEmpty()
+		span.SetTraceID([16]byte{1})
+		span.SetSpanID([8]byte{1})
+		span.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+		return span
+	}
+	newSpan(now)
+	newSpan(now).SetTraceID(pcommon.NewTraceIDEmpty())
+	newSpan(now.Add(2 * time.Hour))
+	newSpan(now.Add(-48 * time.Hour))
+	newSpan(now).Attributes().PutStr("http.url", "https://example.com")
+
+	result := newTestValidator().Traces(td)
+	assert.Equal(t, 5, result.Rejected)
+	assert.Equal(t, 1, td.SpanCount())
+	assert.Equal(t, 1, td.ResourceSpans().Len())
+	assert.Equal(t, "5 rejected: 1 attribute value too long, 1 empty or invalid trace id, 1 missing service.name, "+
+		"1 timestamp too far in the future, 1 timestamp too far in the past", result.Message())
+
+	result.Refuse(1, errors.New("pipeline refused"))
+	assert.Equal(t, 6, result.Rejected)
+	assert.True(t, strings.Contains(result.Message(), "1 pipeline refused"))
+}
+
+func TestMetrics(t *testing.T) {
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr("service.name", "svc")
+	metrics := rm.ScopeMetrics().AppendEmpty().Metrics()
+	gauge := metrics.AppendEmpty().SetEmptyGauge()
+	gauge.DataPoints().AppendEmpty().SetTimestamp(pcommon.NewTimestampFromTime(now))
+	gauge.DataPoints().AppendEmpty().SetTimestamp(pcommon.NewTimestampFromTime(now.Add(2 * time.Hour)))
+	sum := metrics.AppendEmpty().SetEmptySum()
+	dp := sum.DataPoints().AppendEmpty()
+	dp.Attributes().PutStr("a", "1")
+	dp.Attributes().PutStr("b", "2")
+	dp.Attributes().PutStr("c", "3")
+	dp.Attributes().PutStr("d", "4")
+
+	result := newTestValidator().Metrics(md)
+	assert.Equal(t, 2, result.Rejected)
+	assert.Equal(t, 1, md.DataPointCount())
+	assert.Equal(t, 1, md.MetricCount())
+}
+
+func TestLogs(t *testing.T) {
+	ld := plog.NewLogs()
+	rl := ld.ResourceLogs().AppendEmpty()
+	rl.Resource().Attributes().PutStr("service.name", "svc")
+	records := rl.ScopeLogs().AppendEmpty().LogRecords()
+	records.AppendEmpty()
+	records.AppendEmpty().SetObservedTimestamp(pcommon.NewTimestampFromTime(now.Add(-48 * time.Hour)))
+
+	tooLong := ld.ResourceLogs().AppendEmpty()
+	tooLong.Resource().Attributes().PutStr("service.name", "a-very-long-service-name")
+	tooLong.ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+
+	result := newTestValidator().Logs(ld)
+	assert.Equal(t, 2, result.Rejected)
+	assert.Equal(t, 1, ld.LogRecordCount())
+	assert.Equal(t, "2 rejected: 1 attribute value too long, 1 timestamp too far in the past", result.Message())
+}
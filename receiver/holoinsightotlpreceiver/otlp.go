@@ -22,12 +22,18 @@ import (
 	"net/http"
 	"sync"
 
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 
+	"github.com/traas-stack/holoinsight-collector/internal/sharedgrpc"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
 	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/logs"
 	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/metrics"
 	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/trace"
+	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/validation"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/config/configgrpc"
 	"go.opentelemetry.io/collector/config/confighttp"
@@ -43,6 +49,7 @@ import (
 type otlpReceiver struct {
 	cfg        *Config
 	serverGRPC *grpc.Server
+	sharedGRPC *sharedgrpc.Handle
 	httpMux    *http.ServeMux
 	serverHTTP *http.Server
 
@@ -53,6 +60,9 @@ type otlpReceiver struct {
 
 	obsrepGRPC *obsreport.Receiver
 	obsrepHTTP *obsreport.Receiver
+	validator  *validation.Validator
+	limits     *tenantlimit.Gate
+	tenants    *tenantresolver.Gate
 
 	settings receiver.CreateSettings
 }
@@ -62,8 +72,11 @@ type otlpReceiver struct {
 // as the various Stop*Reception methods to end it.
 func newOtlpReceiver(cfg *Config, set receiver.CreateSettings) (*otlpReceiver, error) {
 	r := &otlpReceiver{
-		cfg:      cfg,
-		settings: set,
+		cfg:       cfg,
+		settings:  set,
+		validator: validation.New(cfg.Validation),
+		limits:    &tenantlimit.Gate{},
+		tenants:   &tenantresolver.Gate{},
 	}
 	if cfg.HTTP != nil {
 		r.httpMux = http.NewServeMux()
@@ -86,10 +99,39 @@ func newOtlpReceiver(cfg *Config, set receiver.CreateSettings) (*otlpReceiver, e
 	if err != nil {
 		return nil, err
 	}
+	if cfg.GRPC != nil && cfg.SharedGRPC {
+		r.sharedGRPC, err = sharedgrpc.Register(cfg.GRPC, set.TelemetrySettings, r.registerGRPCServices)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return r, nil
 }
 
+// grpcListener is the endpoint of the gRPC server, empty when the receiver doesn't serve gRPC.
+func (r *otlpReceiver) grpcListener() string {
+	if r.cfg.GRPC == nil {
+		return ""
+	}
+	return r.cfg.GRPC.NetAddr.Endpoint
+}
+
+// registerGRPCServices registers the OTLP services of the signals this receiver is created for.
+func (r *otlpReceiver) registerGRPCServices(server *grpc.Server) {
+	if r.tracesReceiver != nil {
+		ptraceotlp.RegisterGRPCServer(server, r.tracesReceiver)
+	}
+
+	if r.metricsReceiver != nil {
+		pmetricotlp.RegisterGRPCServer(server, r.metricsReceiver)
+	}
+
+	if r.logsReceiver != nil {
+		plogotlp.RegisterGRPCServer(server, r.logsReceiver)
+	}
+}
+
 func (r *otlpReceiver) startGRPCServer(cfg *configgrpc.GRPCServerSettings, host component.Host) error {
 	r.settings.Logger.Info("Starting GRPC server", zap.String("endpoint", cfg.NetAddr.Endpoint))
 
@@ -126,25 +168,18 @@ func (r *otlpReceiver) startHTTPServer(cfg *confighttp.HTTPServerSettings, host
 	return nil
 }
 
-func (r *otlpReceiver) startProtocolServers(host component.Host) error {
+func (r *otlpReceiver) startProtocolServers(ctx context.Context, host component.Host) error {
 	var err error
-	if r.cfg.GRPC != nil {
+	if r.sharedGRPC != nil {
+		if err = r.sharedGRPC.Start(ctx, host); err != nil {
+			return err
+		}
+	} else if r.cfg.GRPC != nil {
 		r.serverGRPC, err = r.cfg.GRPC.ToServer(host, r.settings.TelemetrySettings)
 		if err != nil {
 			return err
 		}
-
-		if r.tracesReceiver != nil {
-			ptraceotlp.RegisterGRPCServer(r.serverGRPC, r.tracesReceiver)
-		}
-
-		if r.metricsReceiver != nil {
-			pmetricotlp.RegisterGRPCServer(r.serverGRPC, r.metricsReceiver)
-		}
-
-		if r.logsReceiver != nil {
-			plogotlp.RegisterGRPCServer(r.serverGRPC, r.logsReceiver)
-		}
+		r.registerGRPCServices(r.serverGRPC)
 
 		err = r.startGRPCServer(r.cfg.GRPC, host)
 		if err != nil {
@@ -161,6 +196,11 @@ func (r *otlpReceiver) startProtocolServers(host component.Host) error {
 		if err != nil {
 			return err
 		}
+		r.serverHTTP.ConnContext = tenantauth.ConnContext
+		if r.cfg.TenantPath != nil {
+			r.serverHTTP.Handler = newTenantPathHandler(r.cfg.TenantPath, r.serverHTTP.Handler)
+		}
+		r.serverHTTP.Handler = tenantresolver.Handler(r.cfg.HTTP.Endpoint, r.serverHTTP.Handler)
 
 		err = r.startHTTPServer(r.cfg.HTTP, host)
 		if err != nil {
@@ -173,8 +213,14 @@ func (r *otlpReceiver) startProtocolServers(host component.Host) error {
 
 // Start runs the trace receiver on the gRPC server. Currently
 // it also enables the metrics receiver too.
-func (r *otlpReceiver) Start(_ context.Context, host component.Host) error {
-	return r.startProtocolServers(host)
+func (r *otlpReceiver) Start(ctx context.Context, host component.Host) error {
+	if err := r.limits.Resolve(host, r.cfg.Limiter); err != nil {
+		return err
+	}
+	if err := r.tenants.Resolve(host, r.cfg.TenantResolver); err != nil {
+		return err
+	}
+	return r.startProtocolServers(ctx, host)
 }
 
 // Shutdown is a method to turn off receiving.
@@ -189,6 +235,10 @@ func (r *otlpReceiver) Shutdown(ctx context.Context) error {
 		r.serverGRPC.GracefulStop()
 	}
 
+	if r.sharedGRPC != nil {
+		err = multierr.Append(err, r.sharedGRPC.Shutdown(ctx))
+	}
+
 	r.shutdownWG.Wait()
 	return err
 }
@@ -197,8 +247,8 @@ func (r *otlpReceiver) registerTraceConsumer(tc consumer.Traces) error {
 	if tc == nil {
 		return component.ErrNilNextConsumer
 	}
-	r.tracesReceiver = trace.New(tc, r.obsrepGRPC)
-	httpTracesReceiver := trace.New(tc, r.obsrepHTTP)
+	r.tracesReceiver = trace.New(tc, r.obsrepGRPC, r.validator, r.limits, r.tenants, r.grpcListener())
+	httpTracesReceiver := trace.New(tc, r.obsrepHTTP, r.validator, r.limits, r.tenants, "")
 	if r.httpMux != nil {
 		r.httpMux.HandleFunc("/v1/traces", func(resp http.ResponseWriter, req *http.Request) {
 			if req.Method != http.MethodPost {
@@ -222,8 +272,8 @@ func (r *otlpReceiver) registerMetricsConsumer(mc consumer.Metrics) error {
 	if mc == nil {
 		return component.ErrNilNextConsumer
 	}
-	r.metricsReceiver = metrics.New(mc, r.obsrepGRPC)
-	httpMetricsReceiver := metrics.New(mc, r.obsrepHTTP)
+	r.metricsReceiver = metrics.New(mc, r.obsrepGRPC, r.validator, r.limits, r.tenants, r.grpcListener())
+	httpMetricsReceiver := metrics.New(mc, r.obsrepHTTP, r.validator, r.limits, r.tenants, "")
 	if r.httpMux != nil {
 		r.httpMux.HandleFunc("/v1/metrics", func(resp http.ResponseWriter, req *http.Request) {
 			if req.Method != http.MethodPost {
@@ -247,8 +297,8 @@ func (r *otlpReceiver) registerLogsConsumer(lc consumer.Logs) error {
 	if lc == nil {
 		return component.ErrNilNextConsumer
 	}
-	r.logsReceiver = logs.New(lc, r.obsrepGRPC)
-	httpLogsReceiver := logs.New(lc, r.obsrepHTTP)
+	r.logsReceiver = logs.New(lc, r.obsrepGRPC, r.validator, r.limits, r.tenants, r.grpcListener())
+	httpLogsReceiver := logs.New(lc, r.obsrepHTTP, r.validator, r.limits, r.tenants, "")
 	if r.httpMux != nil {
 		r.httpMux.HandleFunc("/v1/logs", func(resp http.ResponseWriter, req *http.Request) {
 			if req.Method != http.MethodPost {
@@ -37,23 +37,30 @@ import (
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 
+	"go.opentelemetry.io/collector/client"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config/configauth"
 	"go.opentelemetry.io/collector/config/configgrpc"
 	"go.opentelemetry.io/collector/config/confighttp"
 	"go.opentelemetry.io/collector/config/confignet"
 	"go.opentelemetry.io/collector/config/configtelemetry"
 	"go.opentelemetry.io/collector/config/configtls"
 	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/consumer/consumertest"
-	"go.opentelemetry.io/collector/internal/testdata"
-	"go.opentelemetry.io/collector/internal/testutil"
+	"go.opentelemetry.io/collector/extension/auth"
 	"go.opentelemetry.io/collector/obsreport/obsreporttest"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/pdata/ptrace"
 	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
 	"go.opentelemetry.io/collector/receiver"
 	"go.opentelemetry.io/collector/receiver/receivertest"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/validation"
 	semconv "go.opentelemetry.io/collector/semconv/v1.5.0"
 )
 
@@ -116,6 +123,8 @@ var traceOtlp = func() ptrace.Traces {
 	td := ptrace.NewTraces()
 	rs := td.ResourceSpans().AppendEmpty()
 	rs.Resource().Attributes().PutStr(semconv.AttributeHostName, "testHost")
+	rs.Resource().Attributes().PutStr("tenant", "")
+	rs.Resource().Attributes().PutStr("service.instance.name", "testHost")
 	spans := rs.ScopeSpans().AppendEmpty().Spans()
 	span1 := spans.AppendEmpty()
 	span1.SetTraceID([16]byte{0x5B, 0x8E, 0xFF, 0xF7, 0x98, 0x3, 0x81, 0x3, 0xD2, 0x69, 0xB6, 0x33, 0x81, 0x3F, 0xC6, 0xC})
@@ -162,7 +171,7 @@ func TestJsonHttp(t *testing.T) {
 			err:      status.New(codes.Internal, "").Err(),
 		},
 	}
-	addr := testutil.GetAvailableLocalAddress(t)
+	addr := getAvailableLocalAddress(t)
 
 	// Set the buffer count to 1 to make it flush the test span immediately.
 	sink := &errOrSinkConsumer{TracesSink: new(consumertest.TracesSink)}
@@ -185,7 +194,7 @@ func TestJsonHttp(t *testing.T) {
 }
 
 func TestHandleInvalidRequests(t *testing.T) {
-	endpoint := testutil.GetAvailableLocalAddress(t)
+	endpoint := getAvailableLocalAddress(t)
 	cfg := &Config{
 		Protocols: Protocols{HTTP: &confighttp.HTTPServerSettings{Endpoint: endpoint}},
 	}
@@ -407,7 +416,7 @@ func TestProtoHttp(t *testing.T) {
 			err:      status.New(codes.Internal, "").Err(),
 		},
 	}
-	addr := testutil.GetAvailableLocalAddress(t)
+	addr := getAvailableLocalAddress(t)
 
 	// Set the buffer count to 1 to make it flush the test span immediately.
 	tSink := &errOrSinkConsumer{TracesSink: new(consumertest.TracesSink)}
@@ -420,7 +429,7 @@ func TestProtoHttp(t *testing.T) {
 	// Wait for the servers to start
 	<-time.After(10 * time.Millisecond)
 
-	td := testdata.GenerateTraces(1)
+	td := generateTestTraces(1)
 	marshaler := &ptrace.ProtoMarshaler{}
 	traceBytes, err := marshaler.MarshalTraces(td)
 	require.NoError(t, err)
@@ -488,7 +497,7 @@ func testHTTPProtobufRequest(
 		assert.NoError(t, tr.UnmarshalProto(respBytes), "Unable to unmarshal response to Response")
 
 		require.Len(t, allTraces, 1)
-		assert.EqualValues(t, allTraces[0], wantData)
+		assert.EqualValues(t, allTraces[0], withTenant(wantData, ""))
 	} else {
 		errStatus := &spb.Status{}
 		assert.NoError(t, proto.Unmarshal(respBytes, errStatus))
@@ -537,7 +546,7 @@ func TestOTLPReceiverInvalidContentEncoding(t *testing.T) {
 			status: 400,
 		},
 	}
-	addr := testutil.GetAvailableLocalAddress(t)
+	addr := getAvailableLocalAddress(t)
 
 	// Set the buffer count to 1 to make it flush the test span immediately.
 	tSink := new(consumertest.TracesSink)
@@ -580,7 +589,7 @@ func TestOTLPReceiverInvalidContentEncoding(t *testing.T) {
 }
 
 func TestGRPCNewPortAlreadyUsed(t *testing.T) {
-	addr := testutil.GetAvailableLocalAddress(t)
+	addr := getAvailableLocalAddress(t)
 	ln, err := net.Listen("tcp", addr)
 	require.NoError(t, err, "failed to listen on %q: %v", addr, err)
 	t.Cleanup(func() {
@@ -594,7 +603,7 @@ func TestGRPCNewPortAlreadyUsed(t *testing.T) {
 }
 
 func TestHTTPNewPortAlreadyUsed(t *testing.T) {
-	addr := testutil.GetAvailableLocalAddress(t)
+	addr := getAvailableLocalAddress(t)
 	ln, err := net.Listen("tcp", addr)
 	require.NoError(t, err, "failed to listen on %q: %v", addr, err)
 	t.Cleanup(func() {
@@ -636,8 +645,8 @@ func TestOTLPReceiverGRPCTracesIngestTest(t *testing.T) {
 		},
 	}
 
-	addr := testutil.GetAvailableLocalAddress(t)
-	td := testdata.GenerateTraces(1)
+	addr := getAvailableLocalAddress(t)
+	td := generateTestTraces(1)
 
 	tt, err := obsreporttest.SetupTelemetry(otlpReceiverID)
 	require.NoError(t, err)
@@ -703,8 +712,8 @@ func TestOTLPReceiverHTTPTracesIngestTest(t *testing.T) {
 		},
 	}
 
-	addr := testutil.GetAvailableLocalAddress(t)
-	td := testdata.GenerateTraces(1)
+	addr := getAvailableLocalAddress(t)
+	td := generateTestTraces(1)
 
 	tt, err := obsreporttest.SetupTelemetry(otlpReceiverID)
 	require.NoError(t, err)
@@ -757,7 +766,7 @@ func TestGRPCInvalidTLSCredentials(t *testing.T) {
 		Protocols: Protocols{
 			GRPC: &configgrpc.GRPCServerSettings{
 				NetAddr: confignet.NetAddr{
-					Endpoint:  testutil.GetAvailableLocalAddress(t),
+					Endpoint:  getAvailableLocalAddress(t),
 					Transport: "tcp",
 				},
 				TLSSetting: &configtls.TLSServerSetting{
@@ -783,7 +792,7 @@ func TestGRPCInvalidTLSCredentials(t *testing.T) {
 }
 
 func TestGRPCMaxRecvSize(t *testing.T) {
-	addr := testutil.GetAvailableLocalAddress(t)
+	addr := getAvailableLocalAddress(t)
 	sink := new(consumertest.TracesSink)
 
 	factory := NewFactory()
@@ -798,7 +807,7 @@ func TestGRPCMaxRecvSize(t *testing.T) {
 	cc, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
 	require.NoError(t, err)
 
-	td := testdata.GenerateTraces(50000)
+	td := generateTestTraces(50000)
 	require.Error(t, exportTraces(cc, td))
 	assert.NoError(t, cc.Close())
 	require.NoError(t, ocr.Shutdown(context.Background()))
@@ -816,17 +825,17 @@ func TestGRPCMaxRecvSize(t *testing.T) {
 		assert.NoError(t, cc.Close())
 	}()
 
-	td = testdata.GenerateTraces(50000)
+	td = generateTestTraces(50000)
 	require.NoError(t, exportTraces(cc, td))
 	require.Len(t, sink.AllTraces(), 1)
-	assert.Equal(t, td, sink.AllTraces()[0])
+	assert.Equal(t, withTenant(td, ""), sink.AllTraces()[0])
 }
 
 func TestHTTPInvalidTLSCredentials(t *testing.T) {
 	cfg := &Config{
 		Protocols: Protocols{
 			HTTP: &confighttp.HTTPServerSettings{
-				Endpoint: testutil.GetAvailableLocalAddress(t),
+				Endpoint: getAvailableLocalAddress(t),
 				TLSSetting: &configtls.TLSServerSetting{
 					TLSSetting: configtls.TLSSetting{
 						CertFile: "willfail",
@@ -849,7 +858,7 @@ func TestHTTPInvalidTLSCredentials(t *testing.T) {
 }
 
 func testHTTPMaxRequestBodySizeJSON(t *testing.T, payload []byte, size int, expectedStatusCode int) {
-	endpoint := testutil.GetAvailableLocalAddress(t)
+	endpoint := getAvailableLocalAddress(t)
 	url := fmt.Sprintf("http://%s/v1/traces", endpoint)
 	cfg := &Config{
 		Protocols: Protocols{
@@ -941,8 +950,8 @@ func compressGzip(body []byte) (*bytes.Buffer, error) {
 type senderFunc func(td ptrace.Traces)
 
 func TestShutdown(t *testing.T) {
-	endpointGrpc := testutil.GetAvailableLocalAddress(t)
-	endpointHTTP := testutil.GetAvailableLocalAddress(t)
+	endpointGrpc := getAvailableLocalAddress(t)
+	endpointHTTP := getAvailableLocalAddress(t)
 
 	nextSink := new(consumertest.TracesSink)
 
@@ -1031,12 +1040,12 @@ loop:
 			break loop
 		default:
 		}
-		senderFn(testdata.GenerateTraces(1))
+		senderFn(generateTestTraces(1))
 	}
 
 	// After getting the signal to stop, send one more span and then
 	// finally stop. We should never receive this last span.
-	senderFn(testdata.GenerateTraces(1))
+	senderFn(generateTestTraces(1))
 
 	// Indicate that we are done.
 	close(doneSignal)
@@ -1105,3 +1114,251 @@ func (esc *errOrSinkConsumer) Reset() {
 		esc.MetricsSink.Reset()
 	}
 }
+
+func TestOTLPReceiverPartialSuccess(t *testing.T) {
+	addr := getAvailableLocalAddress(t)
+	tt, err := obsreporttest.SetupTelemetry(otlpReceiverID)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, tt.Shutdown(context.Background())) })
+
+	sink := &errOrSinkConsumer{TracesSink: new(consumertest.TracesSink)}
+
+	factory := NewFactory()
+	cfg := factory.CreateDefaultConfig().(*Config)
+	cfg.GRPC.NetAddr.Endpoint = addr
+	cfg.HTTP = nil
+	cfg.Validation = &validation.Settings{RequireServiceName: true}
+	ocr := newReceiver(t, factory, cfg, otlpReceiverID, sink, nil)
+	require.NoError(t, ocr.Start(context.Background(), componenttest.NewNopHost()))
+	t.Cleanup(func() { require.NoError(t, ocr.Shutdown(context.Background())) })
+
+	cc, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, cc.Close())
+	}()
+	acc := ptraceotlp.NewGRPCClient(cc)
+
+	td := generateTestTraces(2)
+	valid := td.ResourceSpans().AppendEmpty()
+	valid.Resource().Attributes().PutStr("service.name", "svc")
+	generateTestTraces(1).ResourceSpans().At(0).ScopeSpans().CopyTo(valid.ScopeSpans())
+
+	resp, err := acc.Export(context.Background(), ptraceotlp.NewExportRequestFromTraces(td))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), resp.PartialSuccess().RejectedSpans())
+	assert.Equal(t, "2 rejected: 2 missing service.name", resp.PartialSuccess().ErrorMessage())
+	require.Len(t, sink.AllTraces(), 1)
+	assert.Equal(t, 1, sink.AllTraces()[0].SpanCount())
+
+	sink.Reset()
+	sink.SetConsumeError(consumererror.NewPermanent(errors.New("refused")))
+	resp, err = acc.Export(context.Background(), ptraceotlp.NewExportRequestFromTraces(td))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), resp.PartialSuccess().RejectedSpans())
+	assert.Equal(t, "3 rejected: 1 Permanent error: refused, 2 missing service.name", resp.PartialSuccess().ErrorMessage())
+
+	// the invalid spans are refused in the receiver metrics, like the ones the pipeline refused
+	require.NoError(t, tt.CheckReceiverTraces("grpc", 1, 5))
+}
+
+type signalAuthData []string
+
+func (a signalAuthData) GetAttribute(name string) interface{} {
+	if name == tenantauth.AttributeSignals {
+		return []string(a)
+	}
+	return "tenant-1"
+}
+
+func (a signalAuthData) GetAttributeNames() []string {
+	return []string{tenantauth.AttributeTenant, tenantauth.AttributeSignals}
+}
+
+func TestOTLPReceiverSignalPermissions(t *testing.T) {
+	authID := component.NewID("test_auth")
+	host := &authHost{
+		Host: componenttest.NewNopHost(),
+		extensions: map[component.ID]component.Component{
+			authID: auth.NewServer(auth.WithServerAuthenticate(func(ctx context.Context, _ map[string][]string) (context.Context, error) {
+				cl := client.FromContext(ctx)
+				cl.Auth = signalAuthData{tenantauth.SignalMetrics}
+				return client.NewContext(ctx, cl), nil
+			})),
+		},
+	}
+
+	grpcAddr := getAvailableLocalAddress(t)
+	httpAddr := getAvailableLocalAddress(t)
+	factory := NewFactory()
+	cfg := factory.CreateDefaultConfig().(*Config)
+	cfg.GRPC.NetAddr.Endpoint = grpcAddr
+	cfg.GRPC.Auth = &configauth.Authentication{AuthenticatorID: authID}
+	cfg.HTTP.Endpoint = httpAddr
+	cfg.HTTP.Auth = &configauth.Authentication{AuthenticatorID: authID}
+
+	traceSink := new(consumertest.TracesSink)
+	metricsSink := new(consumertest.MetricsSink)
+	r := newReceiver(t, factory, cfg, otlpReceiverID, traceSink, metricsSink)
+	require.NoError(t, r.Start(context.Background(), host))
+	t.Cleanup(func() { require.NoError(t, r.Shutdown(context.Background())) })
+
+	cc, err := grpc.Dial(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, cc.Close())
+	}()
+	err = exportTraces(cc, generateTestTraces(1))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	traces, err := (&ptrace.ProtoMarshaler{}).MarshalTraces(generateTestTraces(1))
+	require.NoError(t, err)
+	resp, err := http.Post(fmt.Sprintf("http://%s/v1/traces", httpAddr), pbContentType, bytes.NewReader(traces))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Len(t, traceSink.AllTraces(), 0)
+
+	md := pmetric.NewMetrics()
+	gauge := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	gauge.SetName("gauge")
+	gauge.SetEmptyGauge().DataPoints().AppendEmpty().SetIntValue(1)
+	metrics, err := (&pmetric.ProtoMarshaler{}).MarshalMetrics(md)
+	require.NoError(t, err)
+	resp, err = http.Post(fmt.Sprintf("http://%s/v1/metrics", httpAddr), pbContentType, bytes.NewReader(metrics))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, metricsSink.AllMetrics(), 1)
+}
+
+// tracesLimiter throttles every trace request.
+type tracesLimiter struct {
+	component.StartFunc
+	component.ShutdownFunc
+}
+
+func (tracesLimiter) Admit(_ context.Context, tenant, signal string, _, _ int) error {
+	if signal != tenantauth.SignalTraces {
+		return nil
+	}
+	return &tenantlimit.ThrottledError{Tenant: tenant, Signal: signal, Reason: tenantlimit.ReasonRate, RetryAfter: 1500 * time.Millisecond}
+}
+
+func TestOTLPReceiverTenantLimits(t *testing.T) {
+	limiterID := component.NewID("test_limiter")
+	host := &authHost{
+		Host:       componenttest.NewNopHost(),
+		extensions: map[component.ID]component.Component{limiterID: tracesLimiter{}},
+	}
+
+	grpcAddr := getAvailableLocalAddress(t)
+	httpAddr := getAvailableLocalAddress(t)
+	factory := NewFactory()
+	cfg := factory.CreateDefaultConfig().(*Config)
+	cfg.GRPC.NetAddr.Endpoint = grpcAddr
+	cfg.HTTP.Endpoint = httpAddr
+	cfg.Limiter = &limiterID
+
+	tt, err := obsreporttest.SetupTelemetry(otlpReceiverID)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, tt.Shutdown(context.Background())) })
+
+	traceSink := new(consumertest.TracesSink)
+	metricsSink := new(consumertest.MetricsSink)
+	r := newReceiver(t, factory, cfg, otlpReceiverID, traceSink, metricsSink)
+	require.NoError(t, r.Start(context.Background(), host))
+	t.Cleanup(func() { require.NoError(t, r.Shutdown(context.Background())) })
+
+	cc, err := grpc.Dial(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, cc.Close())
+	}()
+	err = exportTraces(cc, generateTestTraces(1))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	retryAfter, ok := tenantlimit.RetryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, retryAfter)
+
+	traces, err := (&ptrace.ProtoMarshaler{}).MarshalTraces(generateTestTraces(1))
+	require.NoError(t, err)
+	resp, err := http.Post(fmt.Sprintf("http://%s/v1/traces", httpAddr), pbContentType, bytes.NewReader(traces))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+	assert.Len(t, traceSink.AllTraces(), 0)
+	// the throttled spans are refused in the receiver metrics
+	require.NoError(t, tt.CheckReceiverTraces("grpc", 0, 1))
+	require.NoError(t, tt.CheckReceiverTraces("http", 0, 1))
+
+	md := pmetric.NewMetrics()
+	gauge := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	gauge.SetName("gauge")
+	gauge.SetEmptyGauge().DataPoints().AppendEmpty().SetIntValue(1)
+	metrics, err := (&pmetric.ProtoMarshaler{}).MarshalMetrics(md)
+	require.NoError(t, err)
+	resp, err = http.Post(fmt.Sprintf("http://%s/v1/metrics", httpAddr), pbContentType, bytes.NewReader(metrics))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, metricsSink.AllMetrics(), 1)
+}
+
+// pathResolver resolves the tenant with a static mapping of the paths.
+type pathResolver struct {
+	component.StartFunc
+	component.ShutdownFunc
+	*tenantresolver.Chain
+}
+
+func TestOTLPReceiverTenantResolver(t *testing.T) {
+	chain, err := tenantresolver.NewChain("tenant.id", []tenantresolver.SourceSettings{
+		{Type: tenantresolver.SourceStatic, Paths: map[string]string{
+			"/v1/traces": "http-tenant",
+			"/opentelemetry.proto.collector.trace.v1.TraceService/": "grpc-tenant",
+		}},
+	})
+	require.NoError(t, err)
+	resolverID := component.NewID("test_resolver")
+	host := &authHost{
+		Host:       componenttest.NewNopHost(),
+		extensions: map[component.ID]component.Component{resolverID: pathResolver{Chain: chain}},
+	}
+
+	grpcAddr := getAvailableLocalAddress(t)
+	httpAddr := getAvailableLocalAddress(t)
+	factory := NewFactory()
+	cfg := factory.CreateDefaultConfig().(*Config)
+	cfg.GRPC.NetAddr.Endpoint = grpcAddr
+	cfg.HTTP.Endpoint = httpAddr
+	cfg.TenantResolver = &resolverID
+
+	traceSink := new(consumertest.TracesSink)
+	r := newReceiver(t, factory, cfg, otlpReceiverID, traceSink, nil)
+	require.NoError(t, r.Start(context.Background(), host))
+	t.Cleanup(func() { require.NoError(t, r.Shutdown(context.Background())) })
+
+	cc, err := grpc.Dial(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, cc.Close())
+	}()
+	require.NoError(t, exportTraces(cc, generateTestTraces(1)))
+
+	traces, err := (&ptrace.ProtoMarshaler{}).MarshalTraces(generateTestTraces(1))
+	require.NoError(t, err)
+	resp, err := http.Post(fmt.Sprintf("http://%s/v1/traces", httpAddr), pbContentType, bytes.NewReader(traces))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	received := traceSink.AllTraces()
+	require.Len(t, received, 2)
+	for i, want := range []string{"grpc-tenant", "http-tenant"} {
+		tenant, ok := received[i].ResourceSpans().At(0).Resource().Attributes().Get("tenant.id")
+		require.True(t, ok)
+		assert.Equal(t, want, tenant.Str())
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
 	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/logs"
 	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/metrics"
 	"github.com/traas-stack/holoinsight-collector/receiver/holoinsightotlpreceiver/internal/trace"
@@ -32,6 +33,12 @@ var fallbackMsg = []byte(`{"code": 13, "message": "failed to marshal error messa
 
 const fallbackContentType = "application/json"
 
+// httpStatusCodes maps the gRPC codes the receivers return to the HTTP status codes of OTLP/HTTP.
+var httpStatusCodes = map[codes.Code]int{
+	codes.PermissionDenied:  http.StatusForbidden,
+	codes.ResourceExhausted: http.StatusTooManyRequests,
+}
+
 func handleTraces(resp http.ResponseWriter, req *http.Request, tracesReceiver *trace.Receiver, encoder encoder) {
 	body, ok := readAndCloseBody(resp, req, encoder)
 	if !ok {
@@ -128,6 +135,11 @@ func writeError(w http.ResponseWriter, encoder encoder, err error, statusCode in
 	s, ok := status.FromError(err)
 	if !ok {
 		s = errorMsgToStatus(err.Error(), statusCode)
+	} else if code, mapped := httpStatusCodes[s.Code()]; mapped {
+		statusCode = code
+	}
+	if retryAfter, throttled := tenantlimit.RetryAfter(err); throttled {
+		tenantlimit.SetRetryAfter(w.Header(), retryAfter)
 	}
 	writeStatusResponse(w, encoder, statusCode, s.Proto())
 }
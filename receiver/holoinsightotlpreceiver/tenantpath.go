@@ -0,0 +1,144 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightotlpreceiver // import "go.opentelemetry.io/collector/receiver/otlpreceiver"
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	apikeyPlaceholder   = "{apikey}"
+	defaultPathTemplate = "/" + apikeyPlaceholder
+	defaultApikeyHeader = "authentication"
+)
+
+var otlpHTTPPaths = map[string]bool{
+	"/v1/traces":  true,
+	"/v1/metrics": true,
+	"/v1/logs":    true,
+}
+
+// TenantPathSettings serves the OTLP/HTTP endpoints below a URL prefix carrying the apikey,
+// e.g. /{apikey}/v1/traces, for clients which can't send custom headers.
+type TenantPathSettings struct {
+	// PathTemplate is the URL prefix of the OTLP paths, it must contain the {apikey} placeholder
+	// as a whole path segment. Default: /{apikey}
+	PathTemplate string `mapstructure:"path_template"`
+	// Header is the header the apikey taken from the path is handed to the authenticator in.
+	// Default: authentication
+	Header string `mapstructure:"header"`
+}
+
+// Validate checks the path template is usable.
+func (s *TenantPathSettings) Validate() error {
+	template := s.pathTemplate()
+	if !strings.HasPrefix(template, "/") {
+		return fmt.Errorf("tenant path template %q must start with /", template)
+	}
+	if strings.Count(template, apikeyPlaceholder) != 1 {
+		return fmt.Errorf("tenant path template %q must contain %s exactly once", template, apikeyPlaceholder)
+	}
+	prefix, suffix, _ := strings.Cut(template, apikeyPlaceholder)
+	if !strings.HasSuffix(prefix, "/") || (suffix != "" && !strings.HasPrefix(suffix, "/")) {
+		return fmt.Errorf("tenant path template %q must use %s as a whole path segment", template, apikeyPlaceholder)
+	}
+	if strings.HasSuffix(suffix, "/") {
+		return fmt.Errorf("tenant path template %q must not end with /", template)
+	}
+	return nil
+}
+
+func (s *TenantPathSettings) pathTemplate() string {
+	if s.PathTemplate == "" {
+		return defaultPathTemplate
+	}
+	return s.PathTemplate
+}
+
+func (s *TenantPathSettings) header() string {
+	if s.Header == "" {
+		return defaultApikeyHeader
+	}
+	return s.Header
+}
+
+// tenantPathHandler rewrites /{apikey}/v1/* requests into /v1/* requests carrying the apikey header,
+// so they go through the authenticator exactly like requests sending the header themselves.
+// Any other request is passed through unchanged.
+type tenantPathHandler struct {
+	prefix string
+	suffix string
+	header string
+	next   http.Handler
+}
+
+func newTenantPathHandler(settings *TenantPathSettings, next http.Handler) http.Handler {
+	prefix, suffix, _ := strings.Cut(settings.pathTemplate(), apikeyPlaceholder)
+	return &tenantPathHandler{
+		prefix: prefix,
+		suffix: suffix,
+		header: settings.header(),
+		next:   next,
+	}
+}
+
+func (h *tenantPathHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	apikey, path, ok := h.match(r.URL.EscapedPath())
+	if !ok {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	// same response as a request rejected by the authenticator
+	if apikey == "" {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	req := r.Clone(r.Context())
+	// the apikey must not leak into the path seen by the handlers and the server spans
+	req.URL.Path = path
+	req.URL.RawPath = ""
+	req.RequestURI = req.URL.RequestURI()
+	req.Header.Set(h.header, apikey)
+	h.next.ServeHTTP(w, req)
+}
+
+// match extracts the apikey and the OTLP path from an escaped tenant-scoped request path,
+// so apikeys containing an escaped "/" stay a single path segment.
+func (h *tenantPathHandler) match(path string) (apikey string, otlpPath string, ok bool) {
+	if !strings.HasPrefix(path, h.prefix) {
+		return "", "", false
+	}
+	rest := path[len(h.prefix):]
+	idx := strings.IndexByte(rest, '/')
+	if idx < 0 {
+		return "", "", false
+	}
+	apikey, rest = rest[:idx], rest[idx:]
+	if !strings.HasPrefix(rest, h.suffix) {
+		return "", "", false
+	}
+	otlpPath = rest[len(h.suffix):]
+	if !otlpHTTPPaths[otlpPath] {
+		return "", "", false
+	}
+	if apikey, err := url.PathUnescape(apikey); err == nil {
+		return apikey, otlpPath, true
+	}
+	return "", otlpPath, true
+}
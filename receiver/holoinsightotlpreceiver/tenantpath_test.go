@@ -0,0 +1,169 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package holoinsightotlpreceiver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/client"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config/configauth"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/extension/auth"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestTenantPathSettingsValidate(t *testing.T) {
+	for _, tc := range []struct {
+		template string
+		err      bool
+	}{
+		{template: ""},
+		{template: "/{apikey}"},
+		{template: "/tenants/{apikey}/otlp"},
+		{template: "{apikey}", err: true},
+		{template: "/tenants", err: true},
+		{template: "/{apikey}/{apikey}", err: true},
+		{template: "/key-{apikey}", err: true},
+		{template: "/{apikey}/", err: true},
+	} {
+		t.Run(tc.template, func(t *testing.T) {
+			err := (&TenantPathSettings{PathTemplate: tc.template}).Validate()
+			if tc.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestTenantPathHandler(t *testing.T) {
+	var gotPath, gotApikey string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotApikey = r.URL.Path, r.Header.Get("authentication")
+	})
+	handler := newTenantPathHandler(&TenantPathSettings{PathTemplate: "/tenants/{apikey}/otlp"}, next)
+
+	for _, tc := range []struct {
+		path       string
+		wantPath   string
+		wantApikey string
+		wantStatus int
+	}{
+		{path: "/tenants/key-1/otlp/v1/traces", wantPath: "/v1/traces", wantApikey: "key-1", wantStatus: http.StatusOK},
+		{path: "/tenants/key%2F1/otlp/v1/logs", wantPath: "/v1/logs", wantApikey: "key/1", wantStatus: http.StatusOK},
+		{path: "/tenants/key-1/otlp/v1/metrics", wantPath: "/v1/metrics", wantApikey: "key-1", wantStatus: http.StatusOK},
+		{path: "/v1/traces", wantPath: "/v1/traces", wantStatus: http.StatusOK},
+		{path: "/tenants/key-1/otlp/v2/traces", wantPath: "/tenants/key-1/otlp/v2/traces", wantStatus: http.StatusOK},
+		{path: "/tenants//otlp/v1/traces", wantStatus: http.StatusUnauthorized},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			gotPath, gotApikey = "", ""
+			req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+			assert.Equal(t, tc.wantStatus, resp.Code)
+			assert.Equal(t, tc.wantApikey, gotApikey)
+			if tc.wantStatus == http.StatusOK {
+				assert.Equal(t, tc.wantPath, gotPath)
+			}
+		})
+	}
+}
+
+type tenantAuthData string
+
+func (a tenantAuthData) GetAttribute(string) interface{} {
+	return string(a)
+}
+
+func (a tenantAuthData) GetAttributeNames() []string {
+	return []string{"tenant"}
+}
+
+type authHost struct {
+	component.Host
+	extensions map[component.ID]component.Component
+}
+
+func (h *authHost) GetExtensions() map[component.ID]component.Component {
+	return h.extensions
+}
+
+func TestTenantPathReceiver(t *testing.T) {
+	authID := component.NewID("test_auth")
+	host := &authHost{
+		Host: componenttest.NewNopHost(),
+		extensions: map[component.ID]component.Component{
+			authID: auth.NewServer(auth.WithServerAuthenticate(func(ctx context.Context, headers map[string][]string) (context.Context, error) {
+				if vs := headers["Authentication"]; len(vs) > 0 && vs[0] == "valid-key" {
+					cl := client.FromContext(ctx)
+					cl.Auth = tenantAuthData("tenant-1")
+					return client.NewContext(ctx, cl), nil
+				}
+				return ctx, errors.New("invalid apikey")
+			})),
+		},
+	}
+
+	addr := getAvailableLocalAddress(t)
+	factory := NewFactory()
+	cfg := factory.CreateDefaultConfig().(*Config)
+	cfg.GRPC = nil
+	cfg.HTTP.Endpoint = addr
+	cfg.HTTP.Auth = &configauth.Authentication{AuthenticatorID: authID}
+	cfg.TenantPath = &TenantPathSettings{}
+	require.NoError(t, component.ValidateConfig(cfg))
+
+	sink := new(consumertest.TracesSink)
+	r := newReceiver(t, factory, cfg, otlpReceiverID, sink, nil)
+	require.NoError(t, r.Start(context.Background(), host))
+	t.Cleanup(func() { require.NoError(t, r.Shutdown(context.Background())) })
+
+	td := generateTestTraces(1)
+	body, err := (&ptrace.ProtoMarshaler{}).MarshalTraces(td)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		path       string
+		wantStatus int
+	}{
+		{path: "/valid-key/v1/traces", wantStatus: http.StatusOK},
+		{path: "/invalid-key/v1/traces", wantStatus: http.StatusUnauthorized},
+		{path: "/v1/traces", wantStatus: http.StatusUnauthorized},
+	} {
+		sink.Reset()
+		resp, err := http.Post(fmt.Sprintf("http://%s%s", addr, tc.path), pbContentType, bytes.NewReader(body))
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, tc.wantStatus, resp.StatusCode, tc.path)
+		if tc.wantStatus == http.StatusOK {
+			require.Len(t, sink.AllTraces(), 1)
+			assert.Equal(t, withTenant(td, "tenant-1"), sink.AllTraces()[0])
+		} else {
+			assert.Len(t, sink.AllTraces(), 0)
+		}
+	}
+}
@@ -38,6 +38,14 @@ type Protocols struct {
 type Config struct {
 	Protocols         `mapstructure:"protocols"`
 	HoloinsightServer Protocols `mapstructure:"holoinsight_server"` // holoinsight HoloinsightServer endpoint, get agent configurations for FetchConfigurations
+	// SharedGRPC serves the collector gRPC services on the gRPC server shared with the other receivers
+	// configured with the same gRPC endpoint, e.g. holoinsight_otlp.
+	SharedGRPC bool `mapstructure:"shared_grpc"`
+	// Limiter is the tenant limiter extension throttling the data of each tenant, e.g. holoinsight_tenant_limiter.
+	Limiter *component.ID `mapstructure:"limiter"`
+	// TenantResolver is the tenant resolver extension stamping the tenant of the data, e.g. holoinsight_tenant_resolver.
+	// The built-in sources are used when not set.
+	TenantResolver *component.ID `mapstructure:"tenant_resolver"`
 }
 
 var _ component.Config = (*Config)(nil)
@@ -49,13 +57,17 @@ func (cfg *Config) Validate() error {
 		return fmt.Errorf("must specify at least one protocol when using the Skywalking receiver")
 	}
 
-	if cfg.GRPC != nil {
+	if cfg.GRPC != nil && cfg.GRPC.NetAddr.Transport != "unix" {
 		var err error
 		if _, err = extractPortFromEndpoint(cfg.GRPC.NetAddr.Endpoint); err != nil {
 			return fmt.Errorf("unable to extract port for the gRPC endpoint: %w", err)
 		}
 	}
 
+	if cfg.SharedGRPC && cfg.GRPC == nil {
+		return fmt.Errorf("shared_grpc requires the grpc protocol")
+	}
+
 	if cfg.HTTP != nil {
 		if _, err := extractPortFromEndpoint(cfg.HTTP.Endpoint); err != nil {
 			return fmt.Errorf("unable to extract port for the HTTP endpoint: %w", err)
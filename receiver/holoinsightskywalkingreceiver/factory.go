@@ -90,14 +90,11 @@ func (f *skywalkingReceiverFactory) getReceiver(set receiver.CreateSettings, cfg
 		// that Skywalking receiver understands.
 		rCfg := cfg.(*Config)
 
-		var c configuration
+		c := configuration{Limiter: rCfg.Limiter, TenantResolver: rCfg.TenantResolver}
 		// Set ports
 		if rCfg.Protocols.GRPC != nil {
-			c.CollectorGRPCServerSettings = *rCfg.Protocols.GRPC
-			if c.CollectorGRPCPort, err = extractPortFromEndpoint(rCfg.Protocols.GRPC.NetAddr.Endpoint); err != nil {
-				err = fmt.Errorf("unable to extract port for the gRPC endpoint: %w", err)
-				return nil
-			}
+			c.CollectorGRPCServerSettings = rCfg.Protocols.GRPC
+			c.SharedGRPC = rCfg.SharedGRPC
 		}
 
 		if rCfg.Protocols.HTTP != nil {
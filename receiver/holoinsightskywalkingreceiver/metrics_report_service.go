@@ -16,7 +16,14 @@ package holoinsightskywalkingreceiver // import "github.com/open-telemetry/opent
 
 import (
 	"context"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
 	"go.opentelemetry.io/collector/pdata/pmetric"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 	common "skywalking.apache.org/repo/goapi/collect/common/v3"
 	agent "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
 )
@@ -27,9 +34,19 @@ type metricsReportService struct {
 }
 
 func (s *metricsReportService) Collect(ctx context.Context, jvmMetric *agent.JVMMetricCollection) (*common.Commands, error) {
+	if !tenantauth.SignalAllowed(ctx, tenantauth.SignalMetrics) {
+		return nil, status.Error(codes.PermissionDenied, "metrics are not enabled for the tenant")
+	}
 	rs := SkywalkingToMetrics(jvmMetric)
+	tenant := s.sr.tenants.Stamp(ctx, tenantresolver.RequestOf(ctx, s.sr.grpcListener()), rs.Resource().Attributes())
 	md := pmetric.NewMetrics()
 	rs.MoveTo(md.ResourceMetrics().AppendEmpty())
+	if err := s.sr.limits.Admit(ctx, tenant, tenantauth.SignalMetrics, md.DataPointCount(), proto.Size(jvmMetric)); err != nil {
+		// throttled data points are refused, like the ones the pipeline refuses
+		obsCtx := s.sr.grpcObsrecv.StartMetricsOp(ctx)
+		s.sr.grpcObsrecv.EndMetricsOp(obsCtx, protobufFormat, md.DataPointCount(), err)
+		return nil, tenantlimit.GRPCError(err)
+	}
 
 	err := s.sr.nextMetricsConsumer.ConsumeMetrics(ctx, md)
 	return &common.Commands{}, err
@@ -76,10 +76,6 @@ func SkywalkingToTraces(ctx context.Context, segment *agentV3.SegmentObject, md
 	// for _, span := range swSpans {
 	//	swTagsToInternalResource(span, rs)
 	//}
-	value := ctx.Value(Tenant)
-	if value != nil {
-		rs.Attributes().PutStr(Tenant, value.(string))
-	}
 	rs.Attributes().PutStr(conventions.AttributeServiceName, segment.GetService())
 	rs.Attributes().PutStr(conventions.AttributeServiceInstanceID, segment.GetServiceInstance())
 	rs.Attributes().PutStr(AttributeSkywalkingTraceID, segment.GetTraceId())
@@ -15,6 +15,7 @@
 package holoinsightskywalkingreceiver
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"testing"
@@ -114,7 +115,7 @@ func TestSwProtoToTraces(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			td := SkywalkingToTraces(test.swSpan, "dev")
+			td := SkywalkingToTraces(context.Background(), test.swSpan, nil)
 			assert.Equal(t, 1, td.ResourceSpans().Len())
 			assert.Equal(t, 2, td.ResourceSpans().At(0).ScopeSpans().At(0).Spans().Len())
 		})
@@ -141,7 +142,7 @@ func TestSwReferencesToSpanLinks(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			//swReferencesToSpanLinks(test.swSpan.GetSpans()[0].Refs, test.dest.Links())
+			swReferencesToSpanLinks(test.swSpan.GetSpans()[0].Refs, test.dest)
 			assert.Equal(t, 1, test.dest.Links().Len())
 		})
 	}
@@ -262,12 +263,12 @@ func Test_segmentIdToSpanId(t *testing.T) {
 		{
 			name: "mock-sw-span-id-normal",
 			args: args{segmentID: "4f2f27748b8e44ecaf18fe0347194e86.33.16560607369950066", spanID: 123},
-			want: [8]byte{233, 196, 85, 168, 37, 66, 48, 106},
+			want: [8]byte{110, 143, 169, 3, 222, 51, 154, 245},
 		},
 		{
 			name: "mock-sw-span-id-python-agent",
 			args: args{segmentID: "4f2f27748b8e44ecaf18fe0347194e86", spanID: 123},
-			want: [8]byte{155, 55, 217, 119, 204, 151, 10, 106},
+			want: [8]byte{201, 130, 129, 83, 219, 190, 251, 222},
 		},
 		{
 			name: "mock-sw-span-id-short",
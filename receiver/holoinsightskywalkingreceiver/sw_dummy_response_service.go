@@ -19,8 +19,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
 	"github.com/traas-stack/holoinsight-collector/internal/utils"
 	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.uber.org/zap"
 	v3c "skywalking.apache.org/repo/goapi/collect/agent/configuration/v3"
 	common "skywalking.apache.org/repo/goapi/collect/common/v3"
@@ -49,6 +51,8 @@ type dummyReportService struct {
 	GatewayHTTPPort     int
 	GatewayHTTPSettings confighttp.HTTPServerSettings
 	logger              *zap.Logger
+	tenants             *tenantresolver.Gate
+	grpcListener        string
 }
 
 type AgentConfiguration struct {
@@ -84,12 +88,11 @@ func (d *dummyReportService) FetchConfigurations(ctx context.Context, req *v3c.C
 	if d.GatewayHTTPSettings.Endpoint == "" {
 		d.logger.Error("[fetchConfigurations] Holoinsight server http endpoint not set! ")
 	}
-	tenantValue := ctx.Value(Tenant)
-	if tenantValue == nil {
+	tenant := d.tenants.Tenant(ctx, tenantresolver.RequestOf(ctx, d.grpcListener), pcommon.NewMap())
+	if tenant == "" {
 		d.logger.Error("[fetchConfigurations] tenant cannot be empty!")
 		return &common.Commands{}, nil
 	}
-	tenant := tenantValue.(string)
 	service := req.GetService()
 
 	var extendInfo string
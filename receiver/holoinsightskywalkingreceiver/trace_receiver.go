@@ -21,11 +21,14 @@ import (
 	"fmt"
 	"go.opentelemetry.io/collector/receiver"
 	"io"
-	"net"
 	"net/http"
 	"sync"
 
 	"github.com/gorilla/mux"
+	"github.com/traas-stack/holoinsight-collector/internal/sharedgrpc"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/config/configgrpc"
 	"go.opentelemetry.io/collector/config/confighttp"
@@ -45,10 +48,12 @@ import (
 type configuration struct {
 	CollectorHTTPPort           int
 	CollectorHTTPSettings       confighttp.HTTPServerSettings
-	CollectorGRPCPort           int
-	CollectorGRPCServerSettings configgrpc.GRPCServerSettings
+	CollectorGRPCServerSettings *configgrpc.GRPCServerSettings
+	SharedGRPC                  bool
 	GatewayHTTPPort             int
 	GatewayHTTPSettings         confighttp.HTTPServerSettings
+	Limiter                     *component.ID
+	TenantResolver              *component.ID
 }
 
 // Receiver type is used to receive spans that were originally intended to be sent to Skywaking.
@@ -60,6 +65,7 @@ type swReceiver struct {
 	config *configuration
 
 	grpc            *grpc.Server
+	sharedGRPC      *sharedgrpc.Handle
 	collectorServer *http.Server
 
 	goroutines sync.WaitGroup
@@ -74,11 +80,15 @@ type swReceiver struct {
 	segmentReportService *traceSegmentReportService
 	metricsReportService *metricsReportService
 	dummyReportService   *dummyReportService
+	limits               tenantlimit.Gate
+	tenants              tenantresolver.Gate
 }
 
 const (
 	collectorHTTPTransport = "http"
 	grpcTransport          = "grpc"
+	protobufFormat         = "protobuf"
+	jsonFormat             = "json"
 	failing                = "failing"
 )
 
@@ -90,6 +100,16 @@ type tracesDataConsumer interface {
 	setNextTracesConsumer(nextracesConsumer consumer.Traces)
 }
 
+// builtinTenants is the tenant resolver of the receivers configured without tenant resolver: the tenant is the one
+// of the authenticator, the tenants sent by the clients are only trusted when a tenant resolver consults them.
+var builtinTenants = func() *tenantresolver.Chain {
+	chain, err := tenantresolver.NewChain("", []tenantresolver.SourceSettings{{Type: tenantresolver.SourceAuth}})
+	if err != nil {
+		panic(err)
+	}
+	return chain
+}()
+
 // newSkywalkingReceiver creates a TracesReceiver that receives traffic as a Skywalking collector
 func newSkywalkingReceiver(
 	config *configuration,
@@ -112,12 +132,20 @@ func newSkywalkingReceiver(
 		return nil, err
 	}
 
-	return &swReceiver{
+	sr := &swReceiver{
 		config:      config,
 		settings:    set,
 		grpcObsrecv: grpcObsrecv,
 		httpObsrecv: httpObsrecv,
-	}, nil
+	}
+	sr.tenants.SetFallback(builtinTenants)
+	if config.CollectorGRPCServerSettings != nil && config.SharedGRPC {
+		sr.sharedGRPC, err = sharedgrpc.Register(config.CollectorGRPCServerSettings, set.TelemetrySettings, sr.registerGRPCServices)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sr, nil
 }
 
 func (sr *swReceiver) setNextMetricsConsumer(nextMetricsConsumer consumer.Metrics) {
@@ -128,26 +156,32 @@ func (sr *swReceiver) setNextTracesConsumer(nextTracesConsumer consumer.Traces)
 	sr.nextTracesConsumer = nextTracesConsumer
 }
 
-func (sr *swReceiver) collectorGRPCAddr() string {
-	var port int
-	if sr.config != nil {
-		port = sr.config.CollectorGRPCPort
-	}
-	return fmt.Sprintf(":%d", port)
+func (sr *swReceiver) collectorGRPCEnabled() bool {
+	return sr.config != nil && sr.config.CollectorGRPCServerSettings != nil
 }
 
-func (sr *swReceiver) collectorGRPCEnabled() bool {
-	return sr.config != nil && sr.config.CollectorGRPCPort > 0
+// grpcListener is the endpoint of the collector gRPC server, empty when it isn't enabled.
+func (sr *swReceiver) grpcListener() string {
+	if !sr.collectorGRPCEnabled() {
+		return ""
+	}
+	return sr.config.CollectorGRPCServerSettings.NetAddr.Endpoint
 }
 
 func (sr *swReceiver) collectorHTTPEnabled() bool {
 	return sr.config != nil && sr.config.CollectorHTTPPort > 0
 }
 
-func (sr *swReceiver) Start(_ context.Context, host component.Host) error {
+func (sr *swReceiver) Start(ctx context.Context, host component.Host) error {
 	var err error
 	sr.startOnce.Do(func() {
-		err = sr.startCollector(host)
+		if err = sr.limits.Resolve(host, sr.config.Limiter); err != nil {
+			return
+		}
+		if err = sr.tenants.Resolve(host, sr.config.TenantResolver); err != nil {
+			return
+		}
+		err = sr.startCollector(ctx, host)
 	})
 	return err
 }
@@ -164,6 +198,9 @@ func (sr *swReceiver) Shutdown(ctx context.Context) error {
 		if sr.grpc != nil {
 			sr.grpc.GracefulStop()
 		}
+		if sr.sharedGRPC != nil {
+			errs = multierr.Append(errs, sr.sharedGRPC.Shutdown(ctx))
+		}
 
 		sr.goroutines.Wait()
 	})
@@ -171,7 +208,7 @@ func (sr *swReceiver) Shutdown(ctx context.Context) error {
 	return errs
 }
 
-func (sr *swReceiver) startCollector(host component.Host) error {
+func (sr *swReceiver) startCollector(ctx context.Context, host component.Host) error {
 	if !sr.collectorGRPCEnabled() && !sr.collectorHTTPEnabled() {
 		return nil
 	}
@@ -189,6 +226,8 @@ func (sr *swReceiver) startCollector(host component.Host) error {
 		if cerr != nil {
 			return cerr
 		}
+		sr.collectorServer.ConnContext = tenantauth.ConnContext
+		sr.collectorServer.Handler = tenantresolver.Handler(sr.config.CollectorHTTPSettings.Endpoint, sr.collectorServer.Handler)
 
 		sr.goroutines.Add(1)
 		go func() {
@@ -199,6 +238,10 @@ func (sr *swReceiver) startCollector(host component.Host) error {
 		}()
 	}
 
+	if sr.sharedGRPC != nil {
+		return sr.sharedGRPC.Start(ctx, host)
+	}
+
 	if sr.collectorGRPCEnabled() {
 		var err error
 		sr.grpc, err = sr.config.CollectorGRPCServerSettings.ToServer(host, sr.settings.TelemetrySettings)
@@ -206,37 +249,13 @@ func (sr *swReceiver) startCollector(host component.Host) error {
 			return fmt.Errorf("failed to build the options for the Skywalking gRPC Collector: %w", err)
 		}
 
-		gaddr := sr.collectorGRPCAddr()
-		gln, gerr := net.Listen("tcp", gaddr)
+		gln, gerr := sr.config.CollectorGRPCServerSettings.ToListener()
 		if gerr != nil {
-			return fmt.Errorf("failed to bind to gRPC address %q: %w", gaddr, gerr)
-		}
-
-		sr.segmentReportService = &traceSegmentReportService{sr: sr}
-		v3.RegisterTraceSegmentReportServiceServer(sr.grpc, sr.segmentReportService)
-
-		c := sr.config
-		sr.dummyReportService = &dummyReportService{
-			GatewayHTTPSettings: c.GatewayHTTPSettings,
-			GatewayHTTPPort:     c.GatewayHTTPPort,
-			logger:              sr.settings.Logger,
-		}
-
-		if sr.nextMetricsConsumer != nil {
-			sr.metricsReportService = &metricsReportService{sr: sr}
-			v3.RegisterJVMMetricReportServiceServer(sr.grpc, sr.metricsReportService)
-		} else {
-			v3.RegisterJVMMetricReportServiceServer(sr.grpc, sr.dummyReportService)
+			return fmt.Errorf("failed to bind to gRPC address %q: %w",
+				sr.config.CollectorGRPCServerSettings.NetAddr.Endpoint, gerr)
 		}
 
-		management.RegisterManagementServiceServer(sr.grpc, sr.dummyReportService)
-		cds.RegisterConfigurationDiscoveryServiceServer(sr.grpc, sr.dummyReportService)
-		event.RegisterEventServiceServer(sr.grpc, &eventService{})
-		profile.RegisterProfileTaskServer(sr.grpc, sr.dummyReportService)
-
-		v3.RegisterMeterReportServiceServer(sr.grpc, &meterService{})
-		v3.RegisterCLRMetricReportServiceServer(sr.grpc, &clrService{})
-		v3.RegisterBrowserPerfServiceServer(sr.grpc, sr.dummyReportService)
+		sr.registerGRPCServices(sr.grpc)
 
 		sr.goroutines.Add(1)
 		go func() {
@@ -250,6 +269,37 @@ func (sr *swReceiver) startCollector(host component.Host) error {
 	return nil
 }
 
+// registerGRPCServices registers the Skywalking collector services on server.
+func (sr *swReceiver) registerGRPCServices(server *grpc.Server) {
+	sr.segmentReportService = &traceSegmentReportService{sr: sr}
+	v3.RegisterTraceSegmentReportServiceServer(server, sr.segmentReportService)
+
+	c := sr.config
+	sr.dummyReportService = &dummyReportService{
+		GatewayHTTPSettings: c.GatewayHTTPSettings,
+		GatewayHTTPPort:     c.GatewayHTTPPort,
+		logger:              sr.settings.Logger,
+		tenants:             &sr.tenants,
+		grpcListener:        sr.grpcListener(),
+	}
+
+	if sr.nextMetricsConsumer != nil {
+		sr.metricsReportService = &metricsReportService{sr: sr}
+		v3.RegisterJVMMetricReportServiceServer(server, sr.metricsReportService)
+	} else {
+		v3.RegisterJVMMetricReportServiceServer(server, sr.dummyReportService)
+	}
+
+	management.RegisterManagementServiceServer(server, sr.dummyReportService)
+	cds.RegisterConfigurationDiscoveryServiceServer(server, sr.dummyReportService)
+	event.RegisterEventServiceServer(server, &eventService{})
+	profile.RegisterProfileTaskServer(server, sr.dummyReportService)
+
+	v3.RegisterMeterReportServiceServer(server, &meterService{})
+	v3.RegisterCLRMetricReportServiceServer(server, &clrService{})
+	v3.RegisterBrowserPerfServiceServer(server, sr.dummyReportService)
+}
+
 type Response struct {
 	Status string `json:"status"`
 	Msg    string `json:"msg"`
@@ -257,6 +307,11 @@ type Response struct {
 
 func (sr *swReceiver) httpHandler(rsp http.ResponseWriter, r *http.Request) {
 	rsp.Header().Set("Content-Type", "application/json")
+	if !tenantauth.SignalAllowed(r.Context(), tenantauth.SignalTraces) {
+		response := &Response{Status: failing, Msg: "traces are not enabled for the tenant"}
+		ResponseWithJSON(rsp, response, http.StatusForbidden)
+		return
+	}
 	b, err := io.ReadAll(r.Body)
 	if err != nil {
 		response := &Response{Status: failing, Msg: err.Error()}
@@ -267,15 +322,30 @@ func (sr *swReceiver) httpHandler(rsp http.ResponseWriter, r *http.Request) {
 	if err = json.Unmarshal(b, &data); err != nil {
 		fmt.Printf("cannot Unmarshal skywalking segment collection, %v", err)
 	}
+	traces, tenants := sr.segmentsToTraces(r.Context(), tenantresolver.RequestOf(r.Context(), ""), data)
+	if err = sr.limits.AdmitTenants(r.Context(), tenantauth.SignalTraces, tenants, len(b)); err != nil {
+		if retryAfter, throttled := tenantlimit.RetryAfter(err); throttled {
+			tenantlimit.SetRetryAfter(rsp.Header(), retryAfter)
+		}
+		refuse(r.Context(), sr.httpObsrecv, jsonFormat, spanCount(data), err)
+		ResponseWithJSON(rsp, &Response{Status: failing, Msg: err.Error()}, http.StatusTooManyRequests)
+		return
+	}
 
-	for _, segment := range data {
-		err = consumeTraces(r.Context(), segment, sr.nextTracesConsumer)
+	for _, td := range traces {
+		err = sr.nextTracesConsumer.ConsumeTraces(r.Context(), td)
 		if err != nil {
 			fmt.Printf("cannot consume traces, %v", err)
 		}
 	}
 }
 
+// refuse records the spans refused before reaching the pipeline, e.g. throttled, in the receiver metrics.
+func refuse(ctx context.Context, obsrecv *obsreport.Receiver, format string, spans int, err error) {
+	obsCtx := obsrecv.StartTracesOp(ctx)
+	obsrecv.EndTracesOp(obsCtx, format, spans, err)
+}
+
 func ResponseWithJSON(rsp http.ResponseWriter, response *Response, code int) {
 	rsp.WriteHeader(code)
 	_ = json.NewEncoder(rsp).Encode(response)
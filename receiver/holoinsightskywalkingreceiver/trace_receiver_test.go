@@ -15,10 +15,13 @@
 package holoinsightskywalkingreceiver
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/receiver/receivertest"
+	"net/http"
 	"strconv"
 	"testing"
 	"time"
@@ -26,11 +29,17 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config/configgrpc"
 	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/config/confignet"
+	"go.opentelemetry.io/collector/consumer/consumertest"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	common "skywalking.apache.org/repo/goapi/collect/common/v3"
 	agent "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
 )
 
 var (
@@ -65,19 +74,25 @@ func TestStartAndShutdown(t *testing.T) {
 
 func TestGRPCReception(t *testing.T) {
 	config := &configuration{
-		CollectorGRPCPort: 11800, // that's the only one used by this test
+		CollectorGRPCServerSettings: &configgrpc.GRPCServerSettings{
+			NetAddr: confignet.NetAddr{
+				Endpoint:  "localhost:11800", // that's the only one used by this test
+				Transport: "tcp",
+			},
+		},
 	}
 
 	set := receivertest.NewNopCreateSettings()
 	set.ID = skywalkingReceiver
 	swReceiver, err := newSkywalkingReceiver(config, set)
 	require.NoError(t, err)
+	swReceiver.setNextTracesConsumer(consumertest.NewNop())
 
 	require.NoError(t, swReceiver.Start(context.Background(), componenttest.NewNopHost()))
 
 	t.Cleanup(func() { require.NoError(t, swReceiver.Shutdown(context.Background())) })
 
-	conn, err := grpc.Dial(fmt.Sprintf("0.0.0.0:%d", config.CollectorGRPCPort), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(config.CollectorGRPCServerSettings.NetAddr.Endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	require.NoError(t, err)
 	defer conn.Close()
 
@@ -182,3 +197,104 @@ func mockGrpcTraceSegment(sequence int) *agent.SegmentObject {
 		},
 	}
 }
+
+// chainResolver is a tenant resolver extension.
+type chainResolver struct {
+	component.StartFunc
+	component.ShutdownFunc
+	*tenantresolver.Chain
+}
+
+type resolverHost struct {
+	component.Host
+	extensions map[component.ID]component.Component
+}
+
+func (h *resolverHost) GetExtensions() map[component.ID]component.Component {
+	return h.extensions
+}
+
+func TestTenantResolution(t *testing.T) {
+	chain, err := tenantresolver.NewChain("", []tenantresolver.SourceSettings{
+		{Type: tenantresolver.SourceMetadata},
+		{Type: tenantresolver.SourceStatic, Listeners: map[string]string{"localhost:12802": "http-tenant"}},
+	})
+	require.NoError(t, err)
+	resolverID := component.NewID("test_resolver")
+	host := &resolverHost{
+		Host:       componenttest.NewNopHost(),
+		extensions: map[component.ID]component.Component{resolverID: chainResolver{Chain: chain}},
+	}
+
+	config := &configuration{
+		CollectorGRPCServerSettings: &configgrpc.GRPCServerSettings{
+			NetAddr: confignet.NetAddr{Endpoint: "localhost:11802", Transport: "tcp"},
+		},
+		CollectorHTTPPort:     12802,
+		CollectorHTTPSettings: confighttp.HTTPServerSettings{Endpoint: "localhost:12802"},
+		TenantResolver:        &resolverID,
+	}
+	set := receivertest.NewNopCreateSettings()
+	set.ID = skywalkingReceiver
+	sr, err := newSkywalkingReceiver(config, set)
+	require.NoError(t, err)
+	sink := new(consumertest.TracesSink)
+	sr.setNextTracesConsumer(sink)
+	require.NoError(t, sr.Start(context.Background(), host))
+	t.Cleanup(func() { require.NoError(t, sr.Shutdown(context.Background())) })
+
+	conn, err := grpc.Dial(config.CollectorGRPCServerSettings.NetAddr.Endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "tenant", "grpc-tenant")
+	_, err = agent.NewTraceSegmentReportServiceClient(conn).CollectInSync(ctx, &agent.SegmentCollection{
+		Segments: []*agent.SegmentObject{mockGrpcTraceSegment(1)},
+	})
+	require.NoError(t, err)
+
+	body, err := json.Marshal([]*agent.SegmentObject{mockGrpcTraceSegment(2)})
+	require.NoError(t, err)
+	resp, err := http.Post("http://localhost:12802/v3/segments", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	received := sink.AllTraces()
+	require.Len(t, received, 2)
+	for i, want := range []string{"grpc-tenant", "http-tenant"} {
+		tenant, ok := received[i].ResourceSpans().At(0).Resource().Attributes().Get("tenant")
+		require.True(t, ok)
+		assert.Equal(t, want, tenant.Str())
+	}
+}
+
+func TestTenantWithoutResolver(t *testing.T) {
+	config := &configuration{
+		CollectorGRPCServerSettings: &configgrpc.GRPCServerSettings{
+			NetAddr: confignet.NetAddr{Endpoint: "localhost:11803", Transport: "tcp"},
+		},
+	}
+	set := receivertest.NewNopCreateSettings()
+	set.ID = skywalkingReceiver
+	sr, err := newSkywalkingReceiver(config, set)
+	require.NoError(t, err)
+	sink := new(consumertest.TracesSink)
+	sr.setNextTracesConsumer(sink)
+	require.NoError(t, sr.Start(context.Background(), componenttest.NewNopHost()))
+	t.Cleanup(func() { require.NoError(t, sr.Shutdown(context.Background())) })
+
+	conn, err := grpc.Dial(config.CollectorGRPCServerSettings.NetAddr.Endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	// the tenant claimed by an unauthenticated agent isn't trusted
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "tenant", "claimed-tenant")
+	_, err = agent.NewTraceSegmentReportServiceClient(conn).CollectInSync(ctx, &agent.SegmentCollection{
+		Segments: []*agent.SegmentObject{mockGrpcTraceSegment(1)},
+	})
+	require.NoError(t, err)
+
+	received := sink.AllTraces()
+	require.Len(t, received, 1)
+	tenant, _ := received[0].ResourceSpans().At(0).Resource().Attributes().Get("tenant")
+	assert.Equal(t, "", tenant.Str())
+}
@@ -20,19 +20,30 @@ import (
 	"fmt"
 	"io"
 
-	"go.opentelemetry.io/collector/consumer"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantauth"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantlimit"
+	"github.com/traas-stack/holoinsight-collector/internal/tenantresolver"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	common "skywalking.apache.org/repo/goapi/collect/common/v3"
 	agent "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
 )
 
+var errTracesNotAllowed = status.Error(codes.PermissionDenied, "traces are not enabled for the tenant")
+
 type traceSegmentReportService struct {
 	sr *swReceiver
 	agent.UnimplementedTraceSegmentReportServiceServer
 }
 
 func (s *traceSegmentReportService) Collect(stream agent.TraceSegmentReportService_CollectServer) error {
+	if !tenantauth.SignalAllowed(stream.Context(), tenantauth.SignalTraces) {
+		return errTracesNotAllowed
+	}
+	received := tenantresolver.RequestOf(stream.Context(), s.sr.grpcListener())
 	for {
 		segmentObject, err := stream.Recv()
 		if err != nil {
@@ -41,8 +52,16 @@ func (s *traceSegmentReportService) Collect(stream agent.TraceSegmentReportServi
 			}
 			return err
 		}
+		if segmentObject == nil {
+			continue
+		}
+		td, tenant := s.sr.toTraces(stream.Context(), received, segmentObject)
+		if err = s.sr.limits.Admit(stream.Context(), tenant, tenantauth.SignalTraces, len(segmentObject.GetSpans()), proto.Size(segmentObject)); err != nil {
+			refuse(stream.Context(), s.sr.grpcObsrecv, protobufFormat, len(segmentObject.GetSpans()), err)
+			return tenantlimit.GRPCError(err)
+		}
 
-		err = consumeTraces(stream.Context(), segmentObject, s.sr.nextTracesConsumer)
+		err = s.sr.nextTracesConsumer.ConsumeTraces(stream.Context(), td)
 		if err != nil {
 			return stream.SendAndClose(&common.Commands{})
 		}
@@ -50,29 +69,64 @@ func (s *traceSegmentReportService) Collect(stream agent.TraceSegmentReportServi
 }
 
 func (s *traceSegmentReportService) CollectInSync(ctx context.Context, segments *agent.SegmentCollection) (*common.Commands, error) {
+	if !tenantauth.SignalAllowed(ctx, tenantauth.SignalTraces) {
+		return nil, errTracesNotAllowed
+	}
 	for _, segment := range segments.Segments {
 		marshaledSegment, err := proto.Marshal(segment)
 		if err != nil {
 			fmt.Printf("cannot marshal segemnt from sync, %v", err)
 		}
-		err = consumeTraces(ctx, segment, s.sr.nextTracesConsumer)
-		if err != nil {
+		fmt.Printf("receivec data:%s", marshaledSegment)
+	}
+	traces, tenants := s.sr.segmentsToTraces(ctx, tenantresolver.RequestOf(ctx, s.sr.grpcListener()), segments.Segments)
+	if err := s.sr.limits.AdmitTenants(ctx, tenantauth.SignalTraces, tenants, proto.Size(segments)); err != nil {
+		refuse(ctx, s.sr.grpcObsrecv, protobufFormat, spanCount(segments.Segments), err)
+		return nil, tenantlimit.GRPCError(err)
+	}
+	for _, td := range traces {
+		if err := s.sr.nextTracesConsumer.ConsumeTraces(ctx, td); err != nil {
 			fmt.Printf("cannot consume traces, %v", err)
 		}
-		fmt.Printf("receivec data:%s", marshaledSegment)
 	}
 	return &common.Commands{}, nil
 }
 
-func consumeTraces(ctx context.Context, segment *agent.SegmentObject, consumer consumer.Traces) error {
-	if segment == nil {
-		return nil
+func spanCount(segments []*agent.SegmentObject) int {
+	count := 0
+	for _, segment := range segments {
+		count += len(segment.GetSpans())
 	}
+	return count
+}
+
+// toTraces converts the segment, received as described by received, and stamps its tenant, which it returns.
+func (sr *swReceiver) toTraces(ctx context.Context, received tenantresolver.Request, segment *agent.SegmentObject) (ptrace.Traces, string) {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
 		fmt.Printf("Grpc from metadata error!")
 	}
 
 	ptd := SkywalkingToTraces(ctx, segment, md)
-	return consumer.ConsumeTraces(ctx, ptd)
+	var tenant string
+	rs := ptd.ResourceSpans()
+	for i := 0; i < rs.Len(); i++ {
+		tenant = sr.tenants.Stamp(ctx, received, rs.At(i).Resource().Attributes())
+	}
+	return ptd, tenant
+}
+
+// segmentsToTraces converts the segments of a request with toTraces, counting their spans per tenant.
+func (sr *swReceiver) segmentsToTraces(ctx context.Context, received tenantresolver.Request, segments []*agent.SegmentObject) ([]ptrace.Traces, *tenantlimit.Tenants) {
+	tenants := &tenantlimit.Tenants{}
+	traces := make([]ptrace.Traces, 0, len(segments))
+	for _, segment := range segments {
+		if segment == nil {
+			continue
+		}
+		td, tenant := sr.toTraces(ctx, received, segment)
+		tenants.Add(tenant, len(segment.GetSpans()))
+		traces = append(traces, td)
+	}
+	return traces, tenants
 }